@@ -23,6 +23,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -173,10 +174,13 @@ The export-preimages command export hash preimages to an RLP encoded stream`,
 			utils.IncludeIncompletesFlag,
 			utils.StartKeyFlag,
 			utils.DumpLimitFlag,
+			utils.DumpKindFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 This command dumps out the state for a given block (or latest, if none provided).
+With --kind only the accounts of the given kinds are dumped: validator, staker,
+nft or system, the latter holding the validator, staker and mint pools.
 `,
 	}
 )
@@ -437,9 +441,12 @@ func parseDumpConfig(ctx *cli.Context, stack *node.Node) (*state.DumpConfig, eth
 		Start:             start.Bytes(),
 		Max:               ctx.Uint64(utils.DumpLimitFlag.Name),
 	}
+	if kinds := ctx.String(utils.DumpKindFlag.Name); kinds != "" {
+		conf.Kinds = strings.Split(kinds, ",")
+	}
 	log.Info("State dump configured", "block", header.Number, "hash", header.Hash().Hex(),
 		"skipcode", conf.SkipCode, "skipstorage", conf.SkipStorage,
-		"start", hexutil.Encode(conf.Start), "limit", conf.Max)
+		"start", hexutil.Encode(conf.Start), "limit", conf.Max, "kinds", conf.Kinds)
 	return conf, db, header.Root, nil
 }
 
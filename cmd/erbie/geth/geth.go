@@ -90,6 +90,7 @@ var (
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
+		utils.SnapshotVerifyFlag,
 		utils.TxLookupLimitFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
@@ -102,6 +103,7 @@ var (
 		utils.UltraLightOnlyAnnounceFlag,
 		utils.LightNoSyncServeFlag,
 		utils.WhitelistFlag,
+		utils.StrictDeterminismFlag,
 		utils.BloomFilterSizeFlag,
 		utils.CacheFlag,
 		utils.CacheDatabaseFlag,
@@ -125,6 +127,15 @@ var (
 		utils.MinerExtraDataFlag,
 		utils.MinerRecommitIntervalFlag,
 		utils.MinerNoVerfiyFlag,
+		utils.AllowedFutureBlockTimeFlag,
+		utils.MinerEmptyLogVerboseFlag,
+		utils.MinerEmptyMinOnlineFlag,
+		utils.MinerEmptyValidatorWaitFlag,
+		utils.MinerEmptyNonValidatorWaitFlag,
+		utils.MinerEmptyGossipIntervalFlag,
+		utils.MinerEmptyGossipMaxIntervalFlag,
+		utils.MinerEmptyMaxTxsFlag,
+		utils.MinerEmptyMaxGasFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
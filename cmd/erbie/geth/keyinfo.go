@@ -0,0 +1,92 @@
+package geth
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// KeyInfo prints the address and fingerprint of a validator key. args holds a
+// hex private key or a keystore file, optionally followed by the url of a node
+// to look the address up in its validator pool.
+func KeyInfo(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		utils.Fatalf("Usage: keyinfo <private key | keystore file> [node url]")
+	}
+	privateKey, err := loadKey(args[0])
+	if err != nil {
+		utils.Fatalf("Failed to load key: %v", err)
+		return err
+	}
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	fmt.Println("address     : ", address.String())
+	fmt.Println("fingerprint : ", KeyFingerprint(&privateKey.PublicKey))
+
+	if len(args) == 2 {
+		client, err := rpc.Dial(args[1])
+		if err != nil {
+			utils.Fatalf("Failed to connect to %s: %v", args[1], err)
+			return err
+		}
+		defer client.Close()
+
+		var validators types.ValidatorList
+		if err := client.Call(&validators, "erb_getValidator", "latest"); err != nil {
+			utils.Fatalf("Failed to query validator pool: %v", err)
+			return err
+		}
+		fmt.Println("validator   : ", validatorRole(&validators, address))
+	}
+	return nil
+}
+
+// KeyFingerprint returns a short identifier of a public key, the first four
+// bytes of the hash of its uncompressed encoding.
+func KeyFingerprint(pub *ecdsa.PublicKey) string {
+	return hexutil.Encode(crypto.Keccak256(crypto.FromECDSAPub(pub))[:4])
+}
+
+// loadKey reads a private key given either as hex or as a keystore file, in
+// which case the password is asked for.
+func loadKey(arg string) (*ecdsa.PrivateKey, error) {
+	if _, err := os.Stat(arg); err != nil {
+		return crypto.HexToECDSA(strings.TrimPrefix(arg, "0x"))
+	}
+	keyjson, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	password := utils.GetPassPhrase("Please enter the password of the keystore file.", false)
+	key, err := keystore.DecryptKey(keyjson, password)
+	if err != nil {
+		return nil, err
+	}
+	if key.PrivateKey == nil {
+		return nil, errors.New("keystore file holds no private key")
+	}
+	return key.PrivateKey, nil
+}
+
+// validatorRole describes how address appears in the validator pool.
+func validatorRole(validators *types.ValidatorList, address common.Address) string {
+	for _, v := range validators.Validators {
+		if v.Addr == address {
+			return "yes"
+		}
+		if v.Proxy == address {
+			return "yes, as proxy of " + v.Addr.String()
+		}
+	}
+	return "no"
+}
@@ -0,0 +1,38 @@
+package geth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestKeyInfo(t *testing.T) {
+	key, err := loadKey("0x" + "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatalf("failed to load hex key: %v", err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	if want := common.HexToAddress("0x71562b71999873DB5b286dF957af199Ec94617F7"); address != want {
+		t.Errorf("address mismatch: have %x, want %x", address, want)
+	}
+	if fp := KeyFingerprint(&key.PublicKey); len(fp) != 10 {
+		t.Errorf("fingerprint length mismatch: have %s", fp)
+	}
+
+	validators := types.NewValidatorList(nil)
+	validators.AddValidator(address, big.NewInt(1), common.Address{})
+	proxy := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	validators.AddValidator(common.HexToAddress("0x2"), big.NewInt(1), proxy)
+	if role := validatorRole(validators, address); role != "yes" {
+		t.Errorf("validator role mismatch: have %q", role)
+	}
+	if role := validatorRole(validators, proxy); role == "yes" || role == "no" {
+		t.Errorf("proxy role mismatch: have %q", role)
+	}
+	if role := validatorRole(validators, common.HexToAddress("0x3")); role != "no" {
+		t.Errorf("unknown role mismatch: have %q", role)
+	}
+}
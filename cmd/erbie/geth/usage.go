@@ -56,6 +56,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
+			utils.StrictDeterminismFlag,
 		},
 	},
 	{
@@ -189,6 +190,15 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.MinerExtraDataFlag,
 			utils.MinerRecommitIntervalFlag,
 			utils.MinerNoVerfiyFlag,
+			utils.AllowedFutureBlockTimeFlag,
+			utils.MinerEmptyLogVerboseFlag,
+			utils.MinerEmptyMinOnlineFlag,
+			utils.MinerEmptyValidatorWaitFlag,
+			utils.MinerEmptyNonValidatorWaitFlag,
+			utils.MinerEmptyGossipIntervalFlag,
+			utils.MinerEmptyGossipMaxIntervalFlag,
+			utils.MinerEmptyMaxTxsFlag,
+			utils.MinerEmptyMaxGasFlag,
 		},
 	},
 	{
@@ -234,6 +244,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Name: "MISC",
 		Flags: []cli.Flag{
 			utils.SnapshotFlag,
+			utils.SnapshotVerifyFlag,
 			utils.BloomFilterSizeFlag,
 			cli.HelpFlag,
 			utils.CatalystFlag,
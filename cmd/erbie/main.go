@@ -15,6 +15,11 @@ func main() {
 		return
 	}
 
+	if len(os.Args) >= 2 && os.Args[1] == "keyinfo" {
+		geth.KeyInfo(os.Args[2:])
+		return
+	}
+
 	// change "--mainnet" to "--publicnet"
 	changeArgs()
 
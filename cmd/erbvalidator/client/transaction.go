@@ -339,18 +339,11 @@ func (worm *Wormholes) RecoverCoefficient() (string, error) {
 		return "", err
 	}
 
-	transaction := types2.Transaction{
-		Type:    types2.RecoverCoefficient,
-		Version: types2.WormHolesVersion,
-	}
-
-	data, err := json.Marshal(transaction)
+	tx_data, err := RecoverCoefficientData()
 	if err != nil {
 		log.Println("Transfer() failed to format wormholes data")
 		return "", err
 	}
-
-	tx_data := append([]byte(TranPrefix), data...)
 	fmt.Println(string(tx_data))
 
 	tx := types.NewTransaction(nonce, account, big.NewInt(0), gasLimit, gasPrice, tx_data)
@@ -374,6 +367,37 @@ func (worm *Wormholes) RecoverCoefficient() (string, error) {
 	return strings.ToLower(signedTx.Hash().String()), nil
 }
 
+// RecoverCoefficientData returns the transaction data of a type 5 wormholes
+// transaction, which restores the sender's validator coefficient.
+func RecoverCoefficientData() ([]byte, error) {
+	transaction := types2.Transaction{
+		Type:    types2.RecoverCoefficient,
+		Version: types2.WormHolesVersion,
+	}
+
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(TranPrefix), data...), nil
+}
+
+// CheckRecoverCoefficient simulates a coefficient recovery of the client's
+// account on the pending state, returning the reason the node would reject it.
+func (worm *Wormholes) CheckRecoverCoefficient() error {
+	ctx := context.Background()
+	account, _, err := tools.PriKeyToAddress(worm.priKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := RecoverCoefficientData()
+	if err != nil {
+		return err
+	}
+	return worm.Call(ctx, account, account, 50000, data)
+}
+
 func (worm *Wormholes) GetAccount() common.Address {
 	fmt.Println(worm.priKey)
 	account, _, err := tools.PriKeyToAddress(worm.priKey)
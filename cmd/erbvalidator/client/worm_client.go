@@ -245,6 +245,21 @@ func (worm *Wormholes) SendTransaction(ctx context.Context, tx *types.Transactio
 	return worm.c.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Encode(data))
 }
 
+type callArgs struct {
+	From common.Address `json:"from"`
+	To   common.Address `json:"to"`
+	Gas  hexutil.Uint64 `json:"gas"`
+	Data hexutil.Bytes  `json:"data"`
+}
+
+// Call executes a message call on the pending state without creating a
+// transaction, returning the error the execution would fail with.
+func (worm *Wormholes) Call(ctx context.Context, from, to common.Address, gas uint64, data []byte) error {
+	args := callArgs{From: from, To: to, Gas: hexutil.Uint64(gas), Data: data}
+	var result hexutil.Bytes
+	return worm.c.CallContext(ctx, &result, "eth_call", args, "pending")
+}
+
 // NetworkID returns the network ID (also known as the chain ID) for this chain.
 func (worm *Wormholes) NetworkID(ctx context.Context) (*big.Int, error) {
 	version := new(big.Int)
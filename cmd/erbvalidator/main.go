@@ -9,15 +9,15 @@ import (
 )
 
 func main() {
-	cmd := flag.Int("cmd", 0, "1: to be a validator.\n2: do not to be a validator.\n3: displays the corresponding address based on the private key")
+	cmd := flag.Int("cmd", 0, "1: to be a validator.\n2: do not to be a validator.\n3: displays the corresponding address based on the private key\n6: recover the coefficient of a validator")
 	nodeUrl := flag.String("nodeurl", "http://127.0.0.1:8545", "external service url of the erbie node.")
 	validatorKey := flag.String("prikey", "", "private key of account to be a validator.")
 	proxyKey := flag.String("proxykey", "", "private key of proxy account.")
 	value := flag.Int64("value", 350, "pledge amount of validator.")
 
 	flag.Parse()
-	if *cmd != 1 && *cmd != 2 && *cmd != 3 {
-		fmt.Println("cmd must be a value of 1,2, 3")
+	if *cmd != 1 && *cmd != 2 && *cmd != 3 && *cmd != 6 {
+		fmt.Println("cmd must be a value of 1,2, 3, 6")
 		os.Exit(1)
 	}
 
@@ -54,9 +54,11 @@ func ExecCmd(cmd int, url string, validatorKey string, proxyKey string, value in
 			fmt.Println("proxy address ", proxy)
 		}
 
+	} else if cmd == 6 {
+		hash, err = RecoverCoefficient(url, validatorKey)
 	} else {
-		fmt.Println("cmd must be a value of 1,2, 3")
-		return "", errors.New("cmd must be a value of 1,2, 3")
+		fmt.Println("cmd must be a value of 1,2, 3, 6")
+		return "", errors.New("cmd must be a value of 1,2, 3, 6")
 	}
 	return hash, err
 }
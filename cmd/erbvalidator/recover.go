@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/cmd/erbvalidator/client"
+	"strings"
+)
+
+func RecoverCoefficient(url string, validatorKey string) (string, error) {
+	if strings.HasPrefix(validatorKey, "0x") ||
+		strings.HasPrefix(validatorKey, "0X") {
+		validatorKey = validatorKey[2:]
+	}
+	if len(validatorKey) != 64 {
+		return "", errors.New("private key format error")
+	}
+
+	worm := client.NewClient(validatorKey, url)
+
+	// Simulate the recovery first so a premature attempt is reported
+	// before any gas is spent on it.
+	if err := worm.CheckRecoverCoefficient(); err != nil {
+		err = fmt.Errorf("coefficient of %v can not be recovered now: %v", GetAccount(validatorKey), err)
+		fmt.Println("RecoverCoefficient error : ", err)
+		return "", err
+	}
+
+	hash, err := worm.RecoverCoefficient()
+	if err != nil {
+		fmt.Println("RecoverCoefficient error : ", err)
+	}
+	return hash, err
+}
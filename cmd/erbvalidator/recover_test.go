@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakeEth serves the eth methods the validator tool relies on, failing every
+// simulated call with callErr and recording what was sent.
+type fakeEth struct {
+	callErr error
+	calls   []hexutil.Bytes
+	sent    []*types.Transaction
+}
+
+func (f *fakeEth) Call(args map[string]interface{}, block string) (hexutil.Bytes, error) {
+	data, _ := args["data"].(string)
+	f.calls = append(f.calls, common.FromHex(data))
+	return nil, f.callErr
+}
+
+func (f *fakeEth) GetTransactionCount(addr common.Address, block string) hexutil.Uint64 {
+	return 0
+}
+
+func (f *fakeEth) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(common.Big1)
+}
+
+func (f *fakeEth) SendRawTransaction(data hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return common.Hash{}, err
+	}
+	f.sent = append(f.sent, tx)
+	return tx.Hash(), nil
+}
+
+type fakeNet struct{}
+
+func (fakeNet) Version() string { return "51888" }
+
+func newFakeNode(t *testing.T, eth *fakeEth) string {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("net", fakeNet{}); err != nil {
+		t.Fatal(err)
+	}
+	http := httptest.NewServer(server)
+	t.Cleanup(func() {
+		http.Close()
+		server.Stop()
+	})
+	return http.URL
+}
+
+func TestRecoverCoefficient(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	eth := new(fakeEth)
+	url := newFakeNode(t, eth)
+
+	hash, err := ExecCmd(6, url, hexutil.Encode(crypto.FromECDSA(key)), "", 0)
+	if err != nil {
+		t.Fatalf("recover coefficient: %v", err)
+	}
+	want := `erbie:{"type":5,"version":"v0.0.1"}`
+	if len(eth.calls) != 1 || string(eth.calls[0]) != want {
+		t.Fatalf("simulated data: have %q, want [%q]", eth.calls, want)
+	}
+	if len(eth.sent) != 1 {
+		t.Fatalf("sent transactions: have %d, want 1", len(eth.sent))
+	}
+	tx := eth.sent[0]
+	if string(tx.Data()) != want {
+		t.Errorf("transaction data: have %q, want %q", tx.Data(), want)
+	}
+	if tx.To() == nil || *tx.To() != validator {
+		t.Errorf("recipient: have %v, want %v", tx.To(), validator)
+	}
+	if tx.Value().Sign() != 0 {
+		t.Errorf("value: have %v, want 0", tx.Value())
+	}
+	if hash != strings.ToLower(tx.Hash().Hex()) {
+		t.Errorf("hash: have %s, want %s", hash, tx.Hash().Hex())
+	}
+}
+
+func TestRecoverCoefficientRejected(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	eth := &fakeEth{callErr: errors.New("not a validator")}
+	url := newFakeNode(t, eth)
+
+	_, err := ExecCmd(6, url, hexutil.Encode(crypto.FromECDSA(key)), "", 0)
+	if err == nil || !strings.Contains(err.Error(), "can not be recovered now") || !strings.Contains(err.Error(), "not a validator") {
+		t.Fatalf("error: have %v, want rejection reporting the node error", err)
+	}
+	if len(eth.sent) != 0 {
+		t.Fatalf("sent %d transactions after a rejected simulation", len(eth.sent))
+	}
+}
@@ -42,6 +42,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
@@ -214,6 +215,10 @@ var (
 		Usage: "Max number of elements (0 = no limit)",
 		Value: 0,
 	}
+	DumpKindFlag = cli.StringFlag{
+		Name:  "kind",
+		Usage: "Comma separated account kinds to dump (validator, staker, nft, system), all accounts if empty",
+	}
 	defaultSyncMode = ethconfig.Defaults.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
@@ -229,6 +234,10 @@ var (
 		Name:  "snapshot",
 		Usage: `Enables snapshot-database mode (default = enable)`,
 	}
+	SnapshotVerifyFlag = cli.BoolFlag{
+		Name:  "snapshot.verify",
+		Usage: "Cross-check a sample of committed accounts between the snapshot and the state trie (debug)",
+	}
 	TxLookupLimitFlag = cli.Uint64Flag{
 		Name:  "txlookuplimit",
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
@@ -242,6 +251,10 @@ var (
 		Name:  "whitelist",
 		Usage: "Comma separated block number-to-hash mappings to enforce (<number>=<hash>)",
 	}
+	StrictDeterminismFlag = cli.BoolFlag{
+		Name:  "strictdeterminism",
+		Usage: "Refuse to start unless the reward math passes the determinism self-test, which fails while any of it uses floating point arithmetic",
+	}
 	BloomFilterSizeFlag = cli.Uint64Flag{
 		Name:  "bloomfilter.size",
 		Usage: "Megabytes of memory allocated to bloom-filter for pruning",
@@ -472,10 +485,51 @@ var (
 		Usage: "Time interval to recreate the block being mined",
 		Value: ethconfig.Defaults.Miner.Recommit,
 	}
+	AllowedFutureBlockTimeFlag = cli.IntFlag{
+		Name:  "allowedfutureblocktime",
+		Usage: "Max time (in seconds) from current time allowed for blocks, before they're considered future blocks (default: network setting, 1 on mainnet where it used to be 0)",
+	}
 	MinerNoVerfiyFlag = cli.BoolFlag{
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerEmptyLogVerboseFlag = cli.BoolFlag{
+		Name:  "miner.emptylogverbose",
+		Usage: "Log the routine checks of the empty block loop at info level",
+	}
+	MinerEmptyMinOnlineFlag = cli.IntFlag{
+		Name:  "miner.emptyminonline",
+		Usage: "Online validators from which no early empty block is started",
+		Value: miner.DefaultEmptyMinOnline,
+	}
+	MinerEmptyValidatorWaitFlag = cli.IntFlag{
+		Name:  "miner.emptyvalidatorwait",
+		Usage: "Empty block loop checks a validator of the coming block waits before an empty block",
+		Value: miner.DefaultEmptyValidatorWait,
+	}
+	MinerEmptyNonValidatorWaitFlag = cli.IntFlag{
+		Name:  "miner.emptynonvalidatorwait",
+		Usage: "Empty block loop checks a non-validator of the coming block waits before an empty block",
+		Value: miner.DefaultEmptyNonValidatorWait,
+	}
+	MinerEmptyGossipIntervalFlag = cli.DurationFlag{
+		Name:  "miner.emptygossip",
+		Usage: "Interval of the first empty block vote rebroadcasts",
+		Value: miner.DefaultEmptyGossipInterval,
+	}
+	MinerEmptyGossipMaxIntervalFlag = cli.DurationFlag{
+		Name:  "miner.emptygossipmax",
+		Usage: "Maximum interval of empty block vote rebroadcasts as they back off",
+		Value: miner.DefaultEmptyGossipMaxInterval,
+	}
+	MinerEmptyMaxTxsFlag = cli.IntFlag{
+		Name:  "miner.emptymaxtxs",
+		Usage: "Maximum number of transactions included in an empty block (0 = no limit)",
+	}
+	MinerEmptyMaxGasFlag = cli.Uint64Flag{
+		Name:  "miner.emptymaxgas",
+		Usage: "Maximum gas used by the transactions of an empty block (0 = block gas limit)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -1435,6 +1489,38 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(AllowedFutureBlockTimeFlag.Name) {
+		allowed := ctx.GlobalInt(AllowedFutureBlockTimeFlag.Name)
+		if allowed < 0 {
+			Fatalf("--%s must not be negative, have %d", AllowedFutureBlockTimeFlag.Name, allowed)
+		}
+		seconds := uint64(allowed)
+		cfg.AllowedFutureBlockTime = &seconds
+	}
+	if ctx.GlobalIsSet(MinerEmptyLogVerboseFlag.Name) {
+		cfg.Empty.LogVerbose = ctx.GlobalBool(MinerEmptyLogVerboseFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyMinOnlineFlag.Name) {
+		cfg.Empty.MinOnline = ctx.GlobalInt(MinerEmptyMinOnlineFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyValidatorWaitFlag.Name) {
+		cfg.Empty.ValidatorWait = ctx.GlobalInt(MinerEmptyValidatorWaitFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyNonValidatorWaitFlag.Name) {
+		cfg.Empty.NonValidatorWait = ctx.GlobalInt(MinerEmptyNonValidatorWaitFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyGossipIntervalFlag.Name) {
+		cfg.Empty.GossipInterval = ctx.GlobalDuration(MinerEmptyGossipIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyGossipMaxIntervalFlag.Name) {
+		cfg.Empty.GossipMaxInterval = ctx.GlobalDuration(MinerEmptyGossipMaxIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyMaxTxsFlag.Name) {
+		cfg.Empty.MaxTxs = ctx.GlobalInt(MinerEmptyMaxTxsFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerEmptyMaxGasFlag.Name) {
+		cfg.Empty.MaxGas = ctx.GlobalUint64(MinerEmptyMaxGasFlag.Name)
+	}
 	if ctx.GlobalIsSet(LegacyMinerGasTargetFlag.Name) {
 		log.Warn("The generic --miner.gastarget flag is deprecated and will be removed in the future!")
 	}
@@ -1578,6 +1664,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		cfg.Preimages = true
 		log.Info("Enabling recording of key preimages since archive mode is used")
 	}
+	if ctx.GlobalIsSet(StrictDeterminismFlag.Name) {
+		cfg.StrictDeterminism = ctx.GlobalBool(StrictDeterminismFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
@@ -1596,6 +1685,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheSnapshotFlag.Name) {
 		cfg.SnapshotCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheSnapshotFlag.Name) / 100
 	}
+	if ctx.GlobalIsSet(SnapshotVerifyFlag.Name) {
+		state.VerifySnapshotCommits = ctx.GlobalBool(SnapshotVerifyFlag.Name)
+	}
 	if !ctx.GlobalBool(SnapshotFlag.Name) {
 		// If snap-sync is requested, this flag is also required
 		if cfg.SyncMode == downloader.SnapSync {
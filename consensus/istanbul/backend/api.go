@@ -18,11 +18,17 @@ package backend
 
 import (
 	"errors"
+	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	istanbulcommon "github.com/ethereum/go-ethereum/consensus/istanbul/common"
+	ibftengine "github.com/ethereum/go-ethereum/consensus/istanbul/ibft/engine"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -97,6 +103,98 @@ func (api *API) signers(header *types.Header) (*BlockSigners, error) {
 	}, nil
 }
 
+// CommitterStake is the stake of a validator that committed a block
+type CommitterStake struct {
+	Address     common.Address `json:"address"`     // Validator the committed seal counts for
+	Signer      common.Address `json:"signer"`      // Address that signed the seal, the validator or its proxy
+	Balance     *hexutil.Big   `json:"balance"`     // Pledged balance of the validator
+	Coefficient uint8          `json:"coefficient"` // Coefficient of the validator
+}
+
+// SigningStake is how much of the validator pool stake committed a block
+type SigningStake struct {
+	Number       uint64            `json:"number"`
+	Hash         common.Hash       `json:"hash"`
+	Committers   []*CommitterStake `json:"committers"`
+	SigningStake *hexutil.Big      `json:"signingStake"` // Pledged balance of the committers
+	ActiveStake  *hexutil.Big      `json:"activeStake"`  // Pledged balance of the validator pool
+}
+
+// GetSigningStake returns the committers of a given block number, or the latest
+// block available if none is specified, with their stake in the validator pool
+// of the parent state.
+func (api *API) GetSigningStake(number *rpc.BlockNumber) (*SigningStake, error) {
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, istanbulcommon.ErrUnknownBlock
+	}
+	if header.Number.Sign() == 0 {
+		return nil, errors.New("genesis block has no committers")
+	}
+	parent := api.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	chain, ok := api.chain.(*core.BlockChain)
+	if !ok {
+		return nil, errors.New("chain state not available")
+	}
+	statedb, err := chain.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	committers, err := api.backend.Signers(header)
+	if err != nil {
+		return nil, err
+	}
+	validators := statedb.GetValidators(types.ValidatorStorageAddress)
+	return signingStake(header, committers, validators, statedb.GetValidatorCoefficient), nil
+}
+
+// signingStake weighs the committers of header against the validator pool.
+// Committers signing as proxy count for the validator they sign for, and each
+// validator counts once.
+func signingStake(header *types.Header, committers []common.Address, validators *types.ValidatorList, coefficient func(common.Address) uint8) *SigningStake {
+	stake := &SigningStake{
+		Number:      header.Number.Uint64(),
+		Hash:        header.Hash(),
+		Committers:  make([]*CommitterStake, 0, len(committers)),
+		ActiveStake: (*hexutil.Big)(validators.TotalStakeBalance()),
+	}
+	signing := new(big.Int)
+	seen := make(map[common.Address]bool)
+	for _, signer := range committers {
+		addr := signer
+		if validator, ok := validators.ProxyFor(signer); ok {
+			addr = validator
+		}
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		balance := new(big.Int)
+		if v := validators.GetValidatorByAddr(addr); v != nil && v.Balance != nil {
+			balance.Set(v.Balance)
+		}
+		signing.Add(signing, balance)
+		stake.Committers = append(stake.Committers, &CommitterStake{
+			Address:     addr,
+			Signer:      signer,
+			Balance:     (*hexutil.Big)(balance),
+			Coefficient: coefficient(addr),
+		})
+	}
+	stake.SigningStake = (*hexutil.Big)(signing)
+	return stake
+}
+
 // GetSnapshot retrieves the state snapshot at a given block.
 func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
 	// Retrieve the requested block number (or current if none requested)
@@ -275,3 +373,242 @@ func (api *API) IsValidator(blockNum *rpc.BlockNumber) (bool, error) {
 func (api *API) ConsensusInfo() map[string]interface{} {
 	return api.backend.ConsensusInfo()
 }
+
+// maxParticipationRange bounds the number of headers a single GetParticipation
+// call scans.
+const maxParticipationRange = 10000
+
+// ValidatorParticipation is how many blocks of a range a validator proposed and
+// committed, against its fair share of them
+type ValidatorParticipation struct {
+	Address          common.Address `json:"address"`
+	Proposed         uint64         `json:"proposed"`         // Blocks the validator proposed
+	Sealed           uint64         `json:"sealed"`           // Blocks carrying a committed seal of the validator
+	ExpectedProposed float64        `json:"expectedProposed"` // Fair share of the proposed blocks it was selected for
+	ExpectedSealed   float64        `json:"expectedSealed"`   // Fair share of the quorum seals of the blocks it was selected for
+	Participation    float64        `json:"participation"`    // Proposals and seals as a percentage of the fair share
+}
+
+// Participation is the block production report of a block range
+type Participation struct {
+	Start       uint64                    `json:"start"`
+	End         uint64                    `json:"end"`
+	NumBlocks   uint64                    `json:"numBlocks"`   // Normal blocks tallied
+	EmptyBlocks uint64                    `json:"emptyBlocks"` // Empty blocks, which have no proposer and are not tallied
+	Validators  []*ValidatorParticipation `json:"validators"`
+}
+
+// participationKey identifies a report by its range, the end given by hash so
+// that a reorg does not serve a stale report.
+type participationKey struct {
+	start uint64
+	end   common.Hash
+}
+
+// GetParticipation returns how many of the normal blocks in [start, end] each
+// validator proposed and committed, against its fair share. The validators are
+// those selected to seal any block of the range in the parent state, whether
+// they took part or not, with the proposal and the quorum of committed seals of
+// each block shared out equally between its selected validators. The state of
+// every parent in the range must still be available.
+func (api *API) GetParticipation(start rpc.BlockNumber, end rpc.BlockNumber) (*Participation, error) {
+	chain, ok := api.chain.(*core.BlockChain)
+	if !ok {
+		return nil, errors.New("chain state not available")
+	}
+	var last *types.Header
+	if end == rpc.LatestBlockNumber {
+		last = api.chain.CurrentHeader()
+	} else {
+		last = api.chain.GetHeaderByNumber(uint64(end.Int64()))
+	}
+	if last == nil {
+		return nil, istanbulcommon.ErrUnknownBlock
+	}
+	if start < 0 || uint64(start) > last.Number.Uint64() {
+		return nil, errors.New("start block number should be less than or equal to end block number")
+	}
+	if last.Number.Uint64()-uint64(start) >= maxParticipationRange {
+		return nil, fmt.Errorf("range exceeds %d blocks", maxParticipationRange)
+	}
+	key := participationKey{start: uint64(start), end: last.Hash()}
+	if report, ok := api.backend.participation.Get(key); ok {
+		return report.(*Participation), nil
+	}
+	headers := make([]*types.Header, 0, last.Number.Uint64()-uint64(start)+1)
+	for header := last; ; {
+		headers = append(headers, header)
+		if header.Number.Uint64() == uint64(start) {
+			break
+		}
+		if header = api.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+	}
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+	validators := func(header *types.Header) (*types.ValidatorList, *types.ValidatorList, error) {
+		parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return nil, nil, consensus.ErrUnknownAncestor
+		}
+		statedb, err := chain.StateAt(parent.Root)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := statedb.GetValidators(types.ValidatorStorageAddress)
+		if pool == nil {
+			return nil, nil, fmt.Errorf("validators of parent %d not found", parent.Number)
+		}
+		selected, err := chain.Random11ValidatorWithOutProxy(parent)
+		if err != nil {
+			return nil, nil, err
+		}
+		if selected == nil {
+			selected = new(types.ValidatorList)
+		}
+		return selected, pool, nil
+	}
+	report, err := tallyParticipation(chain.Config(), headers, api.backend.Author, api.backend.Signers, validators)
+	if err != nil {
+		return nil, err
+	}
+	api.backend.participation.Add(key, report)
+	return report, nil
+}
+
+// tallyParticipation counts the proposers and committers of the normal blocks
+// among headers, which must be a contiguous range in ascending order, against
+// the validators selected for each block. validators returns those selected
+// and the pool they were selected from, whose proxies sign and propose for
+// them, and each block's quorum follows config. The validators are reported in
+// the order they first appear.
+func tallyParticipation(config *params.ChainConfig, headers []*types.Header, author func(*types.Header) (common.Address, error), signers func(*types.Header) ([]common.Address, error), validators func(*types.Header) (selected, pool *types.ValidatorList, err error)) (*Participation, error) {
+	report := &Participation{
+		Start:      headers[0].Number.Uint64(),
+		End:        headers[len(headers)-1].Number.Uint64(),
+		Validators: make([]*ValidatorParticipation, 0),
+	}
+	tally := make(map[common.Address]*ValidatorParticipation)
+	validator := func(addr common.Address) *ValidatorParticipation {
+		v, ok := tally[addr]
+		if !ok {
+			v = &ValidatorParticipation{Address: addr}
+			tally[addr] = v
+			report.Validators = append(report.Validators, v)
+		}
+		return v
+	}
+	for _, header := range headers {
+		if header.Number.Sign() == 0 {
+			continue
+		}
+		if header.EmptyBlock() {
+			report.EmptyBlocks++
+			continue
+		}
+		proposer, err := author(header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", header.Number, err)
+		}
+		committers, err := signers(header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", header.Number, err)
+		}
+		selected, pool, err := validators(header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", header.Number, err)
+		}
+		// Proxies count for the validator they sign for
+		resolve := func(addr common.Address) common.Address {
+			if validator, ok := pool.ProxyFor(addr); ok {
+				return validator
+			}
+			return addr
+		}
+		report.NumBlocks++
+		if n := selected.Len(); n > 0 {
+			quorum := float64(ibftengine.QuorumSize(config, n))
+			for _, v := range selected.Validators {
+				expected := validator(v.Addr)
+				expected.ExpectedProposed += 1 / float64(n)
+				expected.ExpectedSealed += quorum / float64(n)
+			}
+		}
+		validator(resolve(proposer)).Proposed++
+
+		seen := make(map[common.Address]bool)
+		for _, committer := range committers {
+			addr := resolve(committer)
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			validator(addr).Sealed++
+		}
+	}
+	for _, v := range report.Validators {
+		if expected := v.ExpectedProposed + v.ExpectedSealed; expected > 0 {
+			v.Participation = 100 * float64(v.Proposed+v.Sealed) / expected
+		}
+	}
+	return report, nil
+}
+
+// OnlineStatus reports whether the network currently considers a validator online
+type OnlineStatus struct {
+	Number    uint64 `json:"number"`    // Head block the status was computed against
+	Committer bool   `json:"committer"` // Rewarded as a committer by the latest normal block
+	Online    bool   `json:"online"`    // In the online validator set for the next height
+}
+
+// GetOnlineStatus reports whether the given address appears among the recent
+// committers used for rewards and in the online validator set for the next height.
+func (api *API) GetOnlineStatus(addr common.Address) (*OnlineStatus, error) {
+	header := api.chain.CurrentHeader()
+	if header == nil {
+		return nil, istanbulcommon.ErrUnknownBlock
+	}
+
+	committer, err := isRecentCommitter(api.chain, header, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OnlineStatus{
+		Number:    header.Number.Uint64(),
+		Committer: committer,
+		Online:    containsAddress(api.backend.OnlineValidators(header.Number.Uint64()+1), addr),
+	}, nil
+}
+
+// isRecentCommitter reports whether addr is in the reward set of the latest
+// normal block at or before the given header. Empty blocks carry no reward
+// set, so they are skipped.
+func isRecentCommitter(chain consensus.ChainHeaderReader, header *types.Header, addr common.Address) (bool, error) {
+	for header.Number.Sign() > 0 && header.EmptyBlock() {
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if header == nil {
+			return false, consensus.ErrUnknownAncestor
+		}
+	}
+	if header.Number.Sign() == 0 {
+		return false, nil
+	}
+
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return false, err
+	}
+	return containsAddress(extra.ValidatorAddr, addr), nil
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
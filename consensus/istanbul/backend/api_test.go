@@ -0,0 +1,329 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	ibftengine "github.com/ethereum/go-ethereum/consensus/istanbul/ibft/engine"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// headerChain is a minimal consensus.ChainHeaderReader backed by a header slice.
+type headerChain []*types.Header
+
+func (hc headerChain) Config() *params.ChainConfig  { return params.TestChainConfig }
+func (hc headerChain) CurrentHeader() *types.Header { return hc[len(hc)-1] }
+func (hc headerChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number >= uint64(len(hc)) {
+		return nil
+	}
+	return hc[number]
+}
+func (hc headerChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if h := hc.GetHeaderByNumber(number); h != nil && h.Hash() == hash {
+		return h
+	}
+	return nil
+}
+func (hc headerChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, h := range hc {
+		if h.Hash() == hash {
+			return h
+		}
+	}
+	return nil
+}
+
+// push appends a header rewarding the given committers, or an empty block if
+// the coinbase is the zero address.
+func (hc headerChain) push(t *testing.T, coinbase common.Address, rewarded ...common.Address) headerChain {
+	payload, err := rlp.EncodeToBytes(&types.IstanbulExtra{ValidatorAddr: rewarded})
+	if err != nil {
+		t.Fatalf("failed to encode istanbul extra: %v", err)
+	}
+	header := &types.Header{
+		Number:     big.NewInt(int64(len(hc))),
+		Coinbase:   coinbase,
+		Difficulty: big.NewInt(1),
+		Extra:      append(bytes.Repeat([]byte{0x00}, types.IstanbulExtraVanity), payload...),
+	}
+	if coinbase == (common.Address{}) {
+		header.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+	}
+	if len(hc) > 0 {
+		header.ParentHash = hc.CurrentHeader().Hash()
+	}
+	return append(hc, header)
+}
+
+func TestIsRecentCommitter(t *testing.T) {
+	var (
+		proposer = common.HexToAddress("0x1000000000000000000000000000000000000000")
+		active   = common.HexToAddress("0x2000000000000000000000000000000000000000")
+		stopped  = common.HexToAddress("0x3000000000000000000000000000000000000000")
+	)
+	chain := headerChain{}.push(t, common.Address{})
+	chain = chain.push(t, proposer, active, stopped)
+
+	check := func(addr common.Address, want bool) {
+		t.Helper()
+		have, err := isRecentCommitter(chain, chain.CurrentHeader(), addr)
+		if err != nil {
+			t.Fatalf("failed to check committer %x: %v", addr, err)
+		}
+		if have != want {
+			t.Errorf("committer %x at #%d mismatch: have %v, want %v", addr, chain.CurrentHeader().Number, have, want)
+		}
+	}
+	check(active, true)
+	check(stopped, true)
+
+	// The next normal block only rewards the committers of its predecessor,
+	// so a validator that stopped signing drops out after one normal block.
+	chain = chain.push(t, proposer, active)
+	check(active, true)
+	check(stopped, false)
+
+	// Empty blocks carry no reward set and must not reset the status.
+	chain = chain.push(t, common.Address{})
+	check(active, true)
+	check(stopped, false)
+}
+
+// onlineCore is an istanbul.Core serving recorded online validator sets.
+type onlineCore struct {
+	istanbul.Core
+	online map[uint64][]common.Address
+}
+
+func (c *onlineCore) OnlineValidators(height uint64) []common.Address { return c.online[height] }
+
+func TestOnlineStatusStoppedValidator(t *testing.T) {
+	var (
+		proposer = common.HexToAddress("0x1000000000000000000000000000000000000000")
+		active   = common.HexToAddress("0x2000000000000000000000000000000000000000")
+		stopped  = common.HexToAddress("0x3000000000000000000000000000000000000000")
+	)
+	proofs := &onlineCore{online: map[uint64][]common.Address{
+		2: {proposer, active, stopped},
+	}}
+	chain := headerChain{}.push(t, common.Address{})
+	chain = chain.push(t, proposer, active, stopped)
+
+	check := func(addr common.Address, committer, online bool) {
+		t.Helper()
+		api := &API{chain: chain, backend: &Backend{core: proofs}}
+		status, err := api.GetOnlineStatus(addr)
+		if err != nil {
+			t.Fatalf("failed to get online status of %x: %v", addr, err)
+		}
+		if status.Number != chain.CurrentHeader().Number.Uint64() || status.Committer != committer || status.Online != online {
+			t.Errorf("status of %x at #%d mismatch: have %+v, want committer %v and online %v", addr, chain.CurrentHeader().Number, *status, committer, online)
+		}
+	}
+	check(active, true, true)
+	check(stopped, true, true)
+
+	// The stopped validator sends no online proof for the next height, so it
+	// drops out of the online set as soon as the chain moves on.
+	proofs.online[3] = []common.Address{proposer, active}
+	chain = chain.push(t, proposer, active)
+	check(active, true, true)
+	check(stopped, false, false)
+}
+
+// sealedHeader returns a header carrying the committed seals of keys.
+func sealedHeader(t *testing.T, keys ...*ecdsa.PrivateKey) *types.Header {
+	return sealedHeaderAt(t, 1, common.Address{}, keys...)
+}
+
+// sealedHeaderAt returns a header of the given number and coinbase carrying the
+// committed seals of keys.
+func sealedHeaderAt(t *testing.T, number int64, coinbase common.Address, keys ...*ecdsa.PrivateKey) *types.Header {
+	header := &types.Header{
+		Number:     big.NewInt(number),
+		Coinbase:   coinbase,
+		Difficulty: big.NewInt(1),
+		MixDigest:  types.IstanbulDigest,
+		Extra:      bytes.Repeat([]byte{0x00}, types.IstanbulExtraVanity),
+	}
+	payload, err := rlp.EncodeToBytes(&types.IstanbulExtra{})
+	if err != nil {
+		t.Fatalf("failed to encode istanbul extra: %v", err)
+	}
+	header.Extra = append(header.Extra, payload...)
+
+	// The header hash leaves the committed seals out
+	hash := crypto.Keccak256(ibftengine.PrepareCommittedSeal(header.Hash()))
+	extra := &types.IstanbulExtra{}
+	for _, key := range keys {
+		seal, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatalf("failed to sign committed seal: %v", err)
+		}
+		extra.CommittedSeal = append(extra.CommittedSeal, seal)
+	}
+	if payload, err = rlp.EncodeToBytes(extra); err != nil {
+		t.Fatalf("failed to encode istanbul extra: %v", err)
+	}
+	header.Extra = append(header.Extra[:types.IstanbulExtraVanity], payload...)
+	return header
+}
+
+func TestSigningStake(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	addrs := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	// Four validators, the last one signing through the fifth key as proxy
+	validators := types.NewValidatorList([]*types.Validator{
+		{Addr: addrs[0], Balance: big.NewInt(100)},
+		{Addr: addrs[1], Balance: big.NewInt(200)},
+		{Addr: addrs[2], Balance: big.NewInt(300)},
+		{Addr: addrs[3], Balance: big.NewInt(400), Proxy: addrs[4]},
+	})
+	coefficients := map[common.Address]uint8{addrs[0]: 70, addrs[1]: 50, addrs[2]: 30, addrs[3]: 10}
+
+	header := sealedHeader(t, keys[0], keys[2], keys[4])
+	committers, err := new(ibftengine.Engine).Signers(header)
+	if err != nil {
+		t.Fatalf("failed to recover committers: %v", err)
+	}
+	stake := signingStake(header, committers, validators, func(addr common.Address) uint8 {
+		return coefficients[addr]
+	})
+	if stake.Number != 1 || stake.Hash != header.Hash() {
+		t.Errorf("block mismatch: have #%d %x, want #1 %x", stake.Number, stake.Hash, header.Hash())
+	}
+	if have := stake.SigningStake.ToInt(); have.Cmp(big.NewInt(800)) != 0 {
+		t.Errorf("signing stake mismatch: have %v, want 800", have)
+	}
+	if have := stake.ActiveStake.ToInt(); have.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("active stake mismatch: have %v, want 1000", have)
+	}
+	want := []CommitterStake{
+		{Address: addrs[0], Signer: addrs[0], Balance: (*hexutil.Big)(big.NewInt(100)), Coefficient: 70},
+		{Address: addrs[2], Signer: addrs[2], Balance: (*hexutil.Big)(big.NewInt(300)), Coefficient: 30},
+		{Address: addrs[3], Signer: addrs[4], Balance: (*hexutil.Big)(big.NewInt(400)), Coefficient: 10},
+	}
+	if len(stake.Committers) != len(want) {
+		t.Fatalf("committer count mismatch: have %d, want %d", len(stake.Committers), len(want))
+	}
+	for i, c := range stake.Committers {
+		if c.Address != want[i].Address || c.Signer != want[i].Signer || c.Balance.ToInt().Cmp(want[i].Balance.ToInt()) != 0 || c.Coefficient != want[i].Coefficient {
+			t.Errorf("committer %d mismatch: have %+v, want %+v", i, c, want[i])
+		}
+	}
+}
+
+func TestTallyParticipation(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addrs := make([]common.Address, len(keys)+1)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	// The third validator proposes and seals through a proxy, the fifth is
+	// selected for every block but stays offline.
+	proxyKey, _ := crypto.GenerateKey()
+	proxy := crypto.PubkeyToAddress(proxyKey.PublicKey)
+	addrs[len(keys)] = common.HexToAddress("0x5000000000000000000000000000000000000005")
+	pool := types.NewValidatorList(nil)
+	for i, addr := range addrs {
+		validatorProxy := common.Address{}
+		if i == 2 {
+			validatorProxy = proxy
+		}
+		pool.AddValidator(addr, big.NewInt(100), validatorProxy)
+	}
+	signing := []*ecdsa.PrivateKey{keys[0], keys[1], proxyKey, keys[3]}
+	coinbases := []common.Address{addrs[0], addrs[1], proxy}
+
+	// Twelve normal blocks proposed 6:3:3:0:0, each sealed by the first three
+	// validators, with the fourth validator sealing only every other block,
+	// and two empty blocks in between.
+	proposers := []int{0, 1, 0, 2, 0, 1, 0, 2, 0, 1, 0, 2}
+	headers := []*types.Header{}
+	for i, proposer := range proposers {
+		sealers := signing[:3]
+		if i%2 == 0 {
+			sealers = signing
+		}
+		headers = append(headers, sealedHeaderAt(t, int64(len(headers)+1), coinbases[proposer], sealers...))
+		if i == 3 || i == 7 {
+			empty := sealedHeaderAt(t, int64(len(headers)+1), common.Address{})
+			empty.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+			headers = append(headers, empty)
+		}
+	}
+	author := func(header *types.Header) (common.Address, error) { return header.Coinbase, nil }
+	validators := func(header *types.Header) (*types.ValidatorList, *types.ValidatorList, error) {
+		return pool, pool, nil
+	}
+	report, err := tallyParticipation(params.TestChainConfig, headers, author, new(ibftengine.Engine).Signers, validators)
+	if err != nil {
+		t.Fatalf("failed to tally participation: %v", err)
+	}
+	if report.Start != 1 || report.End != 14 || report.NumBlocks != 12 || report.EmptyBlocks != 2 {
+		t.Errorf("range mismatch: have %d-%d with %d normal and %d empty blocks, want 1-14 with 12 and 2",
+			report.Start, report.End, report.NumBlocks, report.EmptyBlocks)
+	}
+	// 12 proposals and 12 quorums of 3 seals shared out between five validators
+	want := []ValidatorParticipation{
+		{Address: addrs[0], Proposed: 6, Sealed: 12, Participation: 100 * 18 / 9.6},
+		{Address: addrs[1], Proposed: 3, Sealed: 12, Participation: 100 * 15 / 9.6},
+		{Address: addrs[2], Proposed: 3, Sealed: 12, Participation: 100 * 15 / 9.6},
+		{Address: addrs[3], Proposed: 0, Sealed: 6, Participation: 100 * 6 / 9.6},
+		{Address: addrs[4], Proposed: 0, Sealed: 0, Participation: 0},
+	}
+	if len(report.Validators) != len(want) {
+		t.Fatalf("validator count mismatch: have %d, want %d", len(report.Validators), len(want))
+	}
+	// The validators come in the order of the pool
+	have := make(map[common.Address]*ValidatorParticipation)
+	for i, v := range report.Validators {
+		if v.Address != pool.Validators[i].Addr {
+			t.Errorf("validator %d mismatch: have %x, want %x", i, v.Address, pool.Validators[i].Addr)
+		}
+		have[v.Address] = v
+	}
+	close := func(have, want float64) bool { return math.Abs(have-want) < 1e-9 }
+	for i, w := range want {
+		v := have[w.Address]
+		if v == nil {
+			t.Errorf("validator %d missing: %x", i, w.Address)
+			continue
+		}
+		if v.Proposed != w.Proposed || v.Sealed != w.Sealed ||
+			!close(v.ExpectedProposed, 2.4) || !close(v.ExpectedSealed, 7.2) || !close(v.Participation, w.Participation) {
+			t.Errorf("validator %d mismatch: have %+v, want %+v with expected 2.4 proposed and 7.2 sealed", i, *v, w)
+		}
+	}
+}
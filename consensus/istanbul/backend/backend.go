@@ -56,6 +56,7 @@ func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, db ethdb.Databas
 	recents, _ := lru.NewARC(inmemorySnapshots)
 	recentMessages, _ := lru.NewARC(inmemoryPeers)
 	knownMessages, _ := lru.NewARC(inmemoryMessages)
+	participation, _ := lru.NewARC(inmemoryReports)
 
 	sb := &Backend{
 		config:           config,
@@ -70,6 +71,7 @@ func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, db ethdb.Databas
 		coreStarted:      false,
 		recentMessages:   recentMessages,
 		knownMessages:    knownMessages,
+		participation:    participation,
 		notifyBlockCh:    make(chan *types.OnlineValidatorList, 1),
 	}
 
@@ -122,6 +124,8 @@ type Backend struct {
 	recentMessages *lru.ARCCache // the cache of peer's messages
 	knownMessages  *lru.ARCCache // the cache of self messages
 
+	participation *lru.ARCCache // Participation reports of recently queried block ranges
+
 	qbftConsensusEnabled bool // qbft consensus
 
 	notifyBlockCh chan *types.OnlineValidatorList // Notify worker modules to produce blocks
@@ -329,7 +333,7 @@ func (sb *Backend) Verify(proposal istanbul.Proposal) (time.Duration, error) {
 		valSet = validator.NewSet(validatorList.ConvertToAddress(), sb.config.ProposerPolicy, db)
 	}
 
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Cmp(common.Big0) > 0 {
+	if header.EmptyBlock() {
 		//return 0, istanbulcommon.ErrEmptyBlock
 		return sb.EngineForBlockNumber(header.Number).VerifyBlockProposal(sb.chain, block, valSet)
 	}
@@ -405,7 +409,7 @@ func (sb *Backend) getValidators(number uint64, hash common.Hash) istanbul.Valid
 func (sb *Backend) LastProposal() (istanbul.Proposal, common.Address) {
 	block := sb.currentBlock()
 
-	if block.Coinbase() == common.HexToAddress("0x0000000000000000000000000000000000000000") && block.Number().Cmp(common.Big0) > 0 {
+	if block.EmptyBlock() {
 		log.Info("LastProposal Empty block")
 		return block, common.Address{}
 	} else {
@@ -40,6 +40,7 @@ const (
 	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
 	inmemoryPeers      = 40
 	inmemoryMessages   = 4096
+	inmemoryReports    = 64 // Number of recent participation reports to keep in memory
 )
 
 // Author retrieves the Ethereum address of the account that minted the given
@@ -90,7 +91,7 @@ func (sb *Backend) verifyHeader(chain consensus.ChainHeaderReader, header *types
 		}
 
 		var valSet istanbul.ValidatorSet
-		if header.Coinbase == (common.Address{}) && header.Number.Cmp(common.Big0) > 0 {
+		if header.EmptyBlock() {
 			valSet = validator.NewEmptySet(validators, sb.config.ProposerPolicy)
 		} else {
 			valSet = validator.NewSet(validators, sb.config.ProposerPolicy, db)
@@ -304,7 +305,7 @@ func (sb *Backend) Seal(chain consensus.ChainHeaderReader, block *types.Block, r
 	// update the block header timestamp and signature and propose the block to core engine
 	header := block.Header()
 
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Uint64() > 0 {
+	if header.EmptyBlock() {
 		log.Error("Seal : coinbase error", "err", "coinbase is 0")
 		return errors.New("coinbase is 0")
 	}
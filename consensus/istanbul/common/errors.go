@@ -57,6 +57,10 @@ var (
 	// ErrMismatchTxhashes is returned if the TxHash in header is mismatch.
 	ErrMismatchTxhashes = errors.New("mismatch transactions hashes")
 
+	// ErrEmptyBlockTransactions is returned if an empty block carries transactions
+	// once the chain requires empty blocks to be transaction free.
+	ErrEmptyBlockTransactions = errors.New("empty block carries transactions")
+
 	// ErrInconsistentSubject is returned when received subject is different from
 	// current subject.
 	ErrInconsistentSubject = errors.New("inconsistent subjects")
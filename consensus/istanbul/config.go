@@ -20,6 +20,7 @@ import (
 	"math/big"
 	"sync"
 
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/naoina/toml"
 )
 
@@ -117,8 +118,11 @@ type Config struct {
 	ProposerPolicy         *ProposerPolicy `toml:",omitempty"` // The policy for proposer selection
 	Epoch                  uint64          `toml:",omitempty"` // The number of blocks after which to checkpoint and reset the pending votes
 	Ceil2Nby3Block         *big.Int        `toml:",omitempty"` // Number of confirmations required to move from one state to next [2F + 1 to Ceil(2N/3)]
-	AllowedFutureBlockTime uint64          `toml:",omitempty"` // Max time (in seconds) from current time allowed for blocks, before they're considered future blocks
+	AllowedFutureBlockTime uint64          `toml:",omitempty"` // Max time (in seconds) from current time allowed for blocks, before they're considered future blocks. Overridden by the network default and --allowedfutureblocktime
 	TestQBFTBlock          *big.Int        `toml:",omitempty"` // Fork block at which block confirmations are done using qbft consensus instead of ibft
+	EvilActionLookback     uint64          `toml:",omitempty"` // Number of blocks before the stale threshold still searched for unhandled evil actions
+	QuorumNumerator        uint64          `toml:",omitempty"` // Numerator of the share of validators a quorum needs, 2F + 1 if QuorumDenominator is zero
+	QuorumDenominator      uint64          `toml:",omitempty"` // Denominator of the share of validators a quorum needs
 }
 
 var DefaultConfig = &Config{
@@ -129,6 +133,16 @@ var DefaultConfig = &Config{
 	Ceil2Nby3Block:         big.NewInt(0),
 	AllowedFutureBlockTime: 0,
 	TestQBFTBlock:          big.NewInt(0),
+	EvilActionLookback:     3,
+}
+
+// QuorumSize returns the number of validators out of n a quorum needs, the
+// same count the engine checks committed seals against.
+func (c *Config) QuorumSize(n int) int {
+	return (&params.IstanbulConfig{
+		QuorumNumerator:   c.QuorumNumerator,
+		QuorumDenominator: c.QuorumDenominator,
+	}).QuorumSize(n)
 }
 
 // QBFTBlockNumber returns the qbftBlock fork block number, returns -1 if qbftBlock is not defined
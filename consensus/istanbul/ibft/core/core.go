@@ -493,7 +493,7 @@ func (c *core) checkValidatorSignature(data []byte, sig []byte) (common.Address,
 }
 
 func (c *core) QuorumSize() int {
-	return (2 * c.valSet.F()) + 1
+	return c.config.QuorumSize(c.valSet.Size())
 }
 
 // PrepareCommittedSeal returns a committed seal for the given hash
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"math"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -20,6 +20,8 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	"golang.org/x/crypto/sha3"
@@ -34,6 +36,23 @@ var (
 // staleThreshold is the maximum depth of the acceptable stale block.
 const staleThreshold = 7
 
+// maxEmptyAncestors is the maximum number of consecutive empty blocks walked
+// back over when looking for the last normal block.
+const maxEmptyAncestors = 1 << 20
+
+// errTooManyEmptyAncestors is returned if no normal block is found within
+// maxEmptyAncestors empty blocks.
+var errTooManyEmptyAncestors = errors.New("no normal ancestor within the empty block limit")
+
+// errInvalidRewardSeals is returned if the reward seals of a block aren't
+// commit seals of the previous normal block.
+var errInvalidRewardSeals = errors.New("reward seals not from the previous normal block committee")
+
+// unauthorizedSignerCounter counts the headers rejected for being signed by an
+// address outside the validator set. It is counted even with metrics disabled
+// so operators can always read it.
+var unauthorizedSignerCounter = metrics.NewRegisteredCounterForced("consensus/istanbul/engine/unauthorized", nil)
+
 type SignerFn func(data []byte) ([]byte, error)
 
 type Option func(*types.IstanbulExtra)
@@ -111,7 +130,7 @@ func (e *Engine) Author(header *types.Header) (common.Address, error) {
 		return common.Address{}, err
 	}
 
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Cmp(common.Big0) > 0 {
+	if header.EmptyBlock() {
 		return common.HexToAddress("0x0000000000000000000000000000000000000000"), nil
 	} else {
 		addr, err := istanbul.GetSignatureAddress(sigHash(header).Bytes(), extra.Seal)
@@ -140,7 +159,7 @@ func (e *Engine) VerifyBlockProposal(chain consensus.ChainHeaderReader, block *t
 	// 	return 0, istanbulcommon.ErrInvalidUncleHash
 	// }
 
-	if block.Coinbase() == common.HexToAddress("0x0000000000000000000000000000000000000000") && block.Number().Cmp(common.Big0) > 0 {
+	if block.EmptyBlock() {
 		return 0, istanbulcommon.ErrEmptyBlock
 	} else {
 		// verify the header of proposed block
@@ -199,9 +218,11 @@ func (e *Engine) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	// 	return istanbulcommon.ErrInvalidUncleHash
 	// }
 
-	// Ensure that the block's difficulty is meaningful (may not be correct at this point)
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Cmp(common.Big0) > 0 {
-		if header.Difficulty == nil || header.Difficulty.Cmp(big.NewInt(24)) != 0 {
+	// Ensure that the block's difficulty is meaningful (may not be correct at this point).
+	// A zero coinbase needs the empty block difficulty, anything else the normal one,
+	// so no header is left that EmptyBlock and the coinbase disagree on.
+	if header.Coinbase == (common.Address{}) && header.Number.Cmp(common.Big0) > 0 {
+		if !header.EmptyBlock() {
 			return istanbulcommon.ErrInvalidDifficulty
 		}
 	} else {
@@ -242,12 +263,12 @@ func (e *Engine) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 		return istanbulcommon.ErrInvalidTimestamp
 	}
 
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Cmp(common.Big0) > 0 {
+	if header.EmptyBlock() {
 		//err := e.verifyEmptyVote(chain, header, parents, validators)
 		//if err != nil {
 		//	return fmt.Errorf("verify empty block %v", err)
 		//}
-		return nil
+		return verifyEmptyBlockBody(chain.Config(), header)
 	}
 
 	// Verify signer
@@ -255,16 +276,95 @@ func (e *Engine) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 		return err
 	}
 
+	if err := e.verifyRewardSeals(chain, header, parents); err != nil {
+		return err
+	}
+
 	return e.verifyCommittedSeals(chain, header, parents, validators)
 }
 
-func (e *Engine) verifyEmptyVote(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, validators istanbul.ValidatorSet) error {
-	var allWeightBalance = big.NewInt(0)
-	var voteBalance *big.Int
-	var coe uint8
+// verifyEmptyBlockBody checks the transactions of an empty block against the
+// chain's policy. Before the transaction free fork empty blocks may carry the
+// pending transactions, from it on their transaction root must be empty.
+func verifyEmptyBlockBody(config *params.ChainConfig, header *types.Header) error {
+	if config.IsTxFreeEmptyBlock(header.Number) && header.TxHash != types.EmptyRootHash {
+		return istanbulcommon.ErrEmptyBlockTransactions
+	}
+	return nil
+}
+
+// verifyRewardSeals checks that the reward seals of a normal block are commit
+// seals of the previous normal block, each from a different validator of its
+// committee. Which of those seals a node holds differs from node to node, so
+// the committee recorded in the previous block bounds the rewarders rather than
+// the local copy of its commit seals. Before the reward seals fork any seals
+// are accepted.
+func (e *Engine) verifyRewardSeals(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	if !chain.Config().IsRewardSeals(header.Number) {
+		return nil
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return err
+	}
+	preHeader, err := rewardHeader(&chainWithParents{chain, parents}, header)
+	if err != nil {
+		return err
+	}
+	if preHeader == nil {
+		return nil
+	}
+	preExtra, err := types.ExtractIstanbulExtra(preHeader)
+	if err != nil {
+		return err
+	}
+	rewarders, err := e.RecoverRewards(preHeader, extra.RewardSeal)
+	if err != nil {
+		return err
+	}
+	committee := make(map[common.Address]bool, len(preExtra.Validators))
+	for _, addr := range preExtra.Validators {
+		committee[addr] = true
+	}
+	for _, addr := range rewarders {
+		if !committee[addr] {
+			log.Error("Engine: reward seal not from the previous committee", "no", header.Number, "hash", header.Hash(), "preHeader", preHeader.Number, "rewarder", addr)
+			return errInvalidRewardSeals
+		}
+		// A duplicated seal would count its validator towards the quorum twice
+		delete(committee, addr)
+	}
+	return nil
+}
+
+// chainWithParents resolves headers from a batch being verified before falling
+// back to the chain, as the batch isn't in the chain yet.
+type chainWithParents struct {
+	consensus.ChainHeaderReader
+	parents []*types.Header
+}
+
+func (c *chainWithParents) GetHeaderByHash(hash common.Hash) *types.Header {
+	for i := len(c.parents) - 1; i >= 0; i-- {
+		if c.parents[i].Hash() == hash {
+			return c.parents[i]
+		}
+	}
+	return c.ChainHeaderReader.GetHeaderByHash(hash)
+}
 
+func (e *Engine) verifyEmptyVote(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, validators istanbul.ValidatorSet) error {
 	log.Info("azh|check empty vote")
 
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return err
+	}
+	votes, err := extra.EmptyBlockVotes()
+	if err != nil {
+		return err
+	}
+
 	//averageCoefficient := bc.GetAverageCoefficient(statedb)
 	bc, ok := chain.(*core.BlockChain)
 	if !ok {
@@ -285,37 +385,43 @@ func (e *Engine) verifyEmptyVote(chain consensus.ChainHeaderReader, header *type
 		return errors.New("get validators error")
 	}
 
-	extra, err := types.ExtractIstanbulExtra(header)
+	round, err := emptyVoteRound(chain.Config(), header, extra)
 	if err != nil {
 		return err
 	}
-
-	for _, validator := range validatorList.Validators {
-		coe = stateDb.GetValidatorCoefficient(validator.Addr)
-		voteBalance = new(big.Int).Mul(validator.Balance, big.NewInt(int64(coe)))
-		allWeightBalance.Add(allWeightBalance, voteBalance)
-	}
-	allWeightBalance50 := new(big.Int).Mul(big.NewInt(50), allWeightBalance)
-	allWeightBalance50 = new(big.Int).Div(allWeightBalance50, big.NewInt(100))
-
 	var votevValidators []common.Address
-	for _, emptyBlockMessage := range extra.EmptyBlockMessages[1:] {
-		flag, height := CheckHeight(header, emptyBlockMessage)
-		log.Info("empty block check", "block height", header.Number, "vote height", height)
+	for _, emptyBlockMessage := range votes {
+		sender, flag, err := VerifyEmptyVote(header, emptyBlockMessage)
+		if err != nil {
+			return err
+		}
 		if !flag {
 			return errors.New("the vote height doesn`t match the block height")
 		}
-		msg := &types.EmptyMsg{}
-		sender, err := msg.RecoverAddress(emptyBlockMessage)
-		if err != nil {
-			return err
+		if round != nil {
+			if err := types.CheckEmptyVoteRound(round, emptyBlockMessage); err != nil {
+				return err
+			}
 		}
 		votevValidators = append(votevValidators, sender)
 	}
+	return emptyVoteQuorum(validatorList, stateDb.GetValidatorCoefficient, votevValidators)
+}
+
+// emptyVoteQuorum checks that the stake of the voters, weighted by the default
+// coefficient, exceeds half of the coefficient weighted stake of all validators.
+func emptyVoteQuorum(validatorList *types.ValidatorList, coefficient func(common.Address) uint8, voters []common.Address) error {
+	var allWeightBalance = big.NewInt(0)
+	for _, validator := range validatorList.Validators {
+		voteBalance := new(big.Int).Mul(validator.Balance, big.NewInt(int64(coefficient(validator.Addr))))
+		allWeightBalance.Add(allWeightBalance, voteBalance)
+	}
+	allWeightBalance50 := new(big.Int).Mul(big.NewInt(50), allWeightBalance)
+	allWeightBalance50 = new(big.Int).Div(allWeightBalance50, big.NewInt(100))
 
 	var blockWeightBalance = big.NewInt(0)
-	for _, v := range votevValidators {
-		voteBalance = new(big.Int).Mul(validatorList.StakeBalance(v), big.NewInt(types.DEFAULT_VALIDATOR_COEFFICIENT))
+	for _, v := range voters {
+		voteBalance := new(big.Int).Mul(validatorList.StakeBalance(v), big.NewInt(types.DEFAULT_VALIDATOR_COEFFICIENT))
 		blockWeightBalance.Add(blockWeightBalance, voteBalance)
 	}
 	if blockWeightBalance.Cmp(allWeightBalance50) > 0 {
@@ -327,6 +433,93 @@ func (e *Engine) verifyEmptyVote(chain consensus.ChainHeaderReader, header *type
 	}
 }
 
+// emptyVoters returns the validators that cast the given empty block votes for
+// header, each counted once. A vote signed by a validator's proxy counts for
+// the validator. Votes that fail to decode, are cast for another height or are
+// signed by neither a validator nor a proxy are dropped.
+func emptyVoters(header *types.Header, votes [][]byte, validatorList *types.ValidatorList, round *types.SignatureData) []common.Address {
+	var voters []common.Address
+	seen := make(map[common.Address]bool)
+	for _, vote := range votes {
+		sender, match, err := VerifyEmptyVote(header, vote)
+		if err != nil || !match {
+			continue
+		}
+		if round != nil && types.CheckEmptyVoteRound(round, vote) != nil {
+			continue
+		}
+		for _, val := range validatorList.Validators {
+			if val.Addr == sender || val.Proxy == sender {
+				if !seen[val.Addr] {
+					seen[val.Addr] = true
+					voters = append(voters, val.Addr)
+				}
+				break
+			}
+		}
+	}
+	return voters
+}
+
+// EmptyBlockVoters returns the validators the empty block header rewards as
+// voters, the leader of its proposer message first. From the empty voter reward
+// fork on these are the emptyVoters of all its messages, so only votes valid for
+// the height and round of the block count and every validator is rewarded once
+// however often it voted.
+func EmptyBlockVoters(config *params.ChainConfig, header *types.Header, extra *types.IstanbulExtra, validators *types.ValidatorList) ([]common.Address, error) {
+	if !config.IsEmptyVoterReward(header.Number) {
+		return legacyEmptyVoters(extra, validators), nil
+	}
+	round, err := emptyVoteRound(config, header, extra)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proposer message: %w", err)
+	}
+	return emptyVoters(header, extra.EmptyBlockMessages, validators, round), nil
+}
+
+// legacyEmptyVoters returns the voters empty blocks rewarded before the empty
+// voter reward fork, in the order of their messages: the signer of every
+// message, mapped from proxy to validator, whatever height or round it voted
+// for. Messages not signed by a validator or its proxy are skipped, while a
+// validator voting more than once is listed for every vote.
+func legacyEmptyVoters(extra *types.IstanbulExtra, validators *types.ValidatorList) []common.Address {
+	voteAddrs := make([]common.Address, 0)
+	emptyMsg := new(types.EmptyMsg)
+
+	for _, emptyMessage := range extra.EmptyBlockMessages {
+		if err := emptyMsg.FromPayload(emptyMessage); err != nil {
+			log.Error("Certify Failed to decode message from payload", "err", err)
+			continue
+		}
+		sender, err := emptyMsg.RecoverAddress(emptyMessage)
+		if err != nil {
+			log.Info("recover emptyMessage", "err", err)
+			continue
+		}
+
+		for _, val := range validators.Validators {
+			if val.Addr == sender || val.Proxy == sender {
+				voteAddrs = append(voteAddrs, val.Addr)
+				break
+			}
+		}
+	}
+	return voteAddrs
+}
+
+// emptyVoteRound returns the proposer message of an empty block, whose round
+// the votes must have been cast in, or nil if votes of any round count at the
+// height of header.
+func emptyVoteRound(config *params.ChainConfig, header *types.Header, extra *types.IstanbulExtra) (*types.SignatureData, error) {
+	if !config.IsEmptyVoteRound(header.Number) {
+		return nil, nil
+	}
+	if len(extra.EmptyBlockMessages) == 0 {
+		return nil, types.ErrTooFewEmptyBlockMessages
+	}
+	return types.DecodeEmptyVote(extra.EmptyBlockMessages[0])
+}
+
 func CheckHeight(header *types.Header, emptyMsg []byte) (bool, *big.Int) {
 	msg := new(types.EmptyMsg)
 	if err := msg.FromPayload(emptyMsg); err != nil {
@@ -345,6 +538,23 @@ func CheckHeight(header *types.Header, emptyMsg []byte) (bool, *big.Int) {
 	return false, signature.Height
 }
 
+// VerifyEmptyVote recovers the signer of a serialized empty-block vote and
+// reports whether the vote is for the height of the given header. It needs no
+// chain access, so external tooling can use it to audit gossiped votes.
+func VerifyEmptyVote(header *types.Header, emptyMsg []byte) (common.Address, bool, error) {
+	flag, height := CheckHeight(header, emptyMsg)
+	log.Debug("empty block check", "block height", header.Number, "vote height", height)
+	if height == nil {
+		return common.Address{}, false, errors.New("invalid empty block vote")
+	}
+	msg := &types.EmptyMsg{}
+	sender, err := msg.RecoverAddress(emptyMsg)
+	if err != nil {
+		return common.Address{}, false, err
+	}
+	return sender, flag, nil
+}
+
 func (e *Engine) verifySigner(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, validators istanbul.ValidatorSet) error {
 	// Verifying the genesis block is not supported
 	number := header.Number.Uint64()
@@ -360,10 +570,14 @@ func (e *Engine) verifySigner(chain consensus.ChainHeaderReader, header *types.H
 	}
 
 	if _, v := validators.GetByAddress(signer); v == nil {
-		log.Error("cavar|verifySigner-signer", "no", header.Number.Text(10), "header", header.Hash().Hex(), "sign", signer.Hex())
-		for _, addr := range validators.List() {
-			log.Error("cavar|verifySigner-val", "no", header.Number.Text(10), "header", header.Hash().Hex(), "val-addr", addr.Address().Hex())
+		// A burst of these usually means this node's validator set is out of
+		// sync with the network's, e.g. around a validator set transition
+		unauthorizedSignerCounter.Inc(1)
+		vals := make([]common.Address, 0, validators.Size())
+		for _, val := range validators.List() {
+			vals = append(vals, val.Address())
 		}
+		log.Error("Engine: block signed by non-validator", "no", number, "hash", header.Hash(), "signer", signer, "validators", vals)
 		return istanbulcommon.ErrUnauthorized
 	}
 
@@ -385,7 +599,7 @@ func (e *Engine) verifyCommittedSeals(chain consensus.ChainHeaderReader, header
 	}
 	committedSeal := extra.CommittedSeal
 
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Cmp(common.Big0) > 0 {
+	if header.EmptyBlock() {
 		return nil
 	} else {
 		// The length of Committed seals should be larger than 0
@@ -475,6 +689,8 @@ func (e *Engine) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 		validatorAddr []common.Address
 		exchangerAddr []common.Address
 		rewardSeals   [][]byte
+		rewardSigners []common.Address
+		quorumSize    int
 		evilAction    = &types.EvilAction{}
 	)
 	if c, ok := chain.(*core.BlockChain); ok {
@@ -493,19 +709,19 @@ func (e *Engine) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 				log.Error("Prepare : invalid validators", err.Error())
 				return errors.New("Prepare: invalid validators")
 			}
-			quorumSize := e.QuorumSize(random11Validators.Len())
+			quorumSize = e.QuorumSize(chain.Config(), random11Validators.Len())
 			if quorumSize == 0 {
 				log.Error("Prepare invalid quorum size", "no", header.Number, "size", quorumSize)
 				return errors.New("invalid quorum size")
 			}
 			log.Info("Prepare quorum size", "no", header.Number, "size", quorumSize)
 			// Get the header of the last normal block
-			preHeader, err := getPreHash(chain, header)
-			if !preHeader.EmptyBlock() {
-				if err != nil {
-					log.Error("Prepare get preHash err", "err", err, "no", header.Number, "hash", header.Hash().Hex())
-					return err
-				}
+			preHeader, err := rewardHeader(chain, header)
+			if err != nil {
+				log.Error("Prepare get preHash err", "err", err, "no", header.Number, "hash", header.Hash().Hex())
+				return err
+			}
+			if preHeader != nil {
 				log.Info("Prepare getPreHash ok", "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
 				commiters, err := e.Signers(preHeader)
 				if err != nil {
@@ -516,19 +732,10 @@ func (e *Engine) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 					log.Error("Prepare commiters len less than 7", "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
 					return errors.New("Prepare commiters len less than 7")
 				}
-				for _, v := range commiters {
-					if len(validatorAddr) == quorumSize {
-						break
-					}
-					// reward to onlineValidtors
-					validatorAddr = append(validatorAddr, v)
-				}
+				rewardSigners = commiters
 				for i, v := range commiters {
 					log.Info("print committers", "len", len(commiters), "i", i, "addr", v.Hex(), "preHeader", preHeader.Number, "no", header.Number)
 				}
-				for _, v := range validatorAddr {
-					log.Info("Prepare: onlineValidator", "addr", v.Hex(), "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
-				}
 				// copy commitSeals to rewardSeals
 				rewardSeals, err = e.copyCommitSeals(preHeader)
 				if err != nil {
@@ -579,40 +786,23 @@ func (e *Engine) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 
 		exchangerAddr = append(exchangerAddr, benifitedStakers...)
 
-		//new&update  at 20220523
-		if validatorList != nil && len(validatorList.Validators) > 0 {
-			//k:proxy,v:validator
-			mp := make(map[string]*types.Validator, 0)
-			for _, v := range validatorList.Validators {
-				if v.Proxy.String() != "0x0000000000000000000000000000000000000000" {
-					mp[v.Proxy.String()] = v
-				}
-			}
+		//The current block issues a reward for the previous block,
+		//but if the participant in the previous block consensus sends a validator to cancel the transaction
+		//and package it in the previous block, the current block does not send him a reward
+		//for index, a := range validatorAddr {
+		//	if !validatorList.Exist(a) {
+		//		validatorAddr = append(validatorAddr[:index], validatorAddr[index+1:]...)
+		//	}
+		//}
 
-			//The current block issues a reward for the previous block,
-			//but if the participant in the previous block consensus sends a validator to cancel the transaction
-			//and package it in the previous block, the current block does not send him a reward
-			//for index, a := range validatorAddr {
-			//	if !validatorList.Exist(a) {
-			//		validatorAddr = append(validatorAddr[:index], validatorAddr[index+1:]...)
-			//	}
-			//}
-
-			//If the reward address is on a proxy account, it will be restored to a pledge account
-			for index, a := range validatorAddr {
-				if v, ok := mp[a.String()]; ok {
-					validatorAddr[index] = v.Addr
-				}
-			}
+		validatorAddr = rewardValidators(rewardSigners, quorumSize, validatorList)
+		for _, v := range validatorAddr {
+			log.Info("Prepare: onlineValidator", "addr", v.Hex(), "no", header.Number, "hash", header.Hash().Hex())
 		}
 
-		// Record the evil behavior of 7 blocks ago
-		if header.Number.Uint64() > staleThreshold {
-			ea, err := c.ReadEvilAction(header.Number.Uint64() - staleThreshold)
-			if err == nil && ea != nil && !ea.Handled {
-				evilAction = ea
-				evilAction.Handled = true
-			}
+		// Record the evil behavior found at least 7 blocks ago
+		if ea := e.pendingEvilAction(chain, c, parent, number); ea != nil {
+			evilAction = ea
 		}
 	}
 
@@ -688,26 +878,165 @@ func (e *Engine) copyCommitSeals(header *types.Header) ([][]byte, error) {
 	return rewardSeals, nil
 }
 
-// getPreHash Get the header of the last normal header
-func getPreHash(chain consensus.ChainHeaderReader, header *types.Header) (*types.Header, error) {
-	preHeader := chain.GetHeaderByHash(header.ParentHash)
+// rewardValidators picks the first quorumSize signers of the previous normal
+// block as the reward recipients. Signers that are proxies are restored to the
+// validator they sign for, so Prepare and Finalize must pass the validator list
+// of the same parent state to agree on the result.
+func rewardValidators(signers []common.Address, quorumSize int, validators *types.ValidatorList) []common.Address {
+	//k:proxy,v:validator
+	mp := make(map[common.Address]common.Address)
+	if validators != nil {
+		for _, v := range validators.Validators {
+			if v.Proxy != (common.Address{}) {
+				mp[v.Proxy] = v.Addr
+			}
+		}
+	}
+	validatorAddr := make([]common.Address, 0, quorumSize)
+	for _, a := range signers {
+		if len(validatorAddr) == quorumSize {
+			break
+		}
+		//If the reward address is on a proxy account, it will be restored to a pledge account
+		if addr, ok := mp[a]; ok {
+			a = addr
+		}
+		validatorAddr = append(validatorAddr, a)
+	}
+	return validatorAddr
+}
+
+// RewardedValidators returns the validators the normal block header rewards:
+// the signers of its reward seals over the previous normal block, mapped from
+// proxy to validator, up to the quorum of the selected validators. validators
+// is the pool of the parent state. Block 1 and the block after an empty block 1
+// reward no one.
+func RewardedValidators(chain consensus.ChainHeaderReader, header *types.Header, extra *types.IstanbulExtra, selected int, validators *types.ValidatorList) ([]common.Address, error) {
+	if header.Number.Uint64() == 1 {
+		// Block 1 does not issue any rewards
+		return make([]common.Address, 0), nil
+	}
+	// quorum Size
+	quorumSize := QuorumSize(chain.Config(), selected)
+	if quorumSize == 0 {
+		return nil, fmt.Errorf("invalid quorum size %d", quorumSize)
+	}
+	log.Info("Finalize quorum size", "no", header.Number, "size", quorumSize)
+	// Get the header of the last normal block
+	preHeader, err := rewardHeader(chain, header)
+	if err != nil {
+		return nil, fmt.Errorf("get previous normal block: %w", err)
+	}
 	if preHeader == nil {
-		return nil, errors.New("getPreHash : invalid preHeader")
+		return nil, nil
+	}
+	log.Info("Finalize getPreHash ok", "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
+	// decode rewards
+	// preHeader + currentRewadSeal
+	rewarders, err := recoverRewards(preHeader, extra.RewardSeal)
+	if err != nil {
+		return nil, fmt.Errorf("recover rewarders of block %d: %w", preHeader.Number, err)
 	}
-	if preHeader.Number.Uint64() == 1 {
-		// may be empty block
-		return preHeader, nil
+	for _, v := range rewarders {
+		log.Info("Finalize: onlineValidator", "addr", v.Hex(), "len", len(rewarders), "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
 	}
-	if preHeader.Coinbase == (common.Address{}) {
-		preHeader, err := getPreHash(chain, preHeader)
-		if err != nil {
-			return nil, err
+	if len(rewarders) < quorumSize {
+		return nil, fmt.Errorf("%d rewarders of block %d, less than the quorum of %d", len(rewarders), preHeader.Number, quorumSize)
+	}
+	return rewardValidators(rewarders, quorumSize, validators), nil
+}
+
+// evilActionReader is the part of the blockchain used to look up recorded evil actions
+type evilActionReader interface {
+	ReadEvilAction(no uint64) (*types.EvilAction, error)
+}
+
+// pendingEvilAction returns the oldest unhandled evil action recorded within
+// the lookback window ending staleThreshold blocks before number, skipping any
+// that an ancestor of the block has already carried.
+func (e *Engine) pendingEvilAction(chain consensus.ChainHeaderReader, reader evilActionReader, parent *types.Header, number uint64) *types.EvilAction {
+	if number <= staleThreshold {
+		return nil
+	}
+	last := number - staleThreshold
+	first := uint64(1)
+	if last > e.cfg.EvilActionLookback {
+		first = last - e.cfg.EvilActionLookback
+	}
+	for no := first; no <= last; no++ {
+		ea, err := reader.ReadEvilAction(no)
+		if err != nil || ea == nil || ea.Handled || len(ea.EvilHeaders) == 0 {
+			continue
+		}
+		// Only blocks past no+staleThreshold could have carried it already
+		if no < last && evilActionIncluded(chain, parent, no) {
+			continue
 		}
-		return preHeader, nil
+		ea.Handled = true
+		return ea
+	}
+	return nil
+}
+
+// evilActionIncluded reports whether an ancestor from header back to
+// no+staleThreshold recorded the evil action of block no in its extra-data.
+func evilActionIncluded(chain consensus.ChainHeaderReader, header *types.Header, no uint64) bool {
+	for header != nil && header.Number.Uint64() >= no+staleThreshold {
+		extra, err := types.ExtractIstanbulExtra(header)
+		if err == nil && extra.EvilAction != nil && len(extra.EvilAction.EvilHeaders) > 0 &&
+			extra.EvilAction.EvilHeaders[0].Number.Uint64() == no {
+			return true
+		}
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	return false
+}
+
+// rewardHeader returns the normal block whose committers are rewarded by header,
+// or nil if header issues no validator rewards. That is the case for block 1,
+// which has no committed parent, and for blocks whose only normal ancestor is
+// the genesis block because the chain went straight into empty blocks.
+func rewardHeader(chain consensus.ChainHeaderReader, header *types.Header) (*types.Header, error) {
+	if header.Number.Uint64() <= 1 {
+		// Block 1 does not issue any rewards
+		return nil, nil
+	}
+	preHeader, err := getPreHash(chain, header)
+	if err != nil {
+		return nil, err
+	}
+	if preHeader.EmptyBlock() {
+		return nil, nil
 	}
 	return preHeader, nil
 }
 
+// getPreHash Get the header of the last normal header
+func getPreHash(chain consensus.ChainHeaderReader, header *types.Header) (*types.Header, error) {
+	return lastNormalHeader(chain, header, maxEmptyAncestors)
+}
+
+// lastNormalHeader walks back from the parent of header to the closest normal
+// block, or block 1 which may be empty, looking at no more than limit empty
+// ancestors on the way.
+func lastNormalHeader(chain consensus.ChainHeaderReader, header *types.Header, limit int) (*types.Header, error) {
+	for i := 0; i <= limit; i++ {
+		preHeader := chain.GetHeaderByHash(header.ParentHash)
+		if preHeader == nil {
+			return nil, fmt.Errorf("getPreHash : invalid preHeader, parent of block %d not found", header.Number)
+		}
+		if preHeader.Number.Uint64() <= 1 {
+			// may be empty block
+			return preHeader, nil
+		}
+		if !preHeader.EmptyBlock() {
+			return preHeader, nil
+		}
+		header = preHeader
+	}
+	return nil, fmt.Errorf("%w: more than %d empty blocks before block %d", errTooManyEmptyAncestors, limit, header.Number)
+}
+
 func (e *Engine) PrepareEmpty(chain consensus.ChainHeaderReader, header *types.Header, validators istanbul.ValidatorSet, emptyBlockMessages [][]byte) error {
 
 	if header.Coinbase != common.HexToAddress("0x0000000000000000000000000000000000000000") {
@@ -723,7 +1052,7 @@ func (e *Engine) PrepareEmpty(chain consensus.ChainHeaderReader, header *types.H
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
-	header.Difficulty = big.NewInt(24)
+	header.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
 
 	// add validators in snapshot to extraData's validators section
 	extra, err := prepareExtra(header, validator.GetAllVotes(validators.List()), nil, nil, nil, emptyBlockMessages)
@@ -775,155 +1104,147 @@ func (e *Engine) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 	if !ok {
 		return
 	}
+	if err := e.finalizeState(c, header, state); err != nil {
+		log.Error("Engine.Finalize()", "err", err, "block number", header.Number)
+	}
+}
+
+// emptyBlockPenalized returns the validators whose coefficient the empty block
+// header lowers, those selected to seal it. Networks with fewer validators than
+// ConsensusValidatorsNum select all of them, and when nothing was selected the
+// parent's validators stand in, as long as all of them would have been picked.
+// Before the empty block penalty fork the selection is penalized as it is.
+func emptyBlockPenalized(header *types.Header, selected, validators *types.ValidatorList) ([]common.Address, error) {
+	if selected.Len() == 0 {
+		if validators.Len() == 0 || validators.Len() > types.ConsensusValidatorsNum {
+			return nil, fmt.Errorf("no validators selected for empty block %d out of %d", header.Number, validators.Len())
+		}
+		log.Warn("No validators selected for empty block, penalizing the validator set", "no", header.Number, "validators", validators.Len())
+		selected = validators
+	} else if selected.Len() < types.ConsensusValidatorsNum {
+		log.Info("Fewer validators than a full selection for empty block", "no", header.Number, "selected", selected.Len(), "want", types.ConsensusValidatorsNum)
+	}
+	penalized := make([]common.Address, 0, selected.Len())
+	for _, v := range selected.Validators {
+		penalized = append(penalized, v.Address())
+	}
+	return penalized, nil
+}
+
+// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
+// nor block rewards given, and returns the final block.
+func (e *Engine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	c, ok := chain.(*core.BlockChain)
+	if !ok {
+		return nil, nil
+	}
+	if err := e.finalizeState(c, header, state); err != nil {
+		return nil, err
+	}
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, uncles, receipts, new(trie.Trie)), nil
+}
 
+// finalizeState applies the coefficient changes and rewards of header to state
+// and sets the header root. Verifiers in Finalize and the producer in
+// FinalizeAndAssemble both go through it, so they always agree on the root: the
+// rewarded validators are recovered from the reward seals and empty block votes,
+// rather than taken from the extra data the producer filled in.
+func (e *Engine) finalizeState(c *core.BlockChain, header *types.Header, state *state.StateDB) error {
 	parent := c.GetBlockByHash(header.ParentHash)
 	if parent == nil {
-		return
+		return istanbul.ErrParent
 	}
 
 	// empty block  reduce 0.1weight and normal block add 0.5weight
 	random11Validators, err := c.Random11ValidatorWithOutProxy(parent.Header())
 	if err != nil {
-		return
+		return err
+	}
+	if random11Validators == nil {
+		random11Validators = new(types.ValidatorList)
 	}
 
 	istanbulExtra, err := types.ExtractIstanbulExtra(header)
 	if err != nil {
-		return
+		return err
 	}
 
 	parentState, err := c.StateAt(parent.Root())
 	if err != nil {
-		log.Error("Engine.Finalize()", "get parent state error", err)
-		return
+		return fmt.Errorf("get parent state: %w", err)
 	}
 	pValidators := parentState.GetValidators(types.ValidatorStorageAddress)
 	if pValidators == nil {
-		log.Error("Engine.Finalize() get parent validators error", "block number", parent.NumberU64())
-		return
+		return fmt.Errorf("get validators of parent %d", parent.NumberU64())
 	}
 
 	randomDrop, err := c.GetRandomDrop(parent.Header())
 	if err != nil {
-		log.Error("Engine.Finalize()", "get randomDrop error", err)
-		return
+		return fmt.Errorf("get randomDrop: %w", err)
 	}
 
-	if header.Coinbase == (common.Address{}) {
-		// reduce 1 weight
-		for _, v := range random11Validators.Validators {
-			state.SubValidatorCoefficient(v.Address(), 20)
-		}
-
-		voteAddrs := make([]common.Address, 0)
-		emptyMsg := new(types.EmptyMsg)
-
-		for _, emptyMessage := range istanbulExtra.EmptyBlockMessages {
-			if err := emptyMsg.FromPayload(emptyMessage); err != nil {
-				log.Error("Certify Failed to decode message from payload", "err", err)
-				continue
+	if header.EmptyBlock() {
+		// Junk messages must not carry an empty block, so the votes that
+		// check out have to reach the weighted quorum before any reward.
+		if c.Config().IsEmptyVoteQuorum(header.Number) {
+			votes, err := istanbulExtra.EmptyBlockVotes()
+			if err != nil {
+				return err
 			}
-			//var signature *types.SignatureData
-			//err = emptyMsg.Decode(&signature)
-			//if err !=nil {
-			//	log.Info("recoverMsg", "err", err)
-			//	continue
-			//}
-			sender, err := emptyMsg.RecoverAddress(emptyMessage)
-			//log.Info("recoverAddress", "msg", signature.Vote, "height", signature.Height, "sender", sender)
+			round, err := emptyVoteRound(c.Config(), header, istanbulExtra)
 			if err != nil {
-				log.Info("recover emptyMessage", "err", err)
-				continue
+				return fmt.Errorf("invalid proposer message: %w", err)
 			}
+			voters := emptyVoters(header, votes, pValidators, round)
+			if err := emptyVoteQuorum(pValidators, parentState.GetValidatorCoefficient, voters); err != nil {
+				log.Error("Engine.Finalize() empty block votes below quorum", "err", err, "block number", header.Number, "votes", len(votes), "valid", len(voters))
+				return err
+			}
+		}
 
-			for _, val := range pValidators.Validators {
-				if val.Addr == sender || val.Proxy == sender {
-					voteAddrs = append(voteAddrs, val.Addr)
-					break
-				}
+		// reduce 1 weight
+		if c.Config().IsEmptyBlockPenalty(header.Number) {
+			penalized, err := emptyBlockPenalized(header, random11Validators, pValidators)
+			if err != nil {
+				return err
+			}
+			for _, addr := range penalized {
+				state.SubValidatorCoefficient(addr, 20)
+			}
+		} else {
+			for _, v := range random11Validators.Validators {
+				state.SubValidatorCoefficient(v.Address(), 20)
 			}
 		}
 
-		for _, vote := range voteAddrs[1:] {
-			log.Info("AddValidatorCoefficient", "addr", vote)
-			state.AddValidatorCoefficient(vote, 70)
+		voteAddrs, err := EmptyBlockVoters(c.Config(), header, istanbulExtra, pValidators)
+		if err != nil {
+			return err
 		}
+		if len(voteAddrs) == 0 {
+			return types.ErrTooFewEmptyBlockMessages
+		}
+		rewardEmptyVoters(c.Config().EmptyBlockReward(header.Number), state, voteAddrs)
+
+		state.CreateNFTByOfficial16(istanbulExtra.ValidatorAddr, istanbulExtra.ExchangerAddr, header.Number, randomDrop.Bytes())
+		state.DistributeRewardsToStakers(istanbulExtra.ValidatorAddr, header.Number, c.Config().ValidatorRewardPercentage(header.Number))
 	} else {
 		// add 2 weight
 		for _, v := range istanbulExtra.ValidatorAddr {
 			state.AddValidatorCoefficient(v, 20)
 		}
-	}
 
-	if header.Coinbase == (common.Address{}) {
-		state.CreateNFTByOfficial16(istanbulExtra.ValidatorAddr, istanbulExtra.ExchangerAddr, header.Number, randomDrop.Bytes())
-		state.DistributeRewardsToStakers(istanbulExtra.ValidatorAddr, header.Number)
-	} else {
 		// pick 7 validator from rewardSeals
-		var validatorAddr []common.Address
-		if header.Number.Uint64() == 1 {
-			// Block 1 does not issue any rewards
-			validatorAddr = make([]common.Address, 0)
-		} else {
-			// quorum Size
-			quorumSize := e.QuorumSize(random11Validators.Len())
-			if quorumSize == 0 {
-				log.Error("Finalize invalid quorum size", "no", header.Number, "size", quorumSize)
-				return
-			}
-			log.Info("Finalize quorum size", "no", header.Number, "size", quorumSize)
-			// Get the header of the last normal block
-			preHeader, err := getPreHash(chain, header)
-			if !preHeader.EmptyBlock() {
-				if err != nil {
-					log.Error("Finalize get preHash err", "err", err, "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
-					return
-				}
-				log.Info("Finalize getPreHash ok", "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
-				// decode rewards
-				// preHeader + currentRewadSeal
-				rewarders, err := e.RecoverRewards(preHeader, istanbulExtra.RewardSeal)
-				if err != nil {
-					log.Error("Finalize rewarders err", "err", err.Error(), "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
-					return
-				}
-				for _, v := range rewarders {
-					log.Info("Finalize: onlineValidator", "addr", v.Hex(), "len", len(rewarders), "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
-				}
-				if len(rewarders) < quorumSize {
-					log.Error("Finalize commiters len less than 7", "preHeader", preHeader.Number, "preHash", preHeader.Hash().Hex(), "no", header.Number, "hash", header.Hash().Hex())
-					return
-				}
-				for _, v := range rewarders {
-					if len(validatorAddr) == quorumSize {
-						break
-					}
-					// reward to onlineValidtors
-					validatorAddr = append(validatorAddr, v)
-				}
-
-				if pValidators != nil && len(pValidators.Validators) > 0 {
-					//k:proxy,v:validator
-					mp := make(map[string]*types.Validator, 0)
-					for _, v := range pValidators.Validators {
-						if v.Proxy.String() != "0x0000000000000000000000000000000000000000" {
-							mp[v.Proxy.String()] = v
-						}
-					}
-					//If the reward address is on a proxy account, it will be restored to a pledge account
-					for index, a := range validatorAddr {
-						if v, ok := mp[a.String()]; ok {
-							validatorAddr[index] = v.Addr
-						}
-					}
-				}
-			}
+		validatorAddr, err := RewardedValidators(c, header, istanbulExtra, random11Validators.Len(), pValidators)
+		if err != nil {
+			return err
 		}
 
 		e.punishEvilValidators(c, state, istanbulExtra, header)
 
 		state.CreateNFTByOfficial16(validatorAddr, istanbulExtra.ExchangerAddr, header.Number, randomDrop.Bytes())
-		state.DistributeRewardsToStakers(validatorAddr, header.Number)
+		state.DistributeRewardsToStakers(validatorAddr, header.Number, c.Config().ValidatorRewardPercentage(header.Number))
 	}
 
 	// Recalculate the weight, which needs to be calculated after the list is determined
@@ -936,76 +1257,33 @@ func (e *Engine) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 	validatorStateObject.SetValidators(validatorList)
 
 	/// No block rewards in Istanbul, so the state remains as is and uncles are dropped
-	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.Root = state.IntermediateRoot(c.Config().IsEIP158(header.Number))
 	header.UncleHash = nilUncleHash
-
+	return nil
 }
 
-// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
-// nor block rewards given, and returns the final block.
-func (e *Engine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
-	// Prepare reward address
-	istanbulExtra, err := types.ExtractIstanbulExtra(header)
-	if err != nil {
-		return nil, err
-	}
-
-	c, ok := chain.(*core.BlockChain)
-	if !ok {
-		return nil, nil
-	}
-
-	parent := c.GetBlockByHash(header.ParentHash)
-	if parent == nil {
-		return nil, istanbul.ErrParent
+// rewardEmptyVoters raises the coefficient of the validators whose votes carry
+// an empty block, the leader's vote coming first. Without a reward the leader
+// is left out and every other voter gets the maximum coefficient.
+func rewardEmptyVoters(reward *params.EmptyBlockReward, state *state.StateDB, voters []common.Address) {
+	if len(voters) == 0 {
+		return
 	}
-
-	// empty block  reduce 0.1weight and normal block add 0.5weight
-	random11Validators, err := c.Random11ValidatorWithOutProxy(parent.Header())
-	if err != nil {
-		return nil, err
+	leader, others := voters[0], voters[1:]
+	if reward == nil {
+		for _, v := range others {
+			state.AddValidatorCoefficient(v, types.DEFAULT_VALIDATOR_COEFFICIENT)
+		}
+		return
 	}
-
-	randomDrop, err := c.GetRandomDrop(parent.Header())
-	if err != nil {
-		log.Error("Engine.Finalize()", "get randomDrop error", err)
-		return nil, err
+	if reward.Leader > 0 {
+		state.IncreaseValidatorCoefficient(leader, reward.Leader)
 	}
-
-	if header.Coinbase == (common.Address{}) {
-		for _, v := range random11Validators.Validators {
-			state.SubValidatorCoefficient(v.Address(), 20)
+	if reward.Voter > 0 {
+		for _, v := range others {
+			state.IncreaseValidatorCoefficient(v, reward.Voter)
 		}
-
-		for _, v := range istanbulExtra.Validators[1:] {
-			state.AddValidatorCoefficient(v, 70)
-		}
-	} else {
-		for _, v := range istanbulExtra.ValidatorAddr {
-			state.AddValidatorCoefficient(v, 20)
-		}
-
 	}
-
-	e.punishEvilValidators(c, state, istanbulExtra, header)
-
-	state.CreateNFTByOfficial16(istanbulExtra.ValidatorAddr, istanbulExtra.ExchangerAddr, header.Number, randomDrop.Bytes())
-	state.DistributeRewardsToStakers(istanbulExtra.ValidatorAddr, header.Number)
-	// Recalculate the weight, which needs to be calculated after the list is determined
-	validatorStateObject := state.GetOrNewStakerStateObject(types.ValidatorStorageAddress)
-	validatorList := validatorStateObject.GetValidators().DeepCopy()
-	for _, account := range validatorList.Validators {
-		coefficient := state.GetValidatorCoefficient(account.Addr)
-		validatorList.CalculateAddressRangeV2(account.Addr, account.Balance, big.NewInt(int64(coefficient)))
-	}
-	validatorStateObject.SetValidators(validatorList)
-
-	/// No block rewards in Istanbul, so the state remains as is and uncles are dropped
-	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
-	header.UncleHash = nilUncleHash
-
-	// Assemble and return the final block for sealing
-	return types.NewBlock(header, txs, uncles, receipts, new(trie.Trie)), nil
 }
 
 // @dev Punish the verifier who signs more
@@ -1042,7 +1320,7 @@ func (e *Engine) punishEvilValidators(bc *core.BlockChain, state *state.StateDB,
 		log.Info("final punishEvilValidators", "addr", evilAddr, "curNo", header.Number.Uint64())
 	}
 
-	state.PunishEvilValidators(noProxyValidators, header.Number)
+	state.PunishEvilValidators(noProxyValidators, header.Number, bc.Config().EvilPenalties(header.Number))
 }
 
 // @dev pickEvilValidators pick out  evil validators
@@ -1073,7 +1351,7 @@ func (e *Engine) pickEvilValidatorsV2(bc *core.BlockChain, ea *types.EvilAction)
 		return totalSigners
 	}
 
-	if canonicalHeader.Coinbase != (common.Address{}) {
+	if !canonicalHeader.EmptyBlock() {
 		canonicalSigners, err := e.Signers(canonicalHeader)
 		if err != nil {
 			log.Error("failed to recover block signers", "height", canonicalNo)
@@ -1128,7 +1406,7 @@ func (e *Engine) Seal(chain consensus.ChainHeaderReader, block *types.Block, val
 	header := block.Header()
 	number := header.Number.Uint64()
 
-	if header.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && header.Number.Cmp(common.Big0) > 0 {
+	if header.EmptyBlock() {
 		parent := chain.GetHeader(header.ParentHash, number-1)
 		if parent == nil {
 			return block, consensus.ErrUnknownAncestor
@@ -1228,6 +1506,11 @@ func (e *Engine) Signers(header *types.Header) ([]common.Address, error) {
 }
 
 func (e *Engine) RecoverRewards(header *types.Header, rewardSeal [][]byte) ([]common.Address, error) {
+	return recoverRewards(header, rewardSeal)
+}
+
+// recoverRewards returns the signers of the reward seals over header.
+func recoverRewards(header *types.Header, rewardSeal [][]byte) ([]common.Address, error) {
 	// extra, err := types.ExtractIstanbulExtra(header)
 	// if err != nil {
 	// 	return []common.Address{}, err
@@ -1336,6 +1619,15 @@ func BytesToInt(bys []byte) int {
 	return int(data)
 }
 
-func (e *Engine) QuorumSize(valSize int) int {
-	return 2*(int(math.Ceil(float64(valSize)/3))-1) + 1
+func (e *Engine) QuorumSize(config *params.ChainConfig, valSize int) int {
+	return QuorumSize(config, valSize)
+}
+
+// QuorumSize returns the number of committed seals a block needs when valSize
+// validators were selected for its height, under the quorum of config.
+func QuorumSize(config *params.ChainConfig, valSize int) int {
+	if config == nil {
+		return (*params.IstanbulConfig)(nil).QuorumSize(valSize)
+	}
+	return config.Istanbul.QuorumSize(valSize)
 }
@@ -2,14 +2,29 @@ package ibftengine
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	istanbulcommon "github.com/ethereum/go-ethereum/consensus/istanbul/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -140,3 +155,1183 @@ func TestWriteCommittedSeals(t *testing.T) {
 		t.Errorf("error mismatch: have %v, want %v", err, istanbulcommon.ErrInvalidCommittedSeals)
 	}
 }
+
+// testHeaderChain is a minimal consensus.ChainHeaderReader backed by a header slice.
+type testHeaderChain []*types.Header
+
+func (hc testHeaderChain) Config() *params.ChainConfig  { return params.TestChainConfig }
+func (hc testHeaderChain) CurrentHeader() *types.Header { return hc[len(hc)-1] }
+func (hc testHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number >= uint64(len(hc)) {
+		return nil
+	}
+	return hc[number]
+}
+func (hc testHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if h := hc.GetHeaderByNumber(number); h != nil && h.Hash() == hash {
+		return h
+	}
+	return nil
+}
+func (hc testHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, h := range hc {
+		if h.Hash() == hash {
+			return h
+		}
+	}
+	return nil
+}
+
+// push appends a header carrying the given evil action in its extra-data.
+func (hc testHeaderChain) push(t *testing.T, ea *types.EvilAction) testHeaderChain {
+	header := &types.Header{Number: big.NewInt(int64(len(hc)))}
+	if len(hc) > 0 {
+		header.ParentHash = hc.CurrentHeader().Hash()
+	}
+	extra, err := prepareExtraAdvanced(header, WithEvilAction(ea))
+	if err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+	header.Extra = extra
+	return append(hc, header)
+}
+
+// testEvilActions is an in-memory evilActionReader.
+type testEvilActions map[uint64]*types.EvilAction
+
+func (ta testEvilActions) ReadEvilAction(no uint64) (*types.EvilAction, error) {
+	if ea, ok := ta[no]; ok {
+		cpy := *ea
+		return &cpy, nil
+	}
+	return nil, nil
+}
+
+func TestPendingEvilAction(t *testing.T) {
+	evil := func(no uint64) *types.EvilAction {
+		return types.NewEvilAction(&types.Header{Number: new(big.Int).SetUint64(no)})
+	}
+	chain := testHeaderChain{}
+	for i := 0; i < 20; i++ {
+		chain = chain.push(t, nil)
+	}
+	parent := chain.CurrentHeader()
+	number := parent.Number.Uint64() + 1
+	late := number - staleThreshold - 1
+
+	// Recorded one block after the fixed offset had already passed it
+	actions := testEvilActions{late: evil(late)}
+
+	fixed := NewEngine(&istanbul.Config{}, common.Address{}, nil, nil)
+	if ea := fixed.pendingEvilAction(chain, actions, parent, number); ea != nil {
+		t.Fatalf("zero lookback picked up late evil action %d", ea.EvilHeaders[0].Number)
+	}
+	windowed := NewEngine(&istanbul.Config{EvilActionLookback: 3}, common.Address{}, nil, nil)
+	ea := windowed.pendingEvilAction(chain, actions, parent, number)
+	if ea == nil || ea.EvilHeaders[0].Number.Uint64() != late {
+		t.Fatalf("late evil action not punished: have %v, want %d", ea, late)
+	}
+	if !ea.Handled {
+		t.Errorf("returned evil action not marked handled")
+	}
+
+	// Once an ancestor carries it, the next block must not punish it again
+	chain = chain.push(t, ea)
+	if ea := windowed.pendingEvilAction(chain, actions, chain.CurrentHeader(), number+1); ea != nil {
+		t.Errorf("evil action %d punished twice", ea.EvilHeaders[0].Number)
+	}
+
+	// Handled actions and those outside the window are skipped
+	actions = testEvilActions{
+		late - 3: evil(late - 3),
+		late:     &types.EvilAction{Handled: true, EvilHeaders: evil(late).EvilHeaders},
+	}
+	if ea := windowed.pendingEvilAction(chain, actions, parent, number); ea != nil {
+		t.Errorf("picked up evil action %d outside the window", ea.EvilHeaders[0].Number)
+	}
+}
+
+func TestVerifyEmptyVote(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	vote := func(height int64) []byte {
+		data, err := rlp.EncodeToBytes(&types.SignatureData{Vote: signer, Height: big.NewInt(height)})
+		if err != nil {
+			t.Fatalf("failed to encode vote: %v", err)
+		}
+		msg := &types.EmptyMsg{Msg: data, Address: signer}
+		noSig, err := msg.PayloadNoSig()
+		if err != nil {
+			t.Fatalf("failed to encode message: %v", err)
+		}
+		if msg.Signature, err = crypto.Sign(crypto.Keccak256(noSig), key); err != nil {
+			t.Fatalf("failed to sign message: %v", err)
+		}
+		payload, err := msg.Payload()
+		if err != nil {
+			t.Fatalf("failed to encode message: %v", err)
+		}
+		return payload
+	}
+	header := &types.Header{Number: big.NewInt(10)}
+
+	sender, match, err := VerifyEmptyVote(header, vote(10))
+	if err != nil {
+		t.Fatalf("valid vote rejected: %v", err)
+	}
+	if sender != signer || !match {
+		t.Errorf("valid vote mismatch: have (%x, %v), want (%x, true)", sender, match, signer)
+	}
+
+	sender, match, err = VerifyEmptyVote(header, vote(9))
+	if err != nil {
+		t.Fatalf("stale vote rejected: %v", err)
+	}
+	if sender != signer || match {
+		t.Errorf("stale vote mismatch: have (%x, %v), want (%x, false)", sender, match, signer)
+	}
+
+	if _, _, err := VerifyEmptyVote(header, []byte{0x01, 0x02}); err == nil {
+		t.Errorf("malformed vote accepted")
+	}
+}
+
+func TestVerifyEmptyVoteTooFewMessages(t *testing.T) {
+	engine := &Engine{}
+	for _, n := range []int{0, 1, 2} {
+		msgs := make([][]byte, n)
+		for i := range msgs {
+			msgs[i] = []byte{byte(i)}
+		}
+		payload, err := rlp.EncodeToBytes(&types.IstanbulExtra{EmptyBlockMessages: msgs})
+		if err != nil {
+			t.Fatalf("failed to encode extra: %v", err)
+		}
+		header := &types.Header{
+			Number: big.NewInt(10),
+			Extra:  append(make([]byte, types.IstanbulExtraVanity), payload...),
+		}
+		err = engine.verifyEmptyVote(nil, header, nil, nil)
+		if n < 2 && err != types.ErrTooFewEmptyBlockMessages {
+			t.Errorf("%d messages: error mismatch: have %v, want %v", n, err, types.ErrTooFewEmptyBlockMessages)
+		}
+		if n >= 2 && err == types.ErrTooFewEmptyBlockMessages {
+			t.Errorf("%d messages: rejected as too few", n)
+		}
+	}
+}
+
+func TestRewardValidators(t *testing.T) {
+	engine := &Engine{}
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	// The second and third signers are proxies of their validators
+	validators := types.NewValidatorList(nil)
+	owners := make([]common.Address, len(keys))
+	for i, key := range keys {
+		signer := crypto.PubkeyToAddress(key.PublicKey)
+		owners[i] = signer
+		proxy := common.Address{}
+		if i == 1 || i == 2 {
+			owners[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+			proxy = signer
+		}
+		validators.AddValidator(owners[i], big.NewInt(1), proxy)
+	}
+
+	preHeader := &types.Header{Number: big.NewInt(5), MixDigest: types.IstanbulDigest}
+	extra, err := prepareExtraAdvanced(preHeader)
+	if err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+	preHeader.Extra = extra
+	hash := preHeader.Hash()
+	seals := make([][]byte, len(keys))
+	for i, key := range keys {
+		if seals[i], err = crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(hash)), key); err != nil {
+			t.Fatalf("failed to sign committed seal: %v", err)
+		}
+	}
+	if err := writeCommittedSeals(preHeader, seals); err != nil {
+		t.Fatalf("failed to write committed seals: %v", err)
+	}
+
+	// Prepare rewards the committers of the previous block
+	committers, err := engine.Signers(preHeader)
+	if err != nil {
+		t.Fatalf("failed to recover committers: %v", err)
+	}
+	prepared := rewardValidators(committers, 3, validators)
+
+	// Finalize recovers them from the reward seals copied into the block
+	rewardSeals, err := engine.copyCommitSeals(preHeader)
+	if err != nil {
+		t.Fatalf("failed to copy committed seals: %v", err)
+	}
+	rewarders, err := engine.RecoverRewards(preHeader, rewardSeals)
+	if err != nil {
+		t.Fatalf("failed to recover rewarders: %v", err)
+	}
+	finalized := rewardValidators(rewarders, 3, validators)
+
+	if !reflect.DeepEqual(prepared, owners[:3]) {
+		t.Errorf("prepared rewards mismatch: have %x, want %x", prepared, owners[:3])
+	}
+	if !reflect.DeepEqual(finalized, prepared) {
+		t.Errorf("finalized rewards mismatch: have %x, want %x", finalized, prepared)
+	}
+}
+
+func TestRewardHeader(t *testing.T) {
+	engine := &Engine{}
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	// makeChain builds a chain on top of genesis from the given block kinds,
+	// 'N' for a normal block committed by keys[number] and 'E' for an empty one.
+	makeChain := func(kinds string) testHeaderChain {
+		hc := testHeaderChain{{Number: big.NewInt(0), Difficulty: big.NewInt(1)}}
+		for i, kind := range kinds {
+			number := int64(i + 1)
+			header := &types.Header{
+				ParentHash: hc.CurrentHeader().Hash(),
+				Number:     big.NewInt(number),
+				MixDigest:  types.IstanbulDigest,
+				Difficulty: big.NewInt(1),
+				Coinbase:   crypto.PubkeyToAddress(keys[number].PublicKey),
+			}
+			if kind == 'E' {
+				header.Coinbase = common.Address{}
+				header.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+			}
+			extra, err := prepareExtraAdvanced(header)
+			if err != nil {
+				t.Fatalf("failed to prepare extra: %v", err)
+			}
+			header.Extra = extra
+			if kind == 'N' {
+				seal, err := crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(header.Hash())), keys[number])
+				if err != nil {
+					t.Fatalf("failed to sign committed seal: %v", err)
+				}
+				if err := writeCommittedSeals(header, [][]byte{seal}); err != nil {
+					t.Fatalf("failed to write committed seals: %v", err)
+				}
+			}
+			hc = append(hc, header)
+		}
+		return hc
+	}
+	tests := []struct {
+		kinds   string
+		rewards []int64 // rewarded block for blocks 1..3, 0 if none
+	}{
+		{"NNN", []int64{0, 1, 2}},
+		{"ENN", []int64{0, 0, 2}},
+		{"NEN", []int64{0, 1, 1}},
+		{"EEN", []int64{0, 0, 0}},
+		{"NEE", []int64{0, 1, 1}},
+	}
+	for _, tt := range tests {
+		hc := makeChain(tt.kinds)
+		for i, want := range tt.rewards {
+			header := hc[i+1]
+			preHeader, err := rewardHeader(hc, header)
+			if err != nil {
+				t.Fatalf("%s block %d: failed to get reward header: %v", tt.kinds, i+1, err)
+			}
+			if want == 0 {
+				if preHeader != nil {
+					t.Errorf("%s block %d: unexpected reward of block %d", tt.kinds, i+1, preHeader.Number)
+				}
+				continue
+			}
+			if preHeader == nil || preHeader.Number.Int64() != want {
+				t.Errorf("%s block %d: reward header mismatch: have %v, want %d", tt.kinds, i+1, preHeader, want)
+				continue
+			}
+			committers, err := engine.Signers(preHeader)
+			if err != nil {
+				t.Fatalf("%s block %d: failed to recover committers: %v", tt.kinds, i+1, err)
+			}
+			rewarded := rewardValidators(committers, 1, nil)
+			if exp := []common.Address{crypto.PubkeyToAddress(keys[want].PublicKey)}; !reflect.DeepEqual(rewarded, exp) {
+				t.Errorf("%s block %d: rewarders mismatch: have %x, want %x", tt.kinds, i+1, rewarded, exp)
+			}
+		}
+	}
+}
+
+func TestEmptyVoteQuorum(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	// The first four keys are validators with equal stake, the last one isn't.
+	validators := types.NewValidatorList(nil)
+	for _, key := range keys[:4] {
+		validators.AddValidator(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(100), common.Address{})
+	}
+	vote := func(key *ecdsa.PrivateKey, height int64) []byte {
+		signer := crypto.PubkeyToAddress(key.PublicKey)
+		data, err := rlp.EncodeToBytes(&types.SignatureData{Vote: signer, Height: big.NewInt(height)})
+		if err != nil {
+			t.Fatalf("failed to encode vote: %v", err)
+		}
+		msg := &types.EmptyMsg{Msg: data, Address: signer}
+		noSig, err := msg.PayloadNoSig()
+		if err != nil {
+			t.Fatalf("failed to encode message: %v", err)
+		}
+		if msg.Signature, err = crypto.Sign(crypto.Keccak256(noSig), key); err != nil {
+			t.Fatalf("failed to sign message: %v", err)
+		}
+		payload, err := msg.Payload()
+		if err != nil {
+			t.Fatalf("failed to encode message: %v", err)
+		}
+		return payload
+	}
+	coefficient := func(common.Address) uint8 { return types.DEFAULT_VALIDATOR_COEFFICIENT }
+	header := &types.Header{Number: big.NewInt(10)}
+	junk := [][]byte{{0x01, 0x02}, vote(keys[2], 9), vote(keys[4], 10)}
+
+	tests := []struct {
+		votes  [][]byte
+		voters int
+		ok     bool
+	}{
+		// Three of four validators carry the quorum, junk or not
+		{[][]byte{vote(keys[0], 10), vote(keys[1], 10), vote(keys[2], 10)}, 3, true},
+		{append([][]byte{vote(keys[0], 10), vote(keys[1], 10), vote(keys[3], 10)}, junk...), 3, true},
+		// Half of the stake padded with junk and duplicates doesn't
+		{append([][]byte{vote(keys[0], 10), vote(keys[1], 10), vote(keys[1], 10)}, junk...), 2, false},
+		{junk, 0, false},
+	}
+	for i, tt := range tests {
+		voters := emptyVoters(header, tt.votes, validators, nil)
+		if len(voters) != tt.voters {
+			t.Errorf("test %d: voter count mismatch: have %d, want %d", i, len(voters), tt.voters)
+		}
+		if err := emptyVoteQuorum(validators, coefficient, voters); (err == nil) != tt.ok {
+			t.Errorf("test %d: quorum mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+	}
+}
+
+// hashedHeaderChain is a testHeaderChain with constant time hash lookups, for
+// chains too long to scan on every lookup.
+type hashedHeaderChain struct {
+	testHeaderChain
+	byHash map[common.Hash]*types.Header
+}
+
+func (hc hashedHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return hc.byHash[hash]
+}
+
+func TestGetPreHashLongEmptyRun(t *testing.T) {
+	// Build genesis, two normal blocks and a long run of empty blocks
+	const empties = 5000
+	hc := hashedHeaderChain{
+		testHeaderChain: testHeaderChain{{Number: big.NewInt(0), Difficulty: big.NewInt(1)}},
+		byHash:          make(map[common.Hash]*types.Header),
+	}
+	hc.byHash[hc.CurrentHeader().Hash()] = hc.CurrentHeader()
+	for i := 1; i <= 2+empties; i++ {
+		header := &types.Header{
+			ParentHash: hc.CurrentHeader().Hash(),
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(1),
+			Coinbase:   common.Address{0x01},
+		}
+		if i > 2 {
+			header.Coinbase = common.Address{}
+			header.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+		}
+		hc.testHeaderChain = append(hc.testHeaderChain, header)
+		hc.byHash[header.Hash()] = header
+	}
+	head := hc.CurrentHeader()
+
+	preHeader, err := getPreHash(hc, head)
+	if err != nil {
+		t.Fatalf("failed to get last normal header: %v", err)
+	}
+	if preHeader.Number.Uint64() != 2 {
+		t.Fatalf("last normal header mismatch: have %d, want 2", preHeader.Number)
+	}
+	// Walking back over more empty blocks than allowed fails explicitly
+	if _, err := lastNormalHeader(hc, head, empties-2); !errors.Is(err, errTooManyEmptyAncestors) {
+		t.Fatalf("error mismatch: have %v, want %v", err, errTooManyEmptyAncestors)
+	}
+	if _, err := lastNormalHeader(hc, head, empties-1); err != nil {
+		t.Fatalf("failed to get last normal header at the limit: %v", err)
+	}
+	// A missing ancestor is reported instead of dereferenced
+	delete(hc.byHash, hc.testHeaderChain[100].Hash())
+	if _, err := getPreHash(hc, head); err == nil {
+		t.Fatal("expected error for missing ancestor")
+	}
+}
+
+func TestVerifySignerRemovedValidator(t *testing.T) {
+	engine := &Engine{}
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addrs := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	sealed := func(key *ecdsa.PrivateKey) *types.Header {
+		header := &types.Header{Number: big.NewInt(10), Coinbase: crypto.PubkeyToAddress(key.PublicKey), Difficulty: big.NewInt(1)}
+		extra, err := prepareExtraAdvanced(header)
+		if err != nil {
+			t.Fatalf("failed to prepare extra: %v", err)
+		}
+		header.Extra = extra
+		seal, err := crypto.Sign(crypto.Keccak256(sigHash(header).Bytes()), key)
+		if err != nil {
+			t.Fatalf("failed to seal header: %v", err)
+		}
+		if err := writeSeal(header, seal); err != nil {
+			t.Fatalf("failed to write seal: %v", err)
+		}
+		return header
+	}
+	policy := istanbul.NewRoundRobinProposerPolicy()
+	before := validator.NewEmptySet(addrs, policy)
+	after := validator.NewEmptySet(addrs[1:], policy)
+
+	if err := engine.verifySigner(nil, sealed(keys[0]), nil, before); err != nil {
+		t.Fatalf("header of a validator rejected: %v", err)
+	}
+	count := unauthorizedSignerCounter.Count()
+	if err := engine.verifySigner(nil, sealed(keys[0]), nil, after); !errors.Is(err, istanbulcommon.ErrUnauthorized) {
+		t.Fatalf("error mismatch: have %v, want %v", err, istanbulcommon.ErrUnauthorized)
+	}
+	if have := unauthorizedSignerCounter.Count(); have != count+1 {
+		t.Errorf("unauthorized count mismatch: have %d, want %d", have, count+1)
+	}
+}
+
+func TestVerifyRewardSeals(t *testing.T) {
+	engine := &Engine{}
+	keys := make([]*ecdsa.PrivateKey, 5)
+	committee := make([]common.Address, len(keys)-1)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		if i < len(committee) {
+			committee[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+		}
+	}
+	outsider := keys[len(keys)-1]
+
+	// The previous normal block committed by the first three of its committee
+	genesis := &types.Header{Number: big.NewInt(0)}
+	block1 := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash()}
+	preHeader := &types.Header{Number: big.NewInt(2), ParentHash: block1.Hash(), MixDigest: types.IstanbulDigest}
+	extra, err := prepareExtraAdvanced(preHeader, withValidators(committee))
+	if err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+	preHeader.Extra = extra
+	seal := func(key *ecdsa.PrivateKey, hash common.Hash) []byte {
+		sig, err := crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(hash)), key)
+		if err != nil {
+			t.Fatalf("failed to sign committed seal: %v", err)
+		}
+		return sig
+	}
+	hash := preHeader.Hash()
+	if err := writeCommittedSeals(preHeader, [][]byte{seal(keys[0], hash), seal(keys[1], hash), seal(keys[2], hash)}); err != nil {
+		t.Fatalf("failed to write committed seals: %v", err)
+	}
+	copied, err := engine.copyCommitSeals(preHeader)
+	if err != nil {
+		t.Fatalf("failed to copy committed seals: %v", err)
+	}
+	config := *params.TestChainConfig
+	config.RewardSealsBlock = big.NewInt(3)
+	chain := configHeaderChain{testHeaderChain{genesis, block1, preHeader}, &config}
+	batch := configHeaderChain{testHeaderChain{genesis, block1}, &config}
+
+	tests := []struct {
+		name  string
+		seals [][]byte
+		err   error
+	}{
+		{"copied", copied, nil},
+		{"other committer", [][]byte{seal(keys[3], hash)}, nil},
+		{"outsider", append(copied, seal(outsider, hash)), errInvalidRewardSeals},
+		{"unrelated block", [][]byte{seal(keys[0], block1.Hash())}, errInvalidRewardSeals},
+		{"duplicated", append(copied, copied[0]), errInvalidRewardSeals},
+	}
+	for _, tt := range tests {
+		header := &types.Header{Number: big.NewInt(3), ParentHash: preHeader.Hash()}
+		extra, err := prepareExtraAdvanced(header, WithRewardSeal(tt.seals))
+		if err != nil {
+			t.Fatalf("%s: failed to prepare extra: %v", tt.name, err)
+		}
+		header.Extra = extra
+		if err := engine.verifyRewardSeals(chain, header, nil); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+		// Blocks of a batch resolve the previous normal block among their parents
+		if err := engine.verifyRewardSeals(batch, header, []*types.Header{preHeader}); !errors.Is(err, tt.err) {
+			t.Errorf("%s: batch error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+		// Before the fork any reward seals are accepted
+		if err := engine.verifyRewardSeals(chain.testHeaderChain, header, nil); err != nil {
+			t.Errorf("%s: pre-fork error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestRewardedValidators(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	committee := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		committee[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	genesis := &types.Header{Number: big.NewInt(0)}
+	block1 := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash()}
+	preHeader := &types.Header{Number: big.NewInt(2), ParentHash: block1.Hash(), MixDigest: types.IstanbulDigest}
+	extra, err := prepareExtraAdvanced(preHeader, withValidators(committee))
+	if err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+	preHeader.Extra = extra
+	empty := &types.Header{Number: big.NewInt(3), ParentHash: preHeader.Hash(), Difficulty: new(big.Int).Set(types.EmptyBlockDifficulty)}
+	chain := testHeaderChain{genesis, block1, preHeader, empty}
+
+	hash := preHeader.Hash()
+	seals := make([][]byte, len(keys))
+	for i, key := range keys {
+		seals[i], err = crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(hash)), key)
+		if err != nil {
+			t.Fatalf("failed to sign committed seal: %v", err)
+		}
+	}
+	// The second committer signs through a proxy of the pool
+	pool := types.NewValidatorList(nil)
+	for i, addr := range committee {
+		proxy := common.Address{}
+		if i == 1 {
+			proxy, addr = addr, common.BytesToAddress([]byte{0x01})
+		}
+		pool.AddValidator(addr, big.NewInt(1), proxy)
+	}
+	rewardedHeader := func(number int64, parent *types.Header, seals [][]byte) (*types.Header, *types.IstanbulExtra) {
+		header := &types.Header{Number: big.NewInt(number), ParentHash: parent.Hash()}
+		extra, err := prepareExtraAdvanced(header, WithRewardSeal(seals))
+		if err != nil {
+			t.Fatalf("failed to prepare extra: %v", err)
+		}
+		header.Extra = extra
+		istanbulExtra, err := types.ExtractIstanbulExtra(header)
+		if err != nil {
+			t.Fatalf("failed to extract extra: %v", err)
+		}
+		return header, istanbulExtra
+	}
+
+	// All four seals, cut to the quorum of three with the proxy mapped back
+	header, rewardExtra := rewardedHeader(3, preHeader, seals)
+	rewarded, err := RewardedValidators(chain, header, rewardExtra, len(keys), pool)
+	if err != nil {
+		t.Fatalf("failed to get the rewarded validators: %v", err)
+	}
+	want := []common.Address{committee[0], common.BytesToAddress([]byte{0x01}), committee[2]}
+	if !reflect.DeepEqual(rewarded, want) {
+		t.Errorf("rewarded validators mismatch: have %v, want %v", rewarded, want)
+	}
+	// Less seals than the quorum
+	header, rewardExtra = rewardedHeader(3, preHeader, seals[:2])
+	if _, err := RewardedValidators(chain, header, rewardExtra, len(keys), pool); err == nil {
+		t.Errorf("rewarded validators below the quorum accepted")
+	}
+	// Empty blocks are skipped over to the previous normal block
+	header, rewardExtra = rewardedHeader(4, empty, seals)
+	rewarded, err = RewardedValidators(chain, header, rewardExtra, len(keys), pool)
+	if err != nil {
+		t.Fatalf("failed to get the rewarded validators after an empty block: %v", err)
+	}
+	if !reflect.DeepEqual(rewarded, want) {
+		t.Errorf("rewarded validators after an empty block mismatch: have %v, want %v", rewarded, want)
+	}
+	// No one is rewarded after an empty block 1
+	emptyBlock1 := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), Difficulty: new(big.Int).Set(types.EmptyBlockDifficulty)}
+	header, rewardExtra = rewardedHeader(2, emptyBlock1, seals)
+	if rewarded, err := RewardedValidators(append(chain, emptyBlock1), header, rewardExtra, len(keys), pool); err != nil || rewarded != nil {
+		t.Errorf("block after an empty block 1 rewarded: have %v, %v, want nil", rewarded, err)
+	}
+}
+
+// signEmptyVote returns the empty block vote message of vote signed by key.
+func signEmptyVote(t *testing.T, key *ecdsa.PrivateKey, vote *types.SignatureData) []byte {
+	data, err := rlp.EncodeToBytes(vote)
+	if err != nil {
+		t.Fatalf("failed to encode vote: %v", err)
+	}
+	msg := &types.EmptyMsg{Msg: data, Address: crypto.PubkeyToAddress(key.PublicKey)}
+	noSig, err := msg.PayloadNoSig()
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	if msg.Signature, err = crypto.Sign(crypto.Keccak256(noSig), key); err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+	payload, err := msg.Payload()
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	return payload
+}
+
+func TestEmptyVotersRound(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	validators := types.NewValidatorList(nil)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		validators.AddValidator(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(100), common.Address{})
+	}
+	collector := crypto.PubkeyToAddress(keys[0].PublicKey)
+	vote := func(key *ecdsa.PrivateKey, to common.Address, round uint64) []byte {
+		return signEmptyVote(t, key, &types.SignatureData{Vote: to, Height: big.NewInt(10), Round: round})
+	}
+	header := &types.Header{Number: big.NewInt(10)}
+	extra := &types.IstanbulExtra{EmptyBlockMessages: [][]byte{
+		vote(keys[0], collector, 3),
+		vote(keys[1], collector, 3),
+		vote(keys[2], collector, 2),                                 // replayed from the previous round
+		vote(keys[3], crypto.PubkeyToAddress(keys[1].PublicKey), 3), // cast for another collector
+	}}
+	votes, err := extra.EmptyBlockVotes()
+	if err != nil {
+		t.Fatalf("failed to get votes: %v", err)
+	}
+
+	// Before the fork votes of every round count
+	round, err := emptyVoteRound(params.TestChainConfig, header, extra)
+	if err != nil || round != nil {
+		t.Fatalf("round before the fork: have %v, %v, want nil", round, err)
+	}
+	if voters := emptyVoters(header, votes, validators, round); len(voters) != 3 {
+		t.Errorf("voter count before the fork mismatch: have %d, want 3", len(voters))
+	}
+	config := *params.TestChainConfig
+	config.EmptyVoteRoundBlock = big.NewInt(10)
+	if round, err = emptyVoteRound(&config, header, extra); err != nil || round == nil || round.Round != 3 {
+		t.Fatalf("round after the fork: have %v, %v, want 3", round, err)
+	}
+	voters := emptyVoters(header, votes, validators, round)
+	if want := []common.Address{crypto.PubkeyToAddress(keys[1].PublicKey)}; !reflect.DeepEqual(voters, want) {
+		t.Errorf("voters after the fork mismatch: have %x, want %x", voters, want)
+	}
+	if err := types.CheckEmptyVoteRound(round, votes[1]); !errors.Is(err, types.ErrEmptyVoteRound) {
+		t.Errorf("replayed vote error mismatch: have %v, want %v", err, types.ErrEmptyVoteRound)
+	}
+}
+
+func TestRewardEmptyVoters(t *testing.T) {
+	var (
+		leader = common.Address{0x01}
+		voters = []common.Address{leader, {0x02}, {0x03}}
+	)
+	newState := func() *state.StateDB {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		for _, v := range voters {
+			statedb.AddValidatorCoefficient(v, types.DEFAULT_VALIDATOR_COEFFICIENT)
+			statedb.SubValidatorCoefficient(v, 40)
+		}
+		return statedb
+	}
+	tests := []struct {
+		reward *params.EmptyBlockReward
+		voters []common.Address
+		want   []uint8
+	}{
+		// Legacy: the leader is left out, the other voters get the maximum
+		{nil, voters, []uint8{30, 70, 70}},
+		{&params.EmptyBlockReward{Voter: 10}, voters, []uint8{30, 40, 40}},
+		{&params.EmptyBlockReward{Leader: 5, Voter: 50}, voters, []uint8{35, 70, 70}},
+		// A single vote is the leader's own
+		{nil, voters[:1], []uint8{30, 30, 30}},
+		{&params.EmptyBlockReward{Leader: 5, Voter: 10}, voters[:1], []uint8{35, 30, 30}},
+	}
+	for i, tt := range tests {
+		statedb := newState()
+		rewardEmptyVoters(tt.reward, statedb, tt.voters)
+		for j, v := range voters {
+			if have := statedb.GetValidatorCoefficient(v); have != tt.want[j] {
+				t.Errorf("test %d, validator %x: coefficient mismatch: have %d, want %d", i, v, have, tt.want[j])
+			}
+		}
+	}
+}
+
+func TestFinalizeMatchesFinalizeAndAssemble(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	proxyKey, _ := crypto.GenerateKey()
+	proxy := crypto.PubkeyToAddress(proxyKey.PublicKey)
+
+	genesis := &core.Genesis{
+		Config:    params.TestChainConfig,
+		GasLimit:  params.GenesisGasLimit,
+		Alloc:     core.GenesisAlloc{},
+		Stake:     core.GenesisAlloc{common.HexToAddress("0x1000000000000000000000000000000000000001"): {Balance: types.StakerBase()}},
+		Validator: core.GenesisAlloc{},
+	}
+	for i, key := range keys {
+		account := core.GenesisAccount{Balance: types.ValidatorBase()}
+		if i == len(keys)-1 {
+			account.Proxy = proxy.Hex()
+		}
+		genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+		genesis.Validator[crypto.PubkeyToAddress(key.PublicKey)] = account
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesisBlock := genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// An empty block carried by every validator, the last one voting through its proxy
+	leader := crypto.PubkeyToAddress(keys[0].PublicKey)
+	signers := append(keys[:len(keys)-1:len(keys)-1], proxyKey)
+	var (
+		messages [][]byte
+		votes    []common.Address
+	)
+	for _, key := range signers {
+		messages = append(messages, signEmptyVote(t, key, &types.SignatureData{Vote: leader, Height: big.NewInt(1)}))
+		votes = append(votes, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	header := &types.Header{
+		ParentHash: genesisBlock.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   genesisBlock.GasLimit(),
+		Difficulty: new(big.Int).Set(types.EmptyBlockDifficulty),
+		Time:       genesisBlock.Time() + 1,
+	}
+	if header.Extra, err = prepareExtra(header, votes, nil, nil, nil, messages); err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+
+	engine := NewEngine(nil, common.Address{}, nil, nil)
+	verified, assembled := types.CopyHeader(header), types.CopyHeader(header)
+	verifierState, _ := state.New(genesisBlock.Root(), state.NewDatabase(db), nil)
+	engine.Finalize(chain, verified, verifierState, nil, nil)
+
+	producerState, _ := state.New(genesisBlock.Root(), state.NewDatabase(db), nil)
+	block, err := engine.FinalizeAndAssemble(chain, assembled, producerState, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	if verified.Root == genesisBlock.Root() {
+		t.Fatalf("verifier left the root unchanged")
+	}
+	if block.Root() != verified.Root {
+		t.Fatalf("root mismatch: producer %x, verifier %x", block.Root(), verified.Root)
+	}
+	// The proxy's vote rewards the validator it signs for
+	if have := producerState.GetValidatorCoefficient(crypto.PubkeyToAddress(keys[len(keys)-1].PublicKey)); have != types.DEFAULT_VALIDATOR_COEFFICIENT {
+		t.Errorf("proxied validator coefficient mismatch: have %d, want %d", have, types.DEFAULT_VALIDATOR_COEFFICIENT)
+	}
+	if have := producerState.GetValidatorCoefficient(proxy); have != 0 {
+		t.Errorf("proxy coefficient mismatch: have %d, want 0", have)
+	}
+}
+
+func TestAllowedFutureBlockTime(t *testing.T) {
+	engine := NewEngine(&istanbul.Config{AllowedFutureBlockTime: 30}, common.Address{}, nil, nil)
+	now := uint64(time.Now().Unix())
+
+	// Headers without extra data fail right after the future block check
+	tests := []struct {
+		ahead  uint64
+		future bool
+	}{
+		{0, false},
+		{20, false},
+		{60, true},
+	}
+	for _, tt := range tests {
+		header := &types.Header{Number: big.NewInt(1), Time: now + tt.ahead}
+		err := engine.verifyHeader(nil, header, nil, nil)
+		if tt.future && err != consensus.ErrFutureBlock {
+			t.Errorf("%ds ahead: have %v, want %v", tt.ahead, err, consensus.ErrFutureBlock)
+		}
+		if !tt.future && err == consensus.ErrFutureBlock {
+			t.Errorf("%ds ahead: rejected as a future block within the allowance", tt.ahead)
+		}
+	}
+}
+
+func TestVerifyHeaderEmptyBlockDifficulty(t *testing.T) {
+	engine := NewEngine(&istanbul.Config{}, common.Address{}, nil, nil)
+	signer := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	// Headers whose coinbase and difficulty disagree on being empty
+	tests := []struct {
+		coinbase   common.Address
+		difficulty *big.Int
+	}{
+		{common.Address{}, big.NewInt(1)},
+		{common.Address{}, nil},
+		{signer, new(big.Int).Set(types.EmptyBlockDifficulty)},
+	}
+	for i, tt := range tests {
+		header := &types.Header{
+			Number:     big.NewInt(1),
+			Coinbase:   tt.coinbase,
+			Difficulty: tt.difficulty,
+			MixDigest:  types.IstanbulDigest,
+			Nonce:      istanbulcommon.EmptyBlockNonce,
+		}
+		extra, err := prepareExtra(header, nil, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to prepare extra: %v", i, err)
+		}
+		header.Extra = extra
+		if err := engine.verifyHeader(nil, header, nil, nil); err != istanbulcommon.ErrInvalidDifficulty {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, istanbulcommon.ErrInvalidDifficulty)
+		}
+	}
+}
+
+func TestEmptyBlockVoters(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	addr := func(i int) common.Address { return crypto.PubkeyToAddress(keys[i].PublicKey) }
+
+	// Validator 1 votes through its proxy, key 3, and key 4 isn't a validator
+	validators := types.NewValidatorList(nil)
+	validators.AddValidator(addr(0), big.NewInt(100), common.Address{})
+	validators.AddValidator(addr(1), big.NewInt(100), addr(3))
+	validators.AddValidator(addr(2), big.NewInt(100), common.Address{})
+
+	vote := func(i int) []byte {
+		return signEmptyVote(t, keys[i], &types.SignatureData{Vote: addr(0), Height: big.NewInt(10)})
+	}
+	extra := &types.IstanbulExtra{EmptyBlockMessages: [][]byte{vote(0), vote(3), vote(4), {0x01}, vote(2)}}
+	want := []common.Address{addr(0), addr(1), addr(2)}
+	if have := legacyEmptyVoters(extra, validators); !reflect.DeepEqual(have, want) {
+		t.Errorf("voters mismatch: have %x, want %x", have, want)
+	}
+	if have := legacyEmptyVoters(&types.IstanbulExtra{}, validators); len(have) != 0 {
+		t.Errorf("voters of a block without votes: have %x", have)
+	}
+
+	// From the fork on a vote for another height isn't rewarded
+	header := &types.Header{Number: big.NewInt(10)}
+	stale := signEmptyVote(t, keys[2], &types.SignatureData{Vote: addr(0), Height: big.NewInt(9)})
+	extra = &types.IstanbulExtra{EmptyBlockMessages: [][]byte{vote(0), stale, vote(3)}}
+	config := *params.TestChainConfig
+	for _, tt := range []struct {
+		fork *big.Int
+		want []common.Address
+	}{
+		{nil, []common.Address{addr(0), addr(2), addr(1)}},
+		{big.NewInt(11), []common.Address{addr(0), addr(2), addr(1)}},
+		{big.NewInt(10), []common.Address{addr(0), addr(1)}},
+	} {
+		config.EmptyVoterRewardBlock = tt.fork
+		have, err := EmptyBlockVoters(&config, header, extra, validators)
+		if err != nil {
+			t.Fatalf("fork %v: failed to get voters: %v", tt.fork, err)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("fork %v: voters mismatch: have %x, want %x", tt.fork, have, tt.want)
+		}
+	}
+}
+
+func TestFinalizeSmallValidatorSet(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	config := *params.TestChainConfig
+	config.EmptyBlockPenaltyBlock = common.Big0
+	genesis := &core.Genesis{
+		Config:    &config,
+		GasLimit:  params.GenesisGasLimit,
+		Alloc:     core.GenesisAlloc{},
+		Stake:     core.GenesisAlloc{common.HexToAddress("0x1000000000000000000000000000000000000001"): {Balance: types.StakerBase()}},
+		Validator: core.GenesisAlloc{},
+	}
+	for _, key := range keys {
+		genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+		genesis.Validator[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesisBlock := genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	selected, err := chain.Random11ValidatorWithOutProxy(genesisBlock.Header())
+	if err != nil {
+		t.Fatalf("failed to select validators: %v", err)
+	}
+	if selected.Len() != len(keys) {
+		t.Fatalf("selected validators mismatch: have %d, want %d", selected.Len(), len(keys))
+	}
+
+	// An empty block voted by the whole network, the leader not being rewarded
+	// for its own vote keeps the penalty visible
+	leader := crypto.PubkeyToAddress(keys[0].PublicKey)
+	var (
+		messages [][]byte
+		votes    []common.Address
+	)
+	for _, key := range keys {
+		messages = append(messages, signEmptyVote(t, key, &types.SignatureData{Vote: leader, Height: big.NewInt(1)}))
+		votes = append(votes, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	header := &types.Header{
+		ParentHash: genesisBlock.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   genesisBlock.GasLimit(),
+		Difficulty: new(big.Int).Set(types.EmptyBlockDifficulty),
+		Time:       genesisBlock.Time() + 1,
+	}
+	if header.Extra, err = prepareExtra(header, votes, nil, nil, nil, messages); err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+	statedb, _ := state.New(genesisBlock.Root(), state.NewDatabase(db), nil)
+	before := statedb.GetValidatorCoefficient(leader)
+
+	engine := NewEngine(nil, common.Address{}, nil, nil)
+	if _, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil); err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	if have, want := statedb.GetValidatorCoefficient(leader), before-20; have != want {
+		t.Errorf("leader coefficient mismatch: have %d, want %d", have, want)
+	}
+}
+
+func TestEmptyBlockPenalized(t *testing.T) {
+	header := &types.Header{Number: big.NewInt(10)}
+	newList := func(n int) *types.ValidatorList {
+		validators := types.NewValidatorList(nil)
+		for i := 0; i < n; i++ {
+			validators.AddValidator(common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(100), common.Address{})
+		}
+		return validators
+	}
+	tests := []struct {
+		selected   *types.ValidatorList
+		validators *types.ValidatorList
+		want       int
+		fail       bool
+	}{
+		// Small selections are penalized as they are
+		{newList(3), newList(3), 3, false},
+		{newList(types.ConsensusValidatorsNum), newList(20), types.ConsensusValidatorsNum, false},
+		// The validator set stands in for an empty selection it would fill
+		{newList(0), newList(3), 3, false},
+		{newList(0), newList(types.ConsensusValidatorsNum), types.ConsensusValidatorsNum, false},
+		// A selection missing out of a large or empty set is an error
+		{newList(0), newList(20), 0, true},
+		{newList(0), newList(0), 0, true},
+	}
+	for i, tt := range tests {
+		penalized, err := emptyBlockPenalized(header, tt.selected, tt.validators)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+		if len(penalized) != tt.want {
+			t.Errorf("test %d: penalized count mismatch: have %d, want %d", i, len(penalized), tt.want)
+		}
+	}
+}
+
+// configHeaderChain is a testHeaderChain running under the given chain config.
+type configHeaderChain struct {
+	testHeaderChain
+	config *params.ChainConfig
+}
+
+func (hc configHeaderChain) Config() *params.ChainConfig { return hc.config }
+
+func TestVerifyEmptyBlockBody(t *testing.T) {
+	parent := &types.Header{Number: big.NewInt(0), Time: 100}
+	emptyBlock := func(txs types.Transactions) *types.Block {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(1),
+			Difficulty: new(big.Int).Set(types.EmptyBlockDifficulty),
+			Time:       parent.Time + 1,
+		}
+		return types.NewBlock(header, txs, nil, nil, new(trie.Trie))
+	}
+	tx := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), params.TxGas, big.NewInt(1), nil)
+	withTxs, withoutTxs := emptyBlock(types.Transactions{tx}), emptyBlock(nil)
+
+	permissive := *params.TestChainConfig
+	strict := *params.TestChainConfig
+	strict.TxFreeEmptyBlock = big.NewInt(1)
+	later := *params.TestChainConfig
+	later.TxFreeEmptyBlock = big.NewInt(2)
+
+	tests := []struct {
+		config *params.ChainConfig
+		block  *types.Block
+		want   error
+	}{
+		{&permissive, withTxs, nil},
+		{&permissive, withoutTxs, nil},
+		{&strict, withTxs, istanbulcommon.ErrEmptyBlockTransactions},
+		{&strict, withoutTxs, nil},
+		// Empty blocks before the fork keep their transactions
+		{&later, withTxs, nil},
+	}
+	engine := NewEngine(&istanbul.Config{}, common.Address{}, nil, nil)
+	for i, tt := range tests {
+		if !tt.block.Header().EmptyBlock() {
+			t.Fatalf("test %d: block not empty", i)
+		}
+		chain := configHeaderChain{testHeaderChain{parent}, tt.config}
+		if err := engine.verifyCascadingFields(chain, tt.block.Header(), nil, nil); err != tt.want {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.want)
+		}
+	}
+}
+
+func TestEmptyBlockVotersDuplicated(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	addr := func(i int) common.Address { return crypto.PubkeyToAddress(keys[i].PublicKey) }
+
+	// Validator 1 votes through its proxy, key 3
+	validators := types.NewValidatorList(nil)
+	validators.AddValidator(addr(0), big.NewInt(100), common.Address{})
+	validators.AddValidator(addr(1), big.NewInt(100), addr(3))
+	validators.AddValidator(addr(2), big.NewInt(100), common.Address{})
+
+	vote := func(i int) []byte {
+		return signEmptyVote(t, keys[i], &types.SignatureData{Vote: addr(0), Height: big.NewInt(10)})
+	}
+	// Validator 2 votes twice, validator 1 both directly and through its proxy
+	extra := &types.IstanbulExtra{EmptyBlockMessages: [][]byte{vote(0), vote(2), vote(1), vote(2), vote(3), vote(0)}}
+	legacy := []common.Address{addr(0), addr(2), addr(1), addr(2), addr(1), addr(0)}
+	if voters := legacyEmptyVoters(extra, validators); !reflect.DeepEqual(voters, legacy) {
+		t.Fatalf("legacy voters mismatch: have %x, want %x", voters, legacy)
+	}
+	config := *params.TestChainConfig
+	config.EmptyVoterRewardBlock = common.Big0
+	want := []common.Address{addr(0), addr(2), addr(1)}
+	voters, err := EmptyBlockVoters(&config, &types.Header{Number: big.NewInt(10)}, extra, validators)
+	if err != nil {
+		t.Fatalf("failed to get voters: %v", err)
+	}
+	if !reflect.DeepEqual(voters, want) {
+		t.Fatalf("voters mismatch: have %x, want %x", voters, want)
+	}
+
+	// Every voter's coefficient rises once however often it voted
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for _, v := range want {
+		statedb.AddValidatorCoefficient(v, types.DEFAULT_VALIDATOR_COEFFICIENT)
+		statedb.SubValidatorCoefficient(v, 40)
+	}
+	rewardEmptyVoters(&params.EmptyBlockReward{Leader: 5, Voter: 10}, statedb, voters)
+	for i, v := range want {
+		expected := uint8(40)
+		if i == 0 {
+			expected = 35
+		}
+		if have := statedb.GetValidatorCoefficient(v); have != expected {
+			t.Errorf("validator %x: coefficient mismatch: have %d, want %d", v, have, expected)
+		}
+	}
+}
+
+// newValidatorChain creates a chain whose genesis holds a validator of the base
+// stake for every key, returning its genesis block and a constructor of fresh
+// states at its root.
+func newValidatorChain(t *testing.T, config *params.ChainConfig, keys []*ecdsa.PrivateKey) (*core.BlockChain, *types.Block, func() *state.StateDB) {
+	genesis := &core.Genesis{
+		Config:    config,
+		GasLimit:  params.GenesisGasLimit,
+		Alloc:     core.GenesisAlloc{},
+		Stake:     core.GenesisAlloc{common.HexToAddress("0x1000000000000000000000000000000000000001"): {Balance: types.StakerBase()}},
+		Validator: core.GenesisAlloc{},
+	}
+	for _, key := range keys {
+		genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+		genesis.Validator[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesisBlock := genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	newState := func() *state.StateDB {
+		statedb, _ := state.New(genesisBlock.Root(), state.NewDatabase(db), nil)
+		return statedb
+	}
+	return chain, genesisBlock, newState
+}
+
+// newEmptyHeader creates an empty block on top of parent carrying messages.
+func newEmptyHeader(t *testing.T, parent *types.Block, messages [][]byte) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Difficulty: new(big.Int).Set(types.EmptyBlockDifficulty),
+		Time:       parent.Time() + 1,
+	}
+	var err error
+	if header.Extra, err = prepareExtra(header, nil, nil, nil, nil, messages); err != nil {
+		t.Fatalf("failed to prepare extra: %v", err)
+	}
+	return header
+}
+
+func TestFinalizeEmptyVoteQuorumFork(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	// Only the leader votes, a third of the stake
+	leader := crypto.PubkeyToAddress(keys[0].PublicKey)
+	vote := signEmptyVote(t, keys[0], &types.SignatureData{Vote: leader, Height: big.NewInt(1)})
+
+	for _, tt := range []struct {
+		fork *big.Int
+		ok   bool
+	}{{nil, true}, {big.NewInt(2), true}, {big.NewInt(1), false}} {
+		config := *params.TestChainConfig
+		config.EmptyVoteQuorumBlock = tt.fork
+		chain, genesis, newState := newValidatorChain(t, &config, keys)
+
+		engine := NewEngine(nil, common.Address{}, nil, nil)
+		_, err := engine.FinalizeAndAssemble(chain, newEmptyHeader(t, genesis, [][]byte{vote, vote}), newState(), nil, nil, nil)
+		if (err == nil) != tt.ok {
+			t.Errorf("fork %v: finalize mismatch: have %v, want ok %v", tt.fork, err, tt.ok)
+		}
+		chain.Stop()
+	}
+}
@@ -60,6 +60,14 @@ var (
 	accountUpdateTimer = metrics.NewRegisteredTimer("chain/account/updates", nil)
 	accountCommitTimer = metrics.NewRegisteredTimer("chain/account/commits", nil)
 
+	accountKindUpdateTimers = map[string]metrics.Timer{
+		state.AccountKindPlain:     metrics.NewRegisteredTimer("chain/account/updates/plain", nil),
+		state.AccountKindValidator: metrics.NewRegisteredTimer("chain/account/updates/validator", nil),
+		state.AccountKindStaker:    metrics.NewRegisteredTimer("chain/account/updates/staker", nil),
+		state.AccountKindNFT:       metrics.NewRegisteredTimer("chain/account/updates/nft", nil),
+		state.AccountKindSystem:    metrics.NewRegisteredTimer("chain/account/updates/system", nil),
+	}
+
 	storageReadTimer   = metrics.NewRegisteredTimer("chain/storage/reads", nil)
 	storageHashTimer   = metrics.NewRegisteredTimer("chain/storage/hashes", nil)
 	storageUpdateTimer = metrics.NewRegisteredTimer("chain/storage/updates", nil)
@@ -86,13 +94,14 @@ var (
 )
 
 const (
-	bodyCacheLimit      = 256
-	blockCacheLimit     = 256
-	receiptsCacheLimit  = 32
-	txLookupCacheLimit  = 1024
-	maxFutureBlocks     = 256
-	maxTimeFutureBlocks = 30
-	TriesInMemory       = 128
+	bodyCacheLimit       = 256
+	blockCacheLimit      = 256
+	receiptsCacheLimit   = 32
+	txLookupCacheLimit   = 1024
+	snftAssignCacheLimit = 256
+	maxFutureBlocks      = 256
+	maxTimeFutureBlocks  = 30
+	TriesInMemory        = 128
 
 	WriteStakersFrequency = 10000
 
@@ -184,6 +193,7 @@ type BlockChain struct {
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
+	snftFeed      event.Feed
 	blockProcFeed event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
@@ -201,6 +211,11 @@ type BlockChain struct {
 	txLookupCache *lru.Cache     // Cache for the most recent transaction lookup data.
 	futureBlocks  *lru.Cache     // future blocks are blocks added for later processing
 
+	snftAssignCache *lru.Cache        // SNFT assignments of the most recent blocks, canonical or not
+	snftEvents      []SNFTAssignEvent // SNFT assignment events waiting for the chain lock to be released
+	snftEventsMu    sync.Mutex        // Protects snftEvents
+	snftSendMu      sync.Mutex        // Keeps the SNFT assignment events in order while sent
+
 	quit          chan struct{}  // blockchain quit channel
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 	running       int32          // 0 if chain is running, 1 when stopped
@@ -250,6 +265,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	receiptsCache, _ := lru.New(receiptsCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
+	snftAssignCache, _ := lru.New(snftAssignCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 
 	bc := &BlockChain{
@@ -262,19 +278,20 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			Journal:   cacheConfig.TrieCleanJournal,
 			Preimages: cacheConfig.Preimages,
 		}),
-		quit:           make(chan struct{}),
-		shouldPreserve: shouldPreserve,
-		bodyCache:      bodyCache,
-		bodyRLPCache:   bodyRLPCache,
-		receiptsCache:  receiptsCache,
-		blockCache:     blockCache,
-		txLookupCache:  txLookupCache,
-		futureBlocks:   futureBlocks,
-		engine:         engine,
-		vmConfig:       vmConfig,
-		stakerPool:     new(types.StakerList),
-		bytesStakersCh: make(chan BytesStakerList, 100),
-		coefficients:   make(map[uint64]map[common.Address]uint8, 0),
+		quit:            make(chan struct{}),
+		shouldPreserve:  shouldPreserve,
+		bodyCache:       bodyCache,
+		bodyRLPCache:    bodyRLPCache,
+		receiptsCache:   receiptsCache,
+		blockCache:      blockCache,
+		txLookupCache:   txLookupCache,
+		snftAssignCache: snftAssignCache,
+		futureBlocks:    futureBlocks,
+		engine:          engine,
+		vmConfig:        vmConfig,
+		stakerPool:      new(types.StakerList),
+		bytesStakersCh:  make(chan BytesStakerList, 100),
+		coefficients:    make(map[uint64]map[common.Address]uint8, 0),
 	}
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
@@ -895,6 +912,35 @@ func (bc *BlockChain) ExportN(w io.Writer, first uint64, last uint64) error {
 	return nil
 }
 
+// writeValidatorBlock indexes the block under the validator that proposed it.
+// Empty blocks are not proposed by anyone and are skipped.
+func (bc *BlockChain) writeValidatorBlock(db ethdb.KeyValueWriter, block *types.Block) {
+	if block.NumberU64() == 0 || block.EmptyBlock() {
+		return
+	}
+	proposer, err := bc.engine.Author(block.Header())
+	if err != nil || proposer == (common.Address{}) {
+		return
+	}
+	rawdb.WriteValidatorBlock(db, proposer, block.NumberU64(), block.Hash())
+}
+
+// ValidatorBlockCount returns the number of canonical blocks in the range
+// [from, to] that were proposed by the given validator.
+func (bc *BlockChain) ValidatorBlockCount(validator common.Address, from, to uint64) uint64 {
+	if to < from {
+		return 0
+	}
+	var count uint64
+	numbers, hashes := rawdb.ReadValidatorBlocks(bc.db, validator, from, to+1)
+	for i, number := range numbers {
+		if rawdb.ReadCanonicalHash(bc.db, number) == hashes[i] {
+			count++
+		}
+	}
+	return count
+}
+
 // writeHeadBlock injects a new head block into the current block chain. This method
 // assumes that the block is indeed a true head. It will also reset the head
 // header and the head fast sync block to this very same block if they are older
@@ -909,6 +955,7 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	batch := bc.db.NewBatch()
 	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
 	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	bc.writeValidatorBlock(batch, block)
 	rawdb.WriteHeadBlockHash(batch, block.Hash())
 
 	// If the block is better than our head or is on a different chain, force update heads
@@ -1368,6 +1415,7 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			} else if rawdb.ReadTxIndexTail(bc.db) != nil {
 				rawdb.WriteTxLookupEntriesByBlock(batch, block)
 			}
+			bc.writeValidatorBlock(batch, block)
 			stats.processed++
 		}
 		// Flush all tx-lookup index data.
@@ -1451,6 +1499,7 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			rawdb.WriteBody(batch, block.Hash(), block.NumberU64(), block.Body())
 			rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receiptChain[i])
 			rawdb.WriteTxLookupEntriesByBlock(batch, block) // Always write tx indices for live blocks, we assume they are needed
+			bc.writeValidatorBlock(batch, block)
 
 			// Write everything belongs to the blocks into the database. So that
 			// we can ensure all components of body is completed(body, receipts,
@@ -1564,15 +1613,18 @@ func (bc *BlockChain) writeKnownBlock(block *types.Block) error {
 		}
 	}
 	bc.writeHeadBlock(block)
+	bc.queueSNFTEvent(block)
 	return nil
 }
 
 // WriteBlockWithState writes the block and all associated state to the database.
 func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
 	bc.chainmu.Lock()
-	defer bc.chainmu.Unlock()
+	status, err = bc.writeBlockWithState(block, receipts, logs, state, emitHeadEvent)
+	bc.chainmu.Unlock()
 
-	return bc.writeBlockWithState(block, receipts, logs, state, emitHeadEvent)
+	bc.sendSNFTEvents()
+	return status, err
 }
 
 // writeBlockWithState writes the block and all associated state to the database,
@@ -1711,11 +1763,16 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	}
 	bc.futureBlocks.Remove(block.Hash())
 
+	// Side blocks keep their assignments too, for when a reorg makes them canonical
+	if assignments := state.SNFTAssignments(); len(assignments) > 0 {
+		bc.snftAssignCache.Add(block.Hash(), assignments)
+	}
 	if status == CanonStatTy {
 		bc.chainFeed.Send(ChainEvent{Block: block, Hash: block.Hash(), Logs: logs})
 		if len(logs) > 0 {
 			bc.logsFeed.Send(logs)
 		}
+		bc.queueSNFTEvent(block)
 		// In theory we should fire a ChainHeadEvent when we inject
 		// a canonical block, but sometimes we can insert a batch of
 		// canonicial blocks. Avoid firing too much ChainHeadEvents,
@@ -1782,6 +1839,7 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	bc.chainmu.Unlock()
 	bc.wg.Done()
 
+	bc.sendSNFTEvents()
 	return n, err
 }
 
@@ -1798,6 +1856,7 @@ func (bc *BlockChain) InsertChainWithoutSealVerification(block *types.Block) (in
 	bc.chainmu.Unlock()
 	bc.wg.Done()
 
+	bc.sendSNFTEvents()
 	return n, err
 }
 
@@ -2009,7 +2068,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// Process block using the parent state as reference point
 		substart := time.Now()
 
-		if block.Coinbase() == common.HexToAddress("0x0000000000000000000000000000000000000000") && block.Number().Cmp(common.Big0) > 0 {
+		if block.EmptyBlock() {
 			emptyBlockErr := bc.verifyEmptyVote(block.Header(), statedb)
 			if emptyBlockErr != nil {
 				log.Error("insertChain: verify Empty Vote", "emptyBlockErr", emptyBlockErr)
@@ -2069,6 +2128,12 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		accountCommitTimer.Update(statedb.AccountCommits)   // Account commits are complete, we can mark them
 		storageCommitTimer.Update(statedb.StorageCommits)   // Storage commits are complete, we can mark them
 		snapshotCommitTimer.Update(statedb.SnapshotCommits) // Snapshot commits are complete, we can mark them
+		for kind, updates := range statedb.AccountKindUpdates {
+			// The commit wrote out every account left to update, so the breakdown is final
+			if timer, ok := accountKindUpdateTimers[kind]; ok {
+				timer.Update(updates.Time)
+			}
+		}
 
 		blockWriteTimer.Update(time.Since(substart) - statedb.AccountCommits - statedb.StorageCommits - statedb.SnapshotCommits)
 		blockInsertTimer.UpdateSince(start)
@@ -2129,6 +2194,15 @@ func (bc *BlockChain) verifyEmptyVote(header *types.Header, stateDB *state.State
 	var coe uint8
 
 	log.Info("azh|check empty vote")
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return err
+	}
+	votes, err := extra.EmptyBlockVotes()
+	if err != nil {
+		return err
+	}
+
 	log.Info("azh|stateDb", "height", bc.CurrentHeader().Number, "empty height", header.Number)
 	validatorList := stateDB.GetValidators(types.ValidatorStorageAddress)
 	if validatorList == nil {
@@ -2137,11 +2211,6 @@ func (bc *BlockChain) verifyEmptyVote(header *types.Header, stateDB *state.State
 		return err
 	}
 
-	extra, err := types.ExtractIstanbulExtra(header)
-	if err != nil {
-		return err
-	}
-
 	for _, validator := range validatorList.Validators {
 		coe = stateDB.GetValidatorCoefficient(validator.Addr)
 		voteBalance = new(big.Int).Mul(validator.Balance, big.NewInt(int64(coe)))
@@ -2150,13 +2219,25 @@ func (bc *BlockChain) verifyEmptyVote(header *types.Header, stateDB *state.State
 	allWeightBalance50 := new(big.Int).Mul(big.NewInt(50), allWeightBalance)
 	allWeightBalance50 = new(big.Int).Div(allWeightBalance50, big.NewInt(100))
 
+	// Votes of an earlier round must not be replayed into the block
+	var round *types.SignatureData
+	if bc.chainConfig.IsEmptyVoteRound(header.Number) {
+		if round, err = types.DecodeEmptyVote(extra.EmptyBlockMessages[0]); err != nil {
+			return err
+		}
+	}
 	var votevValidators []common.Address
-	for _, emptyBlockMessage := range extra.EmptyBlockMessages[1:] {
+	for _, emptyBlockMessage := range votes {
 		flag, height := CheckHeight(header, emptyBlockMessage)
 		log.Info("empty block check", "block height", header.Number, "vote height", height)
 		if !flag {
 			return errors.New("the vote height doesn`t match the block height")
 		}
+		if round != nil {
+			if err := types.CheckEmptyVoteRound(round, emptyBlockMessage); err != nil {
+				return err
+			}
+		}
 		msg := &types.EmptyMsg{}
 		sender, err := msg.RecoverAddress(emptyBlockMessage)
 		if err != nil {
@@ -2478,6 +2559,8 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 
 		// Collect the new added transactions.
 		addedTxs = append(addedTxs, newChain[i].Transactions()...)
+
+		bc.queueSNFTEvent(newChain[i])
 	}
 	// Delete useless indexes right now which includes the non-canonical
 	// transaction indexes, canonical chain indexes which above the head.
@@ -2784,6 +2867,42 @@ func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
 }
 
+// queueSNFTEvent queues the SNFT assignment event of a block that just became
+// canonical, if it assigned any. Assignments are only known for the blocks this
+// node finalized recently, so older blocks a reorg brings back go unannounced.
+// It expects the chain mutex to be held, the event is sent by sendSNFTEvents
+// once it is released.
+func (bc *BlockChain) queueSNFTEvent(block *types.Block) {
+	assignments, ok := bc.snftAssignCache.Get(block.Hash())
+	if !ok {
+		return
+	}
+	bc.snftEventsMu.Lock()
+	bc.snftEvents = append(bc.snftEvents, SNFTAssignEvent{Block: block, Assignments: assignments.([]*types.SNFTAssignment)})
+	bc.snftEventsMu.Unlock()
+}
+
+// sendSNFTEvents sends the queued SNFT assignment events. It must be called
+// without the chain mutex held, so slow subscribers do not stall block import.
+func (bc *BlockChain) sendSNFTEvents() {
+	bc.snftSendMu.Lock()
+	defer bc.snftSendMu.Unlock()
+
+	bc.snftEventsMu.Lock()
+	events := bc.snftEvents
+	bc.snftEvents = nil
+	bc.snftEventsMu.Unlock()
+
+	for _, ev := range events {
+		bc.snftFeed.Send(ev)
+	}
+}
+
+// SubscribeSNFTAssignEvent registers a subscription of SNFTAssignEvent.
+func (bc *BlockChain) SubscribeSNFTAssignEvent(ch chan<- SNFTAssignEvent) event.Subscription {
+	return bc.scope.Track(bc.snftFeed.Subscribe(ch))
+}
+
 // SubscribeBlockProcessingEvent registers a subscription of bool where true means
 // block processing has started while false means it has stopped.
 func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscription {
@@ -3863,3 +3863,254 @@ func TestEIP1559Transition(t *testing.T) {
 	//	t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	//}
 }
+
+// Tests that the per-validator block index counts the canonical blocks each
+// validator proposed and leaves empty blocks out.
+func TestValidatorBlockCount(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = (&Genesis{Config: params.TestChainConfig}).MustCommit(db)
+		engine  = ethash.NewFullFaker()
+		alice   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		bob     = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	// Blocks 1..9 cycle through alice, bob and an empty block.
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 9, func(i int, b *BlockGen) {
+		switch i % 3 {
+		case 0:
+			b.SetCoinbase(alice)
+		case 1:
+			b.SetCoinbase(bob)
+		case 2:
+			b.SetCoinbase(common.Address{})
+			b.header.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+		}
+	})
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Empty blocks can't pass import without a quorum of signed votes, so the
+	// blocks are written as heads directly.
+	for _, block := range blocks {
+		rawdb.WriteBlock(db, block)
+		chain.writeHeadBlock(block)
+	}
+	tests := []struct {
+		validator common.Address
+		from, to  uint64
+		want      uint64
+	}{
+		{alice, 0, 9, 3},
+		{bob, 0, 9, 3},
+		{common.Address{}, 0, 9, 0},
+		{alice, 2, 6, 1},
+		{bob, 2, 5, 2},
+		{alice, 5, 3, 0},
+	}
+	for i, tt := range tests {
+		if have := chain.ValidatorBlockCount(tt.validator, tt.from, tt.to); have != tt.want {
+			t.Errorf("test %d: count mismatch for %x in [%d, %d]: have %d, want %d", i, tt.validator, tt.from, tt.to, have, tt.want)
+		}
+	}
+	// An entry whose block is no longer canonical must not be counted.
+	rawdb.WriteCanonicalHash(db, common.Hash{0x01}, 1)
+	if have := chain.ValidatorBlockCount(alice, 0, 9); have != 2 {
+		t.Errorf("count after reorg mismatch: have %d, want %d", have, 2)
+	}
+}
+
+// Tests that blocks imported with their receipts, as fast sync does, are indexed
+// under their proposer both in the live and the ancient database.
+func TestValidatorBlockCountReceiptChain(t *testing.T) {
+	var (
+		gendb   = rawdb.NewMemoryDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig}
+		genesis = gspec.MustCommit(gendb)
+		alice   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		bob     = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 8, func(i int, b *BlockGen) {
+		if i%2 == 0 {
+			b.SetCoinbase(alice)
+		} else {
+			b.SetCoinbase(bob)
+		}
+	})
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	for _, tt := range []struct {
+		name         string
+		db           ethdb.Database
+		ancientLimit uint64
+	}{
+		{"live", rawdb.NewMemoryDatabase(), 0},
+		{"ancient", ancientDb, uint64(len(blocks) / 2)},
+	} {
+		gspec.MustCommit(tt.db)
+		chain, _ := NewBlockChain(tt.db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+		if n, err := chain.InsertHeaderChain(headers, 1); err != nil {
+			t.Fatalf("%s: failed to insert header %d: %v", tt.name, n, err)
+		}
+		if n, err := chain.InsertReceiptChain(blocks, receipts, tt.ancientLimit); err != nil {
+			t.Fatalf("%s: failed to insert receipt %d: %v", tt.name, n, err)
+		}
+		if have := chain.ValidatorBlockCount(alice, 0, 8); have != 4 {
+			t.Errorf("%s: alice block count mismatch: have %d, want 4", tt.name, have)
+		}
+		if have := chain.ValidatorBlockCount(bob, 1, 4); have != 2 {
+			t.Errorf("%s: bob block count mismatch: have %d, want 2", tt.name, have)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that SNFTs assigned while finalizing normal and empty blocks are
+// published once the blocks become canonical.
+func TestSNFTAssignEvent(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = (&Genesis{Config: params.TestChainConfig}).MustCommit(db)
+		engine  = ethash.NewFullFaker()
+		alice   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		bob     = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2, func(i int, b *BlockGen) {
+		if i == 1 {
+			b.SetCoinbase(common.Address{})
+			b.header.Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+		}
+	})
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	events := make(chan SNFTAssignEvent, 2)
+	sub := chain.SubscribeSNFTAssignEvent(events)
+	defer sub.Unsubscribe()
+
+	firstSNFT, _ := new(big.Int).SetString("8000000000000000000000000000000000000000", 16)
+	exchangers := [][]common.Address{{alice, bob}, {bob}}
+	root := genesis.Root()
+	for i, block := range blocks {
+		statedb, err := chain.StateAt(root)
+		if err != nil {
+			t.Fatalf("block %d: failed to open state: %v", block.NumberU64(), err)
+		}
+		if i == 0 {
+			statedb.GetOrNewStakerStateObject(types.MintDeepStorageAddress).SetOfficialMint(firstSNFT)
+		}
+		statedb.CreateNFTByOfficial16(nil, exchangers[i], block.Number(), nil)
+		if root, err = statedb.Commit(true); err != nil {
+			t.Fatalf("block %d: failed to commit state: %v", block.NumberU64(), err)
+		}
+		if status, err := chain.WriteBlockWithState(block, nil, nil, statedb, false); err != nil || status != CanonStatTy {
+			t.Fatalf("block %d: failed to write block: status %v, err %v", block.NumberU64(), status, err)
+		}
+	}
+	next := firstSNFT
+	for i, block := range blocks {
+		select {
+		case ev := <-events:
+			if ev.Block.Hash() != block.Hash() {
+				t.Fatalf("event %d: block mismatch: have %d, want %d", i, ev.Block.NumberU64(), block.NumberU64())
+			}
+			if len(ev.Assignments) != len(exchangers[i]) {
+				t.Fatalf("event %d: assignment count mismatch: have %d, want %d", i, len(ev.Assignments), len(exchangers[i]))
+			}
+			for j, assignment := range ev.Assignments {
+				if want := common.BigToAddress(next); assignment.Address != want || assignment.Owner != exchangers[i][j] {
+					t.Errorf("event %d: assignment %d mismatch: have %x to %x, want %x to %x", i, j, assignment.Address, assignment.Owner, want, exchangers[i][j])
+				}
+				next = new(big.Int).Add(next, big.NewInt(1))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: no assignment event for block %d", i, block.NumberU64())
+		}
+	}
+}
+
+// Tests that the SNFTs assigned on a side chain are published once a reorg makes
+// it canonical.
+func TestSNFTAssignEventReorg(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = (&Genesis{Config: params.TestChainConfig}).MustCommit(db)
+		engine  = ethash.NewFullFaker()
+		alice   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	)
+	canon, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 1, nil)
+	side, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2, func(i int, b *BlockGen) {
+		b.SetCoinbase(alice)
+		if i == 0 {
+			// Lighter than the canonical block, so it stays a side block until the next one
+			b.header.Difficulty = big.NewInt(1)
+		}
+	})
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	events := make(chan SNFTAssignEvent, 3)
+	sub := chain.SubscribeSNFTAssignEvent(events)
+	defer sub.Unsubscribe()
+
+	firstSNFT, _ := new(big.Int).SetString("8000000000000000000000000000000000000000", 16)
+	write := func(block *types.Block, parentRoot common.Hash, want WriteStatus) common.Hash {
+		statedb, err := chain.StateAt(parentRoot)
+		if err != nil {
+			t.Fatalf("block %x: failed to open state: %v", block.Hash(), err)
+		}
+		if block.NumberU64() == 1 {
+			statedb.GetOrNewStakerStateObject(types.MintDeepStorageAddress).SetOfficialMint(firstSNFT)
+		}
+		statedb.CreateNFTByOfficial16(nil, []common.Address{alice}, block.Number(), nil)
+		root, err := statedb.Commit(true)
+		if err != nil {
+			t.Fatalf("block %x: failed to commit state: %v", block.Hash(), err)
+		}
+		if status, err := chain.WriteBlockWithState(block, nil, nil, statedb, false); err != nil || status != want {
+			t.Fatalf("block %x: failed to write block: status %v, err %v, want %v", block.Hash(), status, err, want)
+		}
+		return root
+	}
+	write(canon[0], genesis.Root(), CanonStatTy)
+	root := write(side[0], genesis.Root(), SideStatTy)
+	write(side[1], root, CanonStatTy)
+
+	for i, block := range []*types.Block{canon[0], side[0], side[1]} {
+		select {
+		case ev := <-events:
+			if ev.Block.Hash() != block.Hash() {
+				t.Fatalf("event %d: block mismatch: have %d [%x], want %d [%x]", i, ev.Block.NumberU64(), ev.Block.Hash(), block.NumberU64(), block.Hash())
+			}
+			if len(ev.Assignments) != 1 || ev.Assignments[0].Owner != alice {
+				t.Errorf("event %d: assignments mismatch: have %v", i, ev.Assignments)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: no assignment event for block %d", i, block.NumberU64())
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected assignment event for block %d", ev.Block.NumberU64())
+	default:
+	}
+}
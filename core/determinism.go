@@ -0,0 +1,138 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrNondeterministicMath is returned by CheckRewardMath when a computation
+// gives a different result on a second run.
+var ErrNondeterministicMath = errors.New("reward math is not deterministic")
+
+// ErrFloatRewardMath is returned by CheckStrictDeterminism while some of the
+// reward math still goes through floating point arithmetic.
+var ErrFloatRewardMath = errors.New("reward math uses floating point arithmetic")
+
+// RewardMathCheck is a consensus computation the strict determinism self-test
+// runs. Float marks the computations that still go through floating point
+// arithmetic, whose results may differ between platforms even when they are
+// stable on this one.
+type RewardMathCheck struct {
+	Name    string
+	Float   bool
+	Compute func() (*big.Int, error)
+}
+
+// RewardMathChecks returns the self-test checks of the reward and exchange
+// computations the state transition depends on.
+func RewardMathChecks() []RewardMathCheck {
+	var checks []RewardMathCheck
+	for _, period := range []uint64{0, 1, 2, 10} {
+		number := period * types.ReduceRewardPeriod
+		checks = append(checks, RewardMathCheck{
+			Name:  fmt.Sprintf("GetRewardAmount(%d)", number),
+			Float: true,
+			Compute: func() (*big.Int, error) {
+				return state.GetRewardAmount(number, types.DREBlockReward), nil
+			},
+		})
+	}
+	for _, period := range []uint64{0, 1, 2, 10} {
+		snft := common.BigToAddress(new(big.Int).Add(types.SNFTBase(), new(big.Int).SetUint64(period*types.ExchangePeriod*4096)))
+		checks = append(checks, RewardMathCheck{
+			Name:  fmt.Sprintf("GetExchangAmount(%x)", snft),
+			Float: true,
+			Compute: func() (*big.Int, error) {
+				statedb, err := newCheckState()
+				if err != nil {
+					return nil, err
+				}
+				return statedb.GetExchangAmount(snft, statedb.CalculateExchangeAmount(0, 1)), nil
+			},
+		})
+	}
+	for level := uint8(0); level <= 3; level++ {
+		level := level
+		checks = append(checks, RewardMathCheck{
+			Name: fmt.Sprintf("CalculateExchangeAmount(%d)", level),
+			Compute: func() (*big.Int, error) {
+				statedb, err := newCheckState()
+				if err != nil {
+					return nil, err
+				}
+				return statedb.CalculateExchangeAmount(level, 1), nil
+			},
+		})
+	}
+	checks = append(checks, RewardMathCheck{
+		Name:  "GetAverageCoefficient",
+		Float: true,
+		Compute: func() (*big.Int, error) {
+			statedb, err := newCheckState()
+			if err != nil {
+				return nil, err
+			}
+			for i, coe := range []uint8{70, 33, 7} {
+				addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+				amount := new(big.Int).Mul(big.NewInt(int64(i+1)), types.DREBlockReward)
+				statedb.AddBalance(addr, amount)
+				if err := statedb.PledgeToken(addr, amount, common.Address{}, common.Big0); err != nil {
+					return nil, err
+				}
+				statedb.IncreaseValidatorCoefficient(addr, coe)
+			}
+			return new(big.Int).SetUint64(new(BlockChain).GetAverageCoefficient(statedb)), nil
+		},
+	})
+	return checks
+}
+
+// CheckRewardMath runs every check twice and fails if any result differs
+// between the runs. The checks passing that still rely on floating point
+// arithmetic are returned by name, for the caller to warn about: they are
+// stable on this platform but may not be on others.
+func CheckRewardMath(checks []RewardMathCheck) ([]string, error) {
+	var floats []string
+	for _, check := range checks {
+		first, err := check.Compute()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", check.Name, err)
+		}
+		second, err := check.Compute()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", check.Name, err)
+		}
+		if first == nil || second == nil || first.Cmp(second) != 0 {
+			return nil, fmt.Errorf("%w: %s gave %v then %v", ErrNondeterministicMath, check.Name, first, second)
+		}
+		if check.Float {
+			floats = append(floats, check.Name)
+		}
+	}
+	return floats, nil
+}
+
+// CheckStrictDeterminism runs CheckRewardMath and also fails if any of the
+// checks still relies on floating point arithmetic, stable here or not.
+func CheckStrictDeterminism(checks []RewardMathCheck) error {
+	floats, err := CheckRewardMath(checks)
+	if err != nil {
+		return err
+	}
+	if len(floats) > 0 {
+		return fmt.Errorf("%w: %s", ErrFloatRewardMath, strings.Join(floats, ", "))
+	}
+	return nil
+}
+
+// newCheckState returns an empty in-memory state for the self-test.
+func newCheckState() (*state.StateDB, error) {
+	return state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+}
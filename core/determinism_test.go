@@ -0,0 +1,64 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestCheckRewardMath(t *testing.T) {
+	// The integer computations pass the self-test
+	var deterministic []RewardMathCheck
+	for _, check := range RewardMathChecks() {
+		if !check.Float {
+			deterministic = append(deterministic, check)
+		}
+	}
+	if len(deterministic) == 0 {
+		t.Fatal("no deterministic reward math checks")
+	}
+	floats, err := CheckRewardMath(deterministic)
+	if err != nil {
+		t.Fatalf("deterministic checks failed: %v", err)
+	}
+	if len(floats) != 0 {
+		t.Errorf("deterministic checks reported as float: %v", floats)
+	}
+	// A computation changing between runs is rejected
+	var calls int64
+	stub := RewardMathCheck{
+		Name: "stub",
+		Compute: func() (*big.Int, error) {
+			calls++
+			return big.NewInt(calls), nil
+		},
+	}
+	if _, err := CheckRewardMath(append(deterministic, stub)); !errors.Is(err, ErrNondeterministicMath) {
+		t.Errorf("nondeterministic stub: have %v, want %v", err, ErrNondeterministicMath)
+	}
+	// The float computations are stable here, so they pass but are reported
+	checks := RewardMathChecks()
+	floats, err = CheckRewardMath(checks)
+	if err != nil {
+		t.Fatalf("reward math checks failed: %v", err)
+	}
+	if want := len(checks) - len(deterministic); len(floats) != want {
+		t.Errorf("float checks reported: have %v, want %d", floats, want)
+	}
+}
+
+func TestCheckStrictDeterminism(t *testing.T) {
+	var deterministic []RewardMathCheck
+	for _, check := range RewardMathChecks() {
+		if !check.Float {
+			deterministic = append(deterministic, check)
+		}
+	}
+	if err := CheckStrictDeterminism(deterministic); err != nil {
+		t.Errorf("deterministic checks failed: %v", err)
+	}
+	// Strict mode refuses the float computations while they remain
+	if err := CheckStrictDeterminism(RewardMathChecks()); !errors.Is(err, ErrFloatRewardMath) {
+		t.Errorf("float checks: have %v, want %v", err, ErrFloatRewardMath)
+	}
+}
@@ -41,3 +41,9 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// SNFTAssignEvent is posted when a canonical block assigned SNFTs to exchangers.
+type SNFTAssignEvent struct {
+	Block       *types.Block
+	Assignments []*types.SNFTAssignment
+}
@@ -95,6 +95,7 @@ func NewEVMBlockContext(header *types.Header, chain ChainContext, author *common
 		ResetMinerBecome:                    ResetMinerBecome,
 		CancelPledgedToken:                  CancelPledgedToken,
 		NewCancelStakerPledge:               NewCancelStakerPledge,
+		RefundDelegator:                     RefundDelegator,
 		GetNFTCreator:                       GetNFTCreator,
 		IsExistNFT:                          IsExistNFT,
 		VerifyPledgedBalance:                VerifyPledgedBalance,
@@ -290,6 +291,18 @@ func NewCancelStakerPledge(db vm.StateDB, from common.Address, address common.Ad
 	return db.NewCancelStakerPledge(from, address, amount, blocknumber)
 }
 
+// RefundDelegator returns the whole pledge of delegator to validator if the
+// delegator signed its consent, see types.DelegatorRefundMessage.
+func RefundDelegator(db vm.StateDB, validator, delegator common.Address, wh *types.Wormholes) error {
+	msg := types.DelegatorRefundMessage(validator, delegator, db.GetPledgedTime(delegator, validator))
+	addr, err := RecoverAddress(msg, wh.DelegatorSign)
+	if err != nil || addr != delegator {
+		log.Error("RefundDelegator()", "delegator", delegator, "signer", addr, "err", err)
+		return vm.ErrDelegatorConsent
+	}
+	return db.RefundDelegator(validator, delegator)
+}
+
 func GetNFTCreator(db vm.StateDB, addr common.Address) common.Address {
 	return db.GetNFTCreator(addr)
 }
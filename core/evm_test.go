@@ -0,0 +1,72 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signMessage signs msg the way RecoverAddress expects.
+func signMessage(t *testing.T, key *ecdsa.PrivateKey, msg string) string {
+	hash, _ := hashMsg([]byte(msg))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	sig[64] += 27
+	return hexutil.Encode(sig)
+}
+
+func TestRefundDelegatorConsent(t *testing.T) {
+	var (
+		delegatorKey, _ = crypto.GenerateKey()
+		otherKey, _     = crypto.GenerateKey()
+		delegator       = crypto.PubkeyToAddress(delegatorKey.PublicKey)
+		validator       = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		pledgedAt       = big.NewInt(2)
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(validator, types.ValidatorBase())
+	if err := statedb.StakerPledge(validator, validator, types.ValidatorBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge validator: %v", err)
+	}
+	if err := statedb.MinerBecome(validator, common.Address{}); err != nil {
+		t.Fatalf("failed to add validator: %v", err)
+	}
+	statedb.AddBalance(delegator, types.StakerBase())
+	if err := statedb.StakerPledge(delegator, validator, types.StakerBase(), pledgedAt, &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge delegator: %v", err)
+	}
+
+	refund := func(sign string) error {
+		return RefundDelegator(statedb, validator, delegator, &types.Wormholes{Type: 6, DelegatorSign: sign})
+	}
+	// Consent signed by someone else, or for another pledge, is rejected
+	if err := refund(signMessage(t, otherKey, types.DelegatorRefundMessage(validator, delegator, pledgedAt))); err != vm.ErrDelegatorConsent {
+		t.Errorf("foreign consent error mismatch: have %v, want %v", err, vm.ErrDelegatorConsent)
+	}
+	if err := refund(signMessage(t, delegatorKey, types.DelegatorRefundMessage(validator, delegator, big.NewInt(1)))); err != vm.ErrDelegatorConsent {
+		t.Errorf("stale consent error mismatch: have %v, want %v", err, vm.ErrDelegatorConsent)
+	}
+	if err := refund(""); err != vm.ErrDelegatorConsent {
+		t.Errorf("missing consent error mismatch: have %v, want %v", err, vm.ErrDelegatorConsent)
+	}
+	if have := statedb.GetStakerPledgedBalance(delegator, validator); have.Cmp(types.StakerBase()) != 0 {
+		t.Fatalf("rejected refund changed the pledge: have %v", have)
+	}
+	// The delegator's consent to this pledge refunds it
+	if err := refund(signMessage(t, delegatorKey, types.DelegatorRefundMessage(validator, delegator, pledgedAt))); err != nil {
+		t.Fatalf("failed to refund with consent: %v", err)
+	}
+	if have := statedb.GetBalance(delegator); have.Cmp(types.StakerBase()) != 0 {
+		t.Errorf("refunded balance mismatch: have %v, want %v", have, types.StakerBase())
+	}
+}
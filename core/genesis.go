@@ -309,7 +309,9 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 		wh.ProxyAddress = account.Proxy
 		statedb.StakerPledge(addr, addr, account.Balance, big.NewInt(0), &wh)
 		proxy := common.HexToAddress(account.Proxy)
-		statedb.MinerBecome(addr, proxy)
+		if err := statedb.MinerBecome(addr, proxy); err != nil {
+			panic(fmt.Sprintf("genesis validator %v with %v not added: %v", addr, account.Balance, err))
+		}
 		statedb.AddValidatorCoefficient(addr, VALIDATOR_COEFFICIENT)
 	}
 
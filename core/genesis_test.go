@@ -27,6 +27,8 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
@@ -243,3 +245,32 @@ func TestDecodePreWormholesInfoV3(t *testing.T) {
 		t.Log("address=", k.Hex(), "freerate=", acc.FeeRate, "exchangername=", acc.ExchangerName, "exchangerurl", acc.ExchangerUrl)
 	}
 }
+
+// Tests that a genesis validator the validator pool rejects fails the genesis
+// instead of being left out of it.
+func TestGenesisValidatorBelowBase(t *testing.T) {
+	validator := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	genesis := func(pledge *big.Int) *Genesis {
+		return &Genesis{
+			Config:    params.TestChainConfig,
+			Alloc:     GenesisAlloc{validator: {Balance: types.ValidatorBase()}},
+			Validator: GenesisAlloc{validator: {Balance: pledge}},
+		}
+	}
+	db := rawdb.NewMemoryDatabase()
+	block := genesis(types.ValidatorBase()).ToBlock(db)
+	statedb, err := state.New(block.Root(), state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	if validators := statedb.GetValidators(types.ValidatorStorageAddress); validators == nil || !validators.Exist(validator) {
+		t.Fatal("genesis validator at the validator base not added")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("genesis validator below the validator base accepted")
+		}
+	}()
+	genesis(new(big.Int).Sub(types.ValidatorBase(), big.NewInt(1))).ToBlock(nil)
+}
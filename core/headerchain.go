@@ -303,7 +303,7 @@ func (hc *HeaderChain) writeHeaders(headers []*types.Header) (result *headerWrit
 func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
 	// Do a sanity check that the provided chain is actually ordered and linked
 	for i := 1; i < len(chain); i++ {
-		if chain[i].Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && chain[i].Number.Cmp(common.Big0) > 0 {
+		if chain[i].EmptyBlock() {
 			return 0, nil
 		}
 		if chain[i].Number.Uint64() != chain[i-1].Number.Uint64()+1 {
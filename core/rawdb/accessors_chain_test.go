@@ -528,3 +528,34 @@ func TestCanonicalHashIteration(t *testing.T) {
 		}
 	}
 }
+
+// Tests official NFT pool storage and retrieval operations.
+func TestOfficialNFTPoolStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	hash, number := common.HexToHash("0x01"), uint64(8)
+	if _, err := ReadOfficialNFTPool(db, hash, number); err == nil {
+		t.Fatalf("Non existent official NFT pool returned")
+	}
+	pool := &types.InjectedOfficialNFTList{
+		InjectedOfficialNFTs: []*types.InjectedOfficialNFT{
+			{Dir: "/ipfs/a", StartIndex: big.NewInt(0), Number: 4096, Royalty: 100, Creator: "a", VoteWeight: big.NewInt(1)},
+			{Dir: "/ipfs/b", StartIndex: big.NewInt(4096), Number: 4096, Royalty: 200, Creator: "b", VoteWeight: big.NewInt(2)},
+		},
+	}
+	WriteOfficialNFTPool(db, hash, number, pool)
+
+	stored, err := ReadOfficialNFTPool(db, hash, number)
+	if err != nil {
+		t.Fatalf("Stored official NFT pool not found: %v", err)
+	}
+	if !reflect.DeepEqual(stored, pool) {
+		t.Fatalf("Retrieved official NFT pool mismatch: have %v, want %v", stored, pool)
+	}
+	if max := stored.MaxIndex(); max.Cmp(big.NewInt(8192)) != 0 {
+		t.Fatalf("Max index mismatch: have %v, want 8192", max)
+	}
+	if _, err := ReadOfficialNFTPool(db, common.HexToHash("0x02"), number); err == nil {
+		t.Fatalf("Official NFT pool returned for another block")
+	}
+}
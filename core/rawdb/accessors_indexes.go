@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -175,3 +176,38 @@ func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
 		log.Crit("Failed to delete bloom bits", "err", it.Error())
 	}
 }
+
+// WriteValidatorBlock records that the given validator proposed the block with
+// the specified number and hash.
+func WriteValidatorBlock(db ethdb.KeyValueWriter, validator common.Address, number uint64, hash common.Hash) {
+	if err := db.Put(validatorBlockKey(validator, number), hash.Bytes()); err != nil {
+		log.Crit("Failed to store validator block index", "err", err)
+	}
+}
+
+// ReadValidatorBlocks retrieves the numbers and hashes of the blocks recorded for
+// the given validator in the range [from, to). Entries left behind by reorgs are
+// not filtered out, callers should check them against the canonical chain.
+func ReadValidatorBlocks(db ethdb.Iteratee, validator common.Address, from uint64, to uint64) ([]uint64, []common.Hash) {
+	var (
+		numbers []uint64
+		hashes  []common.Hash
+	)
+	prefix := append(append([]byte{}, validatorBlockPrefix...), validator.Bytes()...)
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix):])
+		if number >= to {
+			break
+		}
+		numbers = append(numbers, number)
+		hashes = append(hashes, common.BytesToHash(it.Value()))
+	}
+	return numbers, hashes
+}
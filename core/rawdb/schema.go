@@ -104,6 +104,7 @@ var (
 	csbtExchangePoolPrefix     = []byte("csbt-exchange-pool-")
 	officialNFTPrefix          = []byte("official-nft-")
 	nominatedOfficialNFTPrefix = []byte("nominated-official-nft-")
+	validatorBlockPrefix       = []byte("validator-block-") // validatorBlockPrefix + validator + num (uint64 big endian) -> block hash
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -272,6 +273,11 @@ func nominatedOfficialNFTPoolKey(number uint64, hash common.Hash) []byte {
 	return append(append(nominatedOfficialNFTPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// validatorBlockKey = validatorBlockPrefix + validator + num (uint64 big endian)
+func validatorBlockKey(validator common.Address, number uint64) []byte {
+	return append(append(validatorBlockPrefix, validator.Bytes()...), encodeBlockNumber(number)...)
+}
+
 func EvilActionKey(number uint64) []byte {
 	return append(append(evilActionKey, encodeBlockNumber(number)...))
 }
@@ -0,0 +1,92 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newBlockState builds a state resembling a reward-heavy block: many dirty
+// accounts, logs of several transactions and their preimages.
+func newBlockState(accounts, txs int) *StateDB {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for i := 0; i < accounts; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		state.AddBalance(addr, big.NewInt(int64(i+1)))
+		state.SetState(addr, common.Hash{1}, common.BigToHash(big.NewInt(int64(i))))
+	}
+	for i := 0; i < txs; i++ {
+		hash := common.BigToHash(big.NewInt(int64(i)))
+		state.Prepare(hash, i)
+		state.AddLog(&types.Log{Address: common.BigToAddress(big.NewInt(int64(i))), Data: make([]byte, 64)})
+		state.AddPreimage(crypto.Keccak256Hash(hash[:]), hash[:])
+	}
+	state.Finalise(true)
+	return state
+}
+
+func TestLightCopy(t *testing.T) {
+	orig := newBlockState(100, 10)
+	light := orig.LightCopy()
+
+	if have, want := light.IntermediateRoot(true), orig.Copy().IntermediateRoot(true); have != want {
+		t.Fatalf("light copy root mismatch: have %x, want %x", have, want)
+	}
+	if logs := light.Logs(); len(logs) != 0 {
+		t.Errorf("light copy kept %d logs", len(logs))
+	}
+	if preimages := light.Preimages(); len(preimages) != 0 {
+		t.Errorf("light copy kept %d preimages", len(preimages))
+	}
+	// Changes to the copy must not leak into the original
+	addr := common.BigToAddress(big.NewInt(1))
+	light.AddBalance(addr, big.NewInt(10))
+	light.AddLog(&types.Log{Address: addr})
+	if have := orig.GetBalance(addr); have.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("original balance changed: have %v, want 1", have)
+	}
+	if have := light.GetBalance(addr); have.Cmp(big.NewInt(11)) != 0 {
+		t.Errorf("copy balance mismatch: have %v, want 11", have)
+	}
+	if logs := orig.Logs(); len(logs) != 10 {
+		t.Errorf("original log count changed: have %d, want 10", len(logs))
+	}
+}
+
+func BenchmarkCopy(b *testing.B) {
+	state := newBlockState(2000, 200)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.Copy()
+	}
+}
+
+func BenchmarkLightCopy(b *testing.B) {
+	state := newBlockState(2000, 200)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.LightCopy()
+	}
+}
@@ -36,6 +36,72 @@ type DumpConfig struct {
 	OnlyWithAddresses bool
 	Start             []byte
 	Max               uint64
+	Kinds             []string // Only collect accounts of one of these kinds, all if empty
+}
+
+// Account kinds, telling apart accounts by which of their extensions hold
+// data. An account may be of several kinds, a validator pledging to itself
+// being a staker too, or of none.
+const (
+	AccountKindValidator = "validator" // received pledges
+	AccountKindStaker    = "staker"    // made pledges
+	AccountKindNFT       = "nft"       // NFT (CSBT) accounts
+	AccountKindSystem    = "system"    // hold the validator, staker and mint pools
+)
+
+// accountKinds classifies an account. Every account that ever held a balance
+// carries the Worm extension, so it is its pledges that make the difference.
+func accountKinds(data *Account) []string {
+	var kinds []string
+	if data.Worm != nil && len(data.Worm.ValidatorExtension.ValidatorExtensions) > 0 {
+		kinds = append(kinds, AccountKindValidator)
+	}
+	if data.Worm != nil && len(data.Worm.StakerExtension.StakerExtensions) > 0 {
+		kinds = append(kinds, AccountKindStaker)
+	}
+	if data.Csbt != nil {
+		kinds = append(kinds, AccountKindNFT)
+	}
+	if data.Staker != nil {
+		kinds = append(kinds, AccountKindSystem)
+	}
+	return kinds
+}
+
+// AccountKindPlain is the update metrics kind of accounts of no other kind.
+const AccountKindPlain = "plain"
+
+// updateKind returns the kind the trie updates of an account are measured
+// under: the first of system, validator, staker and nft it is of, plain if
+// none.
+func updateKind(data *Account) string {
+	switch {
+	case data.Staker != nil:
+		return AccountKindSystem
+	case data.Worm != nil && len(data.Worm.ValidatorExtension.ValidatorExtensions) > 0:
+		return AccountKindValidator
+	case data.Worm != nil && len(data.Worm.StakerExtension.StakerExtensions) > 0:
+		return AccountKindStaker
+	case data.Csbt != nil:
+		return AccountKindNFT
+	}
+	return AccountKindPlain
+}
+
+// hasKind reports whether any of kinds is wanted, everything being wanted if
+// no kind is.
+func hasKind(kinds []string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, kind := range kinds {
+		for _, want := range wanted {
+			if kind == want {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // DumpCollector interface which the state trie calls during iteration
@@ -54,6 +120,7 @@ type DumpAccount struct {
 	CodeHash  hexutil.Bytes          `json:"codeHash"`
 	Code      hexutil.Bytes          `json:"code,omitempty"`
 	Storage   map[common.Hash]string `json:"storage,omitempty"`
+	Kinds     []string               `json:"kinds,omitempty"`
 	Address   *common.Address        `json:"address,omitempty"` // Address only present in iterative (line-by-line) mode
 	SecureKey hexutil.Bytes          `json:"key,omitempty"`     // If we don't have address, we can output the key
 
@@ -106,6 +173,7 @@ func (d iterativeDump) OnAccount(addr common.Address, account DumpAccount) {
 		CodeHash:  account.CodeHash,
 		Code:      account.Code,
 		Storage:   account.Storage,
+		Kinds:     account.Kinds,
 		SecureKey: account.SecureKey,
 		Address:   nil,
 	}
@@ -144,11 +212,16 @@ func (s *StateDB) DumpToCollector(c DumpCollector, conf *DumpConfig) (nextKey []
 		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
 			panic(err)
 		}
+		kinds := accountKinds(&data)
+		if !hasKind(kinds, conf.Kinds) {
+			continue
+		}
 		account := DumpAccount{
 			Balance:   data.Balance.String(),
 			Nonce:     data.Nonce,
 			Root:      data.Root[:],
 			CodeHash:  data.CodeHash,
+			Kinds:     kinds,
 			SecureKey: it.Key,
 		}
 		addrBytes := s.trie.GetKey(it.Key)
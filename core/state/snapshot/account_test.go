@@ -0,0 +1,70 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCheckSlimAccountRLP(t *testing.T) {
+	if err := CheckSlimAccountRLP(); err != nil {
+		t.Fatalf("self-test failed: %v", err)
+	}
+}
+
+// Tests that accounts with any subset of the extended fields survive encoding
+// to the slim format and decoding from it.
+func TestSlimAccountExtendedFields(t *testing.T) {
+	full := sampleAccount()
+	for mask := 0; mask < 16; mask++ {
+		acc := full
+		if mask&1 == 0 {
+			acc.Worm = nil
+		}
+		if mask&2 == 0 {
+			acc.Csbt = nil
+		}
+		if mask&4 == 0 {
+			acc.Staker = nil
+		}
+		if mask&8 == 0 {
+			acc.Extra = nil
+		}
+		if err := CheckSlimAccount(acc); err != nil {
+			t.Errorf("fields %04b: %v", mask, err)
+		}
+		// The empty root and code hash are left out of the slim format
+		acc.Root, acc.CodeHash = emptyRoot[:], emptyCode[:]
+		if err := CheckSlimAccount(acc); err != nil {
+			t.Errorf("fields %04b, empty root and code: %v", mask, err)
+		}
+	}
+	// Decoded back into the full format, nothing is lost either
+	blob := SlimAccountRLP(full.Nonce, full.Balance, common.BytesToHash(full.Root), full.CodeHash, full.Worm, full.Csbt, full.Staker, full.Extra)
+	acc, err := FullAccount(blob)
+	if err != nil {
+		t.Fatalf("failed to decode full account: %v", err)
+	}
+	if err := CheckSlimAccount(acc); err != nil {
+		t.Errorf("full account: %v", err)
+	}
+	if acc.Worm.ValidatorExtension.ValidatorExtensions[1].BlockNumber.Cmp(full.Worm.ValidatorExtension.ValidatorExtensions[1].BlockNumber) != 0 {
+		t.Errorf("validator extension block number lost")
+	}
+}
@@ -0,0 +1,855 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func newStakingState(t *testing.T) *StateDB {
+	state, err := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	return state
+}
+
+// registerValidator self-pledges the validator base for validator and adds it
+// to the validator pool, so stakers can pledge to it.
+func registerValidator(t *testing.T, state *StateDB, validator common.Address) {
+	state.AddBalance(validator, types.ValidatorBase())
+	if err := state.StakerPledge(validator, validator, types.ValidatorBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge validator: %v", err)
+	}
+	if err := state.MinerBecome(validator, common.Address{}); err != nil {
+		t.Fatalf("failed to add validator: %v", err)
+	}
+}
+
+func TestGetPledgedTime(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		stranger  = common.HexToAddress("0x3000000000000000000000000000000000000003")
+		amount    = types.ValidatorBase()
+	)
+	registerValidator(t, state, validator)
+	state.AddBalance(staker, amount)
+	if err := state.StakerPledge(staker, validator, amount, big.NewInt(42), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge: %v", err)
+	}
+	if have := state.GetPledgedTime(staker, validator); have.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("pledged time mismatch: have %v, want 42", have)
+	}
+	if have := state.GetPledgedTime(stranger, validator); have.Sign() != 0 {
+		t.Errorf("pledged time of non-staker: have %v, want 0", have)
+	}
+	if have := state.GetPledgedTime(staker, stranger); have.Sign() != 0 {
+		t.Errorf("pledged time for unrelated validator: have %v, want 0", have)
+	}
+}
+
+func TestRevocateAllStakersTwice(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		selfStake = types.ValidatorBase()
+		stake     = types.StakerBase()
+	)
+	state.AddBalance(validator, selfStake)
+	state.AddBalance(staker, stake)
+	if err := state.StakerPledge(validator, validator, selfStake, big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge validator: %v", err)
+	}
+	state.MinerBecome(validator, common.Address{})
+	if err := state.StakerPledge(staker, validator, stake, big.NewInt(2), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge staker: %v", err)
+	}
+	if !state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Fatalf("validator not in pool after pledging")
+	}
+
+	check := func(round int) {
+		if have := state.GetBalance(validator); have.Cmp(selfStake) != 0 {
+			t.Errorf("round %d: validator balance mismatch: have %v, want %v", round, have, selfStake)
+		}
+		if have := state.GetBalance(staker); have.Cmp(stake) != 0 {
+			t.Errorf("round %d: staker balance mismatch: have %v, want %v", round, have, stake)
+		}
+		if have := state.GetPledgedBalance(validator); have.Sign() != 0 {
+			t.Errorf("round %d: pledged balance not cleared: have %v", round, have)
+		}
+		if state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+			t.Errorf("round %d: validator still in pool", round)
+		}
+	}
+	state.RevocateAllStakers(validator, big.NewInt(3))
+	check(1)
+	state.RevocateAllStakers(validator, big.NewInt(3))
+	check(2)
+}
+
+func TestMinerBecomeBelowBase(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		base      = types.ValidatorBase()
+		shortfall = big.NewInt(1)
+	)
+	state.AddBalance(validator, new(big.Int).Add(base, shortfall))
+	if err := state.StakerPledge(validator, validator, base, big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge: %v", err)
+	}
+	if err := state.MinerBecome(validator, common.Address{}); err != nil {
+		t.Fatalf("validator at base rejected: %v", err)
+	}
+
+	// Partially unstake and drop out of the pool
+	state.GetOrNewAccountStateObject(validator).SubPledgedBalance(shortfall)
+	state.GetOrNewStakerStateObject(types.ValidatorStorageAddress).RemoveValidator(validator, base)
+	if state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Fatalf("validator still in pool after unstaking")
+	}
+	if err := state.MinerBecome(validator, common.Address{}); err != ErrBelowValidatorBase {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrBelowValidatorBase)
+	}
+	if state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Fatalf("below-base validator re-added to pool")
+	}
+
+	// Topping up lets it back in
+	state.GetOrNewAccountStateObject(validator).AddPledgedBalance(shortfall)
+	if err := state.MinerBecome(validator, common.Address{}); err != nil {
+		t.Fatalf("topped up validator rejected: %v", err)
+	}
+	if !state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Errorf("topped up validator not in pool")
+	}
+}
+
+func TestDistributeRewardsSplitConsensus(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		number    = big.NewInt(100)
+	)
+	// rewarded builds the state of a block whose validator share is percentage
+	rewarded := func(percentage uint64) *StateDB {
+		state := newStakingState(t)
+		registerValidator(t, state, validator)
+		state.AddBalance(staker, types.StakerBase())
+		if err := state.StakerPledge(staker, validator, types.StakerBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge staker: %v", err)
+		}
+		state.AddBalance(validator, GetRewardAmount(number.Uint64(), types.DREBlockReward))
+		state.DistributeRewardsToStakers([]common.Address{validator}, number, percentage)
+		return state
+	}
+	proposed := rewarded(7)
+	reward := GetRewardAmount(number.Uint64(), types.DREBlockReward)
+	want := new(big.Int).Div(new(big.Int).Mul(reward, big.NewInt(93)), big.NewInt(100))
+	if have := proposed.GetBalance(staker); have.Cmp(want) != 0 {
+		t.Errorf("staker reward mismatch: have %v, want %v", have, want)
+	}
+
+	// A verifier only reaches the proposer's state root with the same split
+	if have, want := rewarded(7).IntermediateRoot(true), proposed.IntermediateRoot(true); have != want {
+		t.Errorf("same split diverged: have %x, want %x", have, want)
+	}
+	if have, want := rewarded(10).IntermediateRoot(true), proposed.IntermediateRoot(true); have == want {
+		t.Errorf("different split produced the proposer's root %x", have)
+	}
+}
+
+func TestRewardAtPeriodBoundaries(t *testing.T) {
+	period := types.ReduceRewardPeriod
+	tests := []struct {
+		number uint64
+		period uint64
+		reward string
+	}{
+		{0, 0, "543600000000000000"},
+		{period - 1, 0, "543600000000000000"},
+		{period, 1, "462059999999999987"},
+		{2*period - 1, 1, "462059999999999987"},
+		{2 * period, 2, "392750999999999956"},
+		{3 * period, 3, "333838349999999957"},
+		{10 * period, 10, "107020926199616785"},
+	}
+	for _, tt := range tests {
+		if have := RewardPeriod(tt.number); have != tt.period {
+			t.Errorf("block %d: period mismatch: have %d, want %d", tt.number, have, tt.period)
+		}
+		want, _ := new(big.Int).SetString(tt.reward, 10)
+		if have := GetRewardAmount(tt.number, types.DREBlockReward); have.Cmp(want) != 0 {
+			t.Errorf("block %d: reward mismatch: have %v, want %v", tt.number, have, want)
+		}
+	}
+}
+
+func TestSNFTExchangeMergeNumber(t *testing.T) {
+	state := newStakingState(t)
+	owner := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	snft := common.BigToAddress(types.SNFTBase())
+	state.GetOrNewNFTStateObject(snft).SetNFTInfo(owner, owner)
+
+	// Merge numbers above 16^level are worth nothing
+	if have := state.CalculateExchangeAmount(3, MaxMergeNumber(3)); have.Sign() <= 0 {
+		t.Errorf("full level 3 merge priced at %v", have)
+	}
+	for _, tt := range []struct {
+		level  uint8
+		number uint32
+	}{{0, 2}, {1, 17}, {3, 4097}, {9, ^uint32(0)}} {
+		if have := state.CalculateExchangeAmount(tt.level, tt.number); have.Sign() != 0 {
+			t.Errorf("level %d merge number %d priced at %v", tt.level, tt.number, have)
+		}
+	}
+
+	// Exchanges must price a single unmerged piece
+	want := state.GetExchangAmount(snft, state.CalculateExchangeAmount(0, 1))
+	if have, err := state.SNFTExchangeAmount(snft, 0, 1); err != nil || have.Cmp(want) != 0 {
+		t.Errorf("exchange amount mismatch: have %v, %v, want %v", have, err, want)
+	}
+	for _, tt := range []struct {
+		level  uint8
+		number uint32
+	}{{0, 0}, {0, 2}, {1, 16}, {3, 4096}} {
+		if have, err := state.SNFTExchangeAmount(snft, tt.level, tt.number); err != ErrSNFTMergeNumber {
+			t.Errorf("level %d merge number %d: have %v, %v, want %v", tt.level, tt.number, have, err, ErrSNFTMergeNumber)
+		}
+	}
+	missing := common.BigToAddress(new(big.Int).Add(types.SNFTBase(), common.Big1))
+	if _, err := state.SNFTExchangeAmount(missing, 0, 1); err != ErrSNFTNotExist {
+		t.Errorf("missing snft: have %v, want %v", err, ErrSNFTNotExist)
+	}
+}
+
+func TestTotalSNFTMinted(t *testing.T) {
+	const (
+		blocks     = 5
+		exchangers = 3
+	)
+	state := newStakingState(t)
+	if have := state.TotalSNFTMinted(); have.Sign() != 0 {
+		t.Fatalf("minted before any block: have %v, want 0", have)
+	}
+	validators := []common.Address{common.HexToAddress("0x2000000000000000000000000000000000000002")}
+	awardees := make([]common.Address, exchangers)
+	for i := range awardees {
+		awardees[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+	}
+	for i := 1; i <= blocks; i++ {
+		// Normal blocks assign an SNFT to every exchanger
+		number := big.NewInt(int64(2 * i))
+		state.CreateNFTByOfficial16(validators, awardees, number, common.Big1.Bytes())
+
+		// Empty blocks reward the voters without assigning SNFTs
+		state.CreateNFTByOfficial16(validators, nil, new(big.Int).Add(number, common.Big1), common.Big1.Bytes())
+	}
+	if have := state.TotalSNFTMinted(); have.Cmp(big.NewInt(blocks*exchangers)) != 0 {
+		t.Errorf("minted mismatch: have %v, want %d", have, blocks*exchangers)
+	}
+	if have := len(state.SNFTAssignments()); have != blocks*exchangers {
+		t.Errorf("assignment count mismatch: have %d, want %d", have, blocks*exchangers)
+	}
+}
+
+func TestPledgeByProxy(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		proxy     = common.HexToAddress("0x4000000000000000000000000000000000000004")
+		amount    = types.ValidatorBase()
+	)
+	state.AddBalance(validator, amount)
+	if err := state.StakerPledge(validator, validator, amount, big.NewInt(1), &types.Wormholes{ProxyAddress: proxy.Hex()}); err != nil {
+		t.Fatalf("failed to pledge validator: %v", err)
+	}
+	if err := state.MinerBecome(validator, proxy); err != nil {
+		t.Fatalf("failed to add validator: %v", err)
+	}
+	// The proxy can't become a validator of its own in any way
+	state.AddBalance(proxy, new(big.Int).Mul(amount, big.NewInt(2)))
+	if err := state.CheckNotProxy(proxy); err != ErrProxyPledge {
+		t.Errorf("self pledge error mismatch: have %v, want %v", err, ErrProxyPledge)
+	}
+	if err := state.CheckNotProxy(validator); err != nil {
+		t.Errorf("validator rejected as proxy: %v", err)
+	}
+	if err := state.PledgeToken(proxy, amount, common.Address{}, big.NewInt(2)); err != ErrProxyPledge {
+		t.Errorf("token pledge error mismatch: have %v, want %v", err, ErrProxyPledge)
+	}
+	if err := state.MinerBecome(proxy, common.Address{}); err != ErrProxyPledge {
+		t.Errorf("miner become error mismatch: have %v, want %v", err, ErrProxyPledge)
+	}
+	if have := state.GetBalance(proxy); have.Cmp(new(big.Int).Mul(amount, big.NewInt(2))) != 0 {
+		t.Errorf("rejected pledges moved funds: have %v", have)
+	}
+	if state.GetValidators(types.ValidatorStorageAddress).GetValidatorByAddr(proxy).Addr == proxy {
+		t.Errorf("proxy joined the validator pool")
+	}
+	// The validator itself can pledge more
+	state.AddBalance(validator, amount)
+	if err := state.PledgeToken(validator, amount, proxy, big.NewInt(2)); err != nil {
+		t.Fatalf("failed to pledge more to validator: %v", err)
+	}
+}
+
+func TestGetAllValidatorProxies(t *testing.T) {
+	var (
+		state   = newStakingState(t)
+		proxied = []common.Address{
+			common.HexToAddress("0x2000000000000000000000000000000000000002"),
+			common.HexToAddress("0x2000000000000000000000000000000000000003"),
+		}
+		direct = common.HexToAddress("0x2000000000000000000000000000000000000004")
+	)
+	for i, validator := range proxied {
+		proxy := common.BigToAddress(big.NewInt(int64(0x4001 + i)))
+		state.AddBalance(validator, types.ValidatorBase())
+		if err := state.StakerPledge(validator, validator, types.ValidatorBase(), big.NewInt(1), &types.Wormholes{ProxyAddress: proxy.Hex()}); err != nil {
+			t.Fatalf("failed to pledge validator: %v", err)
+		}
+		if err := state.MinerBecome(validator, proxy); err != nil {
+			t.Fatalf("failed to add validator: %v", err)
+		}
+	}
+	registerValidator(t, state, direct)
+
+	proxies := state.GetAllValidatorProxies()
+	if len(proxies) != len(proxied) {
+		t.Fatalf("proxy count mismatch: have %d, want %d", len(proxies), len(proxied))
+	}
+	for _, v := range state.GetValidators(types.ValidatorStorageAddress).Validators {
+		want := state.GetValidatorProxy(v.Addr)
+		have, ok := proxies[v.Addr]
+		if ok != (want != common.Address{}) || have != want {
+			t.Errorf("validator %x: proxy mismatch: have %x (%v), want %x", v.Addr, have, ok, want)
+		}
+	}
+}
+
+func TestPunishEvilValidatorsEscalates(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		penalties = []params.EvilPenalty{{Coefficient: 20}, {Coefficient: 30, Remove: true}}
+	)
+	registerValidator(t, state, validator)
+	state.AddValidatorCoefficient(validator, types.DEFAULT_VALIDATOR_COEFFICIENT)
+	start := state.GetValidatorCoefficient(validator)
+
+	// A first offence costs part of the coefficient only
+	state.PunishEvilValidators([]common.Address{validator}, big.NewInt(100), penalties)
+	if have, want := state.GetValidatorCoefficient(validator), start-20; have != want {
+		t.Errorf("first offence coefficient mismatch: have %d, want %d", have, want)
+	}
+	if have := state.EvilOffences(validator); have != 1 {
+		t.Errorf("first offence count mismatch: have %d, want 1", have)
+	}
+	if !state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Fatalf("validator removed after first offence")
+	}
+	// A repeat offence costs more and drops the validator from the pool
+	state.PunishEvilValidators([]common.Address{validator}, big.NewInt(200), penalties)
+	if have, want := state.GetValidatorCoefficient(validator), start-50; have != want {
+		t.Errorf("second offence coefficient mismatch: have %d, want %d", have, want)
+	}
+	if have := state.EvilOffences(validator); have != 2 {
+		t.Errorf("second offence count mismatch: have %d, want 2", have)
+	}
+	if state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Errorf("validator still in pool after second offence")
+	}
+	// The offence count survives a commit
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	committed, err := New(root, state.db, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen state: %v", err)
+	}
+	if have := committed.EvilOffences(validator); have != 2 {
+		t.Errorf("committed offence count mismatch: have %d, want 2", have)
+	}
+}
+
+func TestPunishEvilValidatorsDefault(t *testing.T) {
+	state := newStakingState(t)
+	validator := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	registerValidator(t, state, validator)
+	state.AddValidatorCoefficient(validator, types.DEFAULT_VALIDATOR_COEFFICIENT)
+
+	// Without a schedule every offence resets the coefficient and nothing is recorded
+	state.PunishEvilValidators([]common.Address{validator}, big.NewInt(100), nil)
+	if have := state.GetValidatorCoefficient(validator); have != 1 {
+		t.Errorf("coefficient mismatch: have %d, want 1", have)
+	}
+	if have := state.EvilOffences(validator); have != 0 {
+		t.Errorf("offence count mismatch: have %d, want 0", have)
+	}
+}
+
+func TestGetPledgeBreakdown(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		stakers   = []common.Address{
+			common.HexToAddress("0x1000000000000000000000000000000000000001"),
+			common.HexToAddress("0x1000000000000000000000000000000000000002"),
+		}
+	)
+	registerValidator(t, state, validator)
+	for i, staker := range stakers {
+		state.AddBalance(staker, new(big.Int).Mul(types.StakerBase(), big.NewInt(2)))
+		if err := state.StakerPledge(staker, validator, types.StakerBase(), big.NewInt(int64(i+2)), &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge staker %d: %v", i, err)
+		}
+	}
+	// The first staker tops up, the second withdraws part of its stake
+	if err := state.StakerPledge(stakers[0], validator, types.StakerBase(), big.NewInt(5), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to top up pledge: %v", err)
+	}
+	withdrawn := new(big.Int).Div(types.StakerBase(), big.NewInt(4))
+	if err := state.NewCancelStakerPledge(stakers[1], validator, withdrawn, big.NewInt(6)); err != nil {
+		t.Fatalf("failed to withdraw pledge: %v", err)
+	}
+
+	breakdown := state.GetPledgeBreakdown(validator)
+	if have := state.GetPledgedBalance(validator); breakdown.Total.Cmp(have) != 0 {
+		t.Errorf("total mismatch: have %v, want pledged balance %v", breakdown.Total, have)
+	}
+	if breakdown.SelfPledged.Cmp(types.ValidatorBase()) != 0 {
+		t.Errorf("self pledge mismatch: have %v, want %v", breakdown.SelfPledged, types.ValidatorBase())
+	}
+	want := map[common.Address]*big.Int{
+		stakers[0]: new(big.Int).Mul(types.StakerBase(), big.NewInt(2)),
+		stakers[1]: new(big.Int).Sub(types.StakerBase(), withdrawn),
+	}
+	if len(breakdown.Delegations) != len(want) {
+		t.Fatalf("delegation count mismatch: have %d, want %d", len(breakdown.Delegations), len(want))
+	}
+	for _, pledge := range breakdown.Delegations {
+		if pledge.Balance.Cmp(want[pledge.Addr]) != 0 {
+			t.Errorf("delegation of %x mismatch: have %v, want %v", pledge.Addr, pledge.Balance, want[pledge.Addr])
+		}
+	}
+	// The breakdown is a copy, changing it leaves the state alone
+	breakdown.Delegations[0].Balance.SetInt64(0)
+	if have := state.GetPledgeBreakdown(validator).Total; have.Cmp(state.GetPledgedBalance(validator)) != 0 {
+		t.Errorf("breakdown shares the state's pledges")
+	}
+}
+
+func TestHasBeenSlashed(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		punished  = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		innocent  = common.HexToAddress("0x2000000000000000000000000000000000000003")
+		penalties = []params.EvilPenalty{{Coefficient: 10}}
+	)
+	registerValidator(t, state, punished)
+	registerValidator(t, state, innocent)
+
+	state.PunishEvilValidators([]common.Address{punished}, big.NewInt(150), penalties)
+	if slashed, count, last := state.HasBeenSlashed(punished); !slashed || count != 1 || last == nil || last.Uint64() != 150 {
+		t.Errorf("punished validator mismatch: have %v %d %v, want true 1 150", slashed, count, last)
+	}
+	if slashed, count, last := state.HasBeenSlashed(innocent); slashed || count != 0 || last != nil {
+		t.Errorf("innocent validator mismatch: have %v %d %v, want false 0 nil", slashed, count, last)
+	}
+	// The latest punishment replaces the recorded block
+	state.PunishEvilValidators([]common.Address{punished}, big.NewInt(300), penalties)
+	if slashed, count, last := state.HasBeenSlashed(punished); !slashed || count != 2 || last.Uint64() != 300 {
+		t.Errorf("repeat offender mismatch: have %v %d %v, want true 2 300", slashed, count, last)
+	}
+}
+
+func TestGetValidatorWeight(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		outsider  = common.HexToAddress("0x2000000000000000000000000000000000000003")
+	)
+	registerValidator(t, state, validator)
+	state.IncreaseValidatorCoefficient(validator, 30)
+
+	coefficient, stake, weight := state.GetValidatorWeight(validator)
+	if coefficient != state.GetValidatorCoefficient(validator) {
+		t.Errorf("coefficient mismatch: have %d, want %d", coefficient, state.GetValidatorCoefficient(validator))
+	}
+	if want := state.GetValidators(types.ValidatorStorageAddress).StakeBalance(validator); stake.Cmp(want) != 0 {
+		t.Errorf("stake mismatch: have %v, want %v", stake, want)
+	}
+	if want := new(big.Int).Mul(stake, big.NewInt(int64(coefficient))); weight.Cmp(want) != 0 {
+		t.Errorf("weight mismatch: have %v, want %v", weight, want)
+	}
+	if coefficient == 0 || stake.Sign() == 0 {
+		t.Fatalf("validator without weight: coefficient %d, stake %v", coefficient, stake)
+	}
+	if _, stake, weight := state.GetValidatorWeight(outsider); stake.Sign() != 0 || weight.Sign() != 0 {
+		t.Errorf("non-validator weighted: stake %v, weight %v", stake, weight)
+	}
+}
+
+func TestSelfProxyRejected(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		amount    = types.ValidatorBase()
+	)
+	state.AddBalance(validator, new(big.Int).Mul(amount, big.NewInt(2)))
+	if err := state.CheckProxy(validator, validator); err != ErrInvalidProxy {
+		t.Errorf("self proxied pledge error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	if err := state.PledgeToken(validator, amount, validator, big.NewInt(1)); err != ErrInvalidProxy {
+		t.Errorf("self proxied token pledge error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	registerValidator(t, state, validator)
+	if err := state.MinerConsign(validator, validator); err != ErrInvalidProxy {
+		t.Errorf("self consign error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	if err := state.ChangeValidatorProxy(validator, validator); err != ErrInvalidProxy {
+		t.Errorf("self proxy change error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	if proxy := state.GetValidators(types.ValidatorStorageAddress).GetValidatorByAddr(validator).Proxy; proxy != (common.Address{}) {
+		t.Errorf("validator proxy set to %x", proxy)
+	}
+}
+
+func TestCyclicProxyRejected(t *testing.T) {
+	var (
+		state = newStakingState(t)
+		a     = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		b     = common.HexToAddress("0x2000000000000000000000000000000000000003")
+		proxy = common.HexToAddress("0x4000000000000000000000000000000000000004")
+	)
+	registerValidator(t, state, a)
+	registerValidator(t, state, b)
+
+	// Neither validator can sign for the other
+	if err := state.MinerConsign(a, b); err != ErrInvalidProxy {
+		t.Errorf("consign to validator error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	if err := state.ChangeValidatorProxy(b, a); err != ErrInvalidProxy {
+		t.Errorf("proxy change to validator error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	if err := state.CheckProxy(b, a); err != ErrInvalidProxy {
+		t.Errorf("pledge proxied by validator error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	// A proxy bound to one validator can't be shared with another
+	if err := state.MinerConsign(a, proxy); err != nil {
+		t.Fatalf("failed to consign proxy: %v", err)
+	}
+	if err := state.ChangeValidatorProxy(b, proxy); err != ErrInvalidProxy {
+		t.Errorf("shared proxy error mismatch: have %v, want %v", err, ErrInvalidProxy)
+	}
+	if err := state.ChangeValidatorProxy(a, proxy); err != nil {
+		t.Errorf("validator rejected its own proxy: %v", err)
+	}
+	validators := state.GetValidators(types.ValidatorStorageAddress)
+	if have := validators.GetValidatorByAddr(a).Proxy; have != proxy {
+		t.Errorf("proxy mismatch: have %x, want %x", have, proxy)
+	}
+	if have := validators.GetValidatorByAddr(b).Proxy; have != (common.Address{}) {
+		t.Errorf("validator proxy set to %x", have)
+	}
+}
+
+// newRewardState returns a state with validators, each with delegators of
+// different pledges.
+func newRewardState(tb testing.TB, validators, delegators int) (*StateDB, []common.Address) {
+	state, err := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		tb.Fatalf("failed to create state: %v", err)
+	}
+	addrs := make([]common.Address, validators)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(0x2000 + i)))
+		state.AddBalance(addrs[i], types.ValidatorBase())
+		if err := state.StakerPledge(addrs[i], addrs[i], types.ValidatorBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+			tb.Fatalf("failed to pledge validator: %v", err)
+		}
+		if err := state.MinerBecome(addrs[i], common.Address{}); err != nil {
+			tb.Fatalf("failed to add validator: %v", err)
+		}
+		// The delegator rewards come out of the validator's balance
+		state.AddBalance(addrs[i], types.ValidatorBase())
+		for j := 0; j < delegators; j++ {
+			staker := common.BigToAddress(big.NewInt(int64(0x100000 + i*delegators + j)))
+			amount := new(big.Int).Mul(types.StakerBase(), big.NewInt(int64(j+1)))
+			state.AddBalance(staker, amount)
+			if err := state.StakerPledge(staker, addrs[i], amount, big.NewInt(1), &types.Wormholes{}); err != nil {
+				tb.Fatalf("failed to pledge staker: %v", err)
+			}
+		}
+	}
+	state.IntermediateRoot(true)
+	return state, addrs
+}
+
+// rewardRun returns count blocks from start, each rewarding a rotating subset
+// of validators.
+func rewardRun(validators []common.Address, start uint64, count int) []RewardBlock {
+	blocks := make([]RewardBlock, count)
+	for i := range blocks {
+		rewarded := make([]common.Address, 0, len(validators))
+		for j, v := range validators {
+			if (i+j)%3 != 0 {
+				rewarded = append(rewarded, v)
+			}
+		}
+		blocks[i] = RewardBlock{
+			Number:              new(big.Int).SetUint64(start + uint64(i)),
+			Validators:          rewarded,
+			ValidatorPercentage: uint64(30 + 10*(i%2)),
+		}
+	}
+	return blocks
+}
+
+func TestDistributeRewardsBatch(t *testing.T) {
+	// The run crosses a deflation period
+	start := types.ReduceRewardPeriod - 50
+	sequential, validators := newRewardState(t, 5, 4)
+	batched, _ := newRewardState(t, 5, 4)
+	blocks := rewardRun(validators, start, 100)
+
+	roots := batched.DistributeRewardsBatch(blocks, true)
+	if len(roots) != len(blocks) {
+		t.Fatalf("root count mismatch: have %d, want %d", len(roots), len(blocks))
+	}
+	for i, block := range blocks {
+		sequential.DistributeRewardsToStakers(block.Validators, block.Number, block.ValidatorPercentage)
+		if want := sequential.IntermediateRoot(true); roots[i] != want {
+			t.Fatalf("block %d: root mismatch: have %x, want %x", block.Number, roots[i], want)
+		}
+	}
+}
+
+func BenchmarkRewardCatchUp(b *testing.B) {
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			state, validators := newRewardState(b, 11, 20)
+			blocks := rewardRun(validators, 1, 100)
+			b.StartTimer()
+			for _, block := range blocks {
+				state.DistributeRewardsToStakers(block.Validators, block.Number, block.ValidatorPercentage)
+				state.IntermediateRoot(true)
+			}
+		}
+	})
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			state, validators := newRewardState(b, 11, 20)
+			blocks := rewardRun(validators, 1, 100)
+			b.StartTimer()
+			state.DistributeRewardsBatch(blocks, true)
+		}
+	})
+}
+
+func TestMinerBecomeAggregatedStake(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		stake     = types.StakerBase()
+	)
+	registerValidator(t, state, validator)
+
+	// A delegator pledge at the staker base, well below the validator base
+	state.AddBalance(staker, stake)
+	if err := state.StakerPledge(staker, validator, stake, big.NewInt(2), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge staker base: %v", err)
+	}
+	if err := state.ResetMinerBecome(validator); err != nil {
+		t.Fatalf("failed to reset validator: %v", err)
+	}
+	want := new(big.Int).Add(types.ValidatorBase(), stake)
+	if have := state.GetValidators(types.ValidatorStorageAddress).StakeBalance(validator); have.Cmp(want) != 0 {
+		t.Errorf("pool stake mismatch: have %v, want %v", have, want)
+	}
+
+	// The delegated stake keeps the validator in the pool once its own
+	// pledge drops below the validator base
+	state.GetOrNewAccountStateObject(validator).SubPledgedBalance(stake)
+	if err := state.ResetMinerBecome(validator); err != nil {
+		t.Fatalf("failed to reset validator: %v", err)
+	}
+	if !state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Fatalf("validator with aggregated stake at the base dropped from pool")
+	}
+	state.GetOrNewAccountStateObject(validator).SubPledgedBalance(big.NewInt(1))
+	if err := state.ResetMinerBecome(validator); err != nil {
+		t.Fatalf("failed to reset validator: %v", err)
+	}
+	if state.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		t.Errorf("validator with aggregated stake below the base kept in pool")
+	}
+}
+
+func TestRefundDelegator(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		refunded  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		kept      = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		over      = new(big.Int).Mul(types.StakerBase(), big.NewInt(3))
+		stake     = types.StakerBase()
+	)
+	registerValidator(t, state, validator)
+	for addr, amount := range map[common.Address]*big.Int{refunded: over, kept: stake} {
+		state.AddBalance(addr, amount)
+		if err := state.StakerPledge(addr, validator, amount, big.NewInt(2), &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge %x: %v", addr, err)
+		}
+	}
+	// As after a pledge transaction, the pool stake aggregates the delegations
+	if err := state.ResetMinerBecome(validator); err != nil {
+		t.Fatalf("failed to reset validator: %v", err)
+	}
+	pledged := state.GetPledgedBalance(validator)
+	poolStake := state.GetValidators(types.ValidatorStorageAddress).StakeBalance(validator)
+
+	if err := state.RefundDelegator(validator, refunded); err != nil {
+		t.Fatalf("failed to refund delegator: %v", err)
+	}
+	if have, want := state.GetPledgedBalance(validator), new(big.Int).Sub(pledged, over); have.Cmp(want) != 0 {
+		t.Errorf("validator pledged balance mismatch: have %v, want %v", have, want)
+	}
+	if have, want := state.GetValidators(types.ValidatorStorageAddress).StakeBalance(validator), new(big.Int).Sub(poolStake, over); have.Cmp(want) != 0 {
+		t.Errorf("pool stake mismatch: have %v, want %v", have, want)
+	}
+	if have := state.GetBalance(refunded); have.Cmp(over) != 0 {
+		t.Errorf("refunded balance mismatch: have %v, want %v", have, over)
+	}
+	if have := state.GetStakerPledgedBalance(refunded, validator); have.Sign() != 0 {
+		t.Errorf("refunded pledge left: have %v", have)
+	}
+	// The other delegation and the validator's own pledge are untouched
+	if have := state.GetStakerPledgedBalance(kept, validator); have.Cmp(stake) != 0 {
+		t.Errorf("kept pledge mismatch: have %v, want %v", have, stake)
+	}
+	if have := state.GetBalance(kept); have.Sign() != 0 {
+		t.Errorf("kept delegator refunded: have %v", have)
+	}
+	if have := state.GetStakerPledgedBalance(validator, validator); have.Cmp(types.ValidatorBase()) != 0 {
+		t.Errorf("validator own pledge mismatch: have %v, want %v", have, types.ValidatorBase())
+	}
+	breakdown := state.GetPledgeBreakdown(validator)
+	if len(breakdown.Delegations) != 1 || breakdown.Delegations[0].Addr != kept {
+		t.Errorf("delegations mismatch: have %+v, want only %x", breakdown.Delegations, kept)
+	}
+
+	// Nothing is left to refund, and a validator can't refund itself
+	if err := state.RefundDelegator(validator, refunded); err != ErrNoDelegation {
+		t.Errorf("repeated refund error mismatch: have %v, want %v", err, ErrNoDelegation)
+	}
+	if err := state.RefundDelegator(validator, validator); err != ErrNoDelegation {
+		t.Errorf("self refund error mismatch: have %v, want %v", err, ErrNoDelegation)
+	}
+}
+
+func TestAccountKindUpdates(t *testing.T) {
+	defer func(enabled bool) { metrics.EnabledExpensive = enabled }(metrics.EnabledExpensive)
+	metrics.EnabledExpensive = true
+
+	var (
+		state      = newStakingState(t)
+		validators = 2
+		stakers    = 10
+	)
+	// A staking heavy block: validators joining and many delegators pledging
+	for i := 0; i < validators; i++ {
+		validator := common.BigToAddress(big.NewInt(int64(0x2000 + i)))
+		registerValidator(t, state, validator)
+		for j := 0; j < stakers/validators; j++ {
+			staker := common.BigToAddress(big.NewInt(int64(0x1000 + i*stakers + j)))
+			state.AddBalance(staker, types.StakerBase())
+			if err := state.StakerPledge(staker, validator, types.StakerBase(), big.NewInt(2), &types.Wormholes{}); err != nil {
+				t.Fatalf("failed to pledge: %v", err)
+			}
+		}
+	}
+	state.AddBalance(common.HexToAddress("0x3000000000000000000000000000000000000003"), big.NewInt(1))
+	if _, err := state.Commit(false); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	want := map[string]int{
+		AccountKindSystem:    1, // the validator pool
+		AccountKindValidator: validators,
+		AccountKindStaker:    stakers,
+		AccountKindPlain:     1,
+	}
+	var total time.Duration
+	for kind, updates := range state.AccountKindUpdates {
+		if updates.Count != want[kind] {
+			t.Errorf("%s: account count mismatch: have %d, want %d", kind, updates.Count, want[kind])
+		}
+		if updates.Count > 0 && updates.Time <= 0 {
+			t.Errorf("%s: no update time measured for %d accounts", kind, updates.Count)
+		}
+		total += updates.Time
+	}
+	if len(state.AccountKindUpdates) != len(want) {
+		t.Errorf("kinds mismatch: have %v, want %v", state.AccountKindUpdates, want)
+	}
+	if total != state.AccountUpdates {
+		t.Errorf("breakdown does not add up: have %v, want %v", total, state.AccountUpdates)
+	}
+}
+
+// Tests that delegators may pledge to a candidate below the validator base,
+// lifting it into the pool once the pledges together reach the base.
+func TestStakerPledgeLiftsCandidate(t *testing.T) {
+	var (
+		state     = newStakingState(t)
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		candidate = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		half      = new(big.Int).Div(types.ValidatorBase(), big.NewInt(2))
+	)
+	state.AddBalance(candidate, half)
+	state.AddBalance(staker, half)
+	if err := state.StakerPledge(candidate, candidate, half, big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to self pledge: %v", err)
+	}
+	if err := state.StakerPledge(staker, candidate, half, big.NewInt(2), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge to candidate: %v", err)
+	}
+	if err := state.ResetMinerBecome(candidate); err != nil {
+		t.Fatalf("failed to reset candidate: %v", err)
+	}
+	if !state.GetValidators(types.ValidatorStorageAddress).Exist(candidate) {
+		t.Errorf("candidate not in pool with the validator base pledged")
+	}
+}
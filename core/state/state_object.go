@@ -51,7 +51,7 @@ func (s Storage) String() (str string) {
 }
 
 func (s Storage) Copy() Storage {
-	cpy := make(Storage)
+	cpy := make(Storage, len(s))
 	for key, value := range s {
 		cpy[key] = value
 	}
@@ -132,37 +132,39 @@ func newObject(db *StateDB, address common.Address, data Account) *stateObject {
 	if data.Root == (common.Hash{}) {
 		data.Root = emptyRoot
 	}
-	newStateObject := &stateObject{
+	return &stateObject{
 		db:             db,
 		address:        address,
 		addrHash:       crypto.Keccak256Hash(address[:]),
+		data:           copyAccount(data),
 		originStorage:  make(Storage),
 		pendingStorage: make(Storage),
 		dirtyStorage:   make(Storage),
 	}
+}
 
-	newStateObject.data.Nonce = data.Nonce
-	newStateObject.data.Balance = new(big.Int).Set(data.Balance)
-	newStateObject.data.CodeHash = make([]byte, len(data.CodeHash))
-	copy(newStateObject.data.CodeHash, data.CodeHash)
-	newStateObject.data.Root = data.Root
+// copyAccount returns a deep copy of the account data.
+func copyAccount(data Account) Account {
+	cpy := Account{
+		Nonce:    data.Nonce,
+		Balance:  new(big.Int).Set(data.Balance),
+		Root:     data.Root,
+		CodeHash: make([]byte, len(data.CodeHash)),
+		Extra:    make([]byte, len(data.Extra)),
+	}
+	copy(cpy.CodeHash, data.CodeHash)
+	copy(cpy.Extra, data.Extra)
 
 	if data.Worm != nil {
-		newStateObject.data.Worm = data.Worm.DeepCopy()
+		cpy.Worm = data.Worm.DeepCopy()
 	}
-
 	if data.Csbt != nil {
-		newStateObject.data.Csbt = data.Csbt.DeepCopy()
+		cpy.Csbt = data.Csbt.DeepCopy()
 	}
-
 	if data.Staker != nil {
-		newStateObject.data.Staker = data.Staker.DeepCopy()
+		cpy.Staker = data.Staker.DeepCopy()
 	}
-
-	newStateObject.data.Extra = make([]byte, len(data.Extra))
-	copy(newStateObject.data.Extra, data.Extra)
-
-	return newStateObject
+	return cpy
 }
 
 // EncodeRLP implements rlp.Encoder.
@@ -488,17 +490,24 @@ func (s *stateObject) setBalance(amount *big.Int) {
 }
 
 func (s *stateObject) deepCopy(db *StateDB) *stateObject {
-	stateObject := newObject(db, s.address, s.data)
+	// Built directly rather than through newObject, which would hash the
+	// address again and allocate storage maps only to replace them
+	stateObject := &stateObject{
+		db:             db,
+		address:        s.address,
+		addrHash:       s.addrHash,
+		data:           copyAccount(s.data),
+		code:           s.code,
+		originStorage:  s.originStorage.Copy(),
+		pendingStorage: s.pendingStorage.Copy(),
+		dirtyStorage:   s.dirtyStorage.Copy(),
+		suicided:       s.suicided,
+		dirtyCode:      s.dirtyCode,
+		deleted:        s.deleted,
+	}
 	if s.trie != nil {
 		stateObject.trie = db.db.CopyTrie(s.trie)
 	}
-	stateObject.code = s.code
-	stateObject.dirtyStorage = s.dirtyStorage.Copy()
-	stateObject.originStorage = s.originStorage.Copy()
-	stateObject.pendingStorage = s.pendingStorage.Copy()
-	stateObject.suicided = s.suicided
-	stateObject.dirtyCode = s.dirtyCode
-	stateObject.deleted = s.deleted
 	return stateObject
 }
 
@@ -826,6 +835,16 @@ func (s *stateObject) AddCoefficient(coe uint8) {
 	s.SetCoefficient(VALIDATOR_COEFFICIENT)
 }
 
+// IncreaseCoefficient adds coe to the coefficient, up to VALIDATOR_COEFFICIENT.
+// Unlike AddCoefficient it doesn't restore the maximum at once.
+func (s *stateObject) IncreaseCoefficient(coe uint8) {
+	sum := uint16(s.Coefficient()) + uint16(coe)
+	if sum > VALIDATOR_COEFFICIENT {
+		sum = VALIDATOR_COEFFICIENT
+	}
+	s.SetCoefficient(uint8(sum))
+}
+
 func (s *stateObject) SubCoefficient(coe uint8) {
 	var result uint8
 
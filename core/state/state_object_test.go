@@ -18,9 +18,13 @@ package state
 
 import (
 	"bytes"
+	"math/big"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func BenchmarkCutOriginal(b *testing.B) {
@@ -44,3 +48,77 @@ func BenchmarkCutCustomTrim(b *testing.B) {
 		common.TrimLeftZeroes(value[:])
 	}
 }
+
+// Tests that accounts carrying the Wormholes extensions survive an RLP round
+// trip unchanged, so re-encoding a decoded account yields the same trie value.
+func TestAccountRLPRoundTrip(t *testing.T) {
+	addr := common.HexToAddress("0x01")
+	accounts := []Account{
+		{Nonce: 1, Balance: big.NewInt(1), Root: emptyRoot, CodeHash: emptyCodeHash},
+		{
+			Nonce:    2,
+			Balance:  big.NewInt(100),
+			Root:     emptyRoot,
+			CodeHash: emptyCodeHash,
+			Worm: &types.WormholesExtension{
+				PledgedBalance:     big.NewInt(10),
+				PledgedBlockNumber: big.NewInt(5),
+				Coefficient:        70,
+				StakerExtension: types.StakersExtensionList{StakerExtensions: []*types.StakerExtension{
+					{Addr: addr, Balance: big.NewInt(3), BlockNumber: big.NewInt(4)},
+				}},
+				ValidatorExtension: types.ValidatorsExtensionList{ValidatorExtensions: []*types.ValidatorExtension{
+					{Addr: addr, Balance: big.NewInt(7), BlockNumber: big.NewInt(8)},
+				}},
+				ValidatorProxy: addr,
+			},
+		},
+		{
+			Balance:  new(big.Int),
+			Root:     emptyRoot,
+			CodeHash: emptyCodeHash,
+			Csbt:     &types.AccountCSBT{Owner: addr, Creator: common.HexToAddress("0x02")},
+			Extra:    []byte{0x01, 0x02},
+		},
+		{
+			Balance:  new(big.Int),
+			Root:     emptyRoot,
+			CodeHash: emptyCodeHash,
+			Staker: &types.AccountStaker{
+				Mint:         types.MintDeep{UserMint: big.NewInt(1), OfficialMint: big.NewInt(2)},
+				Validators:   *types.NewValidatorList([]*types.Validator{{Addr: addr, Balance: big.NewInt(9), Proxy: addr}}),
+				CSBTCreators: types.StakerList{Stakers: []*types.Staker{{Addr: addr, Balance: big.NewInt(6)}}},
+			},
+		},
+	}
+	for i, acc := range accounts {
+		enc, err := rlp.EncodeToBytes(acc)
+		if err != nil {
+			t.Fatalf("account %d: failed to encode: %v", i, err)
+		}
+		var dec Account
+		if err := rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatalf("account %d: failed to decode: %v", i, err)
+		}
+		reenc, err := rlp.EncodeToBytes(dec)
+		if err != nil {
+			t.Fatalf("account %d: failed to re-encode: %v", i, err)
+		}
+		if !bytes.Equal(enc, reenc) {
+			t.Errorf("account %d: encoding not stable:\nhave %x\nwant %x", i, reenc, enc)
+		}
+	}
+}
+
+func BenchmarkUpdateStateObject(b *testing.B) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	obj := state.GetOrNewStateObject(common.HexToAddress("0x01"))
+	obj.SetBalance(big.NewInt(100))
+	obj.data.Worm = &types.WormholesExtension{PledgedBalance: big.NewInt(10), PledgedBlockNumber: big.NewInt(5)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.updateStateObject(obj)
+	}
+}
@@ -18,11 +18,15 @@ package state
 
 import (
 	"bytes"
+	"errors"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
@@ -251,3 +255,117 @@ func compareStateObjects(so0, so1 *stateObject, t *testing.T) {
 		}
 	}
 }
+
+func TestVerifySnapshotCommit(t *testing.T) {
+	defer func(old bool) { VerifySnapshotCommits = old }(VerifySnapshotCommits)
+	VerifySnapshotCommits = true
+
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		db     = NewDatabase(diskdb)
+		addr   = common.BytesToAddress([]byte{0x01})
+	)
+	// Create a base state on disk and a snapshot tree on top of it
+	state, _ := New(common.Hash{}, db, nil)
+	state.AddBalance(addr, big.NewInt(1))
+	root, _ := state.Commit(false)
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	snaps, err := snapshot.New(diskdb, db.TrieDB(), 16, root, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	// A regular commit passes verification, extended account fields included
+	state, _ = New(root, db, snaps)
+	state.AddBalance(addr, big.NewInt(1))
+	state.AddValidatorCoefficient(addr, 70)
+	if root, err = state.Commit(false); err != nil {
+		t.Fatalf("consistent commit rejected: %v", err)
+	}
+	// Commit a snapshot account that doesn't match what goes into the trie
+	state, _ = New(root, db, snaps)
+	state.AddBalance(addr, big.NewInt(1))
+	state.IntermediateRoot(false)
+	obj := state.getStateObject(addr)
+	state.snapAccounts[obj.addrHash] = snapshot.SlimAccountRLP(obj.data.Nonce, big.NewInt(1000), obj.data.Root, obj.data.CodeHash,
+		obj.data.Worm, obj.data.Csbt, obj.data.Staker, obj.data.Extra)
+	if _, err := state.Commit(false); !errors.Is(err, ErrSnapshotMismatch) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrSnapshotMismatch)
+	}
+}
+
+func TestDumpKinds(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	// One account of each kind, and a plain one
+	var (
+		validator = common.HexToAddress("0x1001")
+		staker    = common.HexToAddress("0x1002")
+		nft       = common.HexToAddress("0x1003")
+		plain     = common.HexToAddress("0x1004")
+	)
+	state.AddBalance(validator, types.ValidatorBase())
+	if err := state.StakerPledge(validator, validator, types.ValidatorBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge: %v", err)
+	}
+	if err := state.MinerBecome(validator, common.Address{}); err != nil {
+		t.Fatalf("failed to add validator: %v", err)
+	}
+	state.AddBalance(staker, types.StakerBase())
+	if err := state.StakerPledge(staker, validator, types.StakerBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge: %v", err)
+	}
+	state.GetOrNewNFTStateObject(nft).data.Csbt = &types.AccountCSBT{Owner: plain, Creator: plain}
+	state.AddBalance(plain, big.NewInt(1))
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	state, _ = New(root, state.db, nil)
+
+	kinds := func(conf *DumpConfig) map[common.Address][]string {
+		dump := state.IteratorDump(conf)
+		have := make(map[common.Address][]string)
+		for addr, account := range dump.Accounts {
+			have[addr] = account.Kinds
+		}
+		return have
+	}
+	all := kinds(&DumpConfig{SkipCode: true, SkipStorage: true})
+	want := map[common.Address][]string{
+		validator:                     {AccountKindValidator, AccountKindStaker},
+		staker:                        {AccountKindStaker},
+		nft:                           {AccountKindNFT},
+		plain:                         nil,
+		types.ValidatorStorageAddress: {AccountKindSystem},
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Fatalf("classification mismatch: have %v, want %v", all, want)
+	}
+	for kind, addrs := range map[string][]common.Address{
+		AccountKindValidator: {validator},
+		AccountKindStaker:    {validator, staker},
+		AccountKindNFT:       {nft},
+		AccountKindSystem:    {types.ValidatorStorageAddress},
+	} {
+		have := kinds(&DumpConfig{SkipCode: true, SkipStorage: true, Kinds: []string{kind}})
+		if len(have) != len(addrs) {
+			t.Errorf("kind %s: have %v, want %x", kind, have, addrs)
+		}
+		for _, addr := range addrs {
+			if have[addr] == nil {
+				t.Errorf("kind %s: %x missing", kind, addr)
+			}
+		}
+	}
+	// Pages are counted in matching accounts
+	page := state.IteratorDump(&DumpConfig{SkipCode: true, SkipStorage: true, Kinds: []string{AccountKindValidator, AccountKindNFT}, Max: 1})
+	if len(page.Accounts) != 1 || page.Next == nil {
+		t.Fatalf("first page mismatch: %d accounts, next %x", len(page.Accounts), page.Next)
+	}
+	rest := state.IteratorDump(&DumpConfig{SkipCode: true, SkipStorage: true, Kinds: []string{AccountKindValidator, AccountKindNFT}, Start: page.Next})
+	if len(rest.Accounts) != 1 {
+		t.Fatalf("second page mismatch: %d accounts", len(rest.Accounts))
+	}
+}
@@ -18,6 +18,7 @@
 package state
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -33,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -45,8 +47,45 @@ type revision struct {
 var (
 	// emptyRoot is the known root hash of an empty trie.
 	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// ErrBelowValidatorBase is returned if an account pledged less than the
+	// validator base tries to join the validator pool.
+	ErrBelowValidatorBase = errors.New("pledged balance is less than the validator base")
+
+	// ErrProxyPledge is returned if an account serving as another validator's
+	// proxy is pledged to, as rewards of the proxy are remapped to the validator.
+	ErrProxyPledge = errors.New("pledge address is another validator's proxy")
+
+	// ErrInvalidProxy is returned if a validator names itself, a validator or
+	// another validator's proxy as its proxy, which would make the proxy to
+	// validator remapping ambiguous or cyclic.
+	ErrInvalidProxy = errors.New("invalid validator proxy")
+
+	// ErrNoDelegation is returned if a validator refunds an account that hasn't
+	// pledged to it, or refunds itself.
+	ErrNoDelegation = errors.New("no delegator pledge to refund")
+
+	// ErrSnapshotMismatch is returned by Commit in snapshot verification mode if
+	// an account in the new snapshot layer differs from the account trie.
+	ErrSnapshotMismatch = errors.New("snapshot diverged from the account trie")
+
+	// ErrSNFTNotExist is returned if an SNFT that isn't in the state is priced.
+	ErrSNFTNotExist = errors.New("snft does not exist")
+
+	// ErrSNFTMergeNumber is returned if an SNFT is priced with a level or merge
+	// number other than those of a single unmerged piece.
+	ErrSNFTMergeNumber = errors.New("snft merge number mismatch")
 )
 
+// VerifySnapshotCommits enables re-reading a sample of the accounts updated by
+// every Commit from both the account trie and the new snapshot layer, failing
+// the commit if they differ. It is a debugging aid for the extended account
+// encoding and costs extra reads on every block.
+var VerifySnapshotCommits = false
+
+// snapshotVerifySamples is the number of accounts checked per verified commit.
+const snapshotVerifySamples = 16
+
 type proofList [][]byte
 
 func (n *proofList) Put(key []byte, value []byte) error {
@@ -98,6 +137,9 @@ type StateDB struct {
 
 	preimages map[common.Hash][]byte
 
+	// SNFTs assigned to exchangers while finalizing the block
+	snftAssignments []*types.SNFTAssignment
+
 	// Per-transaction access list
 	accessList *accessList
 
@@ -119,6 +161,17 @@ type StateDB struct {
 	SnapshotAccountReads time.Duration
 	SnapshotStorageReads time.Duration
 	SnapshotCommits      time.Duration
+
+	// AccountKindUpdates breaks AccountUpdates down by account kind, see
+	// AccountKindPlain and AccountKindValidator and its siblings.
+	AccountKindUpdates map[string]KindUpdates
+}
+
+// KindUpdates is the number of accounts of a kind encoded and written to the
+// account trie, and the time it took.
+type KindUpdates struct {
+	Count int
+	Time  time.Duration
 }
 
 // New creates a new state from a given trie.
@@ -453,18 +506,23 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 func (s *StateDB) updateStateObject(obj *stateObject) {
 	// Track the amount of time wasted on updating the account from the trie
 	if metrics.EnabledExpensive {
-		defer func(start time.Time) { s.AccountUpdates += time.Since(start) }(time.Now())
+		defer func(start time.Time, kind string) {
+			elapsed := time.Since(start)
+			s.AccountUpdates += elapsed
+
+			if s.AccountKindUpdates == nil {
+				s.AccountKindUpdates = make(map[string]KindUpdates)
+			}
+			updates := s.AccountKindUpdates[kind]
+			updates.Count++
+			updates.Time += elapsed
+			s.AccountKindUpdates[kind] = updates
+		}(time.Now(), updateKind(&obj.data))
 	}
 	// Encode the account and update the account trie
 	addr := obj.Address()
 
 	data, err := rlp.EncodeToBytes(obj)
-
-	var tempObj stateObject
-	var acc Account
-	rlp.DecodeBytes(data, &tempObj)
-	rlp.DecodeBytes(data, &acc)
-
 	if err != nil {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
@@ -699,26 +757,24 @@ func (s *StateDB) GetOrNewStakerStateObject(addr common.Address) *stateObject {
 	stateObject := s.getStateObject(addr)
 	if stateObject == nil {
 		stateObject, _ = s.createObject(addr)
-		stateObject.data.Staker = &types.AccountStaker{}
-		if addr == types.MintDeepStorageAddress {
-			stateObject.data.Staker.Mint.UserMint = big.NewInt(1)
-			maskB, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
-			stateObject.data.Staker.Mint.OfficialMint = maskB
-		}
 	}
-
 	if stateObject.data.Staker == nil {
-		stateObject.data.Staker = &types.AccountStaker{}
-		if addr == types.MintDeepStorageAddress {
-			stateObject.data.Staker.Mint.UserMint = big.NewInt(1)
-			maskB, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
-			stateObject.data.Staker.Mint.OfficialMint = maskB
-		}
+		stateObject.data.Staker = newAccountStaker(addr)
 	}
-
 	return stateObject
 }
 
+// newAccountStaker returns the initial staker data of the system storage addr.
+// The mint storage starts its cursors at the first user and official NFT.
+func newAccountStaker(addr common.Address) *types.AccountStaker {
+	staker := &types.AccountStaker{}
+	if addr == types.MintDeepStorageAddress {
+		staker.Mint.UserMint = big.NewInt(1)
+		staker.Mint.OfficialMint = types.SNFTBase()
+	}
+	return staker
+}
+
 // createObject creates a new state object. If there is an existing account with
 // the given address, it is overwritten and returned as the second return value.
 func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject) {
@@ -785,7 +841,7 @@ func (s *StateDB) CreateStakerAccount(addr common.Address) {
 	//newObj.data.Staker = &types.AccountStaker{}
 	//if addr == types.MintDeepStorageAddress {
 	//	newObj.data.Staker.Mint.UserMint = big.NewInt(1)
-	//	maskB, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
+	//	maskB := types.SNFTBase()
 	//	newObj.data.Staker.Mint.OfficialMint = maskB
 	//}
 	s.GetOrNewStakerStateObject(addr)
@@ -823,6 +879,18 @@ func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common
 // Copy creates a deep, independent copy of the state.
 // Snapshots of the copied state cannot be applied to the copy.
 func (s *StateDB) Copy() *StateDB {
+	return s.copy(true)
+}
+
+// LightCopy creates an independent copy of the state for reading and running
+// calls on, like the miner's pending snapshot. It leaves out what is only needed
+// to commit the state: logs, preimages, the access list, the prefetcher and the
+// pending snapshot diffs. The copy must not be committed.
+func (s *StateDB) LightCopy() *StateDB {
+	return s.copy(false)
+}
+
+func (s *StateDB) copy(full bool) *StateDB {
 	// Copy all the basic fields, initialize the memory ones
 	state := &StateDB{
 		db:                  s.db,
@@ -831,9 +899,8 @@ func (s *StateDB) Copy() *StateDB {
 		stateObjectsPending: make(map[common.Address]struct{}, len(s.stateObjectsPending)),
 		stateObjectsDirty:   make(map[common.Address]struct{}, len(s.journal.dirties)),
 		refund:              s.refund,
-		logs:                make(map[common.Hash][]*types.Log, len(s.logs)),
-		logSize:             s.logSize,
-		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
+		logs:                make(map[common.Hash][]*types.Log),
+		preimages:           make(map[common.Hash][]byte),
 		journal:             newJournal(),
 		hasher:              crypto.NewKeccakState(),
 	}
@@ -868,6 +935,22 @@ func (s *StateDB) Copy() *StateDB {
 		}
 		state.stateObjectsDirty[addr] = struct{}{}
 	}
+	if !full {
+		state.accessList = newAccessList()
+		if s.snaps != nil {
+			// Storage reads still consult the destructs, the diffs are only
+			// needed on commit
+			state.snaps, state.snap = s.snaps, s.snap
+			state.snapDestructs = make(map[common.Hash]struct{}, len(s.snapDestructs))
+			for k, v := range s.snapDestructs {
+				state.snapDestructs[k] = v
+			}
+			state.snapAccounts = make(map[common.Hash][]byte)
+			state.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+		}
+		return state
+	}
+	state.logSize = s.logSize
 	for hash, logs := range s.logs {
 		cpy := make([]*types.Log, len(logs))
 		for i, l := range logs {
@@ -879,6 +962,10 @@ func (s *StateDB) Copy() *StateDB {
 	for hash, preimage := range s.preimages {
 		state.preimages[hash] = preimage
 	}
+	for _, assignment := range s.snftAssignments {
+		cpy := *assignment
+		state.snftAssignments = append(state.snftAssignments, &cpy)
+	}
 	// Do we need to copy the access list? In practice: No. At the start of a
 	// transaction, the access list is empty. In practice, we only ever copy state
 	// _between_ transactions/blocks, never in the middle of a transaction.
@@ -1136,8 +1223,15 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		}
 		// Only update if there's a state transition (skip empty Clique blocks)
 		if parent := s.snap.Root(); parent != root {
+			var samples []common.Address
+			if VerifySnapshotCommits {
+				samples = s.snapshotSamples(snapshotVerifySamples)
+			}
 			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
 				log.Warn("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
+			} else if err := s.verifySnapshot(root, samples); err != nil {
+				log.Error("Snapshot verification failed", "root", root, "err", err)
+				return common.Hash{}, err
 			}
 			// Keep 128 diff layers in the memory, persistent layer is 129th.
 			// - head layer is paired with HEAD state
@@ -1152,6 +1246,53 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	return root, err
 }
 
+// snapshotSamples returns up to n addresses whose accounts are written to the
+// snapshot by the pending commit.
+func (s *StateDB) snapshotSamples(n int) []common.Address {
+	samples := make([]common.Address, 0, n)
+	for addr, obj := range s.stateObjects {
+		if len(samples) == n {
+			break
+		}
+		if _, ok := s.snapAccounts[obj.addrHash]; ok {
+			samples = append(samples, addr)
+		}
+	}
+	return samples
+}
+
+// verifySnapshot checks that the snapshot layer of root holds the same account
+// data as the account trie for every address in samples.
+func (s *StateDB) verifySnapshot(root common.Hash, samples []common.Address) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	snap := s.snaps.Snapshot(root)
+	if snap == nil {
+		return fmt.Errorf("%w: no snapshot layer for root %x", ErrSnapshotMismatch, root)
+	}
+	for _, addr := range samples {
+		want, err := s.trie.TryGet(addr[:])
+		if err != nil {
+			return err
+		}
+		slim, err := snap.AccountRLP(crypto.HashData(s.hasher, addr[:]))
+		if err != nil {
+			return err
+		}
+		var have []byte
+		if len(slim) > 0 {
+			if have, err = snapshot.FullAccountRLP(slim); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(have, want) {
+			return fmt.Errorf("%w: account %x, snapshot %x, trie %x", ErrSnapshotMismatch, addr, have, want)
+		}
+	}
+	return nil
+}
+
 // PrepareAccessList handles the preparatory steps for executing a state transition with
 // regards to both EIP-2929 and EIP-2930:
 //
@@ -1349,8 +1490,13 @@ func (s *StateDB) IsOfficialNFT(nftAddress common.Address) bool {
 	return false
 }
 
+// RewardPeriod returns the index of the reward reduction period the block falls in.
+func RewardPeriod(blocknumber uint64) uint64 {
+	return blocknumber / types.ReduceRewardPeriod
+}
+
 func GetRewardAmount(blocknumber uint64, initamount *big.Int) *big.Int {
-	times := blocknumber / types.ReduceRewardPeriod
+	times := RewardPeriod(blocknumber)
 	rewardratio := gomath.Pow(types.DeflationRate, float64(times))
 	u, _ := new(big.Float).Mul(big.NewFloat(rewardratio), new(big.Float).SetInt(initamount)).Uint64()
 
@@ -1392,6 +1538,7 @@ func (s *StateDB) CreateNFTByOfficial16(validators, exchangers []common.Address,
 			stateObject.SetNFTInfo(
 				awardee,
 				awardee)
+			s.snftAssignments = append(s.snftAssignments, &types.SNFTAssignment{Address: nftAddr, Owner: awardee})
 
 			mintStateObject.AddOfficialMint(big.NewInt(1))
 
@@ -1399,28 +1546,107 @@ func (s *StateDB) CreateNFTByOfficial16(validators, exchangers []common.Address,
 	}
 }
 
-func (s *StateDB) DistributeRewardsToStakers(validators []common.Address, blocknumber *big.Int) {
+// SNFTAssignments returns the SNFTs assigned to exchangers by
+// CreateNFTByOfficial16 on this state.
+func (s *StateDB) SNFTAssignments() []*types.SNFTAssignment {
+	return s.snftAssignments
+}
+
+// DistributeRewardsToStakers pays each validator's stakers their share of the
+// block reward, validatorPercentage being the percent the validator keeps.
+func (s *StateDB) DistributeRewardsToStakers(validators []common.Address, blocknumber *big.Int, validatorPercentage uint64) {
 	rewardAmount := GetRewardAmount(blocknumber.Uint64(), types.DREBlockReward)
-	stakersPercentage := 100 - types.PercentageValidatorReward
+	stakersPercentage := 100 - validatorPercentage
 	sumStakerReward := new(big.Int).Div(new(big.Int).Mul(rewardAmount, big.NewInt(int64(stakersPercentage))), big.NewInt(100))
 	for _, owner := range validators {
 		ownerObject := s.GetOrNewAccountStateObject(owner)
 		if ownerObject != nil {
-			stakerList := ownerObject.GetValidatorExtension()
-			ownerStakerBalance := stakerList.GetBalance(owner)
-			sumStakerBalance := new(big.Int).Sub(stakerList.GetAllBalance(), ownerStakerBalance)
-			actualSumStakerReward := big.NewInt(0)
-			for _, staker := range stakerList.ValidatorExtensions {
-				if staker.Addr != owner {
-					stakerReward := new(big.Int).Div(new(big.Int).Mul(sumStakerReward, staker.Balance), sumStakerBalance)
-					stakerObject := s.GetOrNewAccountStateObject(staker.Addr)
-					stakerObject.AddBalance(stakerReward)
-					actualSumStakerReward.Add(actualSumStakerReward, stakerReward)
-				}
+			s.payStakers(ownerObject, newStakerPayout(ownerObject.GetValidatorExtension(), owner, sumStakerReward))
+		}
+	}
+}
+
+// RewardBlock is the staker reward distribution of one block.
+type RewardBlock struct {
+	Number              *big.Int
+	Validators          []common.Address
+	ValidatorPercentage uint64
+}
+
+// stakerPayout is what the delegators of a validator are paid for one block.
+type stakerPayout struct {
+	stakers []common.Address
+	rewards []*big.Int
+	total   *big.Int
+}
+
+// DistributeRewardsBatch applies the staker rewards of a contiguous run of
+// blocks and returns the intermediate root after each of them, the same roots
+// DistributeRewardsToStakers and IntermediateRoot give block by block. The
+// delegators of every validator and their shares are only worked out once per
+// reward amount, so no pledge may change within the run, as when catching up
+// on reward only blocks.
+func (s *StateDB) DistributeRewardsBatch(blocks []RewardBlock, deleteEmptyObjects bool) []common.Hash {
+	type payoutKey struct {
+		validator common.Address
+		reward    string
+	}
+	var (
+		roots   = make([]common.Hash, 0, len(blocks))
+		amounts = make(map[uint64]*big.Int)
+		payouts = make(map[payoutKey]*stakerPayout)
+	)
+	for _, block := range blocks {
+		period := RewardPeriod(block.Number.Uint64())
+		rewardAmount, ok := amounts[period]
+		if !ok {
+			rewardAmount = GetRewardAmount(block.Number.Uint64(), types.DREBlockReward)
+			amounts[period] = rewardAmount
+		}
+		stakersPercentage := 100 - block.ValidatorPercentage
+		sumStakerReward := new(big.Int).Div(new(big.Int).Mul(rewardAmount, big.NewInt(int64(stakersPercentage))), big.NewInt(100))
+		for _, owner := range block.Validators {
+			ownerObject := s.GetOrNewAccountStateObject(owner)
+			if ownerObject == nil {
+				continue
 			}
-			ownerObject.SubBalance(actualSumStakerReward)
+			key := payoutKey{owner, sumStakerReward.String()}
+			payout, ok := payouts[key]
+			if !ok {
+				payout = newStakerPayout(ownerObject.GetValidatorExtension(), owner, sumStakerReward)
+				payouts[key] = payout
+			}
+			s.payStakers(ownerObject, payout)
+		}
+		roots = append(roots, s.IntermediateRoot(deleteEmptyObjects))
+	}
+	return roots
+}
+
+// payStakers credits the delegators of ownerObject with payout, out of the
+// validator's own balance.
+func (s *StateDB) payStakers(ownerObject *stateObject, payout *stakerPayout) {
+	for i, staker := range payout.stakers {
+		s.GetOrNewAccountStateObject(staker).AddBalance(payout.rewards[i])
+	}
+	ownerObject.SubBalance(payout.total)
+}
+
+// newStakerPayout splits sumStakerReward among the delegators of owner in
+// proportion to their pledges, as DistributeRewardsToStakers does.
+func newStakerPayout(stakerList types.ValidatorsExtensionList, owner common.Address, sumStakerReward *big.Int) *stakerPayout {
+	ownerStakerBalance := stakerList.GetBalance(owner)
+	sumStakerBalance := new(big.Int).Sub(stakerList.GetAllBalance(), ownerStakerBalance)
+	payout := &stakerPayout{total: big.NewInt(0)}
+	for _, staker := range stakerList.ValidatorExtensions {
+		if staker.Addr != owner {
+			stakerReward := new(big.Int).Div(new(big.Int).Mul(sumStakerReward, staker.Balance), sumStakerBalance)
+			payout.stakers = append(payout.stakers, staker.Addr)
+			payout.rewards = append(payout.rewards, stakerReward)
+			payout.total.Add(payout.total, stakerReward)
 		}
 	}
+	return payout
 }
 
 func (s *StateDB) MintNFTLog(nftAddress common.Address, blockNumber *big.Int) *types.Log {
@@ -1445,7 +1671,7 @@ func (s *StateDB) MintNFTLog(nftAddress common.Address, blockNumber *big.Int) *t
 
 func (s *StateDB) GetExchangAmount(nftaddress common.Address, initamount *big.Int) *big.Int {
 	nftInt := new(big.Int).SetBytes(nftaddress.Bytes())
-	baseInt, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
+	baseInt := types.SNFTBase()
 	nftInt.Sub(nftInt, baseInt)
 	//nftInt.Add(nftInt, big.NewInt(1))
 	nftInt.Div(nftInt, big.NewInt(4096))
@@ -1457,7 +1683,22 @@ func (s *StateDB) GetExchangAmount(nftaddress common.Address, initamount *big.In
 	return result
 }
 
+// MaxMergeNumber returns the most pieces an SNFT of the given level merges,
+// 16^level. Levels above 3 are priced, and bounded, as level 3.
+func MaxMergeNumber(level uint8) uint32 {
+	if level > 3 {
+		level = 3
+	}
+	return 1 << (4 * uint32(level))
+}
+
+// calculateExchangeAmount returns the ERB an SNFT of level merging mergenumber
+// pieces exchanges for, before deflation. Merge numbers above the level bound
+// are worth nothing.
 func (s *StateDB) calculateExchangeAmount(level uint8, mergenumber uint32) *big.Int {
+	if mergenumber > MaxMergeNumber(level) {
+		return big.NewInt(0)
+	}
 	//nftNumber := math.BigPow(16, int64(level))
 	nftNumber := big.NewInt(int64(mergenumber))
 	switch {
@@ -1480,6 +1721,21 @@ func (s *StateDB) CalculateExchangeAmount(level uint8, mergenumber uint32) *big.
 	return s.calculateExchangeAmount(level, mergenumber)
 }
 
+// SNFTExchangeAmount returns the ERB the SNFT exchanges for, deflated for the
+// exchange periods minted before it. The NFT state records no merge level, only
+// the owner and creator, and SNFTs are never merged, so only the level and
+// merge number of a single level 0 piece are accepted: an exchange can't claim
+// more pieces than one.
+func (s *StateDB) SNFTExchangeAmount(snft common.Address, level uint8, mergenumber uint32) (*big.Int, error) {
+	if !s.IsOfficialNFT(snft) || !s.IsExistNFT(snft) {
+		return nil, ErrSNFTNotExist
+	}
+	if level != 0 || mergenumber != 1 {
+		return nil, ErrSNFTMergeNumber
+	}
+	return s.GetExchangAmount(snft, s.calculateExchangeAmount(level, mergenumber)), nil
+}
+
 // -  pledge token: a user who want to be a miner need to pledge token, must more than 100000 erb
 // ````
 // {
@@ -1501,6 +1757,12 @@ func (s *StateDB) PledgeToken(address common.Address,
 	if amount == nil {
 		amount = big.NewInt(0)
 	}
+	if err := s.CheckNotProxy(address); err != nil {
+		return err
+	}
+	if err := s.CheckProxy(address, proxy); err != nil {
+		return err
+	}
 
 	stateObject := s.GetOrNewAccountStateObject(address)
 
@@ -1603,6 +1865,9 @@ func (s *StateDB) MinerConsign(address common.Address, proxy common.Address) err
 		log.Info("MinerConsign", "err", "no repeated pledge")
 		return errors.New("no repeated pledge")
 	}
+	if err := s.CheckProxy(address, proxy); err != nil {
+		return err
+	}
 
 	//Resolving duplicates is delegated
 	for _, v := range validators.Validators {
@@ -1617,7 +1882,40 @@ func (s *StateDB) MinerConsign(address common.Address, proxy common.Address) err
 	return nil
 }
 
+// CheckNotProxy returns ErrProxyPledge if address signs for another validator.
+// Pledges of transactions only run it from the proxy pledge fork on.
+func (s *StateDB) CheckNotProxy(address common.Address) error {
+	if validator, ok := s.GetValidators(types.ValidatorStorageAddress).ProxyFor(address); ok {
+		log.Info("CheckNotProxy", "address", address, "validator", validator)
+		return ErrProxyPledge
+	}
+	return nil
+}
+
+// CheckProxy returns ErrInvalidProxy if proxy can't sign for validator: it is
+// the validator itself, a validator in the pool or bound to another validator.
+// Self pledges of transactions only run it from the validator proxy fork on.
+func (s *StateDB) CheckProxy(validator, proxy common.Address) error {
+	if proxy == (common.Address{}) {
+		return nil
+	}
+	if proxy == validator {
+		return ErrInvalidProxy
+	}
+	validators := s.GetValidators(types.ValidatorStorageAddress)
+	if validators.GetValidatorByAddr(proxy).Addr == proxy {
+		return ErrInvalidProxy
+	}
+	if other, ok := validators.ProxyFor(proxy); ok && other != validator {
+		return ErrInvalidProxy
+	}
+	return nil
+}
+
 func (s *StateDB) MinerBecome(address common.Address, proxy common.Address) error {
+	if err := s.CheckNotProxy(address); err != nil {
+		return err
+	}
 	stateObject := s.GetOrNewAccountStateObject(address)
 	//empty := common.Address{}
 
@@ -1638,6 +1936,11 @@ func (s *StateDB) MinerBecome(address common.Address, proxy common.Address) erro
 	//	}
 	//}
 	if stateObject != nil {
+		// Same minimum as ResetMinerBecome, so a partially unstaked
+		// account cannot re-enter the pool without topping up
+		if stateObject.PledgedBalance().Cmp(types.ValidatorBase()) < 0 {
+			return ErrBelowValidatorBase
+		}
 		validatorStateObject.AddValidator(address, stateObject.PledgedBalance(), proxy)
 	}
 	return nil
@@ -1794,14 +2097,7 @@ func (s *StateDB) NewCancelStakerPledge(from, address common.Address, amount *bi
 			}
 
 		} else {
-			fromObject.AddBalance(amount)
-
-			fromObject.RemoveStakerPledge(address, amount)
-			toObject.RemoveValidatorExtension(from, amount)
-			toObject.SubPledgedBalance(amount)
-
-			validatorStateObject.RemoveValidator(address, amount)
-
+			s.refundDelegation(fromObject, toObject, amount)
 		}
 
 	}
@@ -1809,9 +2105,41 @@ func (s *StateDB) NewCancelStakerPledge(from, address common.Address, amount *bi
 	return nil
 }
 
+// RefundDelegator returns the whole pledge of delegator to validator, leaving
+// the validator's other delegations as they are. A validator's own pledge is
+// cancelled with NewCancelStakerPledge instead.
+func (s *StateDB) RefundDelegator(validator, delegator common.Address) error {
+	if validator == delegator {
+		return ErrNoDelegation
+	}
+	amount := new(big.Int).Set(s.GetStakerPledged(delegator, validator).Balance)
+	if amount.Sign() == 0 {
+		return ErrNoDelegation
+	}
+	s.refundDelegation(s.GetOrNewAccountStateObject(delegator), s.GetOrNewAccountStateObject(validator), amount)
+	return nil
+}
+
+// refundDelegation returns amount of from's pledge to the validator to, and
+// removes it from the validator's pledged balance and stake in the pool.
+func (s *StateDB) refundDelegation(from, to *stateObject, amount *big.Int) {
+	from.AddBalance(amount)
+
+	from.RemoveStakerPledge(to.address, amount)
+	to.RemoveValidatorExtension(from.address, amount)
+	to.SubPledgedBalance(amount)
+
+	s.GetOrNewStakerStateObject(types.ValidatorStorageAddress).RemoveValidator(to.address, amount)
+}
+
 func (s *StateDB) RevocateAllStakers(addr common.Address, blocknumber *big.Int) {
 	addrObject := s.GetOrNewAccountStateObject(addr)
 	stakers := addrObject.GetValidatorExtension()
+	if len(stakers.ValidatorExtensions) == 0 {
+		// No stakers left to refund, either none delegated or an earlier call
+		// already paid them back and cleared the list
+		return
+	}
 
 	validatorStateObject := s.GetOrNewStakerStateObject(types.ValidatorStorageAddress)
 
@@ -1826,6 +2154,11 @@ func (s *StateDB) RevocateAllStakers(addr common.Address, blocknumber *big.Int)
 	}
 	// clean up validator extension
 	addrObject.SetValidatorExtension(&types.ValidatorsExtensionList{})
+
+	if addrObject.PledgedBalance().Sign() != 0 {
+		log.Error("RevocateAllStakers(), pledged balance not cleared",
+			"validator", addr, "remaining", addrObject.PledgedBalance())
+	}
 }
 
 func (s *StateDB) GetStakerStorageAddress() *types.StakerList {
@@ -1890,6 +2223,30 @@ func (s *StateDB) IsExistNFT(addr common.Address) bool {
 	return false
 }
 
+// GetPledgeBreakdown returns the stake pledged to validator, by itself and by
+// each of its delegators.
+func (s *StateDB) GetPledgeBreakdown(validator common.Address) *types.PledgeBreakdown {
+	breakdown := &types.PledgeBreakdown{
+		SelfPledged: big.NewInt(0),
+		Delegations: make([]*types.ValidatorExtension, 0),
+		Total:       big.NewInt(0),
+	}
+	stateObject := s.GetOrNewAccountStateObject(validator)
+	if stateObject == nil {
+		return breakdown
+	}
+	extensions := stateObject.GetValidatorExtension()
+	for _, pledge := range extensions.DeepCopy().ValidatorExtensions {
+		breakdown.Total.Add(breakdown.Total, pledge.Balance)
+		if pledge.Addr == validator {
+			breakdown.SelfPledged.Add(breakdown.SelfPledged, pledge.Balance)
+			continue
+		}
+		breakdown.Delegations = append(breakdown.Delegations, pledge)
+	}
+	return breakdown
+}
+
 // GetPledgedBalance retrieves the pledged balance from the given address or 0 if object not found
 func (s *StateDB) GetPledgedBalance(addr common.Address) *big.Int {
 	stateObject := s.GetOrNewAccountStateObject(addr)
@@ -1944,6 +2301,15 @@ func (s *StateDB) AddValidatorCoefficient(addr common.Address, coe uint8) {
 	}
 }
 
+// IncreaseValidatorCoefficient adds coe to the ValidatorCoefficient associated
+// with addr, up to the maximum coefficient.
+func (s *StateDB) IncreaseValidatorCoefficient(addr common.Address, coe uint8) {
+	stateObject := s.GetOrNewAccountStateObject(addr)
+	if stateObject != nil {
+		stateObject.IncreaseCoefficient(coe)
+	}
+}
+
 // SubValidatorCoefficient subtracts amount from the ValidatorCoefficient associated with addr.
 func (s *StateDB) SubValidatorCoefficient(addr common.Address, coe uint8) {
 	stateObject := s.GetOrNewAccountStateObject(addr)
@@ -1969,6 +2335,23 @@ func (s *StateDB) GetValidatorCoefficient(addr common.Address) uint8 {
 	return 0
 }
 
+// GetValidatorWeight returns the coefficient and stake of the validator addr
+// together with their product, its voting weight. An address that isn't in
+// the validator list has no stake and no weight.
+func (s *StateDB) GetValidatorWeight(addr common.Address) (uint8, *big.Int, *big.Int) {
+	coefficient := s.GetValidatorCoefficient(addr)
+	stake := new(big.Int)
+	if validators := s.GetValidators(types.ValidatorStorageAddress); validators != nil {
+		for _, v := range validators.Validators {
+			if v.Addr == addr && v.Balance != nil {
+				stake.Set(v.Balance)
+				break
+			}
+		}
+	}
+	return coefficient, stake, new(big.Int).Mul(stake, big.NewInt(int64(coefficient)))
+}
+
 func (s *StateDB) GetStakers(addr common.Address) *types.StakerList {
 	stakerStateObject := s.GetOrNewStakerStateObject(addr)
 	if stakerStateObject != nil {
@@ -1999,6 +2382,16 @@ func (s *StateDB) GetOfficialMint() *big.Int {
 	return nil
 }
 
+// TotalSNFTMinted returns the number of SNFTs assigned by the official mint to
+// date, the distance of the official mint cursor from the SNFT address base.
+func (s *StateDB) TotalSNFTMinted() *big.Int {
+	minted := new(big.Int).Sub(s.GetOfficialMint(), types.SNFTBase())
+	if minted.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return minted
+}
+
 func (s *StateDB) GetUserMint() *big.Int {
 	mintStateObject := s.GetOrNewStakerStateObject(types.MintDeepStorageAddress)
 	if mintStateObject != nil {
@@ -2009,11 +2402,15 @@ func (s *StateDB) GetUserMint() *big.Int {
 	return nil
 }
 
-func (s *StateDB) ChangeValidatorProxy(addr common.Address, newValidatorProxy common.Address) {
+func (s *StateDB) ChangeValidatorProxy(addr common.Address, newValidatorProxy common.Address) error {
+	if err := s.CheckProxy(addr, newValidatorProxy); err != nil {
+		return err
+	}
 	accountStateObject := s.GetOrNewAccountStateObject(addr)
 	if accountStateObject != nil {
 		accountStateObject.SetValidatorProxy(newValidatorProxy)
 	}
+	return nil
 }
 
 func (s *StateDB) GetValidatorProxy(addr common.Address) common.Address {
@@ -2025,14 +2422,81 @@ func (s *StateDB) GetValidatorProxy(addr common.Address) common.Address {
 	return common.Address{}
 }
 
-func (s *StateDB) PunishEvilValidators(evilValidators []common.Address, blocknumber *big.Int) error {
+// GetAllValidatorProxies returns the proxies of the validators in the pool,
+// keyed by validator. Validators signing for themselves are left out.
+func (s *StateDB) GetAllValidatorProxies() map[common.Address]common.Address {
+	proxies := make(map[common.Address]common.Address)
+	for _, v := range s.GetValidators(types.ValidatorStorageAddress).Validators {
+		if v.Proxy != (common.Address{}) {
+			proxies[v.Addr] = v.Proxy
+		}
+	}
+	return proxies
+}
+
+// PunishEvilValidators punishes validators caught signing two blocks of the same
+// height. Without penalties every offence resets the validator's coefficient.
+// Otherwise the validator's offences are counted in the storage of the validator
+// pool and the n-th one is punished by penalties[n-1], the last penalty
+// applying to any further offence.
+func (s *StateDB) PunishEvilValidators(evilValidators []common.Address, blocknumber *big.Int, penalties []params.EvilPenalty) error {
 	if len(evilValidators) == 0 {
 		return nil
 	}
 
 	for _, evil := range evilValidators {
-		s.SubValidatorCoefficient(evil, types.DEFAULT_VALIDATOR_COEFFICIENT)
+		if len(penalties) == 0 {
+			s.SubValidatorCoefficient(evil, types.DEFAULT_VALIDATOR_COEFFICIENT)
+			continue
+		}
+		offences := s.EvilOffences(evil) + 1
+		validatorStateObject := s.GetOrNewStakerStateObject(types.ValidatorStorageAddress)
+		validatorStateObject.SetState(s.db, evilOffenceKey(evil), common.BigToHash(new(big.Int).SetUint64(offences)))
+		validatorStateObject.SetState(s.db, lastEvilOffenceKey(evil), common.BigToHash(blocknumber))
+
+		penalty := penalties[len(penalties)-1]
+		if offences <= uint64(len(penalties)) {
+			penalty = penalties[offences-1]
+		}
+		log.Info("PunishEvilValidators", "addr", evil, "offences", offences, "coefficient", penalty.Coefficient, "remove", penalty.Remove, "no", blocknumber)
+		s.SubValidatorCoefficient(evil, penalty.Coefficient)
+		if penalty.Remove {
+			s.GetOrNewStakerStateObject(types.ValidatorStorageAddress).ResetemoveValidator(evil)
+		}
 	}
 
 	return nil
 }
+
+// evilOffenceKey is the validator pool storage slot counting addr's offences.
+func evilOffenceKey(addr common.Address) common.Hash {
+	return common.BytesToHash(addr.Bytes())
+}
+
+// lastEvilOffenceKey is the validator pool storage slot holding the block of
+// addr's latest offence.
+func lastEvilOffenceKey(addr common.Address) common.Hash {
+	key := evilOffenceKey(addr)
+	key[0] = 0x01
+	return key
+}
+
+// EvilOffences returns the number of times addr was punished as an evil
+// validator under an EvilPenalty schedule.
+func (s *StateDB) EvilOffences(addr common.Address) uint64 {
+	validatorStateObject := s.GetOrNewStakerStateObject(types.ValidatorStorageAddress)
+	return validatorStateObject.GetState(s.db, evilOffenceKey(addr)).Big().Uint64()
+}
+
+// HasBeenSlashed reports whether validator was ever punished as an evil
+// validator under an EvilPenalty schedule, along with the number of times and
+// the block of the latest punishment. Punishments made without a schedule only
+// reset the coefficient and leave no record.
+func (s *StateDB) HasBeenSlashed(validator common.Address) (slashed bool, count uint64, last *big.Int) {
+	count = s.EvilOffences(validator)
+	if count == 0 {
+		return false, 0, nil
+	}
+	validatorStateObject := s.GetOrNewStakerStateObject(types.ValidatorStorageAddress)
+	return true, count, validatorStateObject.GetState(s.db, lastEvilOffenceKey(validator)).Big()
+}
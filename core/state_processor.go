@@ -72,7 +72,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		misc.ApplyDAOHardFork(statedb)
 	}
 	var blockContext vm.BlockContext
-	if block.Header().Coinbase == (common.Address{}) {
+	if block.EmptyBlock() {
 		blockContext = NewEVMBlockContext(header, p.bc, &common.Address{})
 	} else {
 		blockContext = NewEVMBlockContext(header, p.bc, nil)
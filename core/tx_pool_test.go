@@ -2542,7 +2542,35 @@ func BenchmarkInsertRemoteWithAllLocals(b *testing.B) {
 	}
 }
 
-func TestAdd(t *testing.T){
+func TestAdd(t *testing.T) {
 	var isTx30 bool
 	fmt.Println(isTx30)
 }
+
+// Tests that delegator refund transactions are only accepted once the fork
+// introducing them is active.
+func TestDelegatorRefundTransactionFork(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(types.TransactionType + `{"type":6,"version":"v0.0.1"}`)
+	forked := *params.TestChainConfig
+	forked.DelegatorRefundBlock = big.NewInt(1)
+
+	for _, tt := range []struct {
+		config *params.ChainConfig
+		err    error
+	}{
+		{params.TestChainConfig, types.ErrNotExistNFTType}, // Before the fork
+		{&forked, nil}, // From the fork on
+	} {
+		pool, key := setupTxPoolWithConfig(tt.config)
+		tx, _ := types.SignTx(types.NewTransaction(0, common.Address{0x01}, big.NewInt(0), 1000000, big.NewInt(1), data), types.HomesteadSigner{}, key)
+		from, _ := deriveSender(tx)
+		testAddBalance(pool, from, big.NewInt(params.Ether))
+
+		if err := pool.AddRemote(tx); !errors.Is(err, tt.err) {
+			t.Errorf("fork %v: error mismatch: have %v, want %v", tt.config.DelegatorRefundBlock, err, tt.err)
+		}
+		pool.Stop()
+	}
+}
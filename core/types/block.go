@@ -163,9 +163,18 @@ func (h *Header) EmptyReceipts() bool {
 	return h.ReceiptHash == EmptyRootHash
 }
 
-// EmptyBlock returns true if block is empty
+// EmptyBlockDifficulty is the difficulty stamped on empty blocks. Together with
+// the zero coinbase it marks a block as empty, so a block that merely lacks a
+// coinbase is not mistaken for one.
+var EmptyBlockDifficulty = big.NewInt(24)
+
+// EmptyBlock returns true if block is empty. Header verification rejects a zero
+// coinbase without the empty block difficulty and a coinbase with it, so on
+// chain the zero coinbase alone still tells empty blocks apart.
 func (h *Header) EmptyBlock() bool {
-	return h.Coinbase == common.Address{}
+	return h.Number != nil && h.Number.Sign() > 0 &&
+		h.Coinbase == (common.Address{}) &&
+		h.Difficulty != nil && h.Difficulty.Cmp(EmptyBlockDifficulty) == 0
 }
 
 // Body is a simple (mutable, non-safe) data container for storing and moving
@@ -314,6 +323,7 @@ func (b *Block) MixDigest() common.Hash   { return b.header.MixDigest }
 func (b *Block) Nonce() uint64            { return binary.BigEndian.Uint64(b.header.Nonce[:]) }
 func (b *Block) Bloom() Bloom             { return b.header.Bloom }
 func (b *Block) Coinbase() common.Address { return b.header.Coinbase }
+func (b *Block) EmptyBlock() bool         { return b.header.EmptyBlock() }
 func (b *Block) Root() common.Hash        { return b.header.Root }
 func (b *Block) ParentHash() common.Hash  { return b.header.ParentHash }
 func (b *Block) TxHash() common.Hash      { return b.header.TxHash }
@@ -281,3 +281,31 @@ func makeBenchBlock() *Block {
 	}
 	return NewBlock(header, txs, uncles, receipts, newHasher())
 }
+
+func TestHeaderEmptyBlock(t *testing.T) {
+	signer := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	tests := []struct {
+		name       string
+		number     int64
+		coinbase   common.Address
+		difficulty *big.Int
+		empty      bool
+	}{
+		// Empty blocks already on chain carry both the zero coinbase and the marker difficulty
+		{"legacy empty block", 10, common.Address{}, big.NewInt(24), true},
+		{"normal block", 10, signer, big.NewInt(1), false},
+		{"zero coinbase without marker", 10, common.Address{}, big.NewInt(1), false},
+		{"marker with coinbase", 10, signer, big.NewInt(24), false},
+		{"genesis", 0, common.Address{}, big.NewInt(24), false},
+		{"missing difficulty", 10, common.Address{}, nil, false},
+	}
+	for _, tt := range tests {
+		header := &Header{Number: big.NewInt(tt.number), Coinbase: tt.coinbase, Difficulty: tt.difficulty}
+		if have := header.EmptyBlock(); have != tt.empty {
+			t.Errorf("%s: empty mismatch: have %v, want %v", tt.name, have, tt.empty)
+		}
+		if have := NewBlockWithHeader(header).EmptyBlock(); have != tt.empty {
+			t.Errorf("%s: block empty mismatch: have %v, want %v", tt.name, have, tt.empty)
+		}
+	}
+}
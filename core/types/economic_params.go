@@ -1,8 +1,10 @@
 package types
 
 import (
-	"github.com/ethereum/go-ethereum/common"
+	"fmt"
 	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // NFT and CSBT minting sequence storage address
@@ -17,16 +19,29 @@ var StakerStorageAddress = common.HexToAddress("0x000000000000000000000000000000
 // Voting contract address
 var VoteContractAddress = common.HexToAddress("0x0000000000000000000000000000000000000010")
 
+// IsSystemStorageAddress reports whether addr is one of the accounts the state
+// keeps consensus data in: the mint cursor, the validators or the stakers.
+func IsSystemStorageAddress(addr common.Address) bool {
+	switch addr {
+	case MintDeepStorageAddress, ValidatorStorageAddress, StakerStorageAddress:
+		return true
+	}
+	return false
+}
+
+// IsSystemAddress reports whether addr is a system storage address or the
+// voting contract. No contract can be created at a system address, whatever
+// the fork schedule.
+func IsSystemAddress(addr common.Address) bool {
+	return IsSystemStorageAddress(addr) || addr == VoteContractAddress
+}
+
 // The amount of voting contract generated per block
 var VoteAmountEachBlock, _ = new(big.Int).SetString("800000000000000000", 10)
 
 // validator reward 0.54360 ERB
 var DREBlockReward = big.NewInt(5.436e+17)
 
-// The percentage of rewards that validator receives
-// 10 represents 10 percent
-var PercentageValidatorReward = 7
-
 // Deflation rate
 var DeflationRate = 0.85
 
@@ -77,6 +92,18 @@ var DefaultCreator string = "0x0000000000000000000000000000000000000000"
 var TransactionType = "erbie:"
 var TransactionTypeLen = 6
 
+// SNFT addresses are SNFTAddressBase plus the SNFT's index, in hex
+const SNFTAddressBase = "8000000000000000000000000000000000000000"
+
+// SNFTBase returns SNFTAddressBase as a big.Int the caller is free to modify.
+func SNFTBase() *big.Int {
+	base, _ := new(big.Int).SetString(SNFTAddressBase, 16)
+	return base
+}
+
+// StakerBase returns the minimum pledge an account holds with a validator, 350
+// ERB. It applies to every pledge, both a delegator's and a validator's pledge
+// to itself.
 func StakerBase() *big.Int {
 	baseErb, _ := new(big.Int).SetString("1000000000000000000", 10)
 	Erb100 := big.NewInt(350)
@@ -85,6 +112,10 @@ func StakerBase() *big.Int {
 	return Erb100
 }
 
+// ValidatorBase returns the minimum pledged balance of a validator in the pool,
+// 35000 ERB. The pledged balance aggregates the validator's own pledge and
+// those of its delegators, so it is checked against the total whenever a
+// pledge changes.
 func ValidatorBase() *big.Int {
 	baseErb, _ := new(big.Int).SetString("1000000000000000000", 10)
 	Erb100000 := big.NewInt(35000)
@@ -92,3 +123,18 @@ func ValidatorBase() *big.Int {
 
 	return Erb100000
 }
+
+// CheckPledgeBases verifies StakerBase is positive and no more than
+// ValidatorBase. A validator joins the pool by pledging to itself, which has
+// to meet both minimums, so a StakerBase above ValidatorBase would turn away
+// pledges that are enough to become a validator.
+func CheckPledgeBases() error {
+	staker, validator := StakerBase(), ValidatorBase()
+	if staker.Sign() <= 0 {
+		return fmt.Errorf("staker base %v is not positive", staker)
+	}
+	if staker.Cmp(validator) > 0 {
+		return fmt.Errorf("staker base %v exceeds validator base %v", staker, validator)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"errors"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -78,6 +80,37 @@ type SignatureData struct {
 	Round uint64
 }
 
+// ErrEmptyVoteRound is returned for an empty block vote cast in another round,
+// or for another collector, than the proposer's own message.
+var ErrEmptyVoteRound = errors.New("empty block vote from another round")
+
+// DecodeEmptyVote decodes the vote carried by a serialized empty block message.
+func DecodeEmptyVote(payload []byte) (*SignatureData, error) {
+	msg := new(EmptyMsg)
+	if err := msg.FromPayload(payload); err != nil {
+		return nil, err
+	}
+	var vote *SignatureData
+	if err := msg.Decode(&vote); err != nil {
+		return nil, err
+	}
+	return vote, nil
+}
+
+// CheckEmptyVoteRound checks that vote was cast for the same collector and in
+// the same round as the proposer message, so votes of an earlier round can't
+// be replayed into an empty block of the same height.
+func CheckEmptyVoteRound(proposer *SignatureData, vote []byte) error {
+	sig, err := DecodeEmptyVote(vote)
+	if err != nil {
+		return err
+	}
+	if sig.Round != proposer.Round || sig.Vote != proposer.Vote {
+		return ErrEmptyVoteRound
+	}
+	return nil
+}
+
 type OnlineZkProof struct {
 	Height *big.Int
 	Proof  []byte
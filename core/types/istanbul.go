@@ -38,6 +38,10 @@ var (
 	// ErrInvalidIstanbulHeaderExtra is returned if the length of extra-data is less than 32 bytes
 	ErrInvalidIstanbulHeaderExtra = errors.New("invalid istanbul header extra-data")
 
+	// ErrTooFewEmptyBlockMessages is returned if an empty block carries no vote
+	// besides the message of the proposing node
+	ErrTooFewEmptyBlockMessages = errors.New("too few empty block messages")
+
 	OnlineValidatorVanity = 632
 )
 
@@ -86,6 +90,15 @@ func (ist *IstanbulExtra) DecodeRLP(s *rlp.Stream) error {
 	return nil
 }
 
+// EmptyBlockVotes returns the empty block messages that vote for the block,
+// that is all of them except the first one, which belongs to the proposer.
+func (ist *IstanbulExtra) EmptyBlockVotes() ([][]byte, error) {
+	if len(ist.EmptyBlockMessages) < 2 {
+		return nil, ErrTooFewEmptyBlockMessages
+	}
+	return ist.EmptyBlockMessages[1:], nil
+}
+
 // ExtractIstanbulExtra extracts all values of the IstanbulExtra from the header. It returns an
 // error if the length of the given extra-data is less than 32 bytes or the extra-data can not
 // be decoded.
@@ -125,7 +138,7 @@ func IstanbulFilteredHeader(h *Header, keepSeal bool) *Header {
 		return nil
 	}
 
-	if h.Coinbase == common.HexToAddress("0x0000000000000000000000000000000000000000") && h.Number.Cmp(common.Big0) > 0 {
+	if h.EmptyBlock() {
 		istanbulExtra.Seal = []byte{}
 		istanbulExtra.CommittedSeal = [][]byte{}
 		istanbulExtra.Validators = []common.Address{}
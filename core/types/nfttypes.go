@@ -2,6 +2,7 @@ package types
 
 import (
 	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/params"
 	"math/big"
@@ -29,12 +30,18 @@ type InjectedOfficialNFT struct {
 	VoteWeight *big.Int       `json:"vote_weight"`
 }
 
+// SNFTAssignment records an SNFT handed to an exchanger while a block is finalized.
+type SNFTAssignment struct {
+	Address common.Address `json:"address"`
+	Owner   common.Address `json:"owner"`
+}
+
 type InjectedOfficialNFTList struct {
 	InjectedOfficialNFTs []*InjectedOfficialNFT
 }
 
 func (list *InjectedOfficialNFTList) GetInjectedInfo(addr common.Address) *InjectedOfficialNFT {
-	maskB, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
+	maskB := SNFTBase()
 	addrInt := new(big.Int).SetBytes(addr.Bytes())
 	addrInt.Sub(addrInt, maskB)
 	tempInt := new(big.Int)
@@ -56,7 +63,7 @@ func (list *InjectedOfficialNFTList) GetInjectedInfo(addr common.Address) *Injec
 
 func (list *InjectedOfficialNFTList) DeleteExpireElem(num *big.Int) {
 	var index int
-	maskB, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
+	maskB := SNFTBase()
 	for k, injectOfficialNFT := range list.InjectedOfficialNFTs {
 		sum := new(big.Int).Add(injectOfficialNFT.StartIndex, new(big.Int).SetUint64(injectOfficialNFT.Number))
 		sum.Add(sum, maskB)
@@ -71,7 +78,7 @@ func (list *InjectedOfficialNFTList) DeleteExpireElem(num *big.Int) {
 
 func (list *InjectedOfficialNFTList) RemainderNum(addrInt *big.Int) uint64 {
 	var sum uint64
-	maskB, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
+	maskB := SNFTBase()
 	tempInt := new(big.Int)
 	for _, injectOfficialNFT := range list.InjectedOfficialNFTs {
 		if injectOfficialNFT.StartIndex.Cmp(addrInt) >= 0 {
@@ -132,12 +139,28 @@ type Wormholes struct {
 	ProxySign    string `json:"proxy_sign,omitempty"`
 	Creator      string `json:"creator,omitempty"`
 	Version      string `json:"version,omitempty"`
+
+	// DelegatorSign is the delegator's consent to a validator refunding its
+	// pledge, see DelegatorRefundMessage.
+	DelegatorSign string `json:"delegator_sign,omitempty"`
+}
+
+// DelegatorRefundMessage returns the message a delegator signs to consent to
+// validator refunding its pledge. It names the block the pledge was recorded
+// at, so the consent lapses once the delegator pledges again.
+func DelegatorRefundMessage(validator, delegator common.Address, pledgedAt *big.Int) string {
+	return fmt.Sprintf("%v%v%v", validator.Hex(), delegator.Hex(), pledgedAt)
 }
 
+// ErrNotExistNFTType is returned for Wormholes transactions of an unknown type.
+var ErrNotExistNFTType = errors.New("not exist nft type")
+
 const WormholesVersion = "v0.0.1"
 const PattenAddr = "^0x[0-9a-fA-F]{40}$"
 
-func (w *Wormholes) CheckFormat() error {
+// CheckFormat checks the type of the transaction is known. Delegator refunds,
+// type 6, only exist from the DelegatorRefundBlock fork on.
+func (w *Wormholes) CheckFormat(isDelegatorRefund bool) error {
 
 	switch w.Type {
 
@@ -146,14 +169,20 @@ func (w *Wormholes) CheckFormat() error {
 	case 3:
 	case 4:
 	case 5:
+	case 6:
+		if !isDelegatorRefund {
+			return ErrNotExistNFTType
+		}
 	default:
-		return errors.New("not exist nft type")
+		return ErrNotExistNFTType
 	}
 
 	return nil
 }
 
-func (w *Wormholes) TxGas() (uint64, error) {
+// TxGas returns the intrinsic gas of the transaction type, failing like
+// CheckFormat for unknown types.
+func (w *Wormholes) TxGas(isDelegatorRefund bool) (uint64, error) {
 
 	switch w.Type {
 	case 1:
@@ -166,8 +195,13 @@ func (w *Wormholes) TxGas() (uint64, error) {
 		return params.WormholesTx4, nil
 	case 5:
 		return params.WormholesTx5, nil
+	case 6:
+		if !isDelegatorRefund {
+			return 0, ErrNotExistNFTType
+		}
+		return params.WormholesTx6, nil
 	default:
-		return 0, errors.New("not exist nft type")
+		return 0, ErrNotExistNFTType
 	}
 }
 
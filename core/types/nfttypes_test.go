@@ -32,3 +32,18 @@ func TestInjectedOfficialNFTList(t *testing.T) {
 	injectedList.GetInjectedInfo(address)
 
 }
+
+func TestSNFTBase(t *testing.T) {
+	want := new(big.Int).Lsh(big.NewInt(1), 159)
+	base := SNFTBase()
+	if base.Cmp(want) != 0 {
+		t.Fatalf("SNFT base mismatch: have %x, want %x", base, want)
+	}
+	if addr := common.BigToAddress(base); addr != common.HexToAddress("0x"+SNFTAddressBase) {
+		t.Errorf("SNFT base address mismatch: have %x", addr)
+	}
+	base.SetInt64(1)
+	if SNFTBase().Cmp(want) != 0 {
+		t.Errorf("SNFT base shared between callers")
+	}
+}
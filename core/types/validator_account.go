@@ -594,13 +594,10 @@ func (vl *ValidatorList) MakeUpValidators(validators []common.Address, weights [
 
 // CollectValidators Collect the k validators closest to the drop point
 func (vl *ValidatorList) CollectValidators(randomHash common.Hash, k int) (error, []common.Address) {
-	rr := randomHash.Hex()
-	pri, err := crypto.HexToECDSA(rr[2:])
+	point, err := DropPoint(randomHash)
 	if err != nil {
 		return err, []common.Address{}
 	}
-	addr := crypto.PubkeyToAddress(pri.PublicKey)
-	point := addr.Hash().Big()
 
 	var validators []common.Address
 	var count int
@@ -628,15 +625,22 @@ func (vl *ValidatorList) CollectValidators(randomHash common.Hash, k int) (error
 	return nil, validators
 }
 
+// DropPoint returns the point of the address space that randomHash lands on,
+// the validators whose address ranges cover it being selected.
+func DropPoint(randomHash common.Hash) (*big.Int, error) {
+	pri, err := crypto.ToECDSA(randomHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return crypto.PubkeyToAddress(pri.PublicKey).Hash().Big(), nil
+}
+
 // CollectValidators Collect the k validators closest to the drop point
 func (vl *ValidatorList) CollectValidatorsV3(randomHash common.Hash) (error, []common.Address) {
-	rr := randomHash.Hex()
-	pri, err := crypto.HexToECDSA(rr[2:])
+	point, err := DropPoint(randomHash)
 	if err != nil {
 		return err, []common.Address{}
 	}
-	addr := crypto.PubkeyToAddress(pri.PublicKey)
-	point := addr.Hash().Big()
 
 	var validators []common.Address
 	var count int
@@ -717,6 +721,17 @@ func (vl *ValidatorList) ExistProxy(addr common.Address) bool {
 	return false
 }
 
+// ProxyFor returns the validator that addr signs for as proxy, other than addr
+// itself.
+func (vl *ValidatorList) ProxyFor(addr common.Address) (common.Address, bool) {
+	for _, v := range vl.Validators {
+		if v.Proxy == addr && v.Addr != addr {
+			return v.Addr, true
+		}
+	}
+	return common.Address{}, false
+}
+
 func (vl *ValidatorList) GetProxy(delegate common.Address) (common.Address, bool) {
 	emptyAddress := common.Address{}
 	for _, v := range vl.Validators {
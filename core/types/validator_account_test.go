@@ -2101,3 +2101,32 @@ func randomHash() common.Hash {
 	}
 	return hash
 }
+
+func TestCheckPledgeBases(t *testing.T) {
+	if err := CheckPledgeBases(); err != nil {
+		t.Fatalf("pledge minimums are inconsistent: %v", err)
+	}
+	if StakerBase().Cmp(ValidatorBase()) >= 0 {
+		t.Errorf("staker base %v not below validator base %v, delegators could not pledge less than a validator", StakerBase(), ValidatorBase())
+	}
+}
+
+func TestIsSystemStorageAddress(t *testing.T) {
+	for addr, storage := range map[common.Address]bool{
+		MintDeepStorageAddress:  true,
+		ValidatorStorageAddress: true,
+		StakerStorageAddress:    true,
+		VoteContractAddress:     false,
+		{}:                      false,
+		common.HexToAddress("0x0000000000000000000000000000000000000004"): false,
+		common.HexToAddress("0x1000000000000000000000000000000000000001"): false,
+		common.BigToAddress(SNFTBase()):                                   false,
+	} {
+		if have := IsSystemStorageAddress(addr); have != storage {
+			t.Errorf("%x: storage mismatch: have %v, want %v", addr, have, storage)
+		}
+		if have, want := IsSystemAddress(addr), storage || addr == VoteContractAddress; have != want {
+			t.Errorf("%x: system mismatch: have %v, want %v", addr, have, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrCheckpointHeader     = errors.New("checkpoint does not match the header")
+	ErrCheckpointValidators = errors.New("checkpoint validators malformed")
+	ErrCheckpointSigner     = errors.New("checkpoint not signed by the expected signer")
+)
+
+// ValidatorCheckpoint is a portable description of the validator pool at a
+// block, for light clients and bridges that don't hold the state. Weights are
+// the validators' stakes multiplied by their coefficients.
+type ValidatorCheckpoint struct {
+	Number     hexutil.Uint64   `json:"number"`
+	Root       common.Hash      `json:"root"`
+	Validators []common.Address `json:"validators"`
+	Weights    []*hexutil.Big   `json:"weights"`
+	Signature  hexutil.Bytes    `json:"signature"`
+}
+
+// NewValidatorCheckpoint builds the unsigned checkpoint of validators, the
+// validator pool in the state of header, ordered by address.
+func NewValidatorCheckpoint(header *Header, validators *ValidatorList, coefficient func(common.Address) uint8) *ValidatorCheckpoint {
+	sorted := make([]*Validator, len(validators.Validators))
+	copy(sorted, validators.Validators)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Addr[:], sorted[j].Addr[:]) < 0
+	})
+	cp := &ValidatorCheckpoint{
+		Number:     hexutil.Uint64(header.Number.Uint64()),
+		Root:       header.Root,
+		Validators: make([]common.Address, 0, len(sorted)),
+		Weights:    make([]*hexutil.Big, 0, len(sorted)),
+	}
+	for _, v := range sorted {
+		weight := new(big.Int).Mul(v.Balance, big.NewInt(int64(coefficient(v.Addr))))
+		cp.Validators = append(cp.Validators, v.Addr)
+		cp.Weights = append(cp.Weights, (*hexutil.Big)(weight))
+	}
+	return cp
+}
+
+// SigHash returns the hash the checkpoint signature covers, every field but the
+// signature itself.
+func (cp *ValidatorCheckpoint) SigHash() common.Hash {
+	weights := make([]*big.Int, len(cp.Weights))
+	for i, w := range cp.Weights {
+		weights[i] = w.ToInt()
+	}
+	return rlpHash([]interface{}{
+		uint64(cp.Number),
+		cp.Root,
+		cp.Validators,
+		weights,
+	})
+}
+
+// Sign signs the checkpoint with key.
+func (cp *ValidatorCheckpoint) Sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(cp.SigHash().Bytes(), key)
+	if err != nil {
+		return err
+	}
+	cp.Signature = sig
+	return nil
+}
+
+// Signer recovers the address that signed the checkpoint.
+func (cp *ValidatorCheckpoint) Signer() (common.Address, error) {
+	pub, err := crypto.SigToPub(cp.SigHash().Bytes(), cp.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Verify checks the checkpoint against an independently obtained header and
+// the address trusted to have exported it.
+func (cp *ValidatorCheckpoint) Verify(header *Header, signer common.Address) error {
+	if header.Number == nil || header.Number.Uint64() != uint64(cp.Number) || header.Root != cp.Root {
+		return ErrCheckpointHeader
+	}
+	if len(cp.Validators) != len(cp.Weights) {
+		return ErrCheckpointValidators
+	}
+	for i := range cp.Validators {
+		if cp.Weights[i] == nil || (i > 0 && bytes.Compare(cp.Validators[i-1][:], cp.Validators[i][:]) >= 0) {
+			return ErrCheckpointValidators
+		}
+	}
+	if addr, err := cp.Signer(); err != nil || addr != signer {
+		return ErrCheckpointSigner
+	}
+	return nil
+}
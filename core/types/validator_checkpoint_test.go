@@ -0,0 +1,74 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestValidatorCheckpoint(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	validators := NewValidatorList(nil)
+	for i := 3; i > 0; i-- {
+		validators.AddValidator(common.BigToAddress(big.NewInt(int64(i))), big.NewInt(int64(100*i)), common.Address{})
+	}
+	coefficient := func(addr common.Address) uint8 { return uint8(new(big.Int).SetBytes(addr[:]).Uint64() * 10) }
+	header := &Header{Number: big.NewInt(42), Root: common.HexToHash("0x01")}
+
+	cp := NewValidatorCheckpoint(header, validators, coefficient)
+	for i, addr := range cp.Validators {
+		if want := common.BigToAddress(big.NewInt(int64(i + 1))); addr != want {
+			t.Fatalf("validator %d mismatch: have %x, want %x", i, addr, want)
+		}
+		if want := int64(100*(i+1)) * int64(10*(i+1)); cp.Weights[i].ToInt().Int64() != want {
+			t.Fatalf("weight %d mismatch: have %v, want %d", i, cp.Weights[i], want)
+		}
+	}
+	if err := cp.Sign(key); err != nil {
+		t.Fatalf("failed to sign checkpoint: %v", err)
+	}
+	// Round trip through JSON, the way the checkpoint leaves the node
+	enc, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatalf("failed to encode checkpoint: %v", err)
+	}
+	var dec ValidatorCheckpoint
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	if err := dec.Verify(header, signer); err != nil {
+		t.Fatalf("valid checkpoint rejected: %v", err)
+	}
+
+	// Tampering with a weight breaks the signature
+	tampered := dec
+	tampered.Weights = append([]*hexutil.Big{}, dec.Weights...)
+	tampered.Weights[1] = (*hexutil.Big)(big.NewInt(1))
+	if err := tampered.Verify(header, signer); err != ErrCheckpointSigner {
+		t.Errorf("tampered weight: error mismatch: have %v, want %v", err, ErrCheckpointSigner)
+	}
+	// A checkpoint of another block or state doesn't match the header
+	if err := dec.Verify(&Header{Number: big.NewInt(43), Root: header.Root}, signer); err != ErrCheckpointHeader {
+		t.Errorf("other number: error mismatch: have %v, want %v", err, ErrCheckpointHeader)
+	}
+	if err := dec.Verify(&Header{Number: header.Number, Root: common.HexToHash("0x02")}, signer); err != ErrCheckpointHeader {
+		t.Errorf("other root: error mismatch: have %v, want %v", err, ErrCheckpointHeader)
+	}
+	// Nor does one exported by someone else
+	other, _ := crypto.GenerateKey()
+	if err := dec.Verify(header, crypto.PubkeyToAddress(other.PublicKey)); err != ErrCheckpointSigner {
+		t.Errorf("other signer: error mismatch: have %v, want %v", err, ErrCheckpointSigner)
+	}
+	// Unsorted validators are malformed
+	unsorted := dec
+	unsorted.Validators = []common.Address{dec.Validators[1], dec.Validators[0], dec.Validators[2]}
+	if err := unsorted.Verify(header, signer); err != ErrCheckpointValidators {
+		t.Errorf("unsorted: error mismatch: have %v, want %v", err, ErrCheckpointValidators)
+	}
+}
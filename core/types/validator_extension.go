@@ -17,6 +17,14 @@ type ValidatorExtension struct {
 	BlockNumber *big.Int
 }
 
+// PledgeBreakdown splits the pledged balance of a validator into its own stake
+// and the contributions of the stakers pledging to it.
+type PledgeBreakdown struct {
+	SelfPledged *big.Int
+	Delegations []*ValidatorExtension
+	Total       *big.Int
+}
+
 func (vl *ValidatorsExtensionList) AddValidatorPledge(addr common.Address, balance *big.Int, blocknumber *big.Int) bool {
 	for _, v := range vl.ValidatorExtensions {
 		if v.Addr == addr {
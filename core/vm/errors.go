@@ -19,6 +19,8 @@ package vm
 import (
 	"errors"
 	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 // List evm execution errors
@@ -28,6 +30,7 @@ var (
 	ErrDepth                      = errors.New("max call depth exceeded")
 	ErrInsufficientBalance        = errors.New("insufficient balance for transfer")
 	ErrContractAddressCollision   = errors.New("contract address collision")
+	ErrSystemAddressCollision     = errors.New("contract creation at system address")
 	ErrExecutionReverted          = errors.New("execution reverted")
 	ErrMaxCodeSizeExceeded        = errors.New("max code size exceeded")
 	ErrInvalidJump                = errors.New("invalid jump destination")
@@ -36,15 +39,17 @@ var (
 	ErrGasUintOverflow            = errors.New("gas uint64 overflow")
 	ErrInvalidCode                = errors.New("invalid code: must not begin with 0xef")
 	ErrNotOwner                   = errors.New("not the owner of the csbt")
-	ErrNotExistNFTType            = errors.New("not exist nft type")
+	ErrNotExistNFTType            = types.ErrNotExistNFTType
 	ErrInsufficientPledgedBalance = errors.New("not sufficient pledged balance")
 	ErrStartIndex                 = errors.New("StartIndex is not string of 0x!")
 	ErrNotExchanger               = errors.New("not exchanger")
 	ErrWormholesFormat            = errors.New("wormholes format error, can't unmarshal")
+	ErrRefundUnderflow            = errors.New("refund counter below zero")
 	ErrNotMoreThan100ERB          = errors.New("not more than 700 ERB")
 	ErrTooCloseWithOpenExchanger  = errors.New("too close with openexchanger")
 	ErrTooCloseForWithdraw        = errors.New("too close for Withdraw")
 	ErrTooCloseToCancel           = errors.New("too close to cancel")
+	ErrDelegatorConsent           = errors.New("refund not signed by the delegator")
 	ErrRoyaltyNotMoreThan0        = errors.New("royalty not more than 0")
 	ErrRoyaltyNotLessthan10000    = errors.New("royalty not less than 10000")
 	ErrFeeRateNotMoreThan0        = errors.New("feerate not more than 0")
@@ -64,6 +69,7 @@ var (
 	ErrNotExistFrozenAccount      = errors.New("not exist frozen account or unfrozen time not arrive in")
 	ErrNoTrade                    = errors.New("non-tradable")
 	ErrNotCreator                 = errors.New("not csbt creator")
+	ErrCSBTAddress                = errors.New("malformed csbt address")
 )
 
 // ErrStackUnderflow wraps an evm error when the items on the stack less
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	gomath "math"
 	"math/big"
 	"strings"
 	"sync/atomic"
@@ -31,6 +32,7 @@ import (
 	"golang.org/x/crypto/sha3"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
@@ -56,7 +58,6 @@ type (
 	VerifyCSBTOwnerFunc func(StateDB, string, common.Address) bool
 	// TransferCSBTFunc is the signature of a TransferCSBT function
 	TransferCSBTFunc                          func(StateDB, string, common.Address, *big.Int) error
-	ExchangeNFTToCurrencyFunc                 func(StateDB, common.Address, string, *big.Int) error
 	PledgeTokenFunc                           func(StateDB, common.Address, *big.Int, *types.Wormholes, *big.Int) error
 	StakerPledgeFunc                          func(StateDB, common.Address, common.Address, *big.Int, *big.Int, *types.Wormholes) error
 	GetPledgedTimeFunc                        func(StateDB, common.Address, common.Address) *big.Int
@@ -67,6 +68,7 @@ type (
 	ResetMinerBecomeFunc                      func(StateDB, common.Address) error
 	CancelPledgedTokenFunc                    func(StateDB, common.Address, *big.Int)
 	NewCancelStakerPledgeFunc                 func(StateDB, common.Address, common.Address, *big.Int, *big.Int) error
+	RefundDelegatorFunc                       func(StateDB, common.Address, common.Address, *types.Wormholes) error
 	GetNFTCreatorFunc                         func(StateDB, common.Address) common.Address
 	IsExistNFTFunc                            func(StateDB, common.Address) bool
 	VerifyPledgedBalanceFunc                  func(StateDB, common.Address, *big.Int) bool
@@ -122,6 +124,7 @@ type BlockContext struct {
 	ResetMinerBecome                    ResetMinerBecomeFunc
 	CancelPledgedToken                  CancelPledgedTokenFunc
 	NewCancelStakerPledge               NewCancelStakerPledgeFunc
+	RefundDelegator                     RefundDelegatorFunc
 	GetNFTCreator                       GetNFTCreatorFunc
 	IsExistNFT                          IsExistNFTFunc
 	VerifyPledgedBalance                VerifyPledgedBalanceFunc
@@ -261,6 +264,32 @@ func RecoverAddress(msg string, sigStr string) (common.Address, error) {
 	return crypto.PubkeyToAddress(*rpk), nil
 }
 
+// maxCSBTMergeLevel is the highest merge level of an SNFT. Each level drops one
+// trailing hex digit of the SNFT address.
+const maxCSBTMergeLevel = 3
+
+// CheckCSBTAddress checks that addr is a 0x prefixed SNFT address of up to
+// maxCSBTMergeLevel merge levels, 40 hex digits for an unmerged SNFT down to 37.
+func CheckCSBTAddress(addr string) error {
+	if !strings.HasPrefix(addr, "0x") && !strings.HasPrefix(addr, "0X") {
+		return ErrCSBTAddress
+	}
+	return checkSNFTDigits(addr[2:], 2*common.AddressLength-maxCSBTMergeLevel, 2*common.AddressLength)
+}
+
+// checkSNFTDigits checks that digits holds between min and max hex digits.
+func checkSNFTDigits(digits string, min, max int) error {
+	if len(digits) < min || len(digits) > max {
+		return ErrCSBTAddress
+	}
+	for _, c := range digits {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return ErrCSBTAddress
+		}
+	}
+	return nil
+}
+
 func GetCsbtAddrs(db StateDB, nftParentAddress string, addr common.Address) []common.Address {
 	var nftAddrs []common.Address
 	emptyAddress := common.Address{}
@@ -269,14 +298,25 @@ func GetCsbtAddrs(db StateDB, nftParentAddress string, addr common.Address) []co
 		nftParentAddress = string([]byte(nftParentAddress)[2:])
 	}
 
-	if len(nftParentAddress) != 39 {
+	// The parent of 16 unmerged siblings is a level 1 address
+	if checkSNFTDigits(nftParentAddress, 2*common.AddressLength-1, 2*common.AddressLength-1) != nil {
 		return nftAddrs
 	}
 
-	addrInt := big.NewInt(0)
-	addrInt.SetString(nftParentAddress, 16)
+	addrInt, ok := new(big.Int).SetString(nftParentAddress, 16)
+	if !ok || addrInt.Sign() < 0 {
+		log.Warn("GetCsbtAddrs()", "invalid parent address", nftParentAddress)
+		return nftAddrs
+	}
 	addrInt.Lsh(addrInt, 4)
 
+	// All 16 siblings share the parent's leading bits, so if the first one is
+	// outside the official SNFT range, every sibling is.
+	if !IsOfficialNFT(common.BigToAddress(addrInt)) {
+		log.Warn("GetCsbtAddrs()", "parent address is not an official SNFT", nftParentAddress)
+		return nftAddrs
+	}
+
 	// 3. retrieve all the sibling leaf nodes of nftAddr
 	siblingInt := big.NewInt(0)
 	//nftAddrSLen := len(nftAddrS)
@@ -643,7 +683,9 @@ func (c *codeAndHash) Hash() common.Hash {
 	return c.hash
 }
 
-// create creates a new contract using code as deployment code.
+// create creates a new contract using code as deployment code. The deployed
+// code is limited to params.MaxCodeSize from EIP-158 and may not start with
+// 0xEF from London (EIP-3541). System addresses are rejected on every fork.
 func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
@@ -660,6 +702,11 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if evm.chainRules.IsBerlin {
 		evm.StateDB.AddAddressToAccessList(address)
 	}
+	// System storage is never exempt from the creation rules, refuse to
+	// overwrite it with a contract
+	if types.IsSystemAddress(address) {
+		return nil, common.Address{}, 0, ErrSystemAddressCollision
+	}
 	// Ensure there's no existing contract already at the designated address
 	contractHash := evm.StateDB.GetCodeHash(address)
 	if evm.StateDB.GetNonce(address) != 0 || (contractHash != (common.Hash{}) && contractHash != emptyCodeHash) {
@@ -754,19 +801,65 @@ func (evm *EVM) HandleCSBT(
 	gas uint64,
 	value *big.Int) (ret []byte, leftOverGas uint64, err error) {
 
-	formatErr := wormholes.CheckFormat()
+	// Only collect a trace when a tracer asks for one
+	var trace *WormholesTrace
+	if evm.Config.Debug {
+		if tracer, ok := evm.Config.Tracer.(WormholesTracer); ok {
+			trace = &WormholesTrace{
+				Type:          wormholes.Type,
+				BalanceBefore: new(big.Int).Set(evm.StateDB.GetBalance(caller.Address())),
+			}
+			defer func() {
+				trace.BalanceAfter = new(big.Int).Set(evm.StateDB.GetBalance(caller.Address()))
+				if err != nil {
+					trace.Error = err.Error()
+				}
+				tracer.CaptureWormholes(trace)
+			}()
+		}
+	}
+
+	// Delegator refunds are unknown before the fork
+	formatErr := wormholes.CheckFormat(evm.chainConfig.IsDelegatorRefund(evm.Context.BlockNumber))
+	if formatErr == nil && (wormholes.Type == 1 || wormholes.Type == 2) && evm.chainConfig.IsCSBTAddress(evm.Context.BlockNumber) {
+		// Both operations act on the CSBT the transaction names. Before the
+		// fork short addresses were padded with zeros and went through.
+		formatErr = CheckCSBTAddress(wormholes.CSBTAddress)
+	}
+	if trace != nil {
+		trace.check("format", formatErr == nil)
+	}
 	if formatErr != nil {
 		log.Error("HandleCSBT() format error", "wormholes.Type", wormholes.Type, "error", formatErr, "blocknumber", evm.Context.BlockNumber.Uint64())
 		return nil, gas, formatErr
 	}
 
+	// Charge the execution gas up front, before the operation touches the state
+	cost := evm.WormholesGas(caller, addr, &wormholes, value)
+	if trace != nil {
+		trace.check("gas", gas >= cost, "gas", gas, "cost", cost)
+	}
+	if gas < cost {
+		log.Error("HandleCSBT() out of gas", "wormholes.Type", wormholes.Type, "gas", gas, "cost", cost, "blocknumber", evm.Context.BlockNumber.Uint64())
+		return nil, 0, ErrOutOfGas
+	}
+	gas -= cost
+
 	switch wormholes.Type {
 	case 1: //transfer csbt
 
-		if evm.Context.VerifyCSBTOwner(evm.StateDB, wormholes.CSBTAddress, caller.Address()) {
+		isOwner := evm.Context.VerifyCSBTOwner(evm.StateDB, wormholes.CSBTAddress, caller.Address())
+		if trace != nil {
+			trace.check("csbt owner", isOwner, "csbt", wormholes.CSBTAddress, "owner", caller.Address())
+		}
+		if isOwner {
 
 			// whether csbt is first transfer
-			if !evm.Context.IsExistStakerStorageAddress(evm.StateDB, caller.Address()) {
+			isStaker := evm.Context.IsExistStakerStorageAddress(evm.StateDB, caller.Address())
+			if trace != nil {
+				trace.check("staker storage", isStaker, "staker", caller.Address())
+			}
+			if !isStaker {
 				log.Info("HandleCSBT(), TransferCSBT csbt not in Staker Storage >>>>>>>>>>", "wormholes.Type", wormholes.Type,
 					"blocknumber", evm.Context.BlockNumber.Uint64())
 				return nil, gas, ErrNotCreator
@@ -790,7 +883,11 @@ func (evm *EVM) HandleCSBT(
 
 	case 2:
 
-		if evm.Context.VerifyCSBTOwner(evm.StateDB, wormholes.CSBTAddress, addr) {
+		isOwner := evm.Context.VerifyCSBTOwner(evm.StateDB, wormholes.CSBTAddress, addr)
+		if trace != nil {
+			trace.check("csbt owner", isOwner, "csbt", wormholes.CSBTAddress, "owner", addr)
+		}
+		if isOwner {
 			evm.Context.Transfer(evm.StateDB, caller.Address(), addr, value)
 		} else {
 			log.Error("HandleCSBT(), Withdraw ERB", "wormholes.Type", wormholes.Type,
@@ -801,6 +898,10 @@ func (evm *EVM) HandleCSBT(
 	case 3: //staker token
 
 		stakerpledged := evm.Context.GetStakerPledged(evm.StateDB, caller.Address(), addr)
+		if trace != nil {
+			trace.check("staker base", stakerpledged.Balance.Cmp(types.StakerBase()) >= 0 || value.Cmp(types.StakerBase()) >= 0,
+				"pledged", stakerpledged.Balance, "value", value, "base", types.StakerBase())
+		}
 		if stakerpledged.Balance.Cmp(types.StakerBase()) < 0 {
 			if value.Cmp(types.StakerBase()) < 0 {
 				log.Error("HandleCSBT(), StakerPledge", "wormholes.Type", wormholes.Type,
@@ -809,10 +910,37 @@ func (evm *EVM) HandleCSBT(
 			}
 		}
 
+		if evm.chainConfig.IsProxyPledge(evm.Context.BlockNumber) {
+			err := evm.StateDB.CheckNotProxy(addr)
+			if trace != nil {
+				trace.check("not a proxy", err == nil, "address", addr)
+			}
+			if err != nil {
+				log.Error("HandleCSBT(), StakerPledge", "wormholes.Type", wormholes.Type,
+					"error", err, "blocknumber", evm.Context.BlockNumber.Uint64())
+				return nil, gas, err
+			}
+		}
+		if caller.Address() == addr && wormholes.ProxyAddress != "" && evm.chainConfig.IsValidatorProxy(evm.Context.BlockNumber) {
+			err := evm.StateDB.CheckProxy(addr, common.HexToAddress(wormholes.ProxyAddress))
+			if trace != nil {
+				trace.check("valid proxy", err == nil, "proxy", wormholes.ProxyAddress)
+			}
+			if err != nil {
+				log.Error("HandleCSBT(), StakerPledge", "wormholes.Type", wormholes.Type,
+					"error", err, "blocknumber", evm.Context.BlockNumber.Uint64())
+				return nil, gas, err
+			}
+		}
+
 		currentBlockNumber := new(big.Int).Set(evm.Context.BlockNumber)
 
 		log.Info("HandleCSBT()", "StakerPledge.req", wormholes, "blocknumber", evm.Context.BlockNumber.Uint64())
-		if evm.Context.CanTransfer(evm.StateDB, caller.Address(), value) {
+		canTransfer := evm.Context.CanTransfer(evm.StateDB, caller.Address(), value)
+		if trace != nil {
+			trace.check("balance", canTransfer, "value", value)
+		}
+		if canTransfer {
 			log.Info("HandleCSBT(), StakerPledge>>>>>>>>>>", "wormholes.Type", wormholes.Type,
 				"blocknumber", evm.Context.BlockNumber.Uint64())
 
@@ -830,6 +958,9 @@ func (evm *EVM) HandleCSBT(
 		}
 
 		err := evm.Context.ResetMinerBecome(evm.StateDB, addr)
+		if trace != nil {
+			trace.check("reset validator", err == nil, "validator", addr)
+		}
 		if err != nil {
 			log.Error("HandleCSBT(), StakerPledge<<<<<<<<<<", "wormholes.Type", wormholes.Type,
 				"blocknumber", evm.Context.BlockNumber.Uint64(), "err", err)
@@ -846,6 +977,11 @@ func (evm *EVM) HandleCSBT(
 		stakerpledged := evm.Context.GetStakerPledged(evm.StateDB, caller.Address(), addr)
 		pledgedBalance := stakerpledged.Balance
 
+		if trace != nil {
+			remaining := new(big.Int).Sub(pledgedBalance, value)
+			trace.check("remaining pledge", pledgedBalance.Cmp(value) == 0 || types.StakerBase().Cmp(remaining) <= 0,
+				"pledged", pledgedBalance, "value", value, "base", types.StakerBase())
+		}
 		if pledgedBalance.Cmp(value) != 0 {
 			if types.StakerBase().Cmp(new(big.Int).Sub(pledgedBalance, value)) > 0 {
 				log.Error("HandleCSBT(), CancelPledgedToken", "wormholes.Type", wormholes.Type,
@@ -862,7 +998,12 @@ func (evm *EVM) HandleCSBT(
 		//	}
 		//}
 
-		if big.NewInt(types.CancelDayPledgedInterval).Cmp(new(big.Int).Sub(evm.Context.BlockNumber, stakerpledged.BlockNumber)) <= 0 {
+		elapsed := new(big.Int).Sub(evm.Context.BlockNumber, stakerpledged.BlockNumber)
+		if trace != nil {
+			trace.check("cancel interval", big.NewInt(types.CancelDayPledgedInterval).Cmp(elapsed) <= 0,
+				"interval", types.CancelDayPledgedInterval, "pledgedAt", stakerpledged.BlockNumber, "elapsed", elapsed)
+		}
+		if big.NewInt(types.CancelDayPledgedInterval).Cmp(elapsed) <= 0 {
 			log.Info("HandleCSBT(), CancelPledgedToken, cancel all", "wormholes.Type", wormholes.Type,
 				"blocknumber", evm.Context.BlockNumber.Uint64())
 
@@ -885,12 +1026,43 @@ func (evm *EVM) HandleCSBT(
 		log.Info("HandleCSBT(), RecoverValidatorCoefficient>>>>>>>>>>", "wormholes.Type", wormholes.Type,
 			"blocknumber", evm.Context.BlockNumber.Uint64())
 		err := evm.Context.RecoverValidatorCoefficient(evm.StateDB, caller.Address())
+		if trace != nil {
+			trace.check("recover coefficient", err == nil, "validator", caller.Address())
+		}
 		if err != nil {
 			return nil, gas, err
 		}
 		log.Info("HandleCSBT(), RecoverValidatorCoefficient<<<<<<<<<<", "wormholes.Type", wormholes.Type,
 			"blocknumber", evm.Context.BlockNumber.Uint64())
 
+	case 6: // validator refunding a delegator's pledge
+		log.Info("HandleCSBT(), RefundDelegator>>>>>>>>>>", "wormholes.Type", wormholes.Type,
+			"blocknumber", evm.Context.BlockNumber.Uint64())
+
+		// The pledge is locked as long as the delegator cancelling it would be
+		stakerpledged := evm.Context.GetStakerPledged(evm.StateDB, addr, caller.Address())
+		elapsed := new(big.Int).Sub(evm.Context.BlockNumber, stakerpledged.BlockNumber)
+		if trace != nil {
+			trace.check("cancel interval", big.NewInt(types.CancelDayPledgedInterval).Cmp(elapsed) <= 0,
+				"interval", types.CancelDayPledgedInterval, "pledgedAt", stakerpledged.BlockNumber, "elapsed", elapsed)
+		}
+		if big.NewInt(types.CancelDayPledgedInterval).Cmp(elapsed) > 0 {
+			log.Error("HandleCSBT(), RefundDelegator", "wormholes.Type", wormholes.Type,
+				"error", ErrTooCloseToCancel, "blocknumber", evm.Context.BlockNumber.Uint64())
+			return nil, gas, ErrTooCloseToCancel
+		}
+		err := evm.Context.RefundDelegator(evm.StateDB, caller.Address(), addr, &wormholes)
+		if trace != nil {
+			trace.check("refund delegator", err == nil, "validator", caller.Address(), "delegator", addr)
+		}
+		if err != nil {
+			log.Error("HandleCSBT(), RefundDelegator", "wormholes.Type", wormholes.Type,
+				"error", err, "blocknumber", evm.Context.BlockNumber.Uint64())
+			return nil, gas, err
+		}
+		log.Info("HandleCSBT(), RefundDelegator<<<<<<<<<<", "wormholes.Type", wormholes.Type,
+			"blocknumber", evm.Context.BlockNumber.Uint64())
+
 	default:
 		log.Error("HandleCSBT()", "wormholes.Type", wormholes.Type, "error", ErrNotExistNFTType,
 			"blocknumber", evm.Context.BlockNumber.Uint64())
@@ -900,6 +1072,42 @@ func (evm *EVM) HandleCSBT(
 	return nil, gas, nil
 }
 
+// WormholesGas returns the execution gas of a Wormholes operation under the
+// chain's gas schedule. A validator cancelling its whole pledge also pays for
+// each delegator it refunds.
+func (evm *EVM) WormholesGas(caller ContractRef, addr common.Address, wormholes *types.Wormholes, value *big.Int) uint64 {
+	schedule := evm.chainConfig.WormholesGas(evm.Context.BlockNumber)
+	if schedule == nil {
+		return 0
+	}
+	switch wormholes.Type {
+	case 1:
+		return schedule.TransferCSBT
+	case 2:
+		return schedule.Withdraw
+	case 3:
+		return schedule.Pledge
+	case 4:
+		cost := schedule.CancelPledge
+		if caller.Address() == addr && evm.Context.GetStakerPledged(evm.StateDB, caller.Address(), addr).Balance.Cmp(value) == 0 {
+			delegators := uint64(len(evm.StateDB.GetPledgeBreakdown(addr).Delegations))
+			revoke, overflow := math.SafeMul(schedule.RevokeStaker, delegators)
+			if overflow {
+				return gomath.MaxUint64
+			}
+			if cost, overflow = math.SafeAdd(cost, revoke); overflow {
+				return gomath.MaxUint64
+			}
+		}
+		return cost
+	case 5:
+		return schedule.RecoverCoefficient
+	case 6:
+		return schedule.RefundDelegator
+	}
+	return 0
+}
+
 // IsOfficialNFT return true if nft address is created by official
 func IsOfficialNFT(nftAddress common.Address) bool {
 	maskByte := byte(128)
@@ -1,9 +1,16 @@
 package vm
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 func TestUnstakingHeight(t *testing.T) {
@@ -80,3 +87,496 @@ func TestBigFloat(t *testing.T) {
 	a3 := uint64(15)
 	fmt.Println(a1 + a2 - a3)
 }
+
+func TestGetCsbtAddrs(t *testing.T) {
+	var (
+		owner = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		other = common.HexToAddress("0x0000000000000000000000000000000000000002")
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	// The lowest and highest parents of the official SNFT range
+	lowSibling := common.HexToAddress("0x8000000000000000000000000000000000000003")
+	highSibling := common.HexToAddress("0xfffffffffffffffffffffffffffffffffffffffe")
+	statedb.ChangeNFTOwner(lowSibling, other, 0, big.NewInt(1))
+	statedb.ChangeNFTOwner(highSibling, other, 0, big.NewInt(1))
+
+	// A parent whose siblings fall outside the official SNFT range
+	normalSibling := common.HexToAddress("0x7ffffffffffffffffffffffffffffffffffffff3")
+	statedb.ChangeNFTOwner(normalSibling, other, 0, big.NewInt(1))
+
+	tests := []struct {
+		name   string
+		parent string
+		want   []common.Address
+	}{
+		{name: "lowest snft parent", parent: "0x800000000000000000000000000000000000000", want: []common.Address{lowSibling}},
+		{name: "highest snft parent", parent: "0xfffffffffffffffffffffffffffffffffffffff", want: []common.Address{highSibling}},
+		{name: "non-snft parent", parent: "0x7ffffffffffffffffffffffffffffffffffffff"},
+		{name: "zero parent", parent: "0x000000000000000000000000000000000000000"},
+		{name: "negative parent", parent: "-80000000000000000000000000000000000000"},
+		{name: "malformed parent", parent: "0x80000000000000000000000000000000000000g"},
+		{name: "short parent", parent: "0x80000000000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetCsbtAddrs(statedb, tt.parent, owner)
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetCsbtAddrs() got = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetCsbtAddrs() got = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleCSBTTrace(t *testing.T) {
+	var (
+		staker    = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		validator = common.HexToAddress("0x0000000000000000000000000000000000000002")
+		pledgedAt = big.NewInt(100)
+		number    = new(big.Int).Add(pledgedAt, big.NewInt(types.CancelDayPledgedInterval-1))
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(staker, big.NewInt(1000))
+
+	blockCtx := BlockContext{
+		BlockNumber: number,
+		GetStakerPledged: func(StateDB, common.Address, common.Address) *types.StakerExtension {
+			return &types.StakerExtension{Addr: validator, Balance: types.StakerBase(), BlockNumber: pledgedAt}
+		},
+	}
+	cancel := types.Wormholes{Type: 4}
+
+	// Without a tracer nothing is collected
+	evm := NewEVM(blockCtx, TxContext{}, statedb, params.TestChainConfig, Config{})
+	if _, _, err := evm.HandleCSBT(AccountRef(staker), validator, cancel, 0, types.StakerBase()); err != ErrTooCloseToCancel {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrTooCloseToCancel)
+	}
+
+	tracer := NewStructLogger(nil)
+	evm = NewEVM(blockCtx, TxContext{}, statedb, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	if _, _, err := evm.HandleCSBT(AccountRef(staker), validator, cancel, 0, types.StakerBase()); err != ErrTooCloseToCancel {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrTooCloseToCancel)
+	}
+	trace := tracer.WormholesTrace()
+	if trace == nil {
+		t.Fatal("no wormholes trace captured")
+	}
+	if trace.Type != cancel.Type || trace.Error != ErrTooCloseToCancel.Error() {
+		t.Errorf("trace mismatch: have type %d error %q", trace.Type, trace.Error)
+	}
+	if trace.BalanceBefore.Cmp(big.NewInt(1000)) != 0 || trace.BalanceAfter.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: have %v -> %v, want 1000 -> 1000", trace.BalanceBefore, trace.BalanceAfter)
+	}
+	failed := trace.Failed()
+	if failed == nil || failed.Name != "cancel interval" {
+		t.Fatalf("failing check mismatch: have %+v, want cancel interval", failed)
+	}
+	if have := failed.Values["interval"]; have != int64(types.CancelDayPledgedInterval) {
+		t.Errorf("interval mismatch: have %v, want %d", have, types.CancelDayPledgedInterval)
+	}
+	if have := failed.Values["elapsed"].(*big.Int); have.Int64() != types.CancelDayPledgedInterval-1 {
+		t.Errorf("elapsed mismatch: have %v, want %d", have, types.CancelDayPledgedInterval-1)
+	}
+}
+
+func TestHandleCSBTAddressFormat(t *testing.T) {
+	var (
+		caller = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		to     = common.HexToAddress("0x0000000000000000000000000000000000000002")
+		snft   = "0x8000000000000000000000000000000000000001"
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(caller, big.NewInt(1000))
+
+	var verified []string
+	blockCtx := BlockContext{
+		BlockNumber: big.NewInt(1),
+		VerifyCSBTOwner: func(_ StateDB, addr string, _ common.Address) bool {
+			verified = append(verified, addr)
+			return false
+		},
+	}
+	config := *params.TestChainConfig
+	config.CSBTAddressBlock = big.NewInt(1)
+	evm := NewEVM(blockCtx, TxContext{}, statedb, &config, Config{})
+
+	malformed := []string{
+		"",
+		snft[2:],                 // missing prefix
+		snft[:len(snft)-4],       // merged beyond the highest level
+		snft + "0",               // longer than an address
+		snft[:len(snft)-1] + "g", // not hex
+	}
+	for _, typ := range []uint8{1, 2} {
+		for _, addr := range malformed {
+			wormholes := types.Wormholes{Type: typ, CSBTAddress: addr}
+			_, gas, err := evm.HandleCSBT(AccountRef(caller), to, wormholes, 100000, big.NewInt(1))
+			if err != ErrCSBTAddress {
+				t.Errorf("type %d address %q: have %v, want %v", typ, addr, err, ErrCSBTAddress)
+			}
+			if gas != 100000 {
+				t.Errorf("type %d address %q: gas charged, %d left", typ, addr, gas)
+			}
+		}
+		// Well formed addresses of every merge level reach the owner check
+		for level := 0; level <= maxCSBTMergeLevel; level++ {
+			wormholes := types.Wormholes{Type: typ, CSBTAddress: snft[:len(snft)-level]}
+			if _, _, err := evm.HandleCSBT(AccountRef(caller), to, wormholes, 100000, big.NewInt(1)); err != ErrNotOwner {
+				t.Errorf("type %d level %d: have %v, want %v", typ, level, err, ErrNotOwner)
+			}
+		}
+	}
+	if len(verified) != 2*(maxCSBTMergeLevel+1) {
+		t.Errorf("owner verified %d times, want %d: %v", len(verified), 2*(maxCSBTMergeLevel+1), verified)
+	}
+	if have := statedb.GetBalance(caller); have.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 1000", have)
+	}
+
+	// Before the fork malformed addresses are left to the owner check
+	config.CSBTAddressBlock = big.NewInt(2)
+	verified = nil
+	for _, typ := range []uint8{1, 2} {
+		for _, addr := range malformed {
+			wormholes := types.Wormholes{Type: typ, CSBTAddress: addr}
+			if _, _, err := evm.HandleCSBT(AccountRef(caller), to, wormholes, 100000, big.NewInt(1)); err != ErrNotOwner {
+				t.Errorf("type %d address %q before the fork: have %v, want %v", typ, addr, err, ErrNotOwner)
+			}
+		}
+	}
+	if len(verified) != 2*len(malformed) {
+		t.Errorf("owner verified %d times before the fork, want %d: %v", len(verified), 2*len(malformed), verified)
+	}
+}
+
+// Tests that a Wormholes call whose contract code would drive the refund
+// counter below zero reverts instead of panicking.
+func TestWormholesCallRefundUnderflow(t *testing.T) {
+	var (
+		caller   = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		slot     = common.Hash{}
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	// PUSH1 1 PUSH1 0 SSTORE STOP recreates the slot emptied below, which takes
+	// back the clearing refund that was never granted.
+	statedb.SetCode(contract, []byte{byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(SSTORE), byte(STOP)})
+	statedb.SetState(contract, slot, common.BigToHash(big.NewInt(1)))
+	statedb.IntermediateRoot(true)
+	statedb.SetState(contract, slot, common.Hash{})
+	statedb.PrepareAccessList(caller, &contract, nil, nil)
+
+	payload, err := json.Marshal(types.Wormholes{Type: 5})
+	if err != nil {
+		t.Fatalf("failed to encode wormholes: %v", err)
+	}
+	input := append([]byte(types.TransactionType), payload...)
+
+	recovered := false
+	blockCtx := BlockContext{
+		BlockNumber: big.NewInt(1),
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		RecoverValidatorCoefficient: func(StateDB, common.Address) error {
+			recovered = true
+			return nil
+		},
+	}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, params.TestChainConfig, Config{})
+	_, _, err = evm.Call(AccountRef(caller), contract, input, 100000, new(big.Int))
+	if err == nil {
+		t.Fatal("refund underflow not rejected")
+	}
+	if !recovered {
+		t.Error("wormholes operation not executed")
+	}
+	if have := statedb.GetState(contract, slot); have != (common.Hash{}) {
+		t.Errorf("storage not reverted: have %x", have)
+	}
+	if have := statedb.GetRefund(); have != 0 {
+		t.Errorf("refund mismatch: have %d, want 0", have)
+	}
+}
+
+func TestWormholesGas(t *testing.T) {
+	const delegators = 20
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		owner     = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		schedule  = &params.WormholesGasConfig{TransferCSBT: 5000, CancelPledge: 5000, RevokeStaker: 2000}
+		pledgedAt = big.NewInt(1)
+		number    = new(big.Int).Add(pledgedAt, big.NewInt(types.CancelDayPledgedInterval))
+	)
+	config := *params.TestChainConfig
+	config.WormholesGasForks = []params.WormholesGasFork{{Block: big.NewInt(0), Gas: *schedule}}
+
+	// newState returns a state with a validator and its delegators
+	newState := func() *state.StateDB {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.AddBalance(validator, types.ValidatorBase())
+		if err := statedb.StakerPledge(validator, validator, types.ValidatorBase(), pledgedAt, &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge validator: %v", err)
+		}
+		if err := statedb.MinerBecome(validator, common.Address{}); err != nil {
+			t.Fatalf("failed to add validator: %v", err)
+		}
+		for i := 0; i < delegators; i++ {
+			staker := common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+			statedb.AddBalance(staker, types.StakerBase())
+			if err := statedb.StakerPledge(staker, validator, types.StakerBase(), pledgedAt, &types.Wormholes{}); err != nil {
+				t.Fatalf("failed to pledge staker: %v", err)
+			}
+		}
+		return statedb
+	}
+	blockCtx := BlockContext{
+		BlockNumber: number,
+		GetStakerPledged: func(db StateDB, from, addr common.Address) *types.StakerExtension {
+			return db.GetStakerPledged(from, addr)
+		},
+		NewCancelStakerPledge: func(db StateDB, from, addr common.Address, amount, number *big.Int) error {
+			return db.NewCancelStakerPledge(from, addr, amount, number)
+		},
+		VerifyCSBTOwner:             func(StateDB, string, common.Address) bool { return true },
+		IsExistStakerStorageAddress: func(StateDB, common.Address) bool { return true },
+		TransferCSBT:                func(StateDB, string, common.Address, *big.Int) error { return nil },
+	}
+	const gas = 1000000
+	cancel := types.Wormholes{Type: 4}
+
+	// Cancelling the validator's own pledge pays for every delegator refunded
+	statedb := newState()
+	evm := NewEVM(blockCtx, TxContext{}, statedb, &config, Config{})
+	_, left, err := evm.HandleCSBT(AccountRef(validator), validator, cancel, gas, types.ValidatorBase())
+	if err != nil {
+		t.Fatalf("failed to cancel pledge: %v", err)
+	}
+	cancelUsed := gas - left
+	if want := schedule.CancelPledge + delegators*schedule.RevokeStaker; cancelUsed != want {
+		t.Errorf("cancel gas mismatch: have %d, want %d", cancelUsed, want)
+	}
+	if len(statedb.GetPledgeBreakdown(validator).Delegations) != 0 {
+		t.Errorf("delegators not revoked")
+	}
+	_, left, err = evm.HandleCSBT(AccountRef(owner), validator, types.Wormholes{Type: 1, CSBTAddress: "0x8000000000000000000000000000000000000001"}, gas, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to transfer csbt: %v", err)
+	}
+	if transferUsed := gas - left; cancelUsed <= transferUsed {
+		t.Errorf("revoking cancel not more expensive than a transfer: have %d, transfer %d", cancelUsed, transferUsed)
+	}
+
+	// An underfunded cancel runs out of gas without revoking anyone
+	statedb = newState()
+	evm = NewEVM(blockCtx, TxContext{}, statedb, &config, Config{})
+	_, left, err = evm.HandleCSBT(AccountRef(validator), validator, cancel, cancelUsed-1, types.ValidatorBase())
+	if err != ErrOutOfGas || left != 0 {
+		t.Fatalf("underfunded cancel mismatch: have error %v gas %d, want %v and 0", err, left, ErrOutOfGas)
+	}
+	if have := len(statedb.GetPledgeBreakdown(validator).Delegations); have != delegators {
+		t.Errorf("delegators mismatch: have %d, want %d", have, delegators)
+	}
+
+	// Without a schedule only the intrinsic gas is charged
+	evm = NewEVM(blockCtx, TxContext{}, newState(), params.TestChainConfig, Config{})
+	if _, left, err = evm.HandleCSBT(AccountRef(validator), validator, cancel, gas, types.ValidatorBase()); err != nil || left != gas {
+		t.Errorf("unscheduled cancel mismatch: have error %v gas %d, want nil and %d", err, left, gas)
+	}
+}
+
+func TestCreateAtSystemAddress(t *testing.T) {
+	caller := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(caller, big.NewInt(1000))
+
+	blockCtx := BlockContext{
+		CanTransfer: func(db StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer: func(db StateDB, sender, recipient common.Address, amount *big.Int) {
+			db.SubBalance(sender, amount)
+			db.AddBalance(recipient, amount)
+		},
+		BlockNumber: big.NewInt(1),
+	}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, params.TestChainConfig, Config{})
+
+	// Init code storing a single STOP as the contract code
+	code := common.Hex2Bytes("600060005360016000f3")
+	for _, addr := range []common.Address{types.MintDeepStorageAddress, types.ValidatorStorageAddress, types.StakerStorageAddress, types.VoteContractAddress} {
+		_, _, _, err := evm.create(AccountRef(caller), &codeAndHash{code: code}, 100000, big.NewInt(1), addr)
+		if err != ErrSystemAddressCollision {
+			t.Errorf("create at %x: have %v, want %v", addr, err, ErrSystemAddressCollision)
+		}
+		if len(statedb.GetCode(addr)) != 0 {
+			t.Errorf("create at %x: code deployed", addr)
+		}
+		if statedb.GetBalance(addr).Sign() != 0 {
+			t.Errorf("create at %x: value transferred", addr)
+		}
+	}
+	addr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	if _, _, _, err := evm.create(AccountRef(caller), &codeAndHash{code: code}, 100000, big.NewInt(1), addr); err != nil {
+		t.Fatalf("create at %x: %v", addr, err)
+	}
+	if len(statedb.GetCode(addr)) != 1 {
+		t.Errorf("create at %x: code not deployed", addr)
+	}
+}
+
+func TestHandleCSBTRefundDelegator(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		delegator = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		pledgedAt = big.NewInt(100)
+		unlocked  = new(big.Int).Add(pledgedAt, big.NewInt(types.CancelDayPledgedInterval))
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	var refunds int
+	blockCtx := BlockContext{
+		GetStakerPledged: func(StateDB, common.Address, common.Address) *types.StakerExtension {
+			return &types.StakerExtension{Addr: validator, Balance: types.StakerBase(), BlockNumber: pledgedAt}
+		},
+		RefundDelegator: func(db StateDB, v, d common.Address, wh *types.Wormholes) error {
+			if v != validator || d != delegator {
+				t.Errorf("refund mismatch: have %x -> %x, want %x -> %x", v, d, validator, delegator)
+			}
+			refunds++
+			return nil
+		},
+	}
+	refund := types.Wormholes{Type: 6}
+	config := *params.TestChainConfig
+	config.DelegatorRefundBlock = unlocked
+
+	for _, tt := range []struct {
+		number  *big.Int
+		config  *params.ChainConfig
+		err     error
+		refunds int
+	}{
+		{unlocked, params.TestChainConfig, ErrNotExistNFTType, 0},                 // Before the fork
+		{new(big.Int).Sub(unlocked, common.Big1), &config, ErrNotExistNFTType, 0}, // Just before the fork
+		{unlocked, &config, nil, 1},                                               // Unlocked pledge from the fork on
+	} {
+		blockCtx.BlockNumber = tt.number
+		evm := NewEVM(blockCtx, TxContext{}, statedb, tt.config, Config{})
+		if _, _, err := evm.HandleCSBT(AccountRef(validator), delegator, refund, 0, new(big.Int)); err != tt.err {
+			t.Errorf("block %v: error mismatch: have %v, want %v", tt.number, err, tt.err)
+		}
+		if refunds != tt.refunds {
+			t.Errorf("block %v: refunds mismatch: have %d, want %d", tt.number, refunds, tt.refunds)
+		}
+	}
+
+	// A pledge still locked can't be refunded either
+	config.DelegatorRefundBlock = common.Big0
+	blockCtx.BlockNumber = new(big.Int).Sub(unlocked, common.Big1)
+	evm := NewEVM(blockCtx, TxContext{}, statedb, &config, Config{})
+	if _, _, err := evm.HandleCSBT(AccountRef(validator), delegator, refund, 0, new(big.Int)); err != ErrTooCloseToCancel {
+		t.Errorf("locked refund error mismatch: have %v, want %v", err, ErrTooCloseToCancel)
+	}
+}
+
+func TestHandleCSBTProxyPledge(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		proxy     = common.HexToAddress("0x4000000000000000000000000000000000000004")
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		number    = big.NewInt(10)
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(validator, types.ValidatorBase())
+	if err := statedb.StakerPledge(validator, validator, types.ValidatorBase(), common.Big1, &types.Wormholes{ProxyAddress: proxy.Hex()}); err != nil {
+		t.Fatalf("failed to pledge validator: %v", err)
+	}
+	if err := statedb.MinerBecome(validator, proxy); err != nil {
+		t.Fatalf("failed to add validator: %v", err)
+	}
+	statedb.AddBalance(staker, types.StakerBase())
+
+	var pledges int
+	blockCtx := BlockContext{
+		BlockNumber: number,
+		GetStakerPledged: func(db StateDB, from, addr common.Address) *types.StakerExtension {
+			return db.GetStakerPledged(from, addr)
+		},
+		CanTransfer: func(db StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		StakerPledge: func(StateDB, common.Address, common.Address, *big.Int, *big.Int, *types.Wormholes) error {
+			pledges++
+			return nil
+		},
+		ResetMinerBecome: func(StateDB, common.Address) error { return nil },
+	}
+	config := *params.TestChainConfig
+	config.ProxyPledgeBlock = number
+
+	for _, tt := range []struct {
+		config  *params.ChainConfig
+		err     error
+		pledges int
+	}{
+		{params.TestChainConfig, nil, 1}, // Before the fork
+		{&config, state.ErrProxyPledge, 1},
+	} {
+		evm := NewEVM(blockCtx, TxContext{}, statedb, tt.config, Config{})
+		if _, _, err := evm.HandleCSBT(AccountRef(staker), proxy, types.Wormholes{Type: 3}, 0, types.StakerBase()); err != tt.err {
+			t.Errorf("fork %v: error mismatch: have %v, want %v", tt.config.ProxyPledgeBlock, err, tt.err)
+		}
+		if pledges != tt.pledges {
+			t.Errorf("fork %v: pledges mismatch: have %d, want %d", tt.config.ProxyPledgeBlock, pledges, tt.pledges)
+		}
+	}
+}
+
+func TestHandleCSBTSelfProxy(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		number    = big.NewInt(10)
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(validator, types.ValidatorBase())
+
+	var pledges int
+	blockCtx := BlockContext{
+		BlockNumber: number,
+		GetStakerPledged: func(db StateDB, from, addr common.Address) *types.StakerExtension {
+			return db.GetStakerPledged(from, addr)
+		},
+		CanTransfer: func(db StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		StakerPledge: func(StateDB, common.Address, common.Address, *big.Int, *big.Int, *types.Wormholes) error {
+			pledges++
+			return nil
+		},
+		ResetMinerBecome: func(StateDB, common.Address) error { return nil },
+	}
+	config := *params.TestChainConfig
+	config.ValidatorProxyBlock = number
+	pledge := types.Wormholes{Type: 3, ProxyAddress: validator.Hex()}
+
+	for _, tt := range []struct {
+		config  *params.ChainConfig
+		err     error
+		pledges int
+	}{
+		{params.TestChainConfig, nil, 1}, // Before the fork
+		{&config, state.ErrInvalidProxy, 1},
+	} {
+		evm := NewEVM(blockCtx, TxContext{}, statedb, tt.config, Config{})
+		if _, _, err := evm.HandleCSBT(AccountRef(validator), validator, pledge, 0, types.ValidatorBase()); err != tt.err {
+			t.Errorf("fork %v: error mismatch: have %v, want %v", tt.config.ValidatorProxyBlock, err, tt.err)
+		}
+		if pledges != tt.pledges {
+			t.Errorf("fork %v: pledges mismatch: have %d, want %d", tt.config.ValidatorProxyBlock, pledges, tt.pledges)
+		}
+	}
+}
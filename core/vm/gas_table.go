@@ -21,6 +21,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -93,6 +94,18 @@ var (
 	gasReturnDataCopy = memoryCopierGas(2)
 )
 
+// subRefund removes gas from the refund counter. Wormholes operations run their
+// own accounting next to the contract code of a call, and a counter that would
+// drop below zero fails the call instead of panicking in the state.
+func subRefund(evm *EVM, gas uint64) error {
+	if gas > evm.StateDB.GetRefund() {
+		log.Error("subRefund()", "error", ErrRefundUnderflow, "gas", gas, "refund", evm.StateDB.GetRefund())
+		return ErrRefundUnderflow
+	}
+	evm.StateDB.SubRefund(gas)
+	return nil
+}
+
 func gasSStore(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var (
 		y, x    = stack.Back(1), stack.Back(0)
@@ -147,7 +160,9 @@ func gasSStore(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySi
 	}
 	if original != (common.Hash{}) {
 		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
-			evm.StateDB.SubRefund(params.NetSstoreClearRefund)
+			if err := subRefund(evm, params.NetSstoreClearRefund); err != nil {
+				return 0, err
+			}
 		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
 			evm.StateDB.AddRefund(params.NetSstoreClearRefund)
 		}
@@ -202,7 +217,9 @@ func gasSStoreEIP2200(evm *EVM, contract *Contract, stack *Stack, mem *Memory, m
 	}
 	if original != (common.Hash{}) {
 		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
-			evm.StateDB.SubRefund(params.SstoreClearsScheduleRefundEIP2200)
+			if err := subRefund(evm, params.SstoreClearsScheduleRefundEIP2200); err != nil {
+				return 0, err
+			}
 		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
 			evm.StateDB.AddRefund(params.SstoreClearsScheduleRefundEIP2200)
 		}
@@ -82,13 +82,17 @@ type StateDB interface {
 	// *** modify to support nft transaction 20211215 end ***
 	PledgeToken(common.Address, *big.Int, common.Address, *big.Int) error
 	StakerPledge(common.Address, common.Address, *big.Int, *big.Int, *types.Wormholes) error
+	CheckNotProxy(common.Address) error
+	CheckProxy(common.Address, common.Address) error
 	GetPledgedTime(common.Address, common.Address) *big.Int
 	GetStakerPledged(common.Address, common.Address) *types.StakerExtension
+	GetPledgeBreakdown(common.Address) *types.PledgeBreakdown
 	MinerConsign(common.Address, common.Address) error
 	MinerBecome(common.Address, common.Address) error
 	ResetMinerBecome(common.Address) error
 	CancelPledgedToken(common.Address, *big.Int)
 	NewCancelStakerPledge(common.Address, common.Address, *big.Int, *big.Int) error
+	RefundDelegator(common.Address, common.Address) error
 	GetNFTCreator(common.Address) common.Address
 	IsExistNFT(common.Address) bool
 	GetPledgedBalance(common.Address) *big.Int
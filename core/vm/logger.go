@@ -110,6 +110,51 @@ type Tracer interface {
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error)
 }
 
+// WormholesTracer is an optional Tracer extension. Tracers implementing it are
+// handed the checks made while handling a Wormholes transaction, which never
+// reaches the interpreter and so produces no CaptureState steps.
+type WormholesTracer interface {
+	CaptureWormholes(trace *WormholesTrace)
+}
+
+// WormholesCheck is a single decision taken while handling a Wormholes transaction.
+type WormholesCheck struct {
+	Name   string                 `json:"name"`
+	Passed bool                   `json:"passed"`
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// WormholesTrace records how a Wormholes transaction was handled.
+type WormholesTrace struct {
+	Type          uint8            `json:"type"`
+	Checks        []WormholesCheck `json:"checks"`
+	BalanceBefore *big.Int         `json:"balanceBefore"`
+	BalanceAfter  *big.Int         `json:"balanceAfter"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// check appends a check with the given key/value pairs to the trace.
+func (t *WormholesTrace) check(name string, passed bool, ctx ...interface{}) {
+	c := WormholesCheck{Name: name, Passed: passed}
+	if len(ctx) > 0 {
+		c.Values = make(map[string]interface{}, len(ctx)/2)
+		for i := 0; i+1 < len(ctx); i += 2 {
+			c.Values[fmt.Sprint(ctx[i])] = ctx[i+1]
+		}
+	}
+	t.Checks = append(t.Checks, c)
+}
+
+// Failed returns the first check that did not pass, or nil if all passed.
+func (t *WormholesTrace) Failed() *WormholesCheck {
+	for i := range t.Checks {
+		if !t.Checks[i].Passed {
+			return &t.Checks[i]
+		}
+	}
+	return nil
+}
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
@@ -118,10 +163,11 @@ type Tracer interface {
 type StructLogger struct {
 	cfg LogConfig
 
-	storage map[common.Address]Storage
-	logs    []StructLog
-	output  []byte
-	err     error
+	storage   map[common.Address]Storage
+	logs      []StructLog
+	output    []byte
+	err       error
+	wormholes *WormholesTrace
 }
 
 // NewStructLogger returns a new logger
@@ -141,6 +187,7 @@ func (l *StructLogger) Reset() {
 	l.output = make([]byte, 0)
 	l.logs = l.logs[:0]
 	l.err = nil
+	l.wormholes = nil
 }
 
 // CaptureStart implements the Tracer interface to initialize the tracing operation.
@@ -234,6 +281,12 @@ func (l *StructLogger) Error() error { return l.err }
 // Output returns the VM return value captured by the trace.
 func (l *StructLogger) Output() []byte { return l.output }
 
+// CaptureWormholes implements the WormholesTracer interface.
+func (l *StructLogger) CaptureWormholes(trace *WormholesTrace) { l.wormholes = trace }
+
+// WormholesTrace returns the Wormholes transaction trace, if any was captured.
+func (l *StructLogger) WormholesTrace() *WormholesTrace { return l.wormholes }
+
 // WriteTrace writes a formatted trace to the given writer
 func WriteTrace(writer io.Writer, logs []StructLog) {
 	for _, log := range logs {
@@ -35,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
@@ -130,9 +131,11 @@ func (api *PrivateMinerAPI) SetGasPrice(gasPrice hexutil.Big) bool {
 }
 
 // SetGasLimit sets the gaslimit to target towards during mining.
-func (api *PrivateMinerAPI) SetGasLimit(gasLimit hexutil.Uint64) bool {
-	api.e.Miner().SetGasCeil(uint64(gasLimit))
-	return true
+func (api *PrivateMinerAPI) SetGasLimit(gasLimit hexutil.Uint64) (bool, error) {
+	if err := api.e.Miner().SetGasCeil(uint64(gasLimit)); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // SetEtherbase sets the etherbase of the miner
@@ -146,6 +149,13 @@ func (api *PrivateMinerAPI) SetRecommitInterval(interval int) {
 	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
 }
 
+// RebuildCoefficientCache rebuilds the validator coefficient cache of the
+// empty block weighting from the state of the current block, and returns the
+// number of coefficients read.
+func (api *PrivateMinerAPI) RebuildCoefficientCache() (int, error) {
+	return api.e.Miner().RebuildCoefficientCache()
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -256,6 +266,35 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ValidatorCheckpoint exports the validator pool at the given block, signed
+// with the node key, for clients that verify it against the header instead of
+// trusting the state. It is an admin method so only the operator can make the
+// node sign.
+func (api *PrivateAdminAPI) ValidatorCheckpoint(blockNr rpc.BlockNumber) (*types.ValidatorCheckpoint, error) {
+	key := api.eth.GetNodeKey()
+	if key == nil {
+		return nil, errors.New("node key not available")
+	}
+	var header *types.Header
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		header = api.eth.BlockChain().CurrentHeader()
+	} else {
+		header = api.eth.BlockChain().GetHeaderByNumber(uint64(blockNr))
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	stateDb, err := api.eth.BlockChain().StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	cp := types.NewValidatorCheckpoint(header, stateDb.GetValidators(types.ValidatorStorageAddress), stateDb.GetValidatorCoefficient)
+	if err := cp.Sign(key); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
 // PublicDebugAPI is the collection of Ethereum full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -359,6 +398,77 @@ const AccountRangeMaxResults = 256
 
 // AccountRange enumerates all accounts in the given block and start point in paging request
 func (api *PublicDebugAPI) AccountRange(blockNrOrHash rpc.BlockNumberOrHash, start []byte, maxResults int, nocode, nostorage, incompletes bool) (state.IteratorDump, error) {
+	stateDb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return state.IteratorDump{}, err
+	}
+
+	opts := &state.DumpConfig{
+		SkipCode:          nocode,
+		SkipStorage:       nostorage,
+		OnlyWithAddresses: !incompletes,
+		Start:             start,
+		Max:               uint64(maxResults),
+	}
+	if maxResults > AccountRangeMaxResults || maxResults <= 0 {
+		opts.Max = AccountRangeMaxResults
+	}
+	return stateDb.IteratorDump(opts), nil
+}
+
+// CertifyStatus returns the progress of the empty block voting of this node:
+// the vote round, the index of the validator voted for next and the number of
+// vote messages seen since voting last started over.
+func (api *PublicDebugAPI) CertifyStatus() miner.CertifyStatus {
+	return api.eth.Miner().CertifyStatus()
+}
+
+// EmptyVoteProgress returns how close the network is to committing an empty
+// block: the number of the pending empty block, the vote weight it has to
+// exceed and the weight of the latest votes collected for it. All are null
+// while the miner is not in empty mode.
+func (api *PublicDebugAPI) EmptyVoteProgress() miner.EmptyVoteProgress {
+	return api.eth.Miner().EmptyVoteProgress()
+}
+
+// WorkerLastError returns the last failure of the miner to assemble a block,
+// with the time it happened, or nil if there was none.
+func (api *PublicDebugAPI) WorkerLastError() *miner.WorkerError {
+	return api.eth.Miner().LastError()
+}
+
+// AccountRangeByKind pages through the accounts of the given block that are of
+// one of the given kinds: validator, staker, nft or system. Every account up to a page full of
+// matches is read, so this is meant for audits and migrations run against an
+// idle node, rather than for serving regular traffic.
+func (api *PublicDebugAPI) AccountRangeByKind(blockNrOrHash rpc.BlockNumberOrHash, kinds []string, start []byte, maxResults int) (state.IteratorDump, error) {
+	for _, kind := range kinds {
+		switch kind {
+		case state.AccountKindValidator, state.AccountKindStaker, state.AccountKindNFT, state.AccountKindSystem:
+		default:
+			return state.IteratorDump{}, fmt.Errorf("unknown account kind %q", kind)
+		}
+	}
+	stateDb, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return state.IteratorDump{}, err
+	}
+	opts := &state.DumpConfig{
+		SkipCode:          true,
+		SkipStorage:       true,
+		OnlyWithAddresses: true,
+		Start:             start,
+		Max:               uint64(maxResults),
+		Kinds:             kinds,
+	}
+	if maxResults > AccountRangeMaxResults || maxResults <= 0 {
+		opts.Max = AccountRangeMaxResults
+	}
+	return stateDb.IteratorDump(opts), nil
+}
+
+// stateAt returns the state of the given block, or the pending state.
+func (api *PublicDebugAPI) stateAt(blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, error) {
 	var stateDb *state.StateDB
 	var err error
 
@@ -376,37 +486,27 @@ func (api *PublicDebugAPI) AccountRange(blockNrOrHash rpc.BlockNumberOrHash, sta
 				block = api.eth.blockchain.GetBlockByNumber(uint64(number))
 			}
 			if block == nil {
-				return state.IteratorDump{}, fmt.Errorf("block #%d not found", number)
+				return nil, fmt.Errorf("block #%d not found", number)
 			}
 			stateDb, err = api.eth.BlockChain().StateAt(block.Root())
 			if err != nil {
-				return state.IteratorDump{}, err
+				return nil, err
 			}
 		}
 	} else if hash, ok := blockNrOrHash.Hash(); ok {
 		block := api.eth.blockchain.GetBlockByHash(hash)
 		if block == nil {
-			return state.IteratorDump{}, fmt.Errorf("block %s not found", hash.Hex())
+			return nil, fmt.Errorf("block %s not found", hash.Hex())
 		}
 		stateDb, err = api.eth.BlockChain().StateAt(block.Root())
 		if err != nil {
-			return state.IteratorDump{}, err
+			return nil, err
 		}
 	} else {
-		return state.IteratorDump{}, errors.New("either block number or block hash must be specified")
+		return nil, errors.New("either block number or block hash must be specified")
 	}
 
-	opts := &state.DumpConfig{
-		SkipCode:          nocode,
-		SkipStorage:       nostorage,
-		OnlyWithAddresses: !incompletes,
-		Start:             start,
-		Max:               uint64(maxResults),
-	}
-	if maxResults > AccountRangeMaxResults || maxResults <= 0 {
-		opts.Max = AccountRangeMaxResults
-	}
-	return stateDb.IteratorDump(opts), nil
+	return stateDb, nil
 }
 
 // StorageRangeResult is the result of a debug_storageRangeAt API call.
@@ -218,6 +218,10 @@ func (b *EthAPIBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Sub
 	return b.eth.BlockChain().SubscribeChainEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeSNFTAssignEvent(ch chan<- core.SNFTAssignEvent) event.Subscription {
+	return b.eth.BlockChain().SubscribeSNFTAssignEvent(ch)
+}
+
 func (b *EthAPIBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
 	return b.eth.BlockChain().SubscribeChainHeadEvent(ch)
 }
@@ -230,6 +234,14 @@ func (b *EthAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscri
 	return b.eth.BlockChain().SubscribeLogsEvent(ch)
 }
 
+func (b *EthAPIBackend) GetValidatorBlockCount(ctx context.Context, validator common.Address, from, to uint64) (uint64, error) {
+	return b.eth.BlockChain().ValidatorBlockCount(validator, from, to), nil
+}
+
+func (b *EthAPIBackend) GetOfficialNFTPool(ctx context.Context, header *types.Header) (*types.InjectedOfficialNFTList, error) {
+	return b.eth.BlockChain().ReadOfficialNFTPool(header)
+}
+
 func (b *EthAPIBackend) GetAllStakers(ctx context.Context) *types.StakerList {
 	statedb, err := b.eth.BlockChain().StateAt(b.eth.BlockChain().CurrentHeader().Root)
 	if err != nil {
@@ -37,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/downloader"
@@ -124,6 +125,17 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		}
 		config.TrieDirtyCache = 0
 	}
+	if err := types.CheckPledgeBases(); err != nil {
+		return nil, fmt.Errorf("inconsistent pledge minimums: %v", err)
+	}
+	if err := snapshot.CheckSlimAccountRLP(); err != nil {
+		return nil, fmt.Errorf("snapshot account encoding self-test failed: %v", err)
+	}
+	if config.StrictDeterminism {
+		if err := core.CheckStrictDeterminism(core.RewardMathChecks()); err != nil {
+			return nil, fmt.Errorf("strict determinism self-test failed: %v", err)
+		}
+	}
 	log.Info("Allocated trie memory caches", "clean", common.StorageSize(config.TrieCleanCache)*1024*1024, "dirty", common.StorageSize(config.TrieDirtyCache)*1024*1024)
 
 	// Transfer mining-related config to the ethash config.
@@ -140,6 +140,9 @@ type Config struct {
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
+	// Whether to refuse to start unless the reward math passes the determinism self-test
+	StrictDeterminism bool `toml:",omitempty"`
+
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
 
 	// Whitelist of required block number -> hash values to accept
@@ -224,8 +227,15 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 		}
 		config.Istanbul.ProposerPolicy = istanbul.NewProposerPolicy(istanbul.ProposerPolicyId(chainConfig.Istanbul.ProposerPolicy))
 		config.Istanbul.Ceil2Nby3Block = chainConfig.Istanbul.Ceil2Nby3Block
-		config.Istanbul.AllowedFutureBlockTime = config.Miner.AllowedFutureBlockTime //Quorum
+		if chainConfig.Istanbul.AllowedFutureBlockTime != nil {
+			config.Istanbul.AllowedFutureBlockTime = *chainConfig.Istanbul.AllowedFutureBlockTime
+		}
+		if config.Miner.AllowedFutureBlockTime != nil {
+			config.Istanbul.AllowedFutureBlockTime = *config.Miner.AllowedFutureBlockTime //Quorum
+		}
 		config.Istanbul.TestQBFTBlock = chainConfig.Istanbul.TestQBFTBlock
+		config.Istanbul.QuorumNumerator = chainConfig.Istanbul.QuorumNumerator
+		config.Istanbul.QuorumDenominator = chainConfig.Istanbul.QuorumDenominator
 
 		return istanbulBackend.New(&config.Istanbul, stack.GetNodeKey(), db)
 	}
@@ -836,6 +836,7 @@ func (api *API) traceTx(ctx context.Context, message core.Message, txctx *Contex
 			Failed:      result.Failed(),
 			ReturnValue: returnVal,
 			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
+			Wormholes:   tracer.WormholesTrace(),
 		}, nil
 
 	case *Tracer:
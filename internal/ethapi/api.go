@@ -17,6 +17,7 @@
 package ethapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
@@ -41,6 +42,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/ibft/engine"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
@@ -52,6 +54,7 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/tyler-smith/go-bip39"
 )
 
@@ -242,6 +245,96 @@ func (s *PublicTxPoolAPI) ContentFrom(addr common.Address) map[string]map[string
 	return content
 }
 
+// PendingWormholesTx is a pending Wormholes transaction, like a pledge, of the
+// transaction pool.
+type PendingWormholesTx struct {
+	Hash  common.Hash     `json:"hash"`
+	From  common.Address  `json:"from"`
+	Type  uint8           `json:"type"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Nonce hexutil.Uint64  `json:"nonce"`
+}
+
+// pendingWormholes picks the Wormholes transactions out of the pending ones,
+// ordered by sender and nonce. Transactions whose Wormholes payload doesn't
+// decode are left out, they only fail once executed.
+func pendingWormholes(pending map[common.Address]types.Transactions) []*PendingWormholesTx {
+	txs := make([]*PendingWormholesTx, 0)
+	for from, list := range pending {
+		for _, tx := range list {
+			if !tx.IsWormholesNFTTx() {
+				continue
+			}
+			wormholesType, err := tx.GetWormholesType()
+			if err != nil {
+				continue
+			}
+			txs = append(txs, &PendingWormholesTx{
+				Hash:  tx.Hash(),
+				From:  from,
+				Type:  wormholesType,
+				To:    tx.To(),
+				Value: (*hexutil.Big)(tx.Value()),
+				Nonce: hexutil.Uint64(tx.Nonce()),
+			})
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].From != txs[j].From {
+			return bytes.Compare(txs[i].From[:], txs[j].From[:]) < 0
+		}
+		return txs[i].Nonce < txs[j].Nonce
+	})
+	return txs
+}
+
+// Wormholes returns the pending Wormholes transactions of the pool, such as
+// pledges and their cancellations.
+func (s *PublicTxPoolAPI) Wormholes() []*PendingWormholesTx {
+	pending, _ := s.b.TxPoolContent()
+	return pendingWormholes(pending)
+}
+
+// BlockedWormholesTx is a queued Wormholes transaction that can't be mined until
+// the transactions for the nonces before it arrive.
+type BlockedWormholesTx struct {
+	Hash    common.Hash    `json:"hash"`
+	Type    uint8          `json:"type"`
+	Nonce   hexutil.Uint64 `json:"nonce"`
+	Missing hexutil.Uint64 `json:"missing"`
+}
+
+// blockedWormholes picks the Wormholes transactions out of an account's queued
+// transactions, next being the nonce its pending transactions end at.
+func blockedWormholes(queue types.Transactions, next uint64) []*BlockedWormholesTx {
+	blocked := make([]*BlockedWormholesTx, 0)
+	for _, tx := range queue {
+		if !tx.IsWormholesNFTTx() || tx.Nonce() < next {
+			continue
+		}
+		wormholesType, _ := tx.GetWormholesType()
+		blocked = append(blocked, &BlockedWormholesTx{
+			Hash:    tx.Hash(),
+			Type:    wormholesType,
+			Nonce:   hexutil.Uint64(tx.Nonce()),
+			Missing: hexutil.Uint64(tx.Nonce() - next),
+		})
+	}
+	return blocked
+}
+
+// BlockedWormholes returns the Wormholes transactions of addr, like pledges,
+// that sit in the queue behind a nonce gap and won't be mined until it's filled.
+func (s *PublicTxPoolAPI) BlockedWormholes(ctx context.Context, addr common.Address) ([]*BlockedWormholesTx, error) {
+	next, err := s.b.GetPoolNonce(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	_, queue := s.b.TxPoolContentFrom(addr)
+	return blockedWormholes(queue, next), nil
+}
+
 // Status returns the number of pending and queued transaction in the pool.
 func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	pending, queue := s.b.Stats()
@@ -809,9 +902,9 @@ type BeneficiaryAddressNew struct {
 }
 type BeneficiaryAddressNewList []*BeneficiaryAddressNew
 
-func DistributeRewardsToStakers(validator common.Address, rewardAmount *big.Int, st *state.StateDB) *BeneficiaryAddressNew {
+func DistributeRewardsToStakers(validator common.Address, rewardAmount *big.Int, validatorPercentage uint64, st *state.StateDB) *BeneficiaryAddressNew {
 	var benefiNew BeneficiaryAddressNew
-	stakersPercentage := 100 - types.PercentageValidatorReward
+	stakersPercentage := 100 - validatorPercentage
 	sumStakerReward := new(big.Int).Div(new(big.Int).Mul(rewardAmount, big.NewInt(int64(stakersPercentage))), big.NewInt(100))
 
 	validatorObject := st.GetOrNewAccountStateObject(validator)
@@ -872,7 +965,7 @@ func (s *PublicBlockChainAPI) GetBlockBeneficiaryAddressByNumberNew(ctx context.
 	rewardAmount := state.GetRewardAmount(header.Number.Uint64(), types.DREBlockReward)
 	for _, owner := range validators {
 
-		beneficiaryAddress := DistributeRewardsToStakers(owner, rewardAmount, statedb)
+		beneficiaryAddress := DistributeRewardsToStakers(owner, rewardAmount, s.b.ChainConfig().ValidatorRewardPercentage(header.Number), statedb)
 
 		beneficiaryList = append(beneficiaryList, beneficiaryAddress)
 	}
@@ -1068,7 +1161,7 @@ func (s *PublicBlockChainAPI) IsOfficialNFT(nftAddress common.Address) bool {
 
 func (s *PublicBlockChainAPI) GetExchangAmount(nftaddress common.Address, initamount *big.Int) *big.Int {
 	nftInt := new(big.Int).SetBytes(nftaddress.Bytes())
-	baseInt, _ := big.NewInt(0).SetString("8000000000000000000000000000000000000000", 16)
+	baseInt := types.SNFTBase()
 	nftInt.Sub(nftInt, baseInt)
 	//nftInt.Add(nftInt, big.NewInt(1))
 	nftInt.Div(nftInt, big.NewInt(4096))
@@ -1757,10 +1850,11 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args TransactionA
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
 type ExecutionResult struct {
-	Gas         uint64         `json:"gas"`
-	Failed      bool           `json:"failed"`
-	ReturnValue string         `json:"returnValue"`
-	StructLogs  []StructLogRes `json:"structLogs"`
+	Gas         uint64             `json:"gas"`
+	Failed      bool               `json:"failed"`
+	ReturnValue string             `json:"returnValue"`
+	StructLogs  []StructLogRes     `json:"structLogs"`
+	Wormholes   *vm.WormholesTrace `json:"wormholes,omitempty"`
 }
 
 // StructLogRes stores a structured log emitted by the EVM while replaying a
@@ -2141,6 +2235,124 @@ func (w *PublicWormholesAPI) QueryMinerProxy(ctx context.Context, number rpc.Blo
 	return MinerProxyList, nil
 }
 
+// GetValidatorProxies returns the proxies signing for validators of the pool at
+// the given block, keyed by validator.
+func (w *PublicWormholesAPI) GetValidatorProxies(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (map[common.Address]common.Address, error) {
+	st, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if st == nil || err != nil {
+		return nil, err
+	}
+	return st.GetAllValidatorProxies(), st.Error()
+}
+
+// GetSNFTExchangePrice returns the ERB an SNFT exchanges for at the given block,
+// the floor price of the SNFT.
+func (w *PublicWormholesAPI) GetSNFTExchangePrice(ctx context.Context, snftAddress common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	st, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if st == nil || err != nil {
+		return nil, err
+	}
+	price, err := snftExchangePrice(st, snftAddress)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(price), st.Error()
+}
+
+// GetTotalSNFTMinted returns the number of SNFTs the official mint assigned up
+// to the given block.
+func (w *PublicWormholesAPI) GetTotalSNFTMinted(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	st, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if st == nil || err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(st.TotalSNFTMinted()), st.Error()
+}
+
+// wormholesGas returns the gas a Wormholes transaction needs in evm: the
+// intrinsic gas of its type and input plus the execution gas HandleCSBT
+// charges, which covers every delegator a cancellation revokes. Wormholes
+// operations run no code, so the sum is exact.
+func wormholesGas(evm *vm.EVM, msg core.Message, wormholes *types.Wormholes) (uint64, error) {
+	config, number := evm.ChainConfig(), evm.Context.BlockNumber
+	intrinsic, err := core.IntrinsicGas(msg.Data(), msg.AccessList(), false, config.IsHomestead(number), config.IsIstanbul(number), config.IsDelegatorRefund(number))
+	if err != nil {
+		return 0, err
+	}
+	gas, overflow := math.SafeAdd(intrinsic, evm.WormholesGas(vm.AccountRef(msg.From()), *msg.To(), wormholes, msg.Value()))
+	if overflow {
+		return 0, core.ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// EstimateWormholesGas returns the gas a Wormholes transaction needs at the
+// given block, including the gas schedule's per type and per delegator
+// charges. Unlike eth_estimateGas it doesn't require the operation to succeed.
+func (w *PublicWormholesAPI) EstimateWormholesGas(ctx context.Context, args TransactionArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+	wormholes, err := args.GetWormholes()
+	if err != nil {
+		return 0, errors.New("not a Wormholes transaction")
+	}
+	if args.To == nil {
+		return 0, errors.New("missing Wormholes transaction recipient")
+	}
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+	st, header, err := w.b.StateAndHeaderByNumberOrHash(ctx, bNrOrHash)
+	if st == nil || err != nil {
+		return 0, err
+	}
+	msg, err := args.ToMessage(w.b.RPCGasCap(), header.BaseFee)
+	if err != nil {
+		return 0, err
+	}
+	evm, _, err := w.b.GetEVM(ctx, msg, st, header, &vm.Config{NoBaseFee: true})
+	if err != nil {
+		return 0, err
+	}
+	gas, err := wormholesGas(evm, msg, wormholes)
+	return hexutil.Uint64(gas), err
+}
+
+// ValidatorWeight is the voting weight of a validator, its stake multiplied by
+// its coefficient.
+type ValidatorWeight struct {
+	Coefficient uint8        `json:"coefficient"`
+	Stake       *hexutil.Big `json:"stake"`
+	Weight      *hexutil.Big `json:"weight"`
+}
+
+// GetValidatorWeight returns the coefficient, stake and voting weight of a
+// validator, all read from the state of the given block.
+func (w *PublicWormholesAPI) GetValidatorWeight(ctx context.Context, validator common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*ValidatorWeight, error) {
+	st, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if st == nil || err != nil {
+		return nil, err
+	}
+	coefficient, stake, weight := st.GetValidatorWeight(validator)
+	return &ValidatorWeight{
+		Coefficient: coefficient,
+		Stake:       (*hexutil.Big)(stake),
+		Weight:      (*hexutil.Big)(weight),
+	}, st.Error()
+}
+
+// snftExchangePrice returns the exchange value of an SNFT in statedb. SNFTs are
+// never merged, so each one exchanges as a level 0 SNFT of merge number 1.
+func snftExchangePrice(statedb *state.StateDB, snft common.Address) (*big.Int, error) {
+	if !statedb.IsOfficialNFT(snft) {
+		return nil, fmt.Errorf("%x is not an SNFT address", snft)
+	}
+	price, err := statedb.SNFTExchangeAmount(snft, 0, 1)
+	if errors.Is(err, state.ErrSNFTNotExist) {
+		return nil, fmt.Errorf("SNFT %x does not exist", snft)
+	}
+	return price, err
+}
+
 func (w *PublicWormholesAPI) GetAccountInfo(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (state.Account, error) {
 	st, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if st == nil || err != nil {
@@ -2151,6 +2363,72 @@ func (w *PublicWormholesAPI) GetAccountInfo(ctx context.Context, address common.
 	return acc, st.Error()
 }
 
+// FullAccount is the JSON view of an account with its staking extensions
+// flattened, giving wallets the complete staking picture in one call.
+type FullAccount struct {
+	Address             common.Address `json:"address"`
+	Balance             *hexutil.Big   `json:"balance"`
+	Nonce               hexutil.Uint64 `json:"nonce"`
+	Coefficient         uint8          `json:"coefficient"`
+	PledgedBalance      *hexutil.Big   `json:"pledgedBalance"`
+	PledgedBlockNumber  *hexutil.Big   `json:"pledgedBlockNumber"`
+	ValidatorProxy      common.Address `json:"validatorProxy"`
+	StakerExtensions    []*Delegation  `json:"stakerExtensions"`
+	ValidatorExtensions []*Delegation  `json:"validatorExtensions"`
+}
+
+// newFullAccount flattens the state account of address into its JSON view,
+// reporting missing amounts as zero.
+func newFullAccount(address common.Address, acc state.Account) *FullAccount {
+	bigOrZero := func(n *big.Int) *hexutil.Big {
+		if n == nil {
+			return new(hexutil.Big)
+		}
+		return (*hexutil.Big)(new(big.Int).Set(n))
+	}
+	result := &FullAccount{
+		Address:             address,
+		Balance:             bigOrZero(acc.Balance),
+		Nonce:               hexutil.Uint64(acc.Nonce),
+		PledgedBalance:      new(hexutil.Big),
+		PledgedBlockNumber:  new(hexutil.Big),
+		StakerExtensions:    make([]*Delegation, 0),
+		ValidatorExtensions: make([]*Delegation, 0),
+	}
+	if acc.Worm == nil {
+		return result
+	}
+	result.Coefficient = acc.Worm.Coefficient
+	result.PledgedBalance = bigOrZero(acc.Worm.PledgedBalance)
+	result.PledgedBlockNumber = bigOrZero(acc.Worm.PledgedBlockNumber)
+	result.ValidatorProxy = acc.Worm.ValidatorProxy
+	for _, pledge := range acc.Worm.StakerExtension.StakerExtensions {
+		result.StakerExtensions = append(result.StakerExtensions, &Delegation{
+			Address:     pledge.Addr,
+			Amount:      bigOrZero(pledge.Balance),
+			BlockNumber: bigOrZero(pledge.BlockNumber),
+		})
+	}
+	for _, pledge := range acc.Worm.ValidatorExtension.ValidatorExtensions {
+		result.ValidatorExtensions = append(result.ValidatorExtensions, &Delegation{
+			Address:     pledge.Addr,
+			Amount:      bigOrZero(pledge.Balance),
+			BlockNumber: bigOrZero(pledge.BlockNumber),
+		})
+	}
+	return result
+}
+
+// GetFullAccount returns the balance, nonce, coefficient, pledges and staking
+// extensions of an account at the given block.
+func (w *PublicWormholesAPI) GetFullAccount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*FullAccount, error) {
+	st, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if st == nil || err != nil {
+		return nil, err
+	}
+	return newFullAccount(address, st.GetAccountInfo(address)), st.Error()
+}
+
 func (w *PublicWormholesAPI) GetValidators(ctx context.Context, number rpc.BlockNumber) ([]common.Address, error) {
 	parent, err := w.b.BlockByNumber(ctx, number-1)
 	if err != nil {
@@ -2319,6 +2597,264 @@ func (w *PublicWormholesAPI) GetStakerLen(ctx context.Context, number rpc.BlockN
 	return len(stakeList.Stakers)
 }
 
+// maxStakersPerPage bounds the number of stakers a single GetStakers call returns.
+const maxStakersPerPage = 1000
+
+// StakerWeight is a staker of the staker registry together with the range of
+// the cumulative stake it claims when beneficiaries are drawn, the range being
+// (RangeStart, RangeEnd].
+type StakerWeight struct {
+	Address    common.Address `json:"address"`
+	Balance    *hexutil.Big   `json:"balance"`
+	RangeStart *hexutil.Big   `json:"rangeStart"`
+	RangeEnd   *hexutil.Big   `json:"rangeEnd"`
+}
+
+// StakerPage is a window of the staker registry.
+type StakerPage struct {
+	Total        int             `json:"total"`
+	TotalBalance *hexutil.Big    `json:"totalBalance"`
+	Stakers      []*StakerWeight `json:"stakers"`
+}
+
+// stakerPage returns at most limit stakers of the list starting at offset, with
+// the landing ranges SelectRandom4Address draws from.
+func stakerPage(stakers *types.StakerList, offset, limit int) *StakerPage {
+	if limit <= 0 || limit > maxStakersPerPage {
+		limit = maxStakersPerPage
+	}
+	page := &StakerPage{
+		Total:        len(stakers.Stakers),
+		TotalBalance: (*hexutil.Big)(stakers.TotalStakeBalance()),
+		Stakers:      make([]*StakerWeight, 0),
+	}
+	sum := new(big.Int)
+	for i, staker := range stakers.Stakers {
+		start := new(big.Int).Set(sum)
+		sum.Add(sum, staker.Balance)
+		if i < offset {
+			continue
+		}
+		if len(page.Stakers) == limit {
+			break
+		}
+		page.Stakers = append(page.Stakers, &StakerWeight{
+			Address:    staker.Addr,
+			Balance:    (*hexutil.Big)(new(big.Int).Set(staker.Balance)),
+			RangeStart: (*hexutil.Big)(start),
+			RangeEnd:   (*hexutil.Big)(new(big.Int).Set(sum)),
+		})
+	}
+	return page
+}
+
+// GetStakers returns the stakers registered at the given block, the accounts
+// eligible for the SNFT exchanger rewards, along with their selection weights.
+// At most limit stakers starting at offset are returned.
+func (w *PublicWormholesAPI) GetStakers(ctx context.Context, number rpc.BlockNumber, offset hexutil.Uint, limit hexutil.Uint) (*StakerPage, error) {
+	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	stakers := statedb.GetStakers(types.StakerStorageAddress)
+	if stakers == nil {
+		return nil, errors.New("get stakers error")
+	}
+	return stakerPage(stakers, int(offset), int(limit)), nil
+}
+
+// Delegation is a staker's contribution to the pledged balance of a validator.
+type Delegation struct {
+	Address     common.Address `json:"address"`
+	Amount      *hexutil.Big   `json:"amount"`
+	BlockNumber *hexutil.Big   `json:"blockNumber"`
+}
+
+// PledgeBreakdown is the pledged balance of a validator split by contributor.
+type PledgeBreakdown struct {
+	SelfPledged *hexutil.Big  `json:"selfPledged"`
+	Delegations []*Delegation `json:"delegations"`
+	Total       *hexutil.Big  `json:"total"`
+}
+
+// GetPledgeBreakdown returns the stake pledged to validator at the given block,
+// split into the validator's own stake and that of each of its delegators.
+func (w *PublicWormholesAPI) GetPledgeBreakdown(ctx context.Context, validator common.Address, number rpc.BlockNumber) (*PledgeBreakdown, error) {
+	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	breakdown := statedb.GetPledgeBreakdown(validator)
+	result := &PledgeBreakdown{
+		SelfPledged: (*hexutil.Big)(breakdown.SelfPledged),
+		Delegations: make([]*Delegation, 0, len(breakdown.Delegations)),
+		Total:       (*hexutil.Big)(breakdown.Total),
+	}
+	for _, pledge := range breakdown.Delegations {
+		result.Delegations = append(result.Delegations, &Delegation{
+			Address:     pledge.Addr,
+			Amount:      (*hexutil.Big)(pledge.Balance),
+			BlockNumber: (*hexutil.Big)(pledge.BlockNumber),
+		})
+	}
+	return result, statedb.Error()
+}
+
+// SlashRecord tells whether a validator was punished for signing two blocks of
+// the same height.
+type SlashRecord struct {
+	Slashed   bool           `json:"slashed"`
+	Count     hexutil.Uint64 `json:"count"`
+	LastBlock *hexutil.Big   `json:"lastBlock"`
+}
+
+// HasBeenSlashed returns the punishment record of validator at the given block,
+// so delegators can check its history before staking. Only punishments made
+// under the chain's evil penalty schedule are recorded.
+func (w *PublicWormholesAPI) HasBeenSlashed(ctx context.Context, validator common.Address, number rpc.BlockNumber) (*SlashRecord, error) {
+	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	slashed, count, last := statedb.HasBeenSlashed(validator)
+	return &SlashRecord{
+		Slashed:   slashed,
+		Count:     hexutil.Uint64(count),
+		LastBlock: (*hexutil.Big)(last),
+	}, statedb.Error()
+}
+
+// maxRewardWindow bounds the number of blocks a single EstimateStakerReward
+// call projects over.
+const maxRewardWindow = 1 << 20
+
+// StakerRewardEstimate is the projected reward of a new stake over a window of
+// blocks.
+type StakerRewardEstimate struct {
+	Validator common.Address `json:"validator"`
+	Stake     *hexutil.Big   `json:"stake"`
+	FromBlock hexutil.Uint64 `json:"fromBlock"`
+	ToBlock   hexutil.Uint64 `json:"toBlock"`
+	// MaxReward is what the stake earns if the validator is rewarded in every
+	// block of the window.
+	MaxReward *hexutil.Big `json:"maxReward"`
+	// RewardedBlocks is the expected number of blocks of the window the
+	// validator is rewarded in.
+	RewardedBlocks float64      `json:"rewardedBlocks"`
+	Reward         *hexutil.Big `json:"reward"`
+}
+
+// stakerRewardAllBlocks returns what stake newly pledged to validator earns over
+// the blocks [from, to] if the validator is rewarded in every one of them. It
+// applies the per block split of DistributeRewardsToStakers to the current
+// delegator set of validator plus the new stake.
+func stakerRewardAllBlocks(statedb *state.StateDB, validator common.Address, stake *big.Int, from, to uint64, percentage func(*big.Int) uint64) *big.Int {
+	stakers := statedb.GetOrNewAccountStateObject(validator).GetValidatorExtension()
+	sumStakerBalance := new(big.Int).Sub(stakers.GetAllBalance(), stakers.GetBalance(validator))
+	sumStakerBalance.Add(sumStakerBalance, stake)
+
+	total := new(big.Int)
+	for number := from; number <= to; number++ {
+		num := new(big.Int).SetUint64(number)
+		rewardAmount := state.GetRewardAmount(number, types.DREBlockReward)
+		sumStakerReward := new(big.Int).Div(new(big.Int).Mul(rewardAmount, new(big.Int).SetUint64(100-percentage(num))), big.NewInt(100))
+		total.Add(total, new(big.Int).Div(new(big.Int).Mul(sumStakerReward, stake), sumStakerBalance))
+	}
+	return total
+}
+
+// expectedRewardedShare returns the expected fraction of blocks validator is
+// rewarded in with stake added to its pledge. It assumes each block rewards
+// rewarded validators and every validator's chance of being one of them is its
+// share of the pool's weight, stake times coefficient.
+func expectedRewardedShare(statedb *state.StateDB, validator common.Address, stake *big.Int, rewarded int) float64 {
+	validators := statedb.GetValidators(types.ValidatorStorageAddress)
+	own, total := new(big.Int), new(big.Int)
+	for _, v := range validators.Validators {
+		weight := new(big.Int).Mul(v.Balance, big.NewInt(int64(statedb.GetValidatorCoefficient(v.Addr))))
+		if v.Addr == validator {
+			weight.Add(weight, new(big.Int).Mul(stake, big.NewInt(int64(statedb.GetValidatorCoefficient(v.Addr)))))
+			own = weight
+		}
+		total.Add(total, weight)
+	}
+	if own.Sign() == 0 {
+		return 0
+	}
+	share, _ := new(big.Rat).SetFrac(new(big.Int).Mul(own, big.NewInt(int64(rewarded))), total).Float64()
+	if share > 1 {
+		share = 1
+	}
+	return share
+}
+
+// EstimateStakerReward projects what pledging stake to validator would earn
+// over the blocks [fromBlock, toBlock], based on the latest state. It assumes
+// the validator pool, the validator's delegators and their stakes stay as they
+// are, and that the validator is rewarded in its expected share of the blocks,
+// which is its share of the pool weight times the number of validators each
+// block rewards. The actual reward depends on which validators are selected
+// and sign in time, so it varies around the estimate.
+func (w *PublicWormholesAPI) EstimateStakerReward(ctx context.Context, validator common.Address, stake hexutil.Big, fromBlock hexutil.Uint64, toBlock hexutil.Uint64) (*StakerRewardEstimate, error) {
+	if toBlock < fromBlock {
+		return nil, errors.New("toBlock is before fromBlock")
+	}
+	if toBlock-fromBlock >= maxRewardWindow {
+		return nil, fmt.Errorf("window exceeds %d blocks", maxRewardWindow)
+	}
+	if stake.ToInt().Sign() <= 0 {
+		return nil, errors.New("stake must be positive")
+	}
+	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	if !statedb.GetValidators(types.ValidatorStorageAddress).Exist(validator) {
+		return nil, fmt.Errorf("%x is not a validator", validator)
+	}
+	maxReward := stakerRewardAllBlocks(statedb, validator, stake.ToInt(), uint64(fromBlock), uint64(toBlock), w.b.ChainConfig().ValidatorRewardPercentage)
+	share := expectedRewardedShare(statedb, validator, stake.ToInt(), ibftengine.QuorumSize(w.b.ChainConfig(), types.ConsensusValidatorsNum))
+
+	reward, _ := new(big.Float).Mul(new(big.Float).SetInt(maxReward), big.NewFloat(share)).Int(nil)
+	return &StakerRewardEstimate{
+		Validator:      validator,
+		Stake:          &stake,
+		FromBlock:      fromBlock,
+		ToBlock:        toBlock,
+		MaxReward:      (*hexutil.Big)(maxReward),
+		RewardedBlocks: share * float64(toBlock-fromBlock+1),
+		Reward:         (*hexutil.Big)(reward),
+	}, statedb.Error()
+}
+
+// GetPledgedTime returns the block number at which staker's pledge to validator
+// was recorded in the latest state, or zero if there is no such pledge.
+func (w *PublicWormholesAPI) GetPledgedTime(ctx context.Context, staker common.Address, validator common.Address) (*hexutil.Big, error) {
+	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(statedb.GetPledgedTime(staker, validator)), statedb.Error()
+}
+
+// GetValidatorBlockCount returns the number of non-empty canonical blocks in the
+// range [fromBlock, toBlock] that were proposed by the given validator.
+func (w *PublicWormholesAPI) GetValidatorBlockCount(ctx context.Context, validator common.Address, fromBlock rpc.BlockNumber, toBlock rpc.BlockNumber) (hexutil.Uint64, error) {
+	from, err := w.b.HeaderByNumber(ctx, fromBlock)
+	if from == nil || err != nil {
+		return 0, fmt.Errorf("block %d not found", fromBlock)
+	}
+	to, err := w.b.HeaderByNumber(ctx, toBlock)
+	if to == nil || err != nil {
+		return 0, fmt.Errorf("block %d not found", toBlock)
+	}
+	if from.Number.Uint64() > to.Number.Uint64() {
+		return 0, fmt.Errorf("invalid block range %d > %d", from.Number, to.Number)
+	}
+	count, err := w.b.GetValidatorBlockCount(ctx, validator, from.Number.Uint64(), to.Number.Uint64())
+	return hexutil.Uint64(count), err
+}
+
 func (w *PublicWormholesAPI) GetValidator(ctx context.Context, number rpc.BlockNumber) types.ValidatorList {
 	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, number)
 	if err != nil {
@@ -2330,6 +2866,41 @@ func (w *PublicWormholesAPI) GetValidator(ctx context.Context, number rpc.BlockN
 	return *validatorList
 }
 
+// GetValidatorsAt returns the validator pool recorded in the state of the given
+// block, the set the validators of the following block were selected from.
+func (w *PublicWormholesAPI) GetValidatorsAt(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.ValidatorList, error) {
+	statedb, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, stateUnavailable(err)
+	}
+	if statedb == nil {
+		return nil, errors.New("block not found")
+	}
+	return validatorsAt(statedb)
+}
+
+// validatorsAt returns the validator pool of statedb.
+func validatorsAt(statedb *state.StateDB) (*types.ValidatorList, error) {
+	validators := statedb.GetValidators(types.ValidatorStorageAddress)
+	if err := statedb.Error(); err != nil {
+		return nil, stateUnavailable(err)
+	}
+	if validators == nil {
+		return nil, errors.New("validator pool not found")
+	}
+	return validators, nil
+}
+
+// stateUnavailable explains errors caused by the state of a block having been
+// pruned from the database, leaving other errors as they are.
+func stateUnavailable(err error) error {
+	var missing *trie.MissingNodeError
+	if errors.As(err, &missing) {
+		return fmt.Errorf("state of the block is not available, it was likely pruned (query a node running with --gcmode=archive): %w", err)
+	}
+	return err
+}
+
 func (w *PublicWormholesAPI) GetValidatorLen(ctx context.Context, number rpc.BlockNumber) int {
 	statedb, _, err := w.b.StateAndHeaderByNumber(ctx, number)
 	if err != nil {
@@ -2340,6 +2911,395 @@ func (w *PublicWormholesAPI) GetValidatorLen(ctx context.Context, number rpc.Blo
 	return len(validatorList.Validators)
 }
 
+// BlockReward is the validator block reward issued at a height and the index
+// of the reward reduction period the height falls in.
+type BlockReward struct {
+	Reward *hexutil.Big   `json:"reward"`
+	Period hexutil.Uint64 `json:"period"`
+}
+
+// BlockRewardAt returns the block reward issued at the given height, which may
+// lie in the future. Named block numbers resolve against the current chain.
+func (w *PublicWormholesAPI) BlockRewardAt(ctx context.Context, blockNumber rpc.BlockNumber) (*BlockReward, error) {
+	var number uint64
+	if blockNumber < 0 {
+		header, err := w.b.HeaderByNumber(ctx, blockNumber)
+		if header == nil || err != nil {
+			return nil, fmt.Errorf("block %d not found", blockNumber)
+		}
+		number = header.Number.Uint64()
+	} else {
+		number = uint64(blockNumber)
+	}
+	return &BlockReward{
+		Reward: (*hexutil.Big)(state.GetRewardAmount(number, types.DREBlockReward)),
+		Period: hexutil.Uint64(state.RewardPeriod(number)),
+	}, nil
+}
+
+// SNFTAssignmentBatch lists the SNFTs a canonical block assigned to exchangers.
+type SNFTAssignmentBatch struct {
+	BlockNumber hexutil.Uint64          `json:"blockNumber"`
+	BlockHash   common.Hash             `json:"blockHash"`
+	Assignments []*types.SNFTAssignment `json:"assignments"`
+}
+
+// snftAssignChanSize is the size of the channel buffering the SNFT assignment
+// events of a NewSNFTAssignments subscription.
+const snftAssignChanSize = 10
+
+// NewSNFTAssignments sends a notification each time a new canonical block, normal
+// or empty, assigns SNFTs to exchangers, including the blocks a reorg makes
+// canonical.
+func (w *PublicWormholesAPI) NewSNFTAssignments(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan core.SNFTAssignEvent, snftAssignChanSize)
+		eventsSub := w.b.SubscribeSNFTAssignEvent(events)
+		defer eventsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				notifier.Notify(rpcSub.ID, &SNFTAssignmentBatch{
+					BlockNumber: hexutil.Uint64(ev.Block.NumberU64()),
+					BlockHash:   ev.Block.Hash(),
+					Assignments: ev.Assignments,
+				})
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// OfficialNFTPool is the official NFT injection pool at a block together with
+// the highest official NFT index injected so far.
+type OfficialNFTPool struct {
+	InjectedOfficialNFTs []*types.InjectedOfficialNFT `json:"injectedOfficialNFTs"`
+	MaxIndex             *hexutil.Big                 `json:"maxIndex"`
+}
+
+// GetOfficialNFTPool returns the official NFT batches injected as of the given
+// block, with their metadata directories and index ranges.
+func (w *PublicWormholesAPI) GetOfficialNFTPool(ctx context.Context, number rpc.BlockNumber) (*OfficialNFTPool, error) {
+	header, err := w.b.HeaderByNumber(ctx, number)
+	if header == nil || err != nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	pool, err := w.b.GetOfficialNFTPool(ctx, header)
+	if err != nil {
+		return nil, fmt.Errorf("official NFT pool not found at block %d: %v", header.Number, err)
+	}
+	return &OfficialNFTPool{
+		InjectedOfficialNFTs: pool.InjectedOfficialNFTs,
+		MaxIndex:             (*hexutil.Big)(pool.MaxIndex()),
+	}, nil
+}
+
+// BlockSeals reports the committed seals a block carried against the quorum
+// required by the validators selected for its height.
+type BlockSeals struct {
+	Seals     int  `json:"seals"`
+	Quorum    int  `json:"quorum"`
+	MetQuorum bool `json:"metQuorum"`
+}
+
+// blockSeals counts the committed seals of header against the quorum of the
+// given validators under config.
+func blockSeals(config *params.ChainConfig, header *types.Header, validators *types.ValidatorList) (*BlockSeals, error) {
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	quorum := ibftengine.QuorumSize(config, validators.Len())
+	return &BlockSeals{
+		Seals:     len(extra.CommittedSeal),
+		Quorum:    quorum,
+		MetQuorum: len(extra.CommittedSeal) >= quorum,
+	}, nil
+}
+
+// GetBlockSeals returns the number of committed seals the given block carried,
+// the quorum required at its height and whether the block met it.
+func (w *PublicWormholesAPI) GetBlockSeals(ctx context.Context, number rpc.BlockNumber) (*BlockSeals, error) {
+	header, err := w.b.HeaderByNumber(ctx, number)
+	if header == nil || err != nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	if header.Number.Sign() == 0 {
+		return nil, errors.New("genesis block carries no committed seals")
+	}
+	parentHeader, err := w.b.HeaderByHash(ctx, header.ParentHash)
+	if parentHeader == nil || err != nil {
+		return nil, fmt.Errorf("parent of block %d not found", header.Number)
+	}
+	validators, err := w.b.Random11ValidatorFromPool(ctx, parentHeader)
+	if err != nil {
+		return nil, err
+	}
+	return blockSeals(w.b.ChainConfig(), header, validators)
+}
+
+// GetEmptyBlockVoters returns the validators whose votes the given empty block
+// carries, the voters its finalization rewards. Votes cast by a proxy are
+// listed under the validator the proxy signs for. From the empty voter reward
+// fork on votes for another height or round are left out, as Finalize does.
+func (w *PublicWormholesAPI) GetEmptyBlockVoters(ctx context.Context, number rpc.BlockNumber) ([]common.Address, error) {
+	header, err := w.b.HeaderByNumber(ctx, number)
+	if header == nil || err != nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	if !header.EmptyBlock() {
+		return nil, fmt.Errorf("block %d is not an empty block", header.Number)
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	parent, _, err := w.b.StateAndHeaderByNumberOrHash(ctx, rpc.BlockNumberOrHashWithHash(header.ParentHash, false))
+	if parent == nil || err != nil {
+		return nil, fmt.Errorf("state of the parent of block %d not found", header.Number)
+	}
+	return ibftengine.EmptyBlockVoters(w.b.ChainConfig(), header, extra, parent.GetValidators(types.ValidatorStorageAddress))
+}
+
+// maxRecentEmptyBlocks bounds the number of empty blocks a single
+// RecentEmptyBlocks call returns.
+const maxRecentEmptyBlocks = 1000
+
+// maxEmptyBlockScan bounds the number of headers RecentEmptyBlocks reads back
+// from the head.
+const maxEmptyBlockScan = 100000
+
+// EmptyBlock is a block the network produced in fallback mode.
+type EmptyBlock struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
+
+// recentEmptyBlocks walks back from head through the canonical headers, and
+// returns up to count of the empty blocks found, highest first.
+func recentEmptyBlocks(head *types.Header, count int, headerByNumber func(uint64) (*types.Header, error)) ([]*EmptyBlock, error) {
+	if count <= 0 || count > maxRecentEmptyBlocks {
+		count = maxRecentEmptyBlocks
+	}
+	blocks := make([]*EmptyBlock, 0)
+	header := head
+	for scanned := 0; scanned < maxEmptyBlockScan && len(blocks) < count; scanned++ {
+		if header.EmptyBlock() {
+			blocks = append(blocks, &EmptyBlock{
+				Number:    hexutil.Uint64(header.Number.Uint64()),
+				Timestamp: hexutil.Uint64(header.Time),
+			})
+		}
+		if header.Number.Sign() == 0 {
+			break
+		}
+		number := header.Number.Uint64() - 1
+		parent, err := headerByNumber(number)
+		if parent == nil || err != nil {
+			return nil, fmt.Errorf("block %d not found", number)
+		}
+		header = parent
+	}
+	return blocks, nil
+}
+
+// RecentEmptyBlocks returns the heights and timestamps of up to count of the
+// latest empty blocks, scanning back from the head.
+func (w *PublicWormholesAPI) RecentEmptyBlocks(ctx context.Context, count hexutil.Uint) ([]*EmptyBlock, error) {
+	head, err := w.b.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil || err != nil {
+		return nil, errors.New("head block not found")
+	}
+	return recentEmptyBlocks(head, int(count), func(number uint64) (*types.Header, error) {
+		return w.b.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	})
+}
+
+// DecodedWormholes is the Wormholes payload a node parses out of a transaction.
+// Error explains why no payload was decoded.
+type DecodedWormholes struct {
+	Wormholes bool             `json:"wormholes"`
+	Type      uint8            `json:"type"`
+	Payload   *types.Wormholes `json:"payload,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// decodeWormholes parses the input of tx the way EVM.Call does.
+func decodeWormholes(tx *types.Transaction) *DecodedWormholes {
+	data := tx.Data()
+	if len(data) <= types.TransactionTypeLen || string(data[:types.TransactionTypeLen]) != types.TransactionType {
+		return &DecodedWormholes{Error: "not a Wormholes transaction"}
+	}
+	decoded := &DecodedWormholes{Wormholes: true}
+	var wormholes types.Wormholes
+	if err := json.Unmarshal(data[types.TransactionTypeLen:], &wormholes); err != nil {
+		decoded.Error = fmt.Sprintf("%v: %v", vm.ErrWormholesFormat, err)
+		return decoded
+	}
+	decoded.Type = wormholes.Type
+	decoded.Payload = &wormholes
+	return decoded
+}
+
+// DecodeWormholes returns the Wormholes payload of the transaction with the
+// given hash, as the node parses it when executing the transaction.
+func (w *PublicWormholesAPI) DecodeWormholes(ctx context.Context, hash common.Hash) (*DecodedWormholes, error) {
+	// Retrieve a finalized transaction, or a pooled otherwise
+	tx, _, _, _, err := w.b.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		if tx = w.b.GetPoolTransaction(hash); tx == nil {
+			return nil, nil
+		}
+	}
+	return decodeWormholes(tx), nil
+}
+
+// ValidatorStatus tells whether an account takes part in the validator set
+// sealing a block, either as a validator itself or as a validator's proxy.
+type ValidatorStatus struct {
+	Validator bool            `json:"validator"`
+	ProxyOf   *common.Address `json:"proxyOf,omitempty"`
+}
+
+// validatorStatus looks addr up in the active validator set, falling back to the
+// proxies the validator pool records for its members.
+func validatorStatus(active, pool *types.ValidatorList, addr common.Address) *ValidatorStatus {
+	status := new(ValidatorStatus)
+	for _, v := range active.Validators {
+		if v.Addr == addr {
+			status.Validator = true
+			return status
+		}
+	}
+	for _, v := range active.Validators {
+		if proxy, ok := pool.GetProxy(v.Addr); ok && proxy == addr {
+			validator := v.Addr
+			status.ProxyOf = &validator
+			break
+		}
+	}
+	return status
+}
+
+// IsValidator reports whether addr is in the active validator set of the given
+// block, or the proxy of a validator that is.
+func (w *PublicWormholesAPI) IsValidator(ctx context.Context, addr common.Address, number rpc.BlockNumber) (*ValidatorStatus, error) {
+	header, err := w.b.HeaderByNumber(ctx, number)
+	if header == nil || err != nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	if header.Number.Sign() == 0 {
+		return nil, errors.New("genesis block has no validator set")
+	}
+	parentHeader, err := w.b.HeaderByHash(ctx, header.ParentHash)
+	if parentHeader == nil || err != nil {
+		return nil, fmt.Errorf("parent of block %d not found", header.Number)
+	}
+	active, err := w.b.Random11ValidatorFromPool(ctx, parentHeader)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := w.b.GetAllValidators(ctx, parentHeader)
+	if err != nil {
+		return nil, err
+	}
+	return validatorStatus(active, pool, addr), nil
+}
+
+// LandingRange is the part of the address space a validator is selected for
+// when the random drop point falls into it. Ranges wrapping around the end of
+// the address space consist of two intervals.
+type LandingRange struct {
+	Address     common.Address `json:"address"`
+	Balance     *hexutil.Big   `json:"balance"`
+	Coefficient uint8          `json:"coefficient"`
+	Ranges      []*hexutil.Big `json:"ranges"`
+}
+
+// LandingRanges are the landing ranges of the validator pool after a block,
+// with the drop point the validators of the next block are selected by.
+type LandingRanges struct {
+	Number     hexutil.Uint64   `json:"number"`
+	RandomHash common.Hash      `json:"randomHash"`
+	DropPoint  *hexutil.Big     `json:"dropPoint"`
+	Validators []*LandingRange  `json:"validators"`
+	Landed     []common.Address `json:"landed"`
+}
+
+// landingRanges recomputes the landing ranges of the validator pool in statedb,
+// the state of header, the way Finalize does, and reports the validators the
+// random drop of the block after header lands on.
+func landingRanges(statedb *state.StateDB, header *types.Header) (*LandingRanges, error) {
+	validators := statedb.GetValidators(types.ValidatorStorageAddress)
+	stakers := statedb.GetStakers(types.StakerStorageAddress)
+	if validators == nil || stakers == nil {
+		return nil, errors.New("validator pool not found")
+	}
+	randomHash := core.GetRandomDropV2(validators, stakers, header)
+	if randomHash == (common.Hash{}) {
+		return nil, errors.New("no random drop without validators and stakers")
+	}
+	point, err := types.DropPoint(randomHash)
+	if err != nil {
+		return nil, err
+	}
+	ranged := validators.DeepCopy()
+	for _, v := range ranged.Validators {
+		ranged.CalculateAddressRangeV2(v.Addr, v.Balance, big.NewInt(int64(statedb.GetValidatorCoefficient(v.Addr))))
+	}
+	err, landed := ranged.CollectValidatorsV3(randomHash)
+	if err != nil {
+		return nil, err
+	}
+	result := &LandingRanges{
+		Number:     hexutil.Uint64(header.Number.Uint64()),
+		RandomHash: randomHash,
+		DropPoint:  (*hexutil.Big)(point),
+		Validators: make([]*LandingRange, 0, len(ranged.Validators)),
+		Landed:     landed,
+	}
+	for _, v := range ranged.Validators {
+		landing := &LandingRange{
+			Address:     v.Addr,
+			Balance:     (*hexutil.Big)(v.Balance),
+			Coefficient: statedb.GetValidatorCoefficient(v.Addr),
+			Ranges:      make([]*hexutil.Big, len(v.Weight)),
+		}
+		for i, bound := range v.Weight {
+			landing.Ranges[i] = (*hexutil.Big)(bound)
+		}
+		result.Validators = append(result.Validators, landing)
+	}
+	return result, statedb.Error()
+}
+
+// GetLandingRanges returns the landing range of every validator in the pool
+// after the given block and where the random drop selecting the validators of
+// the next block lands, so the selection can be audited independently.
+func (w *PublicWormholesAPI) GetLandingRanges(ctx context.Context, number rpc.BlockNumber) (*LandingRanges, error) {
+	statedb, header, err := w.b.StateAndHeaderByNumber(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	return landingRanges(statedb, header)
+}
+
 type BlockParticipants struct {
 	Address     common.Address
 	Coefficient uint8
@@ -3334,6 +4294,160 @@ func (api *PublicDebugAPI) SeedHash(ctx context.Context, number uint64) (string,
 	return fmt.Sprintf("0x%x", ethash.SeedHash(number)), nil
 }
 
+// AccountReward is the balance change a block's reward distribution caused to
+// an account. Validators keep their share net of what went to their stakers.
+type AccountReward struct {
+	Address   common.Address `json:"address"`
+	Validator bool           `json:"validator"`
+	Amount    *hexutil.Big   `json:"amount"`
+}
+
+// RewardBreakdown details how the rewards of a block are distributed.
+type RewardBreakdown struct {
+	Number      hexutil.Uint64          `json:"number"`
+	EmptyBlock  bool                    `json:"emptyBlock"`
+	BlockReward *hexutil.Big            `json:"blockReward"`
+	Total       *hexutil.Big            `json:"total"`
+	Rewards     []*AccountReward        `json:"rewards"`
+	Exchangers  []*types.SNFTAssignment `json:"exchangers"`
+	Voters      []common.Address        `json:"voters,omitempty"` // Empty block voters whose coefficient is raised
+}
+
+// rewardBreakdown runs the reward part of Finalize on a copy of statedb and
+// reports the balance change of every validator and staker involved, along with
+// the SNFTs assigned to the exchangers.
+func rewardBreakdown(statedb *state.StateDB, number *big.Int, validators, exchangers []common.Address, randomDrop common.Hash, validatorPercentage uint64) *RewardBreakdown {
+	statedb = statedb.Copy()
+	assigned := len(statedb.SNFTAssignments())
+
+	var (
+		accounts  []common.Address
+		before    = make(map[common.Address]*big.Int)
+		validator = make(map[common.Address]bool)
+	)
+	track := func(addr common.Address) {
+		if _, ok := before[addr]; !ok {
+			before[addr] = statedb.GetBalance(addr)
+			accounts = append(accounts, addr)
+		}
+	}
+	for _, addr := range validators {
+		validator[addr] = true
+		track(addr)
+		for _, staker := range statedb.GetOrNewAccountStateObject(addr).GetValidatorExtension().ValidatorExtensions {
+			track(staker.Addr)
+		}
+	}
+	statedb.CreateNFTByOfficial16(validators, exchangers, number, randomDrop.Bytes())
+	statedb.DistributeRewardsToStakers(validators, number, validatorPercentage)
+
+	breakdown := &RewardBreakdown{
+		Number:      hexutil.Uint64(number.Uint64()),
+		BlockReward: (*hexutil.Big)(state.GetRewardAmount(number.Uint64(), types.DREBlockReward)),
+		Rewards:     make([]*AccountReward, 0, len(accounts)),
+		Exchangers:  statedb.SNFTAssignments()[assigned:],
+	}
+	total := new(big.Int)
+	for _, addr := range accounts {
+		amount := new(big.Int).Sub(statedb.GetBalance(addr), before[addr])
+		if amount.Sign() == 0 && !validator[addr] {
+			continue
+		}
+		total.Add(total, amount)
+		breakdown.Rewards = append(breakdown.Rewards, &AccountReward{Address: addr, Validator: validator[addr], Amount: (*hexutil.Big)(amount)})
+	}
+	breakdown.Total = (*hexutil.Big)(total)
+	return breakdown
+}
+
+// RewardBreakdown re-runs the reward distribution of the given block on a copy
+// of its parent state and returns who received what, without committing it.
+// Transactions of the block itself are not applied, so pledges they make are
+// not reflected in the staker splits. Normal blocks pay the validators Finalize
+// recovers from their reward seals, empty blocks the ones their extra data
+// lists, along with the voters carrying them.
+func (api *PublicDebugAPI) RewardBreakdown(ctx context.Context, number rpc.BlockNumber) (*RewardBreakdown, error) {
+	header, err := api.b.HeaderByNumber(ctx, number)
+	if header == nil || err != nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	if header.Number.Sign() == 0 {
+		return nil, errors.New("genesis block distributes no rewards")
+	}
+	parentHeader, err := api.b.HeaderByHash(ctx, header.ParentHash)
+	if parentHeader == nil || err != nil {
+		return nil, fmt.Errorf("parent of block %d not found", header.Number)
+	}
+	statedb, _, err := api.b.StateAndHeaderByNumberOrHash(ctx, rpc.BlockNumberOrHashWithHash(parentHeader.Hash(), false))
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	randomDrop, err := api.b.GetRandomDrop(ctx, parentHeader)
+	if err != nil {
+		return nil, err
+	}
+	pool := statedb.GetValidators(types.ValidatorStorageAddress)
+	if pool == nil {
+		return nil, fmt.Errorf("validators of parent %d not found", parentHeader.Number)
+	}
+	var validators, voters []common.Address
+	if header.EmptyBlock() {
+		validators = extra.ValidatorAddr
+		voters, err = ibftengine.EmptyBlockVoters(api.b.ChainConfig(), header, extra, pool)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		selected, err := api.b.Random11ValidatorFromPool(ctx, parentHeader)
+		if err != nil {
+			return nil, err
+		}
+		if selected == nil {
+			selected = new(types.ValidatorList)
+		}
+		validators, err = ibftengine.RewardedValidators(&backendHeaderReader{ctx, api.b}, header, extra, selected.Len(), pool)
+		if err != nil {
+			return nil, err
+		}
+	}
+	percentage := api.b.ChainConfig().ValidatorRewardPercentage(header.Number)
+	breakdown := rewardBreakdown(statedb, header.Number, validators, extra.ExchangerAddr, randomDrop, percentage)
+	breakdown.EmptyBlock = header.EmptyBlock()
+	breakdown.Voters = voters
+	return breakdown, nil
+}
+
+// backendHeaderReader serves the headers the consensus engine looks up from an
+// API backend.
+type backendHeaderReader struct {
+	ctx context.Context
+	b   Backend
+}
+
+func (r *backendHeaderReader) Config() *params.ChainConfig  { return r.b.ChainConfig() }
+func (r *backendHeaderReader) CurrentHeader() *types.Header { return r.b.CurrentHeader() }
+
+func (r *backendHeaderReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := r.GetHeaderByHash(hash); header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (r *backendHeaderReader) GetHeaderByNumber(number uint64) *types.Header {
+	header, _ := r.b.HeaderByNumber(r.ctx, rpc.BlockNumber(number))
+	return header
+}
+
+func (r *backendHeaderReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	header, _ := r.b.HeaderByHash(r.ctx, hash)
+	return header
+}
+
 // PrivateDebugAPI is the collection of Ethereum APIs exposed over the private
 // debugging endpoint.
 type PrivateDebugAPI struct {
@@ -0,0 +1,753 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestBlockSeals(t *testing.T) {
+	validators := types.NewValidatorList(nil)
+	for i := 0; i < 11; i++ {
+		validators.AddValidator(common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(1), common.Address{})
+	}
+	tests := []struct {
+		seals int
+		met   bool
+	}{
+		{6, false},
+		{7, true},
+		{11, true},
+	}
+	for i, tt := range tests {
+		extra := &types.IstanbulExtra{CommittedSeal: make([][]byte, tt.seals)}
+		for j := range extra.CommittedSeal {
+			extra.CommittedSeal[j] = make([]byte, types.IstanbulExtraSeal)
+		}
+		payload, err := rlp.EncodeToBytes(extra)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode extra: %v", i, err)
+		}
+		header := &types.Header{Number: big.NewInt(1), Extra: append(make([]byte, types.IstanbulExtraVanity), payload...)}
+
+		seals, err := blockSeals(nil, header, validators)
+		if err != nil {
+			t.Fatalf("test %d: failed to count seals: %v", i, err)
+		}
+		if seals.Seals != tt.seals || seals.Quorum != 7 || seals.MetQuorum != tt.met {
+			t.Errorf("test %d: seals mismatch: have %+v, want {Seals:%d Quorum:7 MetQuorum:%v}", i, seals, tt.seals, tt.met)
+		}
+	}
+}
+
+func TestBlockedWormholes(t *testing.T) {
+	pledge := types.NewTransaction(3, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), []byte(types.TransactionType+`{"type":9,"version":"v0.0.1"}`))
+	plain := types.NewTransaction(4, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	stale := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), []byte(types.TransactionType+`{"type":9,"version":"v0.0.1"}`))
+
+	blocked := blockedWormholes(types.Transactions{stale, pledge, plain}, 1)
+	if len(blocked) != 1 {
+		t.Fatalf("blocked transaction count mismatch: have %d, want 1", len(blocked))
+	}
+	if blocked[0].Hash != pledge.Hash() || blocked[0].Type != 9 || blocked[0].Nonce != 3 || blocked[0].Missing != 2 {
+		t.Errorf("blocked transaction mismatch: have %+v", blocked[0])
+	}
+}
+
+func TestValidatorStatus(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x01")
+		proxy     = common.HexToAddress("0x02")
+		unrelated = common.HexToAddress("0x03")
+	)
+	pool := types.NewValidatorList(nil)
+	pool.AddValidator(validator, big.NewInt(1), proxy)
+	active := types.NewValidatorList(nil)
+	active.AddValidator(validator, big.NewInt(1), common.Address{})
+
+	if status := validatorStatus(active, pool, validator); !status.Validator || status.ProxyOf != nil {
+		t.Errorf("validator status mismatch: have %+v, want validator", status)
+	}
+	if status := validatorStatus(active, pool, proxy); status.Validator || status.ProxyOf == nil || *status.ProxyOf != validator {
+		t.Errorf("proxy status mismatch: have %+v, want proxy of %x", status, validator)
+	}
+	if status := validatorStatus(active, pool, unrelated); status.Validator || status.ProxyOf != nil {
+		t.Errorf("unrelated status mismatch: have %+v, want neither", status)
+	}
+}
+
+func TestStakerPage(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	stakerObject := statedb.GetOrNewStakerStateObject(types.StakerStorageAddress)
+	for i := 0; i < 10; i++ {
+		stakerObject.AddStaker(common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(int64(100*(i+1))))
+	}
+	// Read the registry the way Engine.Prepare does when picking beneficiaries.
+	stakers := statedb.GetStakers(types.StakerStorageAddress)
+	page := stakerPage(stakers, 0, 0)
+	if page.Total != 10 || len(page.Stakers) != 10 || page.TotalBalance.ToInt().Cmp(big.NewInt(5500)) != 0 {
+		t.Fatalf("page mismatch: have total %d, %d stakers, balance %v", page.Total, len(page.Stakers), page.TotalBalance)
+	}
+	// The first beneficiary drawn must be the staker whose range holds the draw.
+	hash := common.HexToHash("0xdeadbeef").Bytes()
+	picked, err := stakers.SelectRandom4Address(types.StakerRewardNum, hash)
+	if err != nil {
+		t.Fatalf("failed to select beneficiaries: %v", err)
+	}
+	draw := new(big.Int).Mod(new(big.Int).SetBytes(crypto.Keccak256(hash)), page.TotalBalance.ToInt())
+	var owner common.Address
+	for _, staker := range page.Stakers {
+		if draw.Cmp(staker.RangeStart.ToInt()) >= 0 && draw.Cmp(staker.RangeEnd.ToInt()) <= 0 {
+			owner = staker.Address
+			break
+		}
+	}
+	if owner != picked[0] {
+		t.Errorf("beneficiary mismatch: range holds %x, selected %x", owner, picked[0])
+	}
+	// Windows keep the ranges of the whole registry.
+	window := stakerPage(stakers, 8, 5)
+	if len(window.Stakers) != 2 || window.Stakers[0].Address != page.Stakers[8].Address ||
+		window.Stakers[0].RangeStart.ToInt().Cmp(page.Stakers[8].RangeStart.ToInt()) != 0 {
+		t.Errorf("window mismatch: have %+v", window.Stakers)
+	}
+}
+
+func TestRewardBreakdown(t *testing.T) {
+	var (
+		validators = []common.Address{common.HexToAddress("0x2000000000000000000000000000000000000002"), common.HexToAddress("0x2000000000000000000000000000000000000003")}
+		staker     = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		exchanger  = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		number     = big.NewInt(100)
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for _, validator := range validators {
+		statedb.AddBalance(validator, types.ValidatorBase())
+		if err := statedb.StakerPledge(validator, validator, types.ValidatorBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge validator: %v", err)
+		}
+		if err := statedb.MinerBecome(validator, common.Address{}); err != nil {
+			t.Fatalf("failed to add validator: %v", err)
+		}
+	}
+	statedb.AddBalance(staker, types.StakerBase())
+	if err := statedb.StakerPledge(staker, validators[0], types.StakerBase(), big.NewInt(1), &types.Wormholes{}); err != nil {
+		t.Fatalf("failed to pledge staker: %v", err)
+	}
+	root := statedb.IntermediateRoot(true)
+
+	breakdown := rewardBreakdown(statedb, number, validators, []common.Address{exchanger}, common.Hash{}, 7)
+	reward := state.GetRewardAmount(number.Uint64(), types.DREBlockReward)
+	if breakdown.BlockReward.ToInt().Cmp(reward) != 0 {
+		t.Errorf("block reward mismatch: have %v, want %v", breakdown.BlockReward, reward)
+	}
+	// Splitting with the stakers must not create or lose any of the reward
+	want := new(big.Int).Mul(reward, big.NewInt(int64(len(validators))))
+	if breakdown.Total.ToInt().Cmp(want) != 0 {
+		t.Errorf("total reward mismatch: have %v, want %v", breakdown.Total, want)
+	}
+	sum := new(big.Int)
+	for _, r := range breakdown.Rewards {
+		sum.Add(sum, r.Amount.ToInt())
+		if r.Address == staker {
+			if share := new(big.Int).Div(new(big.Int).Mul(reward, big.NewInt(93)), big.NewInt(100)); r.Amount.ToInt().Cmp(share) != 0 || r.Validator {
+				t.Errorf("staker reward mismatch: have %+v, want %v", r, share)
+			}
+		}
+	}
+	if sum.Cmp(want) != 0 {
+		t.Errorf("rewards don't add up: have %v, want %v", sum, want)
+	}
+	if len(breakdown.Exchangers) != 1 || breakdown.Exchangers[0].Owner != exchanger {
+		t.Errorf("exchanger mismatch: have %+v", breakdown.Exchangers)
+	}
+	if have := statedb.IntermediateRoot(true); have != root {
+		t.Errorf("dry run modified the state: have root %x, want %x", have, root)
+	}
+}
+
+func TestPendingWormholes(t *testing.T) {
+	var (
+		from      = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	transfer := types.NewTransaction(0, validator, big.NewInt(1), 21000, big.NewInt(1), nil)
+	pledge := types.NewTransaction(1, validator, types.StakerBase(), 21000, big.NewInt(1), []byte(types.TransactionType+`{"type":3,"version":"v0.0.1"}`))
+	malformed := types.NewTransaction(2, validator, big.NewInt(0), 21000, big.NewInt(1), []byte(types.TransactionType+`{"type":`))
+
+	txs := pendingWormholes(map[common.Address]types.Transactions{from: {transfer, pledge, malformed}})
+	if len(txs) != 1 {
+		t.Fatalf("pending Wormholes count mismatch: have %d, want 1", len(txs))
+	}
+	tx := txs[0]
+	if tx.Hash != pledge.Hash() || tx.From != from || tx.Type != 3 || tx.To == nil || *tx.To != validator || tx.Value.ToInt().Cmp(types.StakerBase()) != 0 {
+		t.Errorf("pending pledge mismatch: have %+v", tx)
+	}
+}
+
+func TestEstimateStakerReward(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		existing  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		staker    = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		stake     = new(big.Int).Mul(types.StakerBase(), big.NewInt(3))
+		from      = types.ReduceRewardPeriod - 3
+		to        = types.ReduceRewardPeriod + 2
+	)
+	// The validator share changes inside the window
+	percentage := func(number *big.Int) uint64 {
+		if number.Uint64() < types.ReduceRewardPeriod-1 {
+			return 7
+		}
+		return 10
+	}
+	pledge := func(statedb *state.StateDB, from, to common.Address, amount *big.Int) {
+		statedb.AddBalance(from, amount)
+		if err := statedb.StakerPledge(from, to, amount, big.NewInt(1), &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge: %v", err)
+		}
+	}
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	pledge(statedb, validator, validator, types.ValidatorBase())
+	if err := statedb.MinerBecome(validator, common.Address{}); err != nil {
+		t.Fatalf("failed to add validator: %v", err)
+	}
+	statedb.AddValidatorCoefficient(validator, 70)
+	pledge(statedb, existing, validator, types.StakerBase())
+	projected := stakerRewardAllBlocks(statedb, validator, stake, from, to, percentage)
+
+	// Actually pledge and distribute the rewards of every block of the window
+	pledge(statedb, staker, validator, stake)
+	before := statedb.GetBalance(staker)
+	for number := from; number <= to; number++ {
+		num := new(big.Int).SetUint64(number)
+		statedb.AddBalance(validator, state.GetRewardAmount(number, types.DREBlockReward))
+		statedb.DistributeRewardsToStakers([]common.Address{validator}, num, percentage(num))
+	}
+	if have := new(big.Int).Sub(statedb.GetBalance(staker), before); have.Cmp(projected) != 0 {
+		t.Errorf("projection mismatch: distributed %v, projected %v", have, projected)
+	}
+
+	// A lone validator is rewarded in every block, others in their weight share
+	if share := expectedRewardedShare(statedb, validator, stake, 7); share != 1 {
+		t.Errorf("lone validator share mismatch: have %v, want 1", share)
+	}
+	if share := expectedRewardedShare(statedb, existing, stake, 7); share != 0 {
+		t.Errorf("non-validator share mismatch: have %v, want 0", share)
+	}
+	for i := 0; i < 19; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(0x3000 + i)))
+		pledge(statedb, addr, addr, statedb.GetValidators(types.ValidatorStorageAddress).StakeBalance(validator))
+		if err := statedb.MinerBecome(addr, common.Address{}); err != nil {
+			t.Fatalf("failed to add validator: %v", err)
+		}
+		statedb.AddValidatorCoefficient(addr, 70)
+	}
+	if share := expectedRewardedShare(statedb, validator, new(big.Int), 7); share != 0.35 {
+		t.Errorf("pool share mismatch: have %v, want 0.35", share)
+	}
+}
+
+func TestLandingRanges(t *testing.T) {
+	// The staker list is only ever filled by the genesis
+	genesis := &core.Genesis{
+		Config:    params.TestChainConfig,
+		Alloc:     core.GenesisAlloc{},
+		Stake:     core.GenesisAlloc{},
+		Validator: core.GenesisAlloc{},
+	}
+	for i := 1; i <= 12; i++ {
+		addr := common.BigToAddress(new(big.Int).Lsh(big.NewInt(int64(i)), 155))
+		genesis.Alloc[addr] = core.GenesisAccount{Balance: types.ValidatorBase()}
+		genesis.Validator[addr] = core.GenesisAccount{Balance: types.ValidatorBase()}
+	}
+	genesis.Stake[common.HexToAddress("0x1000000000000000000000000000000000000001")] = core.GenesisAccount{Balance: types.StakerBase()}
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(genesis.MustCommit(db).Root(), state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	for i := 1; i <= 12; i++ {
+		// Vary the weights beyond the uniform genesis coefficient
+		statedb.AddValidatorCoefficient(common.BigToAddress(new(big.Int).Lsh(big.NewInt(int64(i)), 155)), uint8(i%4))
+	}
+	header := &types.Header{Number: big.NewInt(5), Coinbase: common.BigToAddress(new(big.Int).Lsh(big.NewInt(3), 155))}
+	ranges, err := landingRanges(statedb, header)
+	if err != nil {
+		t.Fatalf("failed to compute landing ranges: %v", err)
+	}
+	if len(ranges.Validators) != 12 {
+		t.Fatalf("validator count mismatch: have %d, want 12", len(ranges.Validators))
+	}
+	// Whoever the exported ranges put the drop point in must be who the engine selects
+	point := ranges.DropPoint.ToInt()
+	var covered []common.Address
+	for _, v := range ranges.Validators {
+		if len(v.Ranges) != 2 && len(v.Ranges) != 4 {
+			t.Fatalf("validator %x: malformed ranges %v", v.Address, v.Ranges)
+		}
+		for i := 0; i+1 < len(v.Ranges); i += 2 {
+			if point.Cmp(v.Ranges[i].ToInt()) > 0 && point.Cmp(v.Ranges[i+1].ToInt()) < 0 {
+				covered = append(covered, v.Address)
+				break
+			}
+		}
+	}
+	if len(covered) != len(ranges.Landed) {
+		t.Fatalf("landed mismatch: ranges cover %v, selected %v", covered, ranges.Landed)
+	}
+	for i := range covered {
+		if covered[i] != ranges.Landed[i] {
+			t.Fatalf("landed mismatch: ranges cover %v, selected %v", covered, ranges.Landed)
+		}
+	}
+	if want := core.GetRandomDropV2(statedb.GetValidators(types.ValidatorStorageAddress), statedb.GetStakers(types.StakerStorageAddress), header); ranges.RandomHash != want {
+		t.Errorf("random hash mismatch: have %x, want %x", ranges.RandomHash, want)
+	}
+}
+
+func TestSNFTExchangePrice(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	owner := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	price := statedb.CalculateExchangeAmount(0, 1)
+
+	// SNFTs of later exchange periods are deflated, the first one being worth
+	// the full level 0 price
+	var prev *big.Int
+	for period := uint64(0); period < 4; period++ {
+		offset := new(big.Int).SetUint64(period * types.ExchangePeriod * 4096)
+		snft := common.BigToAddress(new(big.Int).Add(types.SNFTBase(), offset))
+		statedb.ChangeNFTOwner(snft, owner, 0, big.NewInt(1))
+
+		have, err := snftExchangePrice(statedb, snft)
+		if err != nil {
+			t.Fatalf("period %d: failed to get price: %v", period, err)
+		}
+		if want := statedb.GetExchangAmount(snft, price); have.Cmp(want) != 0 {
+			t.Errorf("period %d: price mismatch: have %v, want %v", period, have, want)
+		}
+		if period == 0 && have.Cmp(price) != 0 {
+			t.Errorf("first period price mismatch: have %v, want %v", have, price)
+		}
+		if prev != nil && have.Cmp(prev) >= 0 {
+			t.Errorf("period %d: price %v not deflated from %v", period, have, prev)
+		}
+		prev = have
+	}
+	missing := common.BigToAddress(new(big.Int).Add(types.SNFTBase(), big.NewInt(1)))
+	if _, err := snftExchangePrice(statedb, missing); err == nil {
+		t.Errorf("price of a missing SNFT returned")
+	}
+	if _, err := snftExchangePrice(statedb, owner); err == nil {
+		t.Errorf("price of a non-SNFT address returned")
+	}
+}
+
+func TestRecentEmptyBlocks(t *testing.T) {
+	// Blocks 2, 3, 5 and 8 are empty, the rest are normal blocks
+	empty := map[uint64]bool{2: true, 3: true, 5: true, 8: true}
+	headers := make([]*types.Header, 10)
+	for i := range headers {
+		headers[i] = &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       uint64(1000 + 10*i),
+			Coinbase:   common.HexToAddress("0x1000000000000000000000000000000000000001"),
+			Difficulty: big.NewInt(1),
+		}
+		if empty[uint64(i)] {
+			headers[i].Coinbase = common.Address{}
+			headers[i].Difficulty = new(big.Int).Set(types.EmptyBlockDifficulty)
+		}
+	}
+	headerByNumber := func(number uint64) (*types.Header, error) {
+		return headers[number], nil
+	}
+	tests := []struct {
+		count int
+		want  []uint64
+	}{
+		{1, []uint64{8}},
+		{3, []uint64{8, 5, 3}},
+		{10, []uint64{8, 5, 3, 2}},
+		{0, []uint64{8, 5, 3, 2}},
+	}
+	for i, tt := range tests {
+		blocks, err := recentEmptyBlocks(headers[len(headers)-1], tt.count, headerByNumber)
+		if err != nil {
+			t.Fatalf("test %d: failed to list empty blocks: %v", i, err)
+		}
+		if len(blocks) != len(tt.want) {
+			t.Fatalf("test %d: empty block count mismatch: have %d, want %d", i, len(blocks), len(tt.want))
+		}
+		for j, block := range blocks {
+			if uint64(block.Number) != tt.want[j] || uint64(block.Timestamp) != headers[tt.want[j]].Time {
+				t.Errorf("test %d: empty block %d mismatch: have #%d at %d, want #%d at %d", i, j, block.Number, block.Timestamp, tt.want[j], headers[tt.want[j]].Time)
+			}
+		}
+	}
+}
+
+func TestDecodeWormholes(t *testing.T) {
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	wormholesTx := func(w types.Wormholes) *types.Transaction {
+		payload, err := json.Marshal(w)
+		if err != nil {
+			t.Fatalf("failed to encode payload: %v", err)
+		}
+		data := append([]byte(types.TransactionType), payload...)
+		return types.NewTransaction(0, to, big.NewInt(1), 100000, big.NewInt(1), data)
+	}
+	submitted := []types.Wormholes{
+		{
+			Type:         3,
+			ProxyAddress: "0x1000000000000000000000000000000000000002",
+			ProxySign:    "0x01",
+			Version:      types.WormholesVersion,
+		},
+		{
+			Type:        1,
+			CSBTAddress: "0x8000000000000000000000000000000000000001",
+			Version:     types.WormholesVersion,
+		},
+	}
+	for _, w := range submitted {
+		decoded := decodeWormholes(wormholesTx(w))
+		if !decoded.Wormholes || decoded.Error != "" {
+			t.Fatalf("type %d: not decoded: %+v", w.Type, decoded)
+		}
+		if decoded.Type != w.Type || decoded.Payload == nil || *decoded.Payload != w {
+			t.Errorf("type %d: payload mismatch: have %+v, want %+v", w.Type, decoded.Payload, w)
+		}
+	}
+	// An ordinary transfer carries no payload
+	decoded := decodeWormholes(types.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil))
+	if decoded.Wormholes || decoded.Payload != nil || decoded.Error == "" {
+		t.Errorf("transfer decoded as Wormholes: %+v", decoded)
+	}
+	// A Wormholes prefix without a valid payload is reported as malformed
+	data := append([]byte(types.TransactionType), "{"...)
+	decoded = decodeWormholes(types.NewTransaction(0, to, big.NewInt(1), 100000, big.NewInt(1), data))
+	if !decoded.Wormholes || decoded.Payload != nil || decoded.Error == "" {
+		t.Errorf("malformed payload decoded: %+v", decoded)
+	}
+}
+
+// noChain is a chain context without any headers.
+type noChain struct{}
+
+func (noChain) Engine() consensus.Engine                    { return nil }
+func (noChain) GetHeader(common.Hash, uint64) *types.Header { return nil }
+
+func TestWormholesGasEstimate(t *testing.T) {
+	const delegators = 20
+	var (
+		validator = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		owner     = common.HexToAddress("0x2000000000000000000000000000000000000003")
+		pledgedAt = big.NewInt(1)
+		header    = &types.Header{
+			Number:     new(big.Int).Add(pledgedAt, big.NewInt(types.CancelDayPledgedInterval)),
+			Difficulty: big.NewInt(1),
+			GasLimit:   params.GenesisGasLimit,
+		}
+	)
+	config := *params.TestChainConfig
+	config.WormholesGasForks = []params.WormholesGasFork{{Block: big.NewInt(0), Gas: params.WormholesGasConfig{TransferCSBT: 5000, CancelPledge: 5000, RevokeStaker: 2000}}}
+
+	// newEVM returns an EVM on a state with a validator and its delegators
+	newEVM := func() (*vm.EVM, *state.StateDB) {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.AddBalance(validator, types.ValidatorBase())
+		if err := statedb.StakerPledge(validator, validator, types.ValidatorBase(), pledgedAt, &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge validator: %v", err)
+		}
+		if err := statedb.MinerBecome(validator, common.Address{}); err != nil {
+			t.Fatalf("failed to add validator: %v", err)
+		}
+		for i := 0; i < delegators; i++ {
+			staker := common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+			statedb.AddBalance(staker, types.StakerBase())
+			if err := statedb.StakerPledge(staker, validator, types.StakerBase(), pledgedAt, &types.Wormholes{}); err != nil {
+				t.Fatalf("failed to pledge staker: %v", err)
+			}
+		}
+		blockCtx := core.NewEVMBlockContext(header, noChain{}, &common.Address{})
+		return vm.NewEVM(blockCtx, vm.TxContext{}, statedb, &config, vm.Config{NoBaseFee: true}), statedb
+	}
+	message := func(from, to common.Address, value *big.Int, gas uint64, w *types.Wormholes) types.Message {
+		payload, err := json.Marshal(w)
+		if err != nil {
+			t.Fatalf("failed to encode payload: %v", err)
+		}
+		data := append([]byte(types.TransactionType), payload...)
+		return types.NewMessage(from, &to, 0, value, gas, common.Big0, common.Big0, common.Big0, data, nil, true)
+	}
+	cancel := &types.Wormholes{Type: 4, Version: types.WormholesVersion}
+	transfer := &types.Wormholes{Type: 1, CSBTAddress: "0x8000000000000000000000000000000000000001", Version: types.WormholesVersion}
+
+	evm, _ := newEVM()
+	cancelGas, err := wormholesGas(evm, message(validator, validator, types.ValidatorBase(), 0, cancel), cancel)
+	if err != nil {
+		t.Fatalf("failed to estimate cancel: %v", err)
+	}
+	transferGas, err := wormholesGas(evm, message(owner, validator, new(big.Int), 0, transfer), transfer)
+	if err != nil {
+		t.Fatalf("failed to estimate transfer: %v", err)
+	}
+	if cancelGas <= transferGas {
+		t.Errorf("revoking cancel not estimated above a transfer: have %d, transfer %d", cancelGas, transferGas)
+	}
+
+	// The estimate covers the cancellation, one gas less doesn't
+	evm, statedb := newEVM()
+	result, err := core.ApplyMessage(evm, message(validator, validator, types.ValidatorBase(), cancelGas, cancel), new(core.GasPool).AddGas(cancelGas))
+	if err != nil || result.Failed() {
+		t.Fatalf("cancel with the estimate failed: %v %v", err, result)
+	}
+	if result.UsedGas != cancelGas {
+		t.Errorf("used gas mismatch: have %d, want %d", result.UsedGas, cancelGas)
+	}
+	if len(statedb.GetPledgeBreakdown(validator).Delegations) != 0 {
+		t.Errorf("delegators not revoked")
+	}
+	evm, _ = newEVM()
+	result, err = core.ApplyMessage(evm, message(validator, validator, types.ValidatorBase(), cancelGas-1, cancel), new(core.GasPool).AddGas(cancelGas))
+	if err == nil && !result.Failed() {
+		t.Errorf("cancel below the estimate succeeded")
+	}
+}
+
+func TestFullAccount(t *testing.T) {
+	var (
+		validator  = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		delegators = []common.Address{
+			common.HexToAddress("0x1000000000000000000000000000000000000001"),
+			common.HexToAddress("0x1000000000000000000000000000000000000002"),
+		}
+	)
+	genesis := &core.Genesis{
+		Config:    params.TestChainConfig,
+		Alloc:     core.GenesisAlloc{validator: {Balance: types.ValidatorBase()}},
+		Validator: core.GenesisAlloc{validator: {Balance: types.ValidatorBase()}},
+	}
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(genesis.MustCommit(db).Root(), state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	for i, delegator := range delegators {
+		amount := new(big.Int).Mul(types.StakerBase(), big.NewInt(int64(i+1)))
+		statedb.AddBalance(delegator, amount)
+		if err := statedb.StakerPledge(delegator, validator, amount, big.NewInt(int64(7+i)), &types.Wormholes{}); err != nil {
+			t.Fatalf("failed to pledge %x: %v", delegator, err)
+		}
+	}
+
+	decode := func(addr common.Address) map[string]interface{} {
+		blob, err := json.Marshal(newFullAccount(addr, statedb.GetAccountInfo(addr)))
+		if err != nil {
+			t.Fatalf("failed to marshal %x: %v", addr, err)
+		}
+		var view map[string]interface{}
+		if err := json.Unmarshal(blob, &view); err != nil {
+			t.Fatalf("failed to unmarshal %x: %v", addr, err)
+		}
+		return view
+	}
+	// find returns the extension entry of address in the JSON list, checking
+	// it is reported only once
+	find := func(list interface{}, addr common.Address) map[string]interface{} {
+		var found map[string]interface{}
+		for _, entry := range list.([]interface{}) {
+			entry := entry.(map[string]interface{})
+			if common.HexToAddress(entry["address"].(string)) != addr {
+				continue
+			}
+			if found != nil {
+				t.Errorf("extension of %x reported twice", addr)
+			}
+			found = entry
+		}
+		return found
+	}
+
+	// The validator lists every delegator pledging to it
+	view := decode(validator)
+	for _, field := range []string{"address", "balance", "nonce", "coefficient", "pledgedBalance", "pledgedBlockNumber", "validatorProxy", "stakerExtensions", "validatorExtensions"} {
+		if _, ok := view[field]; !ok {
+			t.Errorf("field %q missing", field)
+		}
+	}
+	if have, want := view["pledgedBalance"], hexutil.EncodeBig(statedb.GetPledgedBalance(validator)); have != want {
+		t.Errorf("pledged balance mismatch: have %v, want %v", have, want)
+	}
+	if have, want := uint8(view["coefficient"].(float64)), statedb.GetValidatorCoefficient(validator); have != want {
+		t.Errorf("coefficient mismatch: have %d, want %d", have, want)
+	}
+	if have, want := len(view["validatorExtensions"].([]interface{})), len(statedb.GetAccountInfo(validator).Worm.ValidatorExtension.ValidatorExtensions); have != want || have < len(delegators) {
+		t.Errorf("validator extension count mismatch: have %d, want %d", have, want)
+	}
+	for i, delegator := range delegators {
+		entry := find(view["validatorExtensions"], delegator)
+		if entry == nil {
+			t.Errorf("delegator %x missing from validator extensions", delegator)
+			continue
+		}
+		if have, want := entry["amount"], hexutil.EncodeBig(new(big.Int).Mul(types.StakerBase(), big.NewInt(int64(i+1)))); have != want {
+			t.Errorf("delegator %d amount mismatch: have %v, want %v", i, have, want)
+		}
+		if have, want := entry["blockNumber"], hexutil.EncodeBig(big.NewInt(int64(7+i))); have != want {
+			t.Errorf("delegator %d block number mismatch: have %v, want %v", i, have, want)
+		}
+	}
+
+	// Each delegator lists the validator it pledged to
+	for i, delegator := range delegators {
+		view := decode(delegator)
+		if list := view["stakerExtensions"].([]interface{}); len(list) != 1 {
+			t.Fatalf("delegator %d staker extension count mismatch: have %d, want 1", i, len(list))
+		}
+		entry := find(view["stakerExtensions"], validator)
+		if entry == nil {
+			t.Fatalf("delegator %d staker extension of the validator missing", i)
+		}
+		if have, want := entry["amount"], hexutil.EncodeBig(new(big.Int).Mul(types.StakerBase(), big.NewInt(int64(i+1)))); have != want {
+			t.Errorf("delegator %d amount mismatch: have %v, want %v", i, have, want)
+		}
+		if have, want := entry["blockNumber"], hexutil.EncodeBig(big.NewInt(int64(7+i))); have != want {
+			t.Errorf("delegator %d block number mismatch: have %v, want %v", i, have, want)
+		}
+	}
+
+	// Plain accounts serialize with zero amounts and empty lists
+	view = decode(common.HexToAddress("0x3000000000000000000000000000000000000003"))
+	if view["pledgedBalance"] != "0x0" || len(view["stakerExtensions"].([]interface{})) != 0 || len(view["validatorExtensions"].([]interface{})) != 0 {
+		t.Errorf("plain account view mismatch: %v", view)
+	}
+}
+
+func TestValidatorsAt(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	addr := func(i int) common.Address { return crypto.PubkeyToAddress(keys[i].PublicKey) }
+
+	// Three genesis validators, the fourth account joins them in block 2
+	genesis := &core.Genesis{
+		Config:    params.TestChainConfig,
+		GasLimit:  params.GenesisGasLimit,
+		Alloc:     core.GenesisAlloc{addr(3): {Balance: new(big.Int).Mul(types.ValidatorBase(), big.NewInt(2))}},
+		Stake:     core.GenesisAlloc{common.HexToAddress("0x1000000000000000000000000000000000000001"): {Balance: types.StakerBase()}},
+		Validator: core.GenesisAlloc{},
+	}
+	for i := 0; i < 3; i++ {
+		genesis.Alloc[addr(i)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+		genesis.Validator[addr(i)] = core.GenesisAccount{Balance: types.ValidatorBase()}
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesisBlock := genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	payload, _ := json.Marshal(&types.Wormholes{Type: 3, Version: types.WormholesVersion})
+	signer := types.LatestSigner(genesis.Config)
+	blocks, _ := core.GenerateChain(genesis.Config, genesisBlock, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		if i != 1 {
+			return
+		}
+		validator := addr(3)
+		tx := types.MustSignNewTx(keys[3], signer, &types.LegacyTx{
+			To:       &validator,
+			Value:    types.ValidatorBase(),
+			Gas:      1000000,
+			GasPrice: b.BaseFee(),
+			Data:     append([]byte(types.TransactionType), payload...),
+		})
+		b.AddTx(tx)
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+
+	contains := func(list *types.ValidatorList, addr common.Address) bool {
+		for _, v := range list.Validators {
+			if v.Addr == addr {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tt := range []struct {
+		number uint64
+		want   int
+	}{{1, 3}, {3, 4}} {
+		header := chain.GetHeaderByNumber(tt.number)
+		statedb, err := chain.StateAt(header.Root)
+		if err != nil {
+			t.Fatalf("block %d: failed to open state: %v", tt.number, err)
+		}
+		validators, err := validatorsAt(statedb)
+		if err != nil {
+			t.Fatalf("block %d: failed to read validators: %v", tt.number, err)
+		}
+		if validators.Len() != tt.want {
+			t.Errorf("block %d: validator count mismatch: have %d, want %d", tt.number, validators.Len(), tt.want)
+		}
+		if have, want := contains(validators, addr(3)), tt.want == 4; have != want {
+			t.Errorf("block %d: joined validator membership mismatch: have %v, want %v", tt.number, have, want)
+		}
+		// The validators selected on top of the block come out of its pool
+		selected, err := chain.Random11ValidatorWithOutProxy(header)
+		if err != nil {
+			t.Fatalf("block %d: failed to select validators: %v", tt.number, err)
+		}
+		if selected.Len() == 0 {
+			t.Errorf("block %d: no validators selected", tt.number)
+		}
+		for _, v := range selected.Validators {
+			if !contains(validators, v.Addr) {
+				t.Errorf("block %d: selected validator %x missing from the pool", tt.number, v.Addr)
+			}
+		}
+	}
+
+	// The state of a pruned block is reported as such
+	_, err = chain.StateAt(common.HexToHash("0x01"))
+	if err = stateUnavailable(err); err == nil || !strings.Contains(err.Error(), "pruned") {
+		t.Errorf("pruned state error mismatch: have %v", err)
+	}
+}
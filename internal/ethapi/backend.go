@@ -66,6 +66,7 @@ type Backend interface {
 	GetTd(ctx context.Context, hash common.Hash) *big.Int
 	GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error)
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeSNFTAssignEvent(ch chan<- core.SNFTAssignEvent) event.Subscription
 	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
 	SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription
 	QueryMinerProxy(ctx context.Context, number int64, addr *common.Address) (*types.ValidatorList, error)
@@ -74,6 +75,8 @@ type Backend interface {
 	GetRandomDrop(ctx context.Context, header *types.Header) (common.Hash, error)
 	GetAllStakers(ctx context.Context) *types.StakerList
 	GetAllValidators(ctx context.Context, header *types.Header) (*types.ValidatorList, error)
+	GetValidatorBlockCount(ctx context.Context, validator common.Address, from, to uint64) (uint64, error)
+	GetOfficialNFTPool(ctx context.Context, header *types.Header) (*types.InjectedOfficialNFTList, error)
 
 	// Transaction pool API
 	SendTx(ctx context.Context, signedTx *types.Transaction) error
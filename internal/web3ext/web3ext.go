@@ -152,6 +152,12 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'validatorCheckpoint',
+			call: 'admin_validatorCheckpoint',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -221,6 +227,24 @@ web3._extend({
 			params: 6,
 			inputFormatter: [web3._extend.formatters.inputDefaultBlockNumberFormatter, null, null, null, null, null],
 		}),
+		new web3._extend.Method({
+			name: 'accountRangeByKind',
+			call: 'debug_accountRangeByKind',
+			params: 4,
+			inputFormatter: [web3._extend.formatters.inputDefaultBlockNumberFormatter, null, null, null],
+		}),
+		new web3._extend.Method({
+			name: 'certifyStatus',
+			call: 'debug_certifyStatus',
+		}),
+		new web3._extend.Method({
+			name: 'workerLastError',
+			call: 'debug_workerLastError',
+		}),
+		new web3._extend.Method({
+			name: 'emptyVoteProgress',
+			call: 'debug_emptyVoteProgress',
+		}),
 		new web3._extend.Method({
 			name: 'printBlock',
 			call: 'debug_printBlock',
@@ -232,6 +256,12 @@ web3._extend({
 			call: 'debug_getBlockRlp',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'rewardBreakdown',
+			call: 'debug_rewardBreakdown',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'testSignCliqueBlock',
 			call: 'debug_testSignCliqueBlock',
@@ -637,6 +667,10 @@ web3._extend({
 			name: 'getHashrate',
 			call: 'miner_getHashrate'
 		}),
+		new web3._extend.Method({
+			name: 'rebuildCoefficientCache',
+			call: 'miner_rebuildCoefficientCache'
+		}),
 	],
 	properties: []
 });
@@ -747,11 +781,20 @@ web3._extend({
 				return status;
 			}
 		}),
+		new web3._extend.Property({
+			name: 'wormholes',
+			getter: 'txpool_wormholes'
+		}),
 		new web3._extend.Method({
 			name: 'contentFrom',
 			call: 'txpool_contentFrom',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'blockedWormholes',
+			call: 'txpool_blockedWormholes',
+			params: 1,
+		}),
 	]
 });
 `
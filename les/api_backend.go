@@ -132,6 +132,14 @@ func (b *LesApiBackend) GetAllValidators(ctx context.Context, header *types.Head
 	return nil, nil
 }
 
+func (b *LesApiBackend) GetValidatorBlockCount(ctx context.Context, validator common.Address, from, to uint64) (uint64, error) {
+	return 0, errors.New("validator block index is not available in light mode")
+}
+
+func (b *LesApiBackend) GetOfficialNFTPool(ctx context.Context, header *types.Header) (*types.InjectedOfficialNFTList, error) {
+	return nil, errors.New("official NFT pool is not available in light mode")
+}
+
 func (b *LesApiBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.BlockByNumber(ctx, blockNr)
@@ -258,6 +266,14 @@ func (b *LesApiBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Sub
 	return b.eth.blockchain.SubscribeChainEvent(ch)
 }
 
+// SubscribeSNFTAssignEvent never fires, light clients don't finalize block state.
+func (b *LesApiBackend) SubscribeSNFTAssignEvent(ch chan<- core.SNFTAssignEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
 	return b.eth.blockchain.SubscribeChainHeadEvent(ch)
 }
@@ -18,8 +18,12 @@ const (
 	storeMsgs = 32768 // Number of messages stored by yourself
 )
 
+// errNoNodeKey is returned when a message has to be signed on a node running
+// without a node key.
+var errNoNodeKey = xerrors.New("no node key available")
+
 type Certify struct {
-	mu                sync.Mutex
+	mu                sync.Mutex // Protects round and voteIndex
 	self              common.Address
 	eth               Backend
 	recentMessages    map[string]*EmptyPeerInfo // the cache of peer's messages
@@ -38,6 +42,41 @@ type Certify struct {
 	purge             chan struct{}
 }
 
+// CertifyStatus is the progress of the empty block voting of this node.
+type CertifyStatus struct {
+	Round        uint64 `json:"round"`        // Number of times the votes went round the validators
+	VoteIndex    int    `json:"voteIndex"`    // Index of the validator voted for next
+	SelfMessages int    `json:"selfMessages"` // Number of vote messages seen since the last reset
+}
+
+// Status returns the progress of the empty block voting.
+func (c *Certify) Status() CertifyStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CertifyStatus{
+		Round:        c.round,
+		VoteIndex:    c.voteIndex,
+		SelfMessages: c.selfMessages.Len(),
+	}
+}
+
+// currentRound returns the round of votes being sent.
+func (c *Certify) currentRound() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.round
+}
+
+// resetVotes restarts voting from the first validator and forgets the messages
+// seen so far.
+func (c *Certify) resetVotes() {
+	c.mu.Lock()
+	c.voteIndex = 0
+	c.round = 0
+	c.mu.Unlock()
+	c.selfMessages.Purge()
+}
+
 type VoteResult struct {
 	Height           *big.Int
 	ReceiveSum       *big.Int
@@ -235,15 +274,19 @@ func (c *Certify) signMessage(msg *types.EmptyMsg) ([]byte, error) {
 }
 
 func (c *Certify) sign(data []byte) ([]byte, error) {
+	key := c.eth.GetNodeKey()
+	if key == nil {
+		return nil, errNoNodeKey
+	}
 	hashData := crypto.Keccak256(data)
-	return crypto.Sign(hashData, c.eth.GetNodeKey())
+	return crypto.Sign(hashData, key)
 }
 
-func (c *Certify) assembleMessage(height *big.Int, vote common.Address) (error, []byte) {
+func (c *Certify) assembleMessage(height *big.Int, vote common.Address, round uint64) (error, []byte) {
 	ques := &types.SignatureData{
 		Vote:   vote,
 		Height: height,
-		Round:  c.round,
+		Round:  round,
 	}
 	encQues, err := Encode(ques)
 	if err != nil {
@@ -324,8 +367,9 @@ func (c *Certify) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 			return true, nil
 		}
 
+		round := c.currentRound()
 		log.Info("azh|emptyMessage", "height", signature.Height, "from", sender, "vote", signature.Vote,
-			"message round", signature.Round, "local round", c.round)
+			"message round", signature.Round, "local round", round)
 		if c.self == signature.Vote {
 			emptyMsg := types.EmptyMessageEvent{
 				Sender:  sender,
@@ -335,7 +379,7 @@ func (c *Certify) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 			go c.eventMux.Post(emptyMsg)
 			return true, nil
 		} else {
-			if c.round >= signature.Round {
+			if round >= signature.Round {
 				c.requestEmpty <- data
 			}
 		}
@@ -351,13 +395,18 @@ func (c *Certify) decode(msg p2p.Msg) ([]byte, common.Hash, error) {
 	return data, RLPHash(data), nil
 }
 
-func (c *Certify) handleEvents() {
+// handleEvents gathers the empty block votes of other validators until quit is
+// closed or the vote subscription ends.
+func (c *Certify) handleEvents(quit <-chan struct{}) {
 	log.Info("Certify handle events start")
+	defer log.Info("Certify handle events stop")
 	for {
 		select {
+		case <-quit:
+			return
 		case event, ok := <-c.events.Chan():
 			if !ok {
-				continue
+				return
 			}
 			// A real event arrived, process interesting content
 			switch ev := event.Data.(type) {
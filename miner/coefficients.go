@@ -0,0 +1,103 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// validatorCoefficients holds the coefficients of the validators in the state
+// at one block root. It is read from that state once, addresses outside of the
+// validator pool are read on demand and kept too.
+type validatorCoefficients struct {
+	root  common.Hash
+	state *state.StateDB // State at root, read for addresses not cached yet
+
+	mu    sync.Mutex
+	coefs map[common.Address]uint8
+}
+
+// newValidatorCoefficients reads the coefficients of the validator pool of
+// statedb, the state at root.
+func newValidatorCoefficients(root common.Hash, statedb *state.StateDB) *validatorCoefficients {
+	c := &validatorCoefficients{
+		root:  root,
+		state: statedb,
+		coefs: make(map[common.Address]uint8),
+	}
+	if validators := statedb.GetValidators(types.ValidatorStorageAddress); validators != nil {
+		for _, v := range validators.Validators {
+			c.coefs[v.Addr] = statedb.GetValidatorCoefficient(v.Addr)
+		}
+	}
+	return c
+}
+
+// get returns the coefficient of addr at the root of the set.
+func (c *validatorCoefficients) get(addr common.Address) uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	coe, ok := c.coefs[addr]
+	if !ok {
+		coe = c.state.GetValidatorCoefficient(addr)
+		c.coefs[addr] = coe
+	}
+	return coe
+}
+
+// len returns the number of coefficients in the set.
+func (c *validatorCoefficients) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.coefs)
+}
+
+// coefficientCache keeps the validator coefficients of the latest state the
+// worker looked at. Coefficients only change when a block is processed, and
+// the changes Finalize makes land in the root of that block, so the set of a
+// root never goes stale: a new head, or a reorg to another branch, shows up as
+// a different root, for which the cache misses and is rebuilt.
+type coefficientCache struct {
+	mu      sync.RWMutex
+	current *validatorCoefficients
+}
+
+// at returns the cached coefficients of the state at root, or nil if the cache
+// holds another root.
+func (c *coefficientCache) at(root common.Hash) *validatorCoefficients {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.current == nil || c.current.root != root {
+		return nil
+	}
+	return c.current
+}
+
+// set replaces the cached coefficients.
+func (c *coefficientCache) set(coefs *validatorCoefficients) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.current = coefs
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newCoefficientState commits a state with n pledged validators, the i-th of
+// them with a coefficient i below the default.
+func newCoefficientState(tb testing.TB, n int) (state.Database, common.Hash, []common.Address) {
+	sdb := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, sdb, nil)
+	addrs := make([]common.Address, n)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+		statedb.AddBalance(addrs[i], types.ValidatorBase())
+		if err := statedb.PledgeToken(addrs[i], types.ValidatorBase(), common.Address{}, common.Big1); err != nil {
+			tb.Fatalf("failed to pledge: %v", err)
+		}
+		statedb.AddValidatorCoefficient(addrs[i], types.DEFAULT_VALIDATOR_COEFFICIENT)
+		statedb.SubValidatorCoefficient(addrs[i], uint8(i%types.DEFAULT_VALIDATOR_COEFFICIENT))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		tb.Fatalf("failed to commit state: %v", err)
+	}
+	return sdb, root, addrs
+}
+
+func TestValidatorCoefficients(t *testing.T) {
+	sdb, root, addrs := newCoefficientState(t, 20)
+	statedb, _ := state.New(root, sdb, nil)
+	coefs := newValidatorCoefficients(root, statedb)
+	if coefs.len() != len(addrs) {
+		t.Fatalf("cached coefficients mismatch: have %d, want %d", coefs.len(), len(addrs))
+	}
+	for i, addr := range addrs {
+		if have, want := coefs.get(addr), uint8(types.DEFAULT_VALIDATOR_COEFFICIENT-i); have != want {
+			t.Errorf("validator %d: coefficient mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	// Addresses outside of the pool are read from the state
+	if have := coefs.get(common.Address{0x01}); have != 0 {
+		t.Errorf("non validator coefficient mismatch: have %d, want 0", have)
+	}
+}
+
+// Tests that the cache never serves the coefficients of another root, as it
+// would after a block changed them or the chain reorganised.
+func TestCoefficientCacheRoot(t *testing.T) {
+	sdb, root, addrs := newCoefficientState(t, 3)
+	statedb, _ := state.New(root, sdb, nil)
+
+	var cache coefficientCache
+	if cache.at(root) != nil {
+		t.Fatalf("empty cache returned coefficients")
+	}
+	cache.set(newValidatorCoefficients(root, statedb))
+
+	statedb.SubValidatorCoefficient(addrs[0], 10)
+	next, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if cache.at(next) != nil {
+		t.Fatalf("cache returned coefficients of another root")
+	}
+	nextdb, _ := state.New(next, sdb, nil)
+	cache.set(newValidatorCoefficients(next, nextdb))
+	if have, want := cache.at(next).get(addrs[0]), uint8(types.DEFAULT_VALIDATOR_COEFFICIENT-10); have != want {
+		t.Errorf("coefficient mismatch: have %d, want %d", have, want)
+	}
+	// Switching back to the first root, as a reorg does, rebuilds its values
+	if cache.at(root) != nil {
+		t.Fatalf("cache returned coefficients of another root")
+	}
+	prevdb, _ := state.New(root, sdb, nil)
+	cache.set(newValidatorCoefficients(root, prevdb))
+	if have, want := cache.at(root).get(addrs[0]), uint8(types.DEFAULT_VALIDATOR_COEFFICIENT); have != want {
+		t.Errorf("coefficient mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Benchmarks the weighted vote target of a large validator set, with the
+// coefficients read from the state of the head as before, and from the cache.
+func BenchmarkWeightedTarget(b *testing.B) {
+	sdb, root, _ := newCoefficientState(b, 1000)
+	statedb, _ := state.New(root, sdb, nil)
+	validators := statedb.GetValidators(types.ValidatorStorageAddress)
+
+	b.Run("state", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			statedb, err := state.New(root, sdb, nil)
+			if err != nil {
+				b.Fatalf("failed to open state: %v", err)
+			}
+			weightedTarget(validators, statedb.GetValidatorCoefficient, DefaultEmptyVoteWeight)
+		}
+	})
+	b.Run("cache", func(b *testing.B) {
+		var cache coefficientCache
+		cache.set(newValidatorCoefficients(root, statedb))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			weightedTarget(validators, cache.at(root).get, DefaultEmptyVoteWeight)
+		}
+	})
+}
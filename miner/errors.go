@@ -11,4 +11,9 @@ var (
 	ErrInvalidProposer            = errors.New("err Not the proposer of this height")
 	ErrInvalidProof               = errors.New("err Invalid proof")
 	ErrInvalidValidator           = errors.New("err Not the validator of this height")
+	errEmptyBlockTime             = errors.New("empty block time not after its parent")
+	errReceiptsMismatch           = errors.New("receipts don't match the block transactions")
+	errGasCeilOutOfRange          = errors.New("gas ceiling out of range")
+	errNoEtherbase                = errors.New("refusing to mine without etherbase")
+	errStaleEmptyHeight           = errors.New("chain head moved since entering empty mode")
 )
@@ -49,16 +49,84 @@ type Backend interface {
 
 // Config is the configuration parameters of mining.
 type Config struct {
-	Etherbase              common.Address `toml:",omitempty"` // Public address for block mining rewards (default = first account)
-	Notify                 []string       `toml:",omitempty"` // HTTP URL list to be notified of new work packages (only useful in ethash).
-	NotifyFull             bool           `toml:",omitempty"` // Notify with pending block headers instead of work packages
-	ExtraData              hexutil.Bytes  `toml:",omitempty"` // Block extra data set by the miner
-	GasFloor               uint64         // Target gas floor for mined blocks.
-	GasCeil                uint64         // Target gas ceiling for mined blocks.
-	GasPrice               *big.Int       // Minimum gas price for mining a transaction
-	Recommit               time.Duration  // The time interval for miner to re-create mining work.
-	Noverify               bool           // Disable remote mining solution verification(only useful in ethash).
-	AllowedFutureBlockTime uint64         // Max time (in seconds) from current time allowed for blocks, before they're considered future blocks
+	Etherbase              common.Address   `toml:",omitempty"` // Public address for block mining rewards (default = first account)
+	Notify                 []string         `toml:",omitempty"` // HTTP URL list to be notified of new work packages (only useful in ethash).
+	NotifyFull             bool             `toml:",omitempty"` // Notify with pending block headers instead of work packages
+	ExtraData              hexutil.Bytes    `toml:",omitempty"` // Block extra data set by the miner
+	GasFloor               uint64           // Target gas floor for mined blocks.
+	GasCeil                uint64           // Target gas ceiling for mined blocks.
+	GasPrice               *big.Int         // Minimum gas price for mining a transaction
+	Recommit               time.Duration    // The time interval for miner to re-create mining work.
+	Noverify               bool             // Disable remote mining solution verification(only useful in ethash).
+	AllowedFutureBlockTime *uint64          // Max time (in seconds) from current time allowed for blocks, before they're considered future blocks (nil = network default)
+	Empty                  EmptyBlockConfig // Tunables of the empty block fallback
+}
+
+// EmptyBlockConfig holds the tunables of the empty block fallback, which makes
+// the validators vote for an empty block when no block is produced in time.
+// Fields left zero take the defaults below. Waits are counted in checks of the
+// empty block loop, which run every CheckInterval.
+type EmptyBlockConfig struct {
+	LogVerbose        bool          `toml:",omitempty"` // Log the routine checks of the empty block loop at info level
+	StartDelay        time.Duration `toml:",omitempty"` // Time after startup before the first check, for the node to sync
+	CheckInterval     time.Duration `toml:",omitempty"` // Interval of the empty block loop checks
+	Timeout           int           `toml:",omitempty"` // Checks without a new block after which an empty block is voted for in any case
+	MinOnline         int           `toml:",omitempty"` // Online validators from which the loop waits for the full timeout
+	ValidatorWait     int           `toml:",omitempty"` // Checks a validator of the coming block waits before considering an empty block
+	NonValidatorWait  int           `toml:",omitempty"` // Checks any other node waits before considering an empty block
+	GossipInterval    time.Duration `toml:",omitempty"` // Interval of the first empty block vote rebroadcasts
+	GossipMaxInterval time.Duration `toml:",omitempty"` // Bound of the rebroadcast interval as it backs off
+	VoteWeight        int           `toml:",omitempty"` // Percentage of the weighted stake the votes must exceed
+	MaxTxs            int           `toml:",omitempty"` // Maximum number of transactions included in an empty block (0 = no limit)
+	MaxGas            uint64        `toml:",omitempty"` // Maximum gas used by the transactions of an empty block (0 = block gas limit)
+}
+
+// Defaults of the empty block fallback. The entry conditions assume the mainnet
+// validator set size, and the rebroadcast interval doubles with every round of
+// votes the chain stays stuck, up to the maximum. Other nodes reject empty
+// blocks carrying less than the default vote weight.
+const (
+	DefaultEmptyStartDelay        = 120 * time.Second
+	DefaultEmptyCheckInterval     = 1 * time.Second
+	DefaultEmptyTimeout           = 120
+	DefaultEmptyMinOnline         = 7
+	DefaultEmptyValidatorWait     = 15
+	DefaultEmptyNonValidatorWait  = 16
+	DefaultEmptyGossipInterval    = 5 * time.Second
+	DefaultEmptyGossipMaxInterval = 80 * time.Second
+	DefaultEmptyVoteWeight        = 50
+)
+
+// withDefaults returns the config with the fields left zero set to defaults.
+func (c EmptyBlockConfig) withDefaults() EmptyBlockConfig {
+	if c.StartDelay <= 0 {
+		c.StartDelay = DefaultEmptyStartDelay
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = DefaultEmptyCheckInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultEmptyTimeout
+	}
+	if c.MinOnline <= 0 {
+		c.MinOnline = DefaultEmptyMinOnline
+	}
+	if c.ValidatorWait <= 0 {
+		c.ValidatorWait = DefaultEmptyValidatorWait
+	}
+	if c.NonValidatorWait <= 0 {
+		c.NonValidatorWait = DefaultEmptyNonValidatorWait
+	}
+	if c.GossipInterval <= 0 {
+		c.GossipInterval = DefaultEmptyGossipInterval
+	}
+	if c.GossipMaxInterval <= 0 {
+		c.GossipMaxInterval = DefaultEmptyGossipMaxInterval
+	}
+	if c.VoteWeight <= 0 || c.VoteWeight > 100 {
+		c.VoteWeight = DefaultEmptyVoteWeight
+	}
+	return c
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -120,7 +188,7 @@ func (miner *Miner) update() {
 	miner.doneEmptyTimer = time.NewTimer(0)
 	defer miner.doneEmptyTimer.Stop()
 	<-miner.doneEmptyTimer.C // discard the initial tick
-	miner.doneEmptyTimer.Reset(1 * time.Second)
+	miner.doneEmptyTimer.Reset(miner.worker.emptyConfig().CheckInterval)
 
 	shouldStart := false
 	canStart := true
@@ -196,7 +264,7 @@ func (miner *Miner) update() {
 					miner.emptyBlockNumber.Cmp(emptyEvent.BlockNumber) < 0 {
 					miner.emptyBlockNumber = new(big.Int).Set(emptyEvent.BlockNumber)
 				}
-				miner.doneEmptyTimer.Reset(1 * time.Second)
+				miner.doneEmptyTimer.Reset(miner.worker.emptyConfig().CheckInterval)
 				//case DoneEmptyBlockEvent:
 				//	log.Info("mining empty block done")
 				//	canStart = true
@@ -221,7 +289,7 @@ func (miner *Miner) update() {
 			miner.worker.close()
 			return
 		case <-miner.doneEmptyTimer.C:
-			miner.doneEmptyTimer.Reset(1 * time.Second)
+			miner.doneEmptyTimer.Reset(miner.worker.emptyConfig().CheckInterval)
 			if miner.emptyBlockNumber == nil ||
 				miner == nil ||
 				miner.worker == nil ||
@@ -309,9 +377,14 @@ func (miner *Miner) SetEtherbase(addr common.Address) {
 }
 
 // SetGasCeil sets the gaslimit to strive for when mining blocks post 1559.
-// For pre-1559 blocks, it sets the ceiling.
-func (miner *Miner) SetGasCeil(ceil uint64) {
+// For pre-1559 blocks, it sets the ceiling. Ceilings no block could be built
+// under or verified with are rejected.
+func (miner *Miner) SetGasCeil(ceil uint64) error {
+	if ceil < params.MinGasLimit || ceil > params.MaxGasLimit {
+		return fmt.Errorf("%w: %d not in [%d, %d]", errGasCeilOutOfRange, ceil, params.MinGasLimit, params.MaxGasLimit)
+	}
 	miner.worker.setGasCeil(ceil)
+	return nil
 }
 
 // EnablePreseal turns on the preseal mining feature. It's enabled by default.
@@ -341,6 +414,34 @@ func (miner *Miner) GetCertify() *Certify {
 	return miner.worker.cerytify
 }
 
+// CertifyStatus returns the progress of the empty block voting.
+func (miner *Miner) CertifyStatus() CertifyStatus {
+	return miner.worker.cerytify.Status()
+}
+
+// EmptyVoteProgress returns the vote target of the pending empty block and the
+// vote weight collected for it so far.
+func (miner *Miner) EmptyVoteProgress() EmptyVoteProgress {
+	return miner.worker.emptyVoteProgress()
+}
+
+// LastError returns the last failure of the worker to assemble a block, or nil
+// if there was none.
+func (miner *Miner) LastError() *WorkerError {
+	return miner.worker.lastError()
+}
+
+// RebuildCoefficientCache reads the validator coefficients of the current
+// block from state into the cache of the empty block weighting, and returns
+// the number of coefficients read.
+func (miner *Miner) RebuildCoefficientCache() (int, error) {
+	coefs, err := miner.worker.rebuildCoefficients(miner.worker.chain.CurrentBlock().Root())
+	if err != nil {
+		return 0, err
+	}
+	return coefs.len(), nil
+}
+
 func (miner *Miner) GetWorker() *worker {
 	return miner.worker
 }
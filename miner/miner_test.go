@@ -19,6 +19,7 @@ package miner
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -34,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -275,3 +277,25 @@ func createMiner(t *testing.T) (*Miner, *event.TypeMux) {
 	// Create Miner
 	return New(backend, &config, chainConfig, mux, engine, nil), mux
 }
+
+func TestMinerSetGasCeil(t *testing.T) {
+	miner, _ := createMiner(t)
+	defer miner.Close()
+
+	parent := miner.worker.chain.CurrentBlock()
+	ceil := parent.GasLimit() * 2
+	if err := miner.SetGasCeil(ceil); err != nil {
+		t.Fatalf("failed to set gas ceiling: %v", err)
+	}
+	if have, want := miner.worker.gasLimit(parent), core.CalcGasLimit(parent.GasLimit(), ceil); have != want || have <= parent.GasLimit() {
+		t.Errorf("gas limit mismatch: have %d, want %d above %d", have, want, parent.GasLimit())
+	}
+	for _, absurd := range []uint64{0, params.MinGasLimit - 1, params.MaxGasLimit + 1} {
+		if err := miner.SetGasCeil(absurd); !errors.Is(err, errGasCeilOutOfRange) {
+			t.Errorf("ceiling %d: error mismatch: have %v, want %v", absurd, err, errGasCeilOutOfRange)
+		}
+	}
+	if miner.worker.config.GasCeil != ceil {
+		t.Errorf("rejected ceiling applied: have %d, want %d", miner.worker.config.GasCeil, ceil)
+	}
+}
@@ -75,6 +75,7 @@ type ProofState struct {
 	receiveValidatorsSum *big.Int
 	proposer             common.Address
 	proposerMessage      []byte
+	round                uint64          // The round the collected votes were cast in
 	onlineValidator      OnlineValidator // The highly online validator of this block & reward addr
 	emptyBlockMessages   [][]byte
 }
@@ -12,6 +12,7 @@ import (
 
 func (c *Certify) AssembleAndBroadcastMessage(height *big.Int) {
 	//log.Info("AssembleAndBroadcastMessage", "validators len", len(c.stakers.Validators), "sender", c.addr, "vote index", c.voteIndex, "round", c.round)
+	c.mu.Lock()
 	vote := c.stakers.Validators[c.voteIndex]
 	var voteAddress common.Address
 	if vote.Proxy == (common.Address{}) {
@@ -25,8 +26,10 @@ func (c *Certify) AssembleAndBroadcastMessage(height *big.Int) {
 		c.voteIndex = 0
 		c.round++
 	}
+	round := c.round
+	c.mu.Unlock()
 
-	err, payload := c.assembleMessage(height, voteAddress)
+	err, payload := c.assembleMessage(height, voteAddress, round)
 	if err != nil {
 		return
 	}
@@ -50,9 +53,23 @@ func (c *Certify) AssembleAndBroadcastMessage(height *big.Int) {
 func (c *Certify) GatherOtherPeerSignature(validator common.Address, height *big.Int, encQues []byte) error {
 	var weightBalance *big.Int
 	log.Info("GatherOtherPeerSignature", "c.proofStatePool", c.proofStatePool)
+	vote, err := types.DecodeEmptyVote(encQues)
+	if err != nil {
+		return err
+	}
+	// An empty block only carries votes of a single round, so a vote of a newer
+	// round restarts the collection and votes of older ones are replays
+	if ps, ok := c.proofStatePool.proofs[height.Uint64()]; ok && ps.round != vote.Round {
+		if vote.Round < ps.round {
+			log.Info("GatherOtherPeerSignature: stale vote", "validator", validator, "height", height, "round", vote.Round, "current", ps.round)
+			return types.ErrEmptyVoteRound
+		}
+		delete(c.proofStatePool.proofs, height.Uint64())
+	}
 	if _, ok := c.proofStatePool.proofs[height.Uint64()]; !ok {
-		_, proposerMessage := c.assembleMessage(height, c.self)
+		_, proposerMessage := c.assembleMessage(height, c.self, vote.Round)
 		ps := newProofState(c.self, proposerMessage, height)
+		ps.round = vote.Round
 		ps.receiveValidatorsSum = big.NewInt(0)
 		//coe, err = c.miner.GetWorker().getValidatorCoefficient(validator)
 		//if err != nil {
@@ -21,7 +21,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"math"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -35,6 +34,7 @@ import (
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
@@ -43,6 +43,7 @@ import (
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -87,8 +88,51 @@ const (
 
 	// Send online proof transactions every 1000 blocks
 	activeCycle = 30
+
+	// closeTimeout is the maximum time to wait for the background loops to
+	// finish their in-flight work when the worker is closed.
+	closeTimeout = 10 * time.Second
+
+	// parentStateRetries is the number of extra attempts made to load the parent
+	// state before giving up on assembling a block, e.g. right after a reorg.
+	parentStateRetries = 3
+
+	// parentStateRetryDelay is the time waited between two parent state attempts.
+	parentStateRetryDelay = 100 * time.Millisecond
 )
 
+// parentStateFailMeter counts the parent state (and with it validator pool)
+// reads that failed, so a stuck miner can be spotted.
+var parentStateFailMeter = metrics.NewRegisteredMeter("miner/parentstate/fail", nil)
+
+// parentStateError is returned when the state of the parent block, which holds
+// the validator pool, can't be loaded while assembling a new block.
+type parentStateError struct {
+	number uint64
+	root   common.Hash
+	err    error
+}
+
+func (e *parentStateError) Error() string {
+	return fmt.Sprintf("parent state unavailable: number %d, root %x: %v", e.number, e.root, e.err)
+}
+
+func (e *parentStateError) Unwrap() error { return e.err }
+
+// WorkerError is the last failure of the worker to assemble a block.
+type WorkerError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// EmptyVoteProgress is how close the pending empty block is to being committed.
+// It is zero while the worker is not in empty mode.
+type EmptyVoteProgress struct {
+	Height    *hexutil.Big `json:"height"`    // Number of the pending empty block
+	Target    *hexutil.Big `json:"target"`    // Vote weight the empty block has to exceed
+	Collected *hexutil.Big `json:"collected"` // Vote weight of the latest vote result for the block
+}
+
 // environment is the worker's current environment and holds all of the current state information.
 type environment struct {
 	signer types.Signer
@@ -167,6 +211,8 @@ type worker struct {
 	resubmitAdjustCh   chan *intervalAdjust
 	notifyBlockCh      chan *types.OnlineValidatorList
 
+	wg sync.WaitGroup // Tracks the background loops so close can wait for them
+
 	current      *environment
 	emptycurrent *environment
 	proofcurrent *environment
@@ -186,6 +232,9 @@ type worker struct {
 	snapshotReceipts types.Receipts
 	snapshotState    *state.StateDB
 
+	lastErrMu sync.RWMutex // The lock used to protect the last error
+	lastErr   *WorkerError
+
 	// atomic status counters
 	running int32 // The indicator whether the consensus engine is running or not.
 	newTxs  int32 // New arrival transaction count since last sealing work submitting.
@@ -214,10 +263,16 @@ type worker struct {
 	totalCondition      int
 	emptyTimestamp      int64
 	emptyHandleFlag     bool
+	emptyHandleQuit     chan struct{} // Closed to stop the certify event loop
+	emptyHandleDone     chan struct{} // Closed when the certify event loop returned
 	cacheHeight         *big.Int
+	emptyVoteMu         sync.RWMutex // The lock used to protect the empty vote target and weight below
+	emptyVoteHeight     *big.Int
 	targetWeightBalance *big.Int
+	collectedWeight     *big.Int
 	emptyTimer          *time.Timer
 	resetEmptyCh        chan struct{}
+	coefficients        coefficientCache // Validator coefficients of the latest state looked at
 }
 
 func newWorker(handler Handler, config *Config, chainConfig *params.ChainConfig, engine consensus.Engine, eth Backend, mux *event.TypeMux, isLocalBlock func(*types.Block) bool, init bool) *worker {
@@ -248,7 +303,7 @@ func newWorker(handler Handler, config *Config, chainConfig *params.ChainConfig,
 		isEmpty:             false,
 		resubmitIntervalCh:  make(chan time.Duration),
 		resubmitAdjustCh:    make(chan *intervalAdjust, resubmitAdjustChanSize),
-		cerytify:            NewCertify(ethcrypto.PubkeyToAddress(eth.GetNodeKey().PublicKey), eth, handler),
+		cerytify:            NewCertify(nodeAddress(eth), eth, handler),
 		miner:               handler,
 		notifyBlockCh:       make(chan *types.OnlineValidatorList, 1),
 		emptyTimestamp:      time.Now().Unix(),
@@ -271,6 +326,13 @@ func newWorker(handler Handler, config *Config, chainConfig *params.ChainConfig,
 			recommit = minRecommitInterval
 		}
 
+		if worker.cerytify.self == (common.Address{}) {
+			log.Warn("No node key available, empty block voting disabled")
+		}
+		if _, err := worker.rebuildCoefficients(worker.chain.CurrentBlock().Root()); err != nil {
+			log.Warn("Failed to warm the validator coefficient cache", "err", err)
+		}
+		worker.wg.Add(6)
 		go worker.emptyLoop()
 		go worker.mainLoop()
 		go worker.newWorkLoop(recommit)
@@ -278,7 +340,10 @@ func newWorker(handler Handler, config *Config, chainConfig *params.ChainConfig,
 		go worker.taskLoop()
 
 		// Enable worker message processing
-		go worker.cerytify.Start()
+		go func() {
+			defer worker.wg.Done()
+			worker.cerytify.Start()
+		}()
 
 		// Submit first work to initialize pending state.
 		if init {
@@ -302,6 +367,36 @@ func (w *worker) setGasCeil(ceil uint64) {
 	w.config.GasCeil = ceil
 }
 
+// gasLimit returns the gas limit of the block after parent, moving towards the
+// configured ceiling. The caller must hold w.mu.
+func (w *worker) gasLimit(parent *types.Block) uint64 {
+	parentGasLimit := parent.GasLimit()
+	// The first EIP-1559 block scales the parent limit up to the new target
+	next := new(big.Int).Add(parent.Number(), common.Big1)
+	if w.chainConfig.IsLondon(next) && !w.chainConfig.IsLondon(parent.Number()) {
+		parentGasLimit = parentGasLimit * params.ElasticityMultiplier
+	}
+	return core.CalcGasLimit(parentGasLimit, w.config.GasCeil)
+}
+
+// setLastError records err as the last failure of the worker.
+func (w *worker) setLastError(err error) {
+	w.lastErrMu.Lock()
+	defer w.lastErrMu.Unlock()
+	w.lastErr = &WorkerError{Message: err.Error(), Time: time.Now()}
+}
+
+// lastError returns the last failure of the worker, or nil if there was none.
+func (w *worker) lastError() *WorkerError {
+	w.lastErrMu.RLock()
+	defer w.lastErrMu.RUnlock()
+	if w.lastErr == nil {
+		return nil
+	}
+	lastErr := *w.lastErr
+	return &lastErr
+}
+
 // setExtra sets the content used to initialize the block extra field.
 func (w *worker) setExtra(extra []byte) {
 	w.mu.Lock()
@@ -378,22 +473,82 @@ func (w *worker) isRunning() bool {
 // close terminates all background threads maintained by the worker.
 // Note the worker does not support being closed multiple times.
 func (w *worker) close() {
+	atomic.StoreInt32(&w.running, 0)
+	close(w.exitCh)
+
+	// Wait for the loops to acknowledge the exit signal, so that an in-flight
+	// block write or sealing operation completes before the prefetchers are
+	// torn down underneath it.
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		// The loops still use the prefetchers and the empty handler, leave
+		// them to the loops rather than pulling them out from under them.
+		log.Warn("Worker loops did not exit in time, skipping teardown", "timeout", closeTimeout)
+		return
+	}
+
 	if w.current != nil && w.current.state != nil {
 		w.current.state.StopPrefetcher()
 	}
-	atomic.StoreInt32(&w.running, 0)
-	close(w.exitCh)
+	if w.emptycurrent != nil && w.emptycurrent.state != nil {
+		w.emptycurrent.state.StopPrefetcher()
+	}
+	if w.proofcurrent != nil && w.proofcurrent.state != nil {
+		w.proofcurrent.state.StopPrefetcher()
+	}
+	w.stopEmptyHandler()
+}
+
+// startEmptyHandler starts the certify event loop gathering the empty block
+// votes of other validators, unless it is running already.
+func (w *worker) startEmptyHandler() {
+	if w.emptyHandleFlag {
+		return
+	}
+	w.emptyHandleFlag = true
+	w.emptyHandleQuit = make(chan struct{})
+	w.emptyHandleDone = make(chan struct{})
+	go func(quit, done chan struct{}) {
+		defer close(done)
+		w.cerytify.handleEvents(quit)
+	}(w.emptyHandleQuit, w.emptyHandleDone)
+}
+
+// stopEmptyHandler stops the certify event loop and waits for it to return, so
+// that a new one can be started. It must only be called once the empty loop is
+// gone, as vote results the event loop still delivers are dropped.
+func (w *worker) stopEmptyHandler() {
+	if !w.emptyHandleFlag {
+		return
+	}
+	close(w.emptyHandleQuit)
+	for {
+		select {
+		case <-w.emptyHandleDone:
+			w.emptyHandleFlag = false
+			return
+		case <-w.cerytify.signatureResultCh:
+		}
+	}
 }
 
 func (w *worker) resetEmptyCondition() {
+	if w.isEmpty {
+		log.Info("emptyLoop: leave empty mode", "height", w.cacheHeight)
+	}
 	w.isEmpty = false
+	w.setEmptyTarget(nil, new(big.Int))
 	w.emptyTimestamp = time.Now().Unix()
 	w.totalCondition = 0
-	w.emptyTimer.Reset(1 * time.Second)
+	w.emptyTimer.Reset(w.emptyConfig().CheckInterval)
 
-	w.cerytify.voteIndex = 0
-	w.cerytify.round = 0
-	w.cerytify.selfMessages.Purge()
+	w.cerytify.resetVotes()
 	w.cerytify.purge <- struct{}{}
 }
 
@@ -426,22 +581,25 @@ type StartEmptyBlockEvent struct {
 //type DoneEmptyBlockEvent struct{}
 
 func (w *worker) emptyLoop() {
+	defer w.wg.Done()
+
+	cfg := w.emptyConfig()
 	w.emptyTimer = time.NewTimer(0)
 	defer w.emptyTimer.Stop()
 	<-w.emptyTimer.C // discard the initial tick
-	w.emptyTimer.Reset(120 * time.Second)
+	w.emptyTimer.Reset(cfg.StartDelay)
 
 	gossipTimer := time.NewTimer(0)
 	defer gossipTimer.Stop()
 	<-gossipTimer.C // discard the initial tick
-	gossipTimer.Reset(5 * time.Second)
+	gossipTimer.Reset(w.voteTime())
 
 	checkTimer := time.NewTimer(0)
 	defer checkTimer.Stop()
 	<-checkTimer.C // discard the initial tick
-	checkTimer.Reset(1 * time.Second)
+	checkTimer.Reset(cfg.CheckInterval)
 
-	var valiTotal int
+	var isValidator bool
 	var currentHash common.Hash
 
 	for {
@@ -450,7 +608,7 @@ func (w *worker) emptyLoop() {
 			w.resetEmptyCondition()
 		case <-checkTimer.C:
 			//log.Info("checkTimer.C", "no", w.chain.CurrentHeader().Number, "w.isEmpty", w.isEmpty)
-			checkTimer.Reset(1 * time.Second)
+			checkTimer.Reset(cfg.CheckInterval)
 			if !w.isEmpty {
 				continue
 			}
@@ -467,7 +625,7 @@ func (w *worker) emptyLoop() {
 
 		case <-w.emptyTimer.C:
 			{
-				w.emptyTimer.Reset(1 * time.Second)
+				w.emptyTimer.Reset(cfg.CheckInterval)
 				if !w.isRunning() {
 					w.emptyTimestamp = time.Now().Unix()
 					continue
@@ -475,6 +633,11 @@ func (w *worker) emptyLoop() {
 				if w.isEmpty {
 					continue
 				}
+				// Without a node key there are no empty block votes to sign
+				if w.cerytify.self == (common.Address{}) {
+					w.emptyTimer.Stop()
+					continue
+				}
 				/*
 					if time.Now().Unix()-w.emptyTimestamp < 120 {
 						continue
@@ -489,26 +652,23 @@ func (w *worker) emptyLoop() {
 				if currentHash != curBlock.Hash() {
 					currentHash = curBlock.Hash()
 					rs, err := w.chain.IsValidatorByHight(w.chain.CurrentHeader(), w.cerytify.self)
-					if err == nil && rs {
-						valiTotal = 15
-					} else {
-						valiTotal = 16
-					}
+					isValidator = err == nil && rs
 				}
 
 				//if curTime-int64(curBlock.Time()) < 120 && curBlock.Number().Uint64() > 0 {
-				if w.totalCondition < 120 && curBlock.Number().Uint64() > 0 {
+				if w.totalCondition < cfg.Timeout && curBlock.Number().Uint64() > 0 {
 					//log.Info("wait empty condition", "totalCondition", totalCondition, "time", curTime, "blocktime", int64(w.chain.CurrentBlock().Time()))
-					if w.totalCondition != valiTotal {
+					if w.totalCondition != w.emptyWaitChecks(isValidator) {
 						continue
 					}
-					log.Info("w.engine.OnlineValidators(curBlock.Number().Uint64()+1)", "len", len(w.engine.OnlineValidators(curBlock.Number().Uint64()+1)), "height", curBlock.Number().Uint64()+1)
-					if len(w.engine.OnlineValidators(curBlock.Number().Uint64()+1)) >= 7 {
+					online := len(w.engine.OnlineValidators(curBlock.Number().Uint64() + 1))
+					w.emptyDebug("w.engine.OnlineValidators(curBlock.Number().Uint64()+1)", "len", online, "height", curBlock.Number().Uint64()+1)
+					if !w.tooFewOnline(online) {
 						continue
 					}
-					log.Info("ok empty condition 15", "totalCondition", w.totalCondition, "time", curTime, "blocktime", int64(w.chain.CurrentBlock().Time()), "online len", len(w.engine.OnlineValidators(curBlock.Number().Uint64()+1)))
+					w.emptyDebug("ok empty condition wait", "totalCondition", w.totalCondition, "time", curTime, "blocktime", int64(w.chain.CurrentBlock().Time()), "online len", online)
 				} else {
-					log.Info("ok empty condition 120", "height", new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)), "totalCondition", w.totalCondition, "time", curTime, "blocktime", int64(w.chain.CurrentBlock().Time()), "online len", len(w.engine.OnlineValidators(curBlock.Number().Uint64()+1)))
+					w.emptyDebug("ok empty condition timeout", "height", new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)), "totalCondition", w.totalCondition, "time", curTime, "blocktime", int64(w.chain.CurrentBlock().Time()), "online len", len(w.engine.OnlineValidators(curBlock.Number().Uint64()+1)))
 				}
 				w.totalCondition = 0
 
@@ -540,15 +700,16 @@ func (w *worker) emptyLoop() {
 				}
 				w.cerytify.stakers = stakes
 
-				w.emptyCh <- struct{}{}
+				select {
+				case w.emptyCh <- struct{}{}:
+				case <-w.exitCh:
+					return
+				}
 				//log.Info("generate block time out", "height", w.current.header.Number, "staker:", w.cerytify.stakers)
 				//w.cerytify.lock.Lock()
 				//w.cerytify.lock.Unlock()
 
-				if !w.emptyHandleFlag {
-					w.emptyHandleFlag = true
-					go w.cerytify.handleEvents()
-				}
+				w.startEmptyHandler()
 
 				EmptyEvent := StartEmptyBlockEvent{
 					BlockNumber: new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)),
@@ -567,15 +728,16 @@ func (w *worker) emptyLoop() {
 					log.Error("emptyTimer.C : get targetWeightBalance error", "current block number", w.chain.CurrentBlock().NumberU64())
 					continue
 				}
-				w.targetWeightBalance = totalWeightBalance
+				w.setEmptyTarget(w.cacheHeight, totalWeightBalance)
 
 				w.isEmpty = true
+				log.Info("emptyLoop: enter empty mode", "height", w.cacheHeight, "targetWeightBalance", w.targetWeightBalance)
 				//w.onlineCh <- struct{}{}
 				w.emptyTimer.Stop()
 
-				if valiTotal == 15 {
+				if isValidator {
 					w.cerytify.AssembleAndBroadcastMessage(new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)))
-					gossipTimer.Reset(time.Second * 5)
+					gossipTimer.Reset(w.voteTime())
 				}
 				//log.Info("emptyLoop start empty")
 			}
@@ -583,12 +745,12 @@ func (w *worker) emptyLoop() {
 		case <-gossipTimer.C:
 			{
 				//log.Info("emptyLoop gossipTimer", "w.isEmpty", w.isEmpty)
-				gossipTimer.Reset(time.Second * w.voteTime())
+				gossipTimer.Reset(w.voteTime())
 				if !w.isEmpty {
 					continue
 				}
 				if w.cerytify.stakers == nil {
-					log.Info("emptyLoop", "nil", w.cerytify.stakers == nil)
+					w.emptyTrace("emptyLoop", "nil", w.cerytify.stakers == nil)
 					continue
 				}
 				w.cerytify.AssembleAndBroadcastMessage(new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)))
@@ -596,7 +758,10 @@ func (w *worker) emptyLoop() {
 
 		case rs := <-w.cerytify.signatureResultCh:
 			{
-				log.Info("emptyLoop.signatureResultCh", "isEmpty", w.isEmpty, "receiveValidatorsSum:", rs.ReceiveSum, "w.TargetSize()", w.targetWeightBalance, "w.cacheHeight", new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)), "msgHeight", rs.Height)
+				w.emptyTrace("emptyLoop.signatureResultCh", "isEmpty", w.isEmpty, "receiveValidatorsSum:", rs.ReceiveSum, "w.TargetSize()", w.targetWeightBalance, "w.cacheHeight", new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)), "msgHeight", rs.Height)
+				if w.isEmpty {
+					w.setCollectedWeight(rs.Height, rs.ReceiveSum)
+				}
 				if w.isEmpty && new(big.Int).Add(w.chain.CurrentHeader().Number, big.NewInt(1)).Cmp(rs.Height) == 0 && rs.ReceiveSum.Cmp(w.targetWeightBalance) > 0 {
 					//for _, val := range rs.OnlineValidators {
 					//	log.Info("azh|empty", "vote", val)
@@ -605,6 +770,9 @@ func (w *worker) emptyLoop() {
 					log.Info("emptyLoop.start produce empty block", "time", time.Now())
 					if err := w.commitEmptyWork(nil, true, time.Now().Unix(), rs.OnlineValidators, rs.EmptyMessages); err != nil {
 						log.Error("emptyLoop.commitEmptyWork error", "err", err)
+						if errors.Is(err, errStaleEmptyHeight) {
+							w.resetEmptyCondition()
+						}
 					} else {
 						w.resetEmptyCondition()
 						//w.resetEmptyCh <- struct{}{}
@@ -613,22 +781,118 @@ func (w *worker) emptyLoop() {
 				}
 				w.cerytify.proofStatePool.ClearPrev(w.chain.CurrentHeader().Number)
 			}
+
+		case <-w.exitCh:
+			return
 		}
 	}
 }
 
-func (w *worker) voteTime() time.Duration {
-	var t uint64
-	t = uint64(math.Pow(float64(2), float64(w.cerytify.round))) * 5
-	if t > 80 {
-		t = 80
+// setEmptyTarget records the vote weight the empty block at height has to
+// exceed, and forgets the weight collected so far. A nil height clears it.
+func (w *worker) setEmptyTarget(height *big.Int, target *big.Int) {
+	w.emptyVoteMu.Lock()
+	defer w.emptyVoteMu.Unlock()
+	w.emptyVoteHeight = nil
+	if height != nil {
+		w.emptyVoteHeight = new(big.Int).Set(height)
+	}
+	w.targetWeightBalance = target
+	w.collectedWeight = nil
+}
+
+// setCollectedWeight records the vote weight of a vote result for the empty
+// block at height. Results for any other height are ignored.
+func (w *worker) setCollectedWeight(height *big.Int, weight *big.Int) {
+	w.emptyVoteMu.Lock()
+	defer w.emptyVoteMu.Unlock()
+	if w.emptyVoteHeight == nil || height == nil || w.emptyVoteHeight.Cmp(height) != 0 {
+		return
+	}
+	w.collectedWeight = new(big.Int).Set(weight)
+}
+
+// emptyVoteProgress returns the vote target of the pending empty block and the
+// weight collected for it so far.
+func (w *worker) emptyVoteProgress() EmptyVoteProgress {
+	w.emptyVoteMu.RLock()
+	defer w.emptyVoteMu.RUnlock()
+	if w.emptyVoteHeight == nil {
+		return EmptyVoteProgress{}
+	}
+	collected := new(big.Int)
+	if w.collectedWeight != nil {
+		collected.Set(w.collectedWeight)
+	}
+	return EmptyVoteProgress{
+		Height:    (*hexutil.Big)(new(big.Int).Set(w.emptyVoteHeight)),
+		Target:    (*hexutil.Big)(new(big.Int).Set(w.targetWeightBalance)),
+		Collected: (*hexutil.Big)(collected),
+	}
+}
+
+// emptyConfig returns the empty block tunables the worker runs with.
+func (w *worker) emptyConfig() EmptyBlockConfig {
+	return w.config.Empty.withDefaults()
+}
+
+// emptyWaitChecks returns the number of checks the empty loop waits for a new
+// block before considering an empty one. Validators of the coming block wait
+// less so they are the first to vote.
+func (w *worker) emptyWaitChecks(isValidator bool) int {
+	if isValidator {
+		return w.emptyConfig().ValidatorWait
+	}
+	return w.emptyConfig().NonValidatorWait
+}
+
+// tooFewOnline reports whether so few validators are online that the empty loop
+// may enter empty mode without waiting for the full timeout.
+func (w *worker) tooFewOnline(online int) bool {
+	return online < w.emptyConfig().MinOnline
+}
+
+// emptyTrace logs a routine check of the empty block loop, at trace level unless
+// the miner is configured to log them verbosely.
+func (w *worker) emptyTrace(msg string, ctx ...interface{}) {
+	if w.config.Empty.LogVerbose {
+		log.Info(msg, ctx...)
+		return
 	}
+	log.Trace(msg, ctx...)
+}
 
-	return time.Duration(t)
+// emptyDebug is like emptyTrace but logs at debug level by default.
+func (w *worker) emptyDebug(msg string, ctx ...interface{}) {
+	if w.config.Empty.LogVerbose {
+		log.Info(msg, ctx...)
+		return
+	}
+	log.Debug(msg, ctx...)
+}
+
+// voteTime returns the interval until the next rebroadcast of empty block votes,
+// backing off with the rounds of votes already sent.
+func (w *worker) voteTime() time.Duration {
+	cfg := w.emptyConfig()
+	return gossipInterval(cfg.GossipInterval, cfg.GossipMaxInterval, w.cerytify.currentRound())
+}
+
+// gossipInterval doubles interval for every round, bounded by max.
+func gossipInterval(interval, max time.Duration, round uint64) time.Duration {
+	for i := uint64(0); i < round && interval < max; i++ {
+		interval *= 2
+	}
+	if interval > max {
+		interval = max
+	}
+	return interval
 }
 
 // newWorkLoop is a standalone goroutine to submit new mining work upon received events.
 func (w *worker) newWorkLoop(recommit time.Duration) {
+	defer w.wg.Done()
+
 	var (
 		interrupt   *int32
 		minRecommit = recommit // minimal resubmit interval specified by user.
@@ -686,7 +950,11 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 				//w.isEmpty = false
 				//w.emptyTimestamp = time.Now().Unix()
 				//w.emptyTimer.Reset(120 * time.Second)
-				w.resetEmptyCh <- struct{}{}
+				select {
+				case w.resetEmptyCh <- struct{}{}:
+				case <-w.exitCh:
+					return
+				}
 			}
 			log.Info("w.chainHeadCh: start commit block", "no", head.Block.NumberU64())
 
@@ -695,6 +963,9 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 			}
 
 			log.Info("w.chainHeadCh", "no", head.Block.Number().Uint64()+1)
+			if _, err := w.rebuildCoefficients(head.Block.Root()); err != nil {
+				log.Warn("Failed to rebuild the validator coefficient cache", "no", head.Block.NumberU64(), "err", err)
+			}
 			if h, ok := w.engine.(consensus.Handler); ok {
 				h.NewChainHead()
 			}
@@ -761,6 +1032,7 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 
 // mainLoop is a standalone goroutine to regenerate the sealing task based on the received event.
 func (w *worker) mainLoop() {
+	defer w.wg.Done()
 	defer w.txsSub.Unsubscribe()
 	defer w.chainHeadSub.Unsubscribe()
 	defer w.chainSideSub.Unsubscribe()
@@ -869,6 +1141,8 @@ func (w *worker) mainLoop() {
 // taskLoop is a standalone goroutine to fetch sealing task from the generator and
 // push them to consensus engine.
 func (w *worker) taskLoop() {
+	defer w.wg.Done()
+
 	var (
 		stopCh chan struct{}
 		prev   common.Hash
@@ -925,6 +1199,8 @@ func (w *worker) taskLoop() {
 // resultLoop is a standalone goroutine to handle sealing result submitting
 // and flush relative data to the database.
 func (w *worker) resultLoop() {
+	defer w.wg.Done()
+
 	for {
 		select {
 		case block := <-w.resultCh:
@@ -948,28 +1224,13 @@ func (w *worker) resultLoop() {
 				log.Error("Block found but no relative pending task", "number", block.Number(), "sealhash", sealhash, "hash", hash)
 				continue
 			}
-			// Different block could share same sealhash, deep copy here to prevent write-write conflict.
-			var (
-				receipts = make([]*types.Receipt, len(task.receipts))
-				logs     []*types.Log
-			)
-			for i, receipt := range task.receipts {
-				// add block location fields
-				receipt.BlockHash = hash
-				receipt.BlockNumber = block.Number()
-				receipt.TransactionIndex = uint(i)
-
-				receipts[i] = new(types.Receipt)
-				*receipts[i] = *receipt
-				// Update the block hash in all logs since it is now available and not when the
-				// receipt/log of individual transactions were created.
-				for _, log := range receipt.Logs {
-					log.BlockHash = hash
-				}
-				logs = append(logs, receipt.Logs...)
+			receipts, logs, err := sealedReceipts(block, task.receipts)
+			if err != nil {
+				log.Error("Refusing to write sealed block", "number", block.Number(), "hash", hash, "err", err)
+				continue
 			}
 			// Commit block and state to database.
-			_, err := w.chain.WriteBlockWithState(block, receipts, logs, task.state, true)
+			_, err = w.chain.WriteBlockWithState(block, receipts, logs, task.state, true)
 			if err != nil {
 				log.Error("Failed writing block to chain", "err", err)
 				continue
@@ -988,11 +1249,61 @@ func (w *worker) resultLoop() {
 	}
 }
 
+// sealedReceipts fills the block location fields into the receipts of the task
+// that produced block and returns copies of them along with their logs. The
+// receipts must match the block's transactions one to one.
+func sealedReceipts(block *types.Block, taskReceipts []*types.Receipt) ([]*types.Receipt, []*types.Log, error) {
+	if len(taskReceipts) != len(block.Transactions()) {
+		return nil, nil, fmt.Errorf("%w: %d transactions, %d receipts", errReceiptsMismatch, len(block.Transactions()), len(taskReceipts))
+	}
+	// Different block could share same sealhash, deep copy here to prevent write-write conflict.
+	var (
+		hash     = block.Hash()
+		receipts = make([]*types.Receipt, len(taskReceipts))
+		logs     []*types.Log
+	)
+	for i, receipt := range taskReceipts {
+		// add block location fields
+		receipt.BlockHash = hash
+		receipt.BlockNumber = block.Number()
+		receipt.TransactionIndex = uint(i)
+
+		receipts[i] = new(types.Receipt)
+		*receipts[i] = *receipt
+		// Update the block hash in all logs since it is now available and not when the
+		// receipt/log of individual transactions were created.
+		for _, log := range receipt.Logs {
+			log.BlockHash = hash
+		}
+		logs = append(logs, receipt.Logs...)
+	}
+	return receipts, logs, nil
+}
+
+// readParentState loads the state of parent through stateAt. The state may not
+// be available yet right after a reorg, so failed reads are retried briefly
+// before a *parentStateError is returned.
+func readParentState(stateAt func(common.Hash) (*state.StateDB, error), parent *types.Block) (*state.StateDB, error) {
+	var err error
+	for i := 0; i <= parentStateRetries; i++ {
+		var statedb *state.StateDB
+		if statedb, err = stateAt(parent.Root()); err == nil {
+			return statedb, nil
+		}
+		parentStateFailMeter.Mark(1)
+		if i < parentStateRetries {
+			log.Debug("Parent state unavailable, retrying", "number", parent.NumberU64(), "root", parent.Root(), "err", err)
+			time.Sleep(parentStateRetryDelay)
+		}
+	}
+	return nil, &parentStateError{number: parent.NumberU64(), root: parent.Root(), err: err}
+}
+
 // makeEmptyCurrent creates a new environment for the current cycle.
 func (w *worker) makeEmptyCurrent(parent *types.Block, header *types.Header) error {
 	// Retrieve the parent state to execute on top and start a prefetcher for
 	// the miner to speed block sealing up a bit
-	state, err := w.chain.StateAt(parent.Root())
+	state, err := readParentState(w.chain.StateAt, parent)
 	if err != nil {
 		return err
 	}
@@ -1030,7 +1341,7 @@ func (w *worker) makeEmptyCurrent(parent *types.Block, header *types.Header) err
 func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 	// Retrieve the parent state to execute on top and start a prefetcher for
 	// the miner to speed block sealing up a bit
-	state, err := w.chain.StateAt(parent.Root())
+	state, err := readParentState(w.chain.StateAt, parent)
 	if err != nil {
 		return err
 	}
@@ -1088,7 +1399,7 @@ func (w *worker) commitUncle(env *environment, uncle *types.Header) error {
 }
 
 func (w *worker) RecordEvilAction(uncle *types.Header) {
-	if uncle.Coinbase == (common.Address{}) { // do not handle empty block forks
+	if uncle.EmptyBlock() { // do not handle empty block forks
 		return
 	}
 
@@ -1141,9 +1452,13 @@ func (w *worker) updateSnapshot() {
 		trie.NewStackTrie(nil),
 	)
 	w.snapshotReceipts = copyReceipts(w.current.receipts)
-	w.snapshotState = w.current.state.Copy()
+	w.snapshotState = w.current.state.LightCopy()
 }
 
+// updateEmptySnapshot updates pending snapshot block and state from the empty
+// block being assembled. It runs on the empty loop while updateSnapshot runs on
+// the main loop, snapshotMu orders the two.
+// Note this function assumes the emptycurrent variable is thread safe.
 func (w *worker) updateEmptySnapshot() {
 	w.snapshotMu.Lock()
 	defer w.snapshotMu.Unlock()
@@ -1173,7 +1488,7 @@ func (w *worker) updateEmptySnapshot() {
 		trie.NewStackTrie(nil),
 	)
 	w.snapshotReceipts = copyReceipts(w.emptycurrent.receipts)
-	w.snapshotState = w.emptycurrent.state.Copy()
+	w.snapshotState = w.emptycurrent.state.LightCopy()
 }
 
 func (w *worker) commitTransactionForEmpty(tx *types.Transaction, coinbase common.Address) ([]*types.Log, error) {
@@ -1210,7 +1525,11 @@ func (w *worker) commitTransactionsForEmpty(txs *types.TransactionsByPriceAndNon
 		return true
 	}
 
+	// Keep the empty block small if the operator capped its transactions
 	gasLimit := w.emptycurrent.header.GasLimit
+	if max := w.config.Empty.MaxGas; max > 0 && max < gasLimit {
+		gasLimit = max
+	}
 	if w.emptycurrent.gasPool == nil {
 		w.emptycurrent.gasPool = new(core.GasPool).AddGas(gasLimit)
 	}
@@ -1240,7 +1559,11 @@ func (w *worker) commitTransactionsForEmpty(txs *types.TransactionsByPriceAndNon
 		}
 		// If we don't have enough gas for any further transactions then we're done
 		if w.emptycurrent.gasPool.Gas() < params.TxGas {
-			log.Trace("Not enough gas for further transactions", "have", w.current.gasPool, "want", params.TxGas)
+			log.Trace("Not enough gas for further empty block transactions", "have", w.emptycurrent.gasPool.Gas(), "want", params.TxGas)
+			break
+		}
+		if max := w.config.Empty.MaxTxs; max > 0 && w.emptycurrent.tcount >= max {
+			log.Trace("Empty block transaction cap reached", "count", w.emptycurrent.tcount, "max", max)
 			break
 		}
 		// Retrieve the next transaction and abort if all done
@@ -1264,12 +1587,12 @@ func (w *worker) commitTransactionsForEmpty(txs *types.TransactionsByPriceAndNon
 		// Start executing the transaction
 		w.emptycurrent.state.Prepare(tx.Hash(), w.emptycurrent.tcount)
 
-		log.Info("worker|commitTransaction", "no", w.emptycurrent.header.Number.String(), "hash", tx.Hash().Hex())
+		log.Info("worker|commitTransactionForEmpty", "no", w.emptycurrent.header.Number.String(), "hash", tx.Hash().Hex())
 		logs, err := w.commitTransactionForEmpty(tx, coinbase)
 		switch {
 		case errors.Is(err, core.ErrGasLimitReached):
 			// Pop the current out-of-gas transaction without shifting in the next from the account
-			log.Trace("Gas limit exceeded for current block", "sender", from)
+			log.Trace("Gas limit exceeded for current empty block", "sender", from, "have", w.emptycurrent.gasPool.Gas(), "want", tx.Gas())
 			txs.Pop()
 
 		case errors.Is(err, core.ErrNonceTooLow):
@@ -1280,6 +1603,7 @@ func (w *worker) commitTransactionsForEmpty(txs *types.TransactionsByPriceAndNon
 		case errors.Is(err, core.ErrNonceTooHigh):
 			// Reorg notification data race between the transaction pool and miner, skip account =
 			log.Trace("Skipping account with hight nonce", "sender", from, "nonce", tx.Nonce())
+			logNonceGap(tx, from, w.emptycurrent.state.GetNonce(from))
 			txs.Pop()
 
 		case errors.Is(err, nil):
@@ -1400,6 +1724,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		case errors.Is(err, core.ErrNonceTooHigh):
 			// Reorg notification data race between the transaction pool and miner, skip account =
 			log.Trace("Skipping account with hight nonce", "sender", from, "nonce", tx.Nonce())
+			logNonceGap(tx, from, w.current.state.GetNonce(from))
 			txs.Pop()
 
 		case errors.Is(err, nil):
@@ -1444,22 +1769,25 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 	return false
 }
 
-// commitEmptyWork generates several new sealing tasks based on the parent block.
-func (w *worker) commitEmptyWork(interrupt *int32, noempty bool, timestamp int64, validators []common.Address, emptyBlockMessages [][]byte) error {
-	log.Info("caver|commitEmptyWork|enter", "currentNo", w.chain.CurrentHeader().Number.Uint64())
-
-	if !w.isEmpty {
-		return errors.New("w.isEmpty == false")
+// logNonceGap reports a Wormholes transaction, like a pledge, the miner skipped
+// because an earlier nonce of its sender is missing. Unlike plain transfers
+// these often matter to validators, so the skip is logged rather than traced.
+func logNonceGap(tx *types.Transaction, from common.Address, expected uint64) {
+	if !tx.IsWormholesNFTTx() {
+		return
 	}
+	wormholesType, _ := tx.GetWormholesType()
+	log.Warn("Wormholes transaction blocked by nonce gap", "sender", from, "hash", tx.Hash(), "type", wormholesType, "nonce", tx.Nonce(), "expected", expected)
+}
 
-	w.mu.RLock()
-	defer w.mu.RUnlock()
-	parent := w.chain.CurrentBlock()
-	num := parent.Number()
+// emptyHeader returns the header of an empty block on top of parent, before the
+// engine prepares it. Empty blocks skip the gas checks of engine.Prepare, so the
+// gas limit is verified here against the rules peers apply to the block.
+func (w *worker) emptyHeader(parent *types.Block) (*types.Header, error) {
 	header := &types.Header{
 		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
-		GasLimit:   core.CalcGasLimit(parent.GasLimit(), w.config.GasCeil),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   w.gasLimit(parent),
 		Extra:      w.extra,
 		Time:       uint64(0),
 		BaseFee:    parent.BaseFee(),
@@ -1468,10 +1796,41 @@ func (w *worker) commitEmptyWork(interrupt *int32, noempty bool, timestamp int64
 	// Set baseFee and GasLimit if we are on an EIP-1559 chain
 	if w.chainConfig.IsLondon(header.Number) {
 		header.BaseFee = misc.CalcBaseFee(w.chainConfig, parent.Header())
-		if !w.chainConfig.IsLondon(parent.Number()) {
-			parentGasLimit := parent.GasLimit() * params.ElasticityMultiplier
-			header.GasLimit = core.CalcGasLimit(parentGasLimit, w.config.GasCeil)
+		if err := misc.VerifyEip1559Header(w.chainConfig, parent.Header(), header); err != nil {
+			return nil, err
 		}
+	} else if err := misc.VerifyGaslimit(parent.GasLimit(), header.GasLimit); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// commitEmptyWork generates several new sealing tasks based on the parent block.
+func (w *worker) commitEmptyWork(interrupt *int32, noempty bool, timestamp int64, validators []common.Address, emptyBlockMessages [][]byte) (err error) {
+	log.Info("caver|commitEmptyWork|enter", "currentNo", w.chain.CurrentHeader().Number.Uint64())
+	defer func() {
+		if err != nil {
+			w.setLastError(err)
+		}
+	}()
+
+	if !w.isEmpty {
+		return errors.New("w.isEmpty == false")
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	parent := w.chain.CurrentBlock()
+	// The votes were gathered for cacheHeight, they don't carry over to a block
+	// on a head that moved since
+	if next := new(big.Int).Add(parent.Number(), common.Big1); next.Cmp(w.cacheHeight) != 0 {
+		log.Warn("Chain head moved under the empty block", "head", parent.Number(), "height", w.cacheHeight)
+		return errStaleEmptyHeight
+	}
+	header, err := w.emptyHeader(parent)
+	if err != nil {
+		log.Error("Invalid empty block header", "err", err)
+		return err
 	}
 
 	// Only set the coinbase if our consensus engine is running (avoid spurious block rewards)
@@ -1479,26 +1838,36 @@ func (w *worker) commitEmptyWork(interrupt *int32, noempty bool, timestamp int64
 		log.Error("Failed to prepare header for mining", "err", err)
 		return err
 	}
-	err := w.makeEmptyCurrent(parent, header)
+	// The engine stamps empty blocks with the current time, an engine that
+	// didn't would leave the zero time the header was built with
+	if header.Time <= parent.Time() {
+		log.Error("Empty block time not set by the engine", "no", header.Number, "time", header.Time, "parent", parent.Time())
+		return errEmptyBlockTime
+	}
+	err = w.makeEmptyCurrent(parent, header)
 	if err != nil {
 		log.Error("Failed to create mining context", "err", err)
 		return err
 	}
 	//receipts := copyReceipts(w.emptycurrent.receipts)
 
-	// Fill the block with all available pending transactions.
-	pending, err := w.eth.TxPool().Pending(false)
-	if err != nil {
-		log.Error("Failed to fetch pending transactions", "err", err)
-		return err
-	}
+	// Fill the block with all available pending transactions, unless the chain
+	// requires empty blocks to be transaction free.
+	localTxs, remoteTxs := make(map[common.Address]types.Transactions), make(map[common.Address]types.Transactions)
+	if !w.chainConfig.IsTxFreeEmptyBlock(header.Number) {
+		pending, err := w.eth.TxPool().Pending(false)
+		if err != nil {
+			log.Error("Failed to fetch pending transactions", "err", err)
+			return err
+		}
 
-	// Split the pending transactions into locals and remotes
-	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
-	for _, account := range w.eth.TxPool().Locals() {
-		if txs := remoteTxs[account]; len(txs) > 0 {
-			delete(remoteTxs, account)
-			localTxs[account] = txs
+		// Split the pending transactions into locals and remotes
+		remoteTxs = pending
+		for _, account := range w.eth.TxPool().Locals() {
+			if txs := remoteTxs[account]; len(txs) > 0 {
+				delete(remoteTxs, account)
+				localTxs[account] = txs
+			}
 		}
 	}
 
@@ -1590,50 +1959,37 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     num.Add(num, common.Big1),
-		GasLimit:   core.CalcGasLimit(parent.GasLimit(), w.config.GasCeil),
+		GasLimit:   w.gasLimit(parent),
 		Extra:      w.extra,
 		Time:       uint64(timestamp),
 	}
 	// Set baseFee and GasLimit if we are on an EIP-1559 chain
 	if w.chainConfig.IsLondon(header.Number) {
 		header.BaseFee = misc.CalcBaseFee(w.chainConfig, parent.Header())
-		if !w.chainConfig.IsLondon(parent.Number()) {
-			parentGasLimit := parent.GasLimit() * params.ElasticityMultiplier
-			header.GasLimit = core.CalcGasLimit(parentGasLimit, w.config.GasCeil)
-		}
 	}
 	// Only set the coinbase if our consensus engine is running (avoid spurious block rewards)
 	if w.isRunning() {
 		if w.coinbase == (common.Address{}) {
 			log.Error("Refusing to mine without etherbase")
+			w.setLastError(errNoEtherbase)
 			return
 		}
 		header.Coinbase = w.coinbase
 		if err := w.engine.Prepare(w.chain, header); err != nil {
 			log.Error("Failed to prepare header for mining", "err", err)
+			w.setLastError(err)
 			return
 		}
 	}
 
-	// If we are care about TheDAO hard-fork check whether to override the extra-data or not
-	if daoBlock := w.chainConfig.DAOForkBlock; daoBlock != nil {
-		// Check whether the block is among the fork extra-override range
-		limit := new(big.Int).Add(daoBlock, params.DAOForkExtraRange)
-		if header.Number.Cmp(daoBlock) >= 0 && header.Number.Cmp(limit) < 0 {
-			// Depending whether we support or oppose the fork, override differently
-			if w.chainConfig.DAOForkSupport {
-				header.Extra = common.CopyBytes(params.DAOForkBlockExtra)
-			} else if bytes.Equal(header.Extra, params.DAOForkBlockExtra) {
-				header.Extra = []byte{} // If miner opposes, don't let it use the reserved extra-data
-			}
-		}
-	}
+	daoForkExtra(w.chainConfig, header)
 	// Could potentially happen if starting to mine in an odd state.
 	//deep, err := w.chain.ReadOfficialNFTPool(w.chain.CurrentHeader())
 	//fmt.Println("deep", deep, "err", err)
 	err := w.makeCurrent(parent, header)
 	if err != nil {
 		log.Error("Failed to create mining context", "err", err)
+		w.setLastError(err)
 		return
 	}
 	// Create the current work task and check any fork transitions needed
@@ -1677,6 +2033,7 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	pending, err := w.eth.TxPool().Pending(false)
 	if err != nil {
 		log.Error("Failed to fetch pending transactions", "err", err)
+		w.setLastError(err)
 		return
 	}
 	// Short circuit if there is no available pending transactions.
@@ -1726,6 +2083,7 @@ func (w *worker) commit(uncles []*types.Header, interval func(), update bool, st
 	block, err := w.engine.FinalizeAndAssemble(w.chain, w.current.header, s, w.current.txs, uncles, receipts)
 	if err != nil {
 		log.Info("caver|commit|w.engine.FinalizeAndAssemble", "no", w.current.header.Number.Uint64(), "err", err.Error())
+		w.setLastError(err)
 		return err
 	}
 	if w.isRunning() {
@@ -1768,6 +2126,25 @@ func (w *worker) postSideBlock(event core.ChainSideEvent) {
 	}
 }
 
+// daoForkExtra overrides the extra-data of header in TheDAO hard-fork extra
+// range. Networks without a DAO fork block, as all erbie networks, skip it.
+func daoForkExtra(config *params.ChainConfig, header *types.Header) {
+	daoBlock := config.DAOForkBlock
+	if daoBlock == nil {
+		return
+	}
+	// Check whether the block is among the fork extra-override range
+	limit := new(big.Int).Add(daoBlock, params.DAOForkExtraRange)
+	if header.Number.Cmp(daoBlock) >= 0 && header.Number.Cmp(limit) < 0 {
+		// Depending whether we support or oppose the fork, override differently
+		if config.DAOForkSupport {
+			header.Extra = common.CopyBytes(params.DAOForkBlockExtra)
+		} else if bytes.Equal(header.Extra, params.DAOForkBlockExtra) {
+			header.Extra = []byte{} // If miner opposes, don't let it use the reserved extra-data
+		}
+	}
+}
+
 // totalFees computes total consumed miner fees in ETH. Block transactions and receipts have to have the same order.
 func totalFees(block *types.Block, receipts []*types.Receipt) *big.Float {
 	feesWei := new(big.Int)
@@ -1778,8 +2155,20 @@ func totalFees(block *types.Block, receipts []*types.Receipt) *big.Float {
 	return new(big.Float).Quo(new(big.Float).SetInt(feesWei), new(big.Float).SetInt(big.NewInt(params.Ether)))
 }
 
+// GetBFTSize returns the number of seals a block needs when len validators
+// were selected for its height under the default quorum of 2F + 1.
 func GetBFTSize(len int) int {
-	return 2*(int(math.Ceil(float64(len)/3))-1) + 1
+	return GetConfigBFTSize(nil, len)
+}
+
+// GetConfigBFTSize returns the number of seals a block needs when len
+// validators were selected for its height, the same count the engine
+// verifies against under config.
+func GetConfigBFTSize(config *params.ChainConfig, len int) int {
+	if config == nil {
+		return (*params.IstanbulConfig)(nil).QuorumSize(len)
+	}
+	return config.Istanbul.QuorumSize(len)
 }
 
 func (w *worker) targetSize() *big.Int {
@@ -1787,40 +2176,75 @@ func (w *worker) targetSize() *big.Int {
 }
 
 func (w *worker) targetSizeWithWeight() (*big.Int, error) {
-	var total = big.NewInt(0)
-	currentState, err := w.chain.StateAt(w.chain.CurrentBlock().Root())
+	coefs, err := w.coefficientsAt(w.chain.CurrentBlock().Root())
 	if err != nil {
 		return big.NewInt(0), err
 	}
-	var voteBalance *big.Int
-	var coe uint8
 	//log.Info("targetSizeWithWeight:w.cerytify.stakers.Validators", "height", w.chain.CurrentBlock().NumberU64()+1, "len", len(w.cerytify.stakers.Validators))
-	for _, voter := range w.cerytify.stakers.Validators {
-		coe = currentState.GetValidatorCoefficient(voter.Addr)
-		voteBalance = new(big.Int).Mul(voter.Balance, big.NewInt(int64(coe)))
+	return weightedTarget(w.cerytify.stakers, coefs.get, w.emptyConfig().VoteWeight), nil
+}
+
+// coefficientsAt returns the validator coefficients of the state at root, from
+// the cache if it holds that root.
+func (w *worker) coefficientsAt(root common.Hash) (*validatorCoefficients, error) {
+	if coefs := w.coefficients.at(root); coefs != nil {
+		return coefs, nil
+	}
+	return w.rebuildCoefficients(root)
+}
+
+// rebuildCoefficients reads the validator coefficients of the state at root
+// into the cache.
+func (w *worker) rebuildCoefficients(root common.Hash) (*validatorCoefficients, error) {
+	statedb, err := w.chain.StateAt(root)
+	if err != nil {
+		return nil, err
+	}
+	coefs := newValidatorCoefficients(root, statedb)
+	w.coefficients.set(coefs)
+	return coefs, nil
+}
+
+// weightedTarget returns percent of the coefficient weighted stake of
+// validators, the vote weight an empty block has to exceed. Every validator
+// address counts once, so a duplicated entry can't raise the bar out of reach,
+// and entries without stake, which point at a corrupt pool, are skipped.
+func weightedTarget(validators *types.ValidatorList, coefficient func(common.Address) uint8, percent int) *big.Int {
+	var total = big.NewInt(0)
+	seen := make(map[common.Address]bool, len(validators.Validators))
+	for _, voter := range validators.Validators {
+		if seen[voter.Addr] {
+			log.Warn("Duplicate validator in empty block target", "addr", voter.Addr)
+			continue
+		}
+		seen[voter.Addr] = true
+		if voter.Balance == nil || voter.Balance.Sign() <= 0 {
+			log.Warn("Validator without stake in empty block target", "addr", voter.Addr, "balance", voter.Balance)
+			continue
+		}
+		voteBalance := new(big.Int).Mul(voter.Balance, big.NewInt(int64(coefficient(voter.Addr))))
 		total.Add(total, voteBalance)
-		//log.Info("targetSizeWithWeight:info", "height", w.chain.CurrentBlock().NumberU64()+1, "coe", coe, "voter.Balance", voter.Balance, "voteBalance", voteBalance, "total", total)
 	}
-	a := new(big.Int).Mul(big.NewInt(50), total)
+	a := new(big.Int).Mul(big.NewInt(int64(percent)), total)
 	b := new(big.Int).Div(a, big.NewInt(100))
-	return b, nil
+	return b
 }
 
 func (w *worker) getValidatorCoefficient(address common.Address) (uint8, error) {
-	currentState, err := w.chain.StateAt(w.chain.CurrentBlock().Root())
+	coefs, err := w.coefficientsAt(w.chain.CurrentBlock().Root())
 	if err != nil {
 		return 0, err
 	}
 	validatorAddress := w.cerytify.stakers.GetValidatorAddr(address)
 	//log.Info("worker.getValidatorCoefficient", "address", address.Hex(), "validator address", validatorAddress.Hex())
-	coe := currentState.GetValidatorCoefficient(validatorAddress)
+	coe := coefs.get(validatorAddress)
 	return coe, nil
 }
 
 func (w *worker) GetAverageCoefficient() (uint64, error) {
 	var total = big.NewInt(0)
 	var maxTotal = big.NewInt(0)
-	currentState, err := w.chain.StateAt(w.chain.CurrentBlock().Root())
+	coefs, err := w.coefficientsAt(w.chain.CurrentBlock().Root())
 	if err != nil {
 		return 0, err
 	}
@@ -1829,7 +2253,7 @@ func (w *worker) GetAverageCoefficient() (uint64, error) {
 	var coe uint8
 	//log.Info("GetAverageCoefficient:w.cerytify.stakers.Validators", "height", w.chain.CurrentBlock().NumberU64()+1, "len", len(w.cerytify.stakers.Validators))
 	for _, voter := range w.cerytify.stakers.Validators {
-		coe = currentState.GetValidatorCoefficient(voter.Addr)
+		coe = coefs.get(voter.Addr)
 		voteBalance = new(big.Int).Mul(voter.Balance, big.NewInt(int64(coe)))
 		total.Add(total, voteBalance)
 		maxVoteBalance = new(big.Int).Mul(voter.Balance, big.NewInt(types.DEFAULT_VALIDATOR_COEFFICIENT))
@@ -1848,7 +2272,17 @@ func (w *worker) GetAverageCoefficient() (uint64, error) {
 }
 
 func (w *worker) getNodeAddr() common.Address {
-	return ethcrypto.PubkeyToAddress(w.eth.GetNodeKey().PublicKey)
+	return nodeAddress(w.eth)
+}
+
+// nodeAddress returns the address of the node key, or the zero address for a
+// node running without one, which then takes no part in empty block voting.
+func nodeAddress(eth Backend) common.Address {
+	key := eth.GetNodeKey()
+	if key == nil {
+		return common.Address{}
+	}
+	return ethcrypto.PubkeyToAddress(key.PublicKey)
 }
 
 func IntToBytes(n int) []byte {
@@ -1861,7 +2295,7 @@ func IntToBytes(n int) []byte {
 func (w *worker) makeProofCurrent(parent *types.Block, header *types.Header) error {
 	// Retrieve the parent state to execute on top and start a prefetcher for
 	// the miner to speed block sealing up a bit
-	state, err := w.chain.StateAt(parent.Root())
+	state, err := readParentState(w.chain.StateAt, parent)
 	if err != nil {
 		return err
 	}
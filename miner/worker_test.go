@@ -17,14 +17,20 @@
 package miner
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/p2p"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -32,13 +38,19 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	ibftengine "github.com/ethereum/go-ethereum/consensus/istanbul/ibft/engine"
+	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -117,6 +129,7 @@ type testWorkerBackend struct {
 	testTxFeed event.Feed
 	genesis    *core.Genesis
 	uncleBlock *types.Block
+	noNodeKey  bool
 }
 
 func (b *testWorkerBackend) FindPeers() map[common.Address]Peer {
@@ -140,6 +153,9 @@ func (b *testWorkerBackend) AccountManager() *accounts.Manager {
 }
 
 func (b *testWorkerBackend) GetNodeKey() *ecdsa.PrivateKey {
+	if b.noNodeKey {
+		return nil
+	}
 	priKey, _ := crypto.HexToECDSA("f616c4d20311a2e73c67ef334630f834b7fb42304a1d4448fb2058e9940ecc0a")
 	return priKey
 }
@@ -541,3 +557,1014 @@ func TestOnlineValidatorsDecode(t *testing.T) {
 		fmt.Println("v2: ", v2.Height)
 	}
 }
+
+func TestCloseDrainsLoops(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+
+	taskCh := make(chan struct{}, 1)
+	w.newTaskHook = func(task *task) {
+		select {
+		case taskCh <- struct{}{}:
+		default:
+		}
+	}
+	w.start()
+
+	// Wait until a sealing task is in flight before pulling the plug.
+	select {
+	case <-taskCh:
+	case <-time.NewTimer(3 * time.Second).C:
+		t.Fatal("new task timeout")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.NewTimer(closeTimeout + time.Second).C:
+		t.Fatal("worker close timeout")
+	}
+
+	// All background loops must have acknowledged the exit.
+	exited := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.NewTimer(time.Second).C:
+		t.Fatal("worker loops leaked after close")
+	}
+
+	// Whatever made it into the chain must be fully written.
+	head := b.chain.CurrentBlock()
+	if b.chain.GetBlockByHash(head.Hash()) == nil {
+		t.Fatalf("head block %d missing after close", head.NumberU64())
+	}
+	if _, err := b.chain.StateAt(head.Root()); err != nil {
+		t.Fatalf("head state %d unavailable after close: %v", head.NumberU64(), err)
+	}
+}
+
+// commitBlockingEngine holds the first block the worker assembles until
+// released, keeping the worker inside commit.
+type commitBlockingEngine struct {
+	consensus.Engine
+	once      sync.Once
+	committed chan struct{}
+	release   chan struct{}
+}
+
+func (e *commitBlockingEngine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction,
+	uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	e.once.Do(func() {
+		close(e.committed)
+		<-e.release
+	})
+	return e.Engine.FinalizeAndAssemble(chain, header, state, txs, uncles, receipts)
+}
+
+// Tests that closing the worker while it is committing a block waits for the
+// commit to finish before tearing down the state it works on.
+func TestCloseDuringCommit(t *testing.T) {
+	ethash := ethash.NewFaker()
+	defer ethash.Close()
+
+	engine := &commitBlockingEngine{Engine: ethash, committed: make(chan struct{}), release: make(chan struct{})}
+	b := newTestWorkerBackend(t, ethashChainConfig, ethash, rawdb.NewMemoryDatabase(), 0)
+	w := newWorker(b, testConfig, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+	w.setEtherbase(testBankAddress)
+	w.start()
+
+	select {
+	case <-engine.committed:
+	case <-time.NewTimer(3 * time.Second).C:
+		t.Fatal("commit timeout")
+	}
+	done := make(chan struct{})
+	go func() {
+		w.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("worker closed with a commit in flight")
+	case <-time.NewTimer(100 * time.Millisecond).C:
+	}
+	close(engine.release)
+
+	select {
+	case <-done:
+	case <-time.NewTimer(closeTimeout + time.Second).C:
+		t.Fatal("worker close timeout")
+	}
+	exited := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.NewTimer(time.Second).C:
+		t.Fatal("worker loops leaked after close")
+	}
+	if w.emptyHandleFlag {
+		t.Error("empty handler still running after close")
+	}
+}
+
+// Tests that the routine checks of the empty block loop stay out of the logs at
+// the default level unless verbose empty logging is configured.
+func TestEmptyLoopLogLevel(t *testing.T) {
+	var captured []string
+	handler := log.Root().GetHandler()
+	defer log.Root().SetHandler(handler)
+	log.Root().SetHandler(log.LvlFilterHandler(log.LvlInfo, log.FuncHandler(func(r *log.Record) error {
+		captured = append(captured, r.Msg)
+		return nil
+	})))
+
+	w := &worker{config: &Config{}}
+	w.emptyTrace("trace check")
+	w.emptyDebug("debug check")
+	if len(captured) != 0 {
+		t.Fatalf("routine checks logged at default level: %v", captured)
+	}
+	w.config.Empty.LogVerbose = true
+	w.emptyTrace("trace check")
+	w.emptyDebug("debug check")
+	if len(captured) != 2 {
+		t.Fatalf("verbose checks not logged: have %v", captured)
+	}
+}
+
+// Tests that normal and empty snapshots can be produced concurrently with the
+// pending readers. Run with -race to catch unguarded accesses.
+func TestSnapshotConcurrentAccess(t *testing.T) {
+	newEnv := func(number int64) *environment {
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		if err != nil {
+			t.Fatalf("failed to create state: %v", err)
+		}
+		statedb.AddBalance(common.BigToAddress(big.NewInt(number)), big.NewInt(number))
+		return &environment{
+			state:  statedb,
+			uncles: mapset.NewSet(),
+			header: &types.Header{Number: big.NewInt(number)},
+		}
+	}
+	w := &worker{
+		current:      newEnv(1),
+		emptycurrent: newEnv(2),
+		localUncles:  make(map[common.Hash]*types.Block),
+		remoteUncles: make(map[common.Hash]*types.Block),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			w.updateSnapshot()
+		}()
+		go func() {
+			defer wg.Done()
+			w.updateEmptySnapshot()
+		}()
+		go func() {
+			defer wg.Done()
+			if block, statedb := w.pending(); block != nil && statedb == nil {
+				t.Error("pending block without state")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			w.pendingBlockAndReceipts()
+		}()
+	}
+	wg.Wait()
+
+	block, statedb := w.pending()
+	if block == nil || statedb == nil {
+		t.Fatal("no snapshot after updates")
+	}
+	// The snapshot state must belong to the snapshot block
+	owner := common.BigToAddress(block.Number())
+	if have := statedb.GetBalance(owner); have.Cmp(block.Number()) != 0 {
+		t.Errorf("snapshot state mismatch for block %d: have balance %v", block.Number(), have)
+	}
+}
+
+func TestReadParentStateRetry(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	parent := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10), Root: common.HexToHash("0x01")})
+	missing := errors.New("missing trie node")
+
+	// A state that only shows up on the second attempt is picked up
+	calls, fails := 0, parentStateFailMeter.Count()
+	got, err := readParentState(func(root common.Hash) (*state.StateDB, error) {
+		calls++
+		if root != parent.Root() {
+			t.Fatalf("root mismatch: have %x, want %x", root, parent.Root())
+		}
+		if calls == 1 {
+			return nil, missing
+		}
+		return statedb, nil
+	}, parent)
+	if err != nil || got != statedb {
+		t.Fatalf("transient failure not recovered: state %p, err %v", got, err)
+	}
+	if calls != 2 {
+		t.Fatalf("attempts mismatch: have %d, want 2", calls)
+	}
+	if n := parentStateFailMeter.Count() - fails; metrics.Enabled && n != 1 {
+		t.Fatalf("failure meter mismatch: have %d, want 1", n)
+	}
+
+	// A state that never shows up ends in the typed error
+	calls = 0
+	_, err = readParentState(func(common.Hash) (*state.StateDB, error) {
+		calls++
+		return nil, missing
+	}, parent)
+	var perr *parentStateError
+	if !errors.As(err, &perr) || perr.number != 10 || !errors.Is(err, missing) {
+		t.Fatalf("error mismatch: have %v", err)
+	}
+	if calls != parentStateRetries+1 {
+		t.Fatalf("attempts mismatch: have %d, want %d", calls, parentStateRetries+1)
+	}
+}
+
+// Tests that a node without a node key starts as a non-validator instead of
+// crashing, and never signs empty block votes.
+func TestWorkerWithoutNodeKey(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	backend.noNodeKey = true
+	w := newWorker(backend, testConfig, ethashChainConfig, engine, backend, new(event.TypeMux), nil, false)
+	defer w.close()
+
+	if self := w.cerytify.self; self != (common.Address{}) {
+		t.Fatalf("certify address mismatch: have %x, want zero", self)
+	}
+	if addr := w.getNodeAddr(); addr != (common.Address{}) {
+		t.Fatalf("node address mismatch: have %x, want zero", addr)
+	}
+	if _, err := w.cerytify.sign([]byte("vote")); err != errNoNodeKey {
+		t.Fatalf("sign error mismatch: have %v, want %v", err, errNoNodeKey)
+	}
+	w.start()
+	time.Sleep(100 * time.Millisecond)
+	if w.isEmpty {
+		t.Fatalf("worker without node key entered empty block mode")
+	}
+}
+
+// Tests that the empty block entry conditions follow the configured thresholds
+// and fall back to the defaults when left unset.
+func TestEmptyEntryThresholds(t *testing.T) {
+	w := &worker{config: &Config{}}
+	if !w.tooFewOnline(DefaultEmptyMinOnline-1) || w.tooFewOnline(DefaultEmptyMinOnline) {
+		t.Fatalf("default online threshold is not %d", DefaultEmptyMinOnline)
+	}
+	if have := w.emptyWaitChecks(true); have != DefaultEmptyValidatorWait {
+		t.Fatalf("default validator wait mismatch: have %d, want %d", have, DefaultEmptyValidatorWait)
+	}
+	if have := w.emptyWaitChecks(false); have != DefaultEmptyNonValidatorWait {
+		t.Fatalf("default non-validator wait mismatch: have %d, want %d", have, DefaultEmptyNonValidatorWait)
+	}
+
+	// A four validator fork enters empty mode once fewer than three are online
+	w.config = &Config{Empty: EmptyBlockConfig{MinOnline: 3, ValidatorWait: 5, NonValidatorWait: 6}}
+	for online, want := range []bool{true, true, true, false, false} {
+		if have := w.tooFewOnline(online); have != want {
+			t.Errorf("online %d: too few mismatch: have %v, want %v", online, have, want)
+		}
+	}
+	if have := w.emptyWaitChecks(true); have != 5 {
+		t.Fatalf("validator wait mismatch: have %d, want 5", have)
+	}
+	if have := w.emptyWaitChecks(false); have != 6 {
+		t.Fatalf("non-validator wait mismatch: have %d, want 6", have)
+	}
+}
+
+func TestEmptyGossipBackoff(t *testing.T) {
+	w := &worker{config: &Config{}, cerytify: &Certify{}}
+	defaults := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 80 * time.Second}
+	for round, want := range defaults {
+		w.cerytify.round = uint64(round)
+		if have := w.voteTime(); have != want {
+			t.Errorf("default round %d: interval mismatch: have %v, want %v", round, have, want)
+		}
+	}
+
+	// The interval grows from the configured base and stops at the maximum
+	w.config = &Config{Empty: EmptyBlockConfig{GossipInterval: 3 * time.Second, GossipMaxInterval: 20 * time.Second}}
+	configured := []time.Duration{3 * time.Second, 6 * time.Second, 12 * time.Second, 20 * time.Second, 20 * time.Second}
+	for round, want := range configured {
+		w.cerytify.round = uint64(round)
+		if have := w.voteTime(); have != want {
+			t.Errorf("round %d: interval mismatch: have %v, want %v", round, have, want)
+		}
+	}
+	// Long stalls must not overflow the interval past the bound
+	w.cerytify.round = 1 << 20
+	if have := w.voteTime(); have != 20*time.Second {
+		t.Errorf("long stall interval mismatch: have %v, want %v", have, 20*time.Second)
+	}
+}
+
+func TestWeightedTargetDuplicates(t *testing.T) {
+	var (
+		a = common.HexToAddress("0x01")
+		b = common.HexToAddress("0x02")
+	)
+	coefficient := func(addr common.Address) uint8 {
+		if addr == a {
+			return 70
+		}
+		return 50
+	}
+	unique := &types.ValidatorList{Validators: []*types.Validator{
+		{Addr: a, Balance: big.NewInt(100)},
+		{Addr: b, Balance: big.NewInt(200)},
+	}}
+	want := weightedTarget(unique, coefficient, DefaultEmptyVoteWeight)
+	if want.Cmp(big.NewInt((100*70+200*50)/2)) != 0 {
+		t.Fatalf("target mismatch: have %v, want %v", want, (100*70+200*50)/2)
+	}
+	// The list is built by hand since AddValidator would merge the entries
+	duplicated := &types.ValidatorList{Validators: append(unique.Validators, &types.Validator{Addr: a, Balance: big.NewInt(100), Proxy: b})}
+	if have := weightedTarget(duplicated, coefficient, DefaultEmptyVoteWeight); have.Cmp(want) != 0 {
+		t.Errorf("duplicated target mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestCustomEmptyBlockConfig(t *testing.T) {
+	custom := EmptyBlockConfig{
+		LogVerbose:        true,
+		StartDelay:        10 * time.Second,
+		CheckInterval:     10 * time.Millisecond,
+		Timeout:           30,
+		MinOnline:         2,
+		ValidatorWait:     4,
+		NonValidatorWait:  8,
+		GossipInterval:    time.Second,
+		GossipMaxInterval: 3 * time.Second,
+		VoteWeight:        67,
+		MaxTxs:            1,
+		MaxGas:            params.TxGas,
+	}
+	if have := custom.withDefaults(); have != custom {
+		t.Fatalf("custom config overridden: have %+v, want %+v", have, custom)
+	}
+	defaults := EmptyBlockConfig{
+		StartDelay:        DefaultEmptyStartDelay,
+		CheckInterval:     DefaultEmptyCheckInterval,
+		Timeout:           DefaultEmptyTimeout,
+		MinOnline:         DefaultEmptyMinOnline,
+		ValidatorWait:     DefaultEmptyValidatorWait,
+		NonValidatorWait:  DefaultEmptyNonValidatorWait,
+		GossipInterval:    DefaultEmptyGossipInterval,
+		GossipMaxInterval: DefaultEmptyGossipMaxInterval,
+		VoteWeight:        DefaultEmptyVoteWeight,
+	}
+	if have := (EmptyBlockConfig{}).withDefaults(); have != defaults {
+		t.Fatalf("default config mismatch: have %+v, want %+v", have, defaults)
+	}
+	w := &worker{config: &Config{Empty: custom}, cerytify: NewCertify(common.Address{}, nil, nil), emptyTimer: time.NewTimer(time.Hour)}
+	defer w.emptyTimer.Stop()
+
+	if have := w.emptyWaitChecks(true); have != custom.ValidatorWait {
+		t.Errorf("validator wait mismatch: have %d, want %d", have, custom.ValidatorWait)
+	}
+	if have := w.emptyWaitChecks(false); have != custom.NonValidatorWait {
+		t.Errorf("non-validator wait mismatch: have %d, want %d", have, custom.NonValidatorWait)
+	}
+	if !w.tooFewOnline(1) || w.tooFewOnline(2) {
+		t.Errorf("online threshold mismatch: want %d", custom.MinOnline)
+	}
+	for round, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		w.cerytify.round = uint64(round)
+		if have := w.voteTime(); have != want {
+			t.Errorf("round %d: interval mismatch: have %v, want %v", round, have, want)
+		}
+	}
+	validators := &types.ValidatorList{Validators: []*types.Validator{{Addr: common.Address{0x01}, Balance: big.NewInt(300)}}}
+	if have := weightedTarget(validators, func(common.Address) uint8 { return 1 }, w.emptyConfig().VoteWeight); have.Cmp(big.NewInt(201)) != 0 {
+		t.Errorf("target mismatch: have %v, want 201", have)
+	}
+	// Leaving empty mode rearms the checks with the custom interval
+	w.cerytify.round = 0
+	w.resetEmptyCondition()
+	select {
+	case <-w.emptyTimer.C:
+	case <-time.After(DefaultEmptyCheckInterval / 2):
+		t.Errorf("check not rearmed within %v", custom.CheckInterval)
+	}
+}
+
+func TestWeightedTargetWithoutStake(t *testing.T) {
+	coefficient := func(common.Address) uint8 { return 70 }
+	validators := &types.ValidatorList{Validators: []*types.Validator{
+		{Addr: common.Address{0x01}, Balance: big.NewInt(100)},
+		{Addr: common.Address{0x02}},
+		{Addr: common.Address{0x03}, Balance: big.NewInt(0)},
+		{Addr: common.Address{0x04}, Balance: big.NewInt(300)},
+	}}
+	want := big.NewInt((100 + 300) * 70 / 2)
+	if have := weightedTarget(validators, coefficient, DefaultEmptyVoteWeight); have.Cmp(want) != 0 {
+		t.Errorf("target mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestWeightedTargetMatchesValidatorWeight(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	validator := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	statedb.AddBalance(validator, types.ValidatorBase())
+	if err := statedb.PledgeToken(validator, types.ValidatorBase(), common.Address{}, common.Big1); err != nil {
+		t.Fatalf("failed to pledge: %v", err)
+	}
+	statedb.IncreaseValidatorCoefficient(validator, 30)
+
+	_, _, weight := statedb.GetValidatorWeight(validator)
+	validators := statedb.GetValidators(types.ValidatorStorageAddress)
+	if have := weightedTarget(validators, statedb.GetValidatorCoefficient, 100); have.Cmp(weight) != 0 {
+		t.Errorf("target term mismatch: have %v, want %v", have, weight)
+	}
+}
+
+// Tests that an empty block is never assembled with the zero time it starts
+// out with when the engine doesn't stamp it.
+func TestEmptyBlockWithoutTime(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	// The ethash engine leaves empty block headers untouched
+	w, b := newTestWorker(t, ethashChainConfig, engine, db, 0)
+	defer w.close()
+
+	head := b.chain.CurrentBlock().Hash()
+	w.isEmpty = true
+	w.cacheHeight = big.NewInt(1)
+	if err := w.commitEmptyWork(nil, true, time.Now().Unix(), nil, nil); err != errEmptyBlockTime {
+		t.Fatalf("error mismatch: have %v, want %v", err, errEmptyBlockTime)
+	}
+	if w.emptycurrent != nil {
+		t.Errorf("mining context created for an empty block without time")
+	}
+	if b.chain.CurrentBlock().Hash() != head {
+		t.Errorf("chain head moved")
+	}
+}
+
+func TestEmptyBlockStaleHeight(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	b := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	defer b.chain.Stop()
+
+	// Empty mode was entered for the block on top of genesis
+	w := &worker{
+		config:      testConfig,
+		chainConfig: ethashChainConfig,
+		engine:      engine,
+		chain:       b.chain,
+		isEmpty:     true,
+		cacheHeight: big.NewInt(1),
+	}
+	// Before the votes are in, another block becomes the head
+	if _, err := b.chain.InsertChain([]*types.Block{b.uncleBlock}); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	head := b.chain.CurrentBlock()
+	if head.NumberU64() != 1 {
+		t.Fatalf("head mismatch: have #%d, want #1", head.NumberU64())
+	}
+	if err := w.commitEmptyWork(nil, true, time.Now().Unix(), nil, nil); err != errStaleEmptyHeight {
+		t.Fatalf("error mismatch: have %v, want %v", err, errStaleEmptyHeight)
+	}
+	if w.emptycurrent != nil {
+		t.Errorf("mining context created for a stale empty block")
+	}
+	if b.chain.CurrentBlock().Hash() != head.Hash() {
+		t.Errorf("chain head moved")
+	}
+	if lastErr := w.lastError(); lastErr == nil || lastErr.Message != errStaleEmptyHeight.Error() {
+		t.Errorf("last error mismatch: have %+v, want %q", lastErr, errStaleEmptyHeight)
+	}
+}
+
+func TestEmptyBlockGasLimitAtLondon(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	// Activate London on the first block after genesis
+	chainConfig := *params.TestChainConfig
+	chainConfig.LondonBlock = big.NewInt(1)
+	b := newTestWorkerBackend(t, &chainConfig, engine, db, 0)
+	defer b.chain.Stop()
+
+	// Aim the gas limit far above what a single block may move to
+	w := &worker{
+		config:      &Config{GasCeil: 100 * params.GenesisGasLimit},
+		chainConfig: &chainConfig,
+	}
+	parent := b.chain.CurrentBlock()
+	header, err := w.emptyHeader(parent)
+	if err != nil {
+		t.Fatalf("failed to build empty header: %v", err)
+	}
+	if !chainConfig.IsLondon(header.Number) || chainConfig.IsLondon(parent.Number()) {
+		t.Fatalf("header %d is not the London transition block", header.Number)
+	}
+	if err := misc.VerifyEip1559Header(&chainConfig, parent.Header(), header); err != nil {
+		t.Fatalf("empty header rejected: %v", err)
+	}
+	target := parent.GasLimit() * params.ElasticityMultiplier
+	if limit := target + target/params.GasLimitBoundDivisor; header.GasLimit >= limit {
+		t.Errorf("gas limit out of bounds: have %d, want below %d", header.GasLimit, limit)
+	}
+	if header.GasLimit <= target {
+		t.Errorf("gas limit did not move towards the ceiling: have %d, parent target %d", header.GasLimit, target)
+	}
+}
+
+func TestWorkerLastError(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	// Without background loops, which would commit work of their own
+	b := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	defer b.chain.Stop()
+	w := &worker{
+		config:      testConfig,
+		chainConfig: ethashChainConfig,
+		engine:      engine,
+		chain:       b.chain,
+		running:     1,
+	}
+
+	if lastErr := w.lastError(); lastErr != nil {
+		t.Fatalf("fresh worker has an error: %+v", lastErr)
+	}
+
+	before := time.Now()
+	w.commitNewWork(nil, true, time.Now().Unix())
+	lastErr := w.lastError()
+	if lastErr == nil {
+		t.Fatal("missing etherbase not recorded")
+	}
+	if lastErr.Message != errNoEtherbase.Error() {
+		t.Errorf("error mismatch: have %q, want %q", lastErr.Message, errNoEtherbase)
+	}
+	if lastErr.Time.Before(before) || lastErr.Time.After(time.Now()) {
+		t.Errorf("error time %v out of range", lastErr.Time)
+	}
+}
+
+func TestSealedReceiptsMismatch(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, db, 0)
+	defer w.close()
+
+	parent := b.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Time:       parent.Time() + 1,
+		Difficulty: big.NewInt(1),
+	}
+	block := types.NewBlockWithHeader(header)
+	receipts := []*types.Receipt{{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{{}}}}
+
+	if _, _, err := sealedReceipts(block, receipts); !errors.Is(err, errReceiptsMismatch) {
+		t.Fatalf("error mismatch: have %v, want %v", err, errReceiptsMismatch)
+	}
+	if receipts[0].BlockHash != (common.Hash{}) {
+		t.Errorf("mismatched receipt modified")
+	}
+	if have, logs, err := sealedReceipts(block, nil); err != nil || len(have) != 0 || len(logs) != 0 {
+		t.Errorf("empty block receipts mismatch: have %v %v %v", have, logs, err)
+	}
+
+	// A sealed block with mismatched receipts is not written to the chain
+	state, _ := b.chain.State()
+	w.pendingMu.Lock()
+	w.pendingTasks[engine.SealHash(header)] = &task{receipts: receipts, state: state, block: block, createdAt: time.Now()}
+	w.pendingMu.Unlock()
+	w.resultCh <- block
+
+	time.Sleep(100 * time.Millisecond)
+	if b.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		t.Fatalf("block with mismatched receipts written")
+	}
+}
+
+func TestEmptyBlockTransactionCap(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   int
+	}{
+		{Config{}, 50},
+		{Config{Empty: EmptyBlockConfig{MaxTxs: 10}}, 10},
+		{Config{Empty: EmptyBlockConfig{MaxGas: 5 * params.TxGas}}, 5},
+		{Config{Empty: EmptyBlockConfig{MaxTxs: 10, MaxGas: 5 * params.TxGas}}, 5},
+	}
+	signer := types.LatestSigner(ethashChainConfig)
+	pending := make([]*types.Transaction, 50)
+	for nonce := range pending {
+		pending[nonce] = types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+			Nonce:    uint64(nonce),
+			To:       &testUserAddress,
+			Value:    big.NewInt(1000),
+			Gas:      params.TxGas,
+			GasPrice: big.NewInt(params.InitialBaseFee),
+		})
+	}
+	for i, tt := range tests {
+		engine := ethash.NewFaker()
+		backend := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+		config := tt.config
+		config.Recommit, config.GasCeil = testConfig.Recommit, testConfig.GasCeil
+		w := newWorker(backend, &config, ethashChainConfig, engine, backend, new(event.TypeMux), nil, false)
+
+		parent := backend.chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   core.CalcGasLimit(parent.GasLimit(), config.GasCeil),
+			Time:       parent.Time() + 1,
+			Difficulty: big.NewInt(1),
+			BaseFee:    parent.BaseFee(),
+		}
+		if err := w.makeEmptyCurrent(parent, header); err != nil {
+			t.Fatalf("test %d: failed to create mining context: %v", i, err)
+		}
+		w.emptycurrent.state.AddBalance(testBankAddress, testBankFunds)
+
+		// Offer many more transactions than the cap
+		start := time.Now()
+		txs := types.NewTransactionsByPriceAndNonce(w.emptycurrent.signer, map[common.Address]types.Transactions{testBankAddress: pending}, header.BaseFee)
+		if w.commitTransactionsForEmpty(txs, common.Address{}, nil) {
+			t.Fatalf("test %d: transaction commit interrupted", i)
+		}
+		if _, err := engine.FinalizeAndAssemble(backend.chain, w.emptycurrent.header, w.emptycurrent.state, w.emptycurrent.txs, nil, w.emptycurrent.receipts); err != nil {
+			t.Fatalf("test %d: failed to finalize empty block: %v", i, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("test %d: empty block took %v", i, elapsed)
+		}
+		if w.emptycurrent.tcount != tt.want || len(w.emptycurrent.txs) != tt.want {
+			t.Errorf("test %d: transaction count mismatch: have %d, want %d", i, w.emptycurrent.tcount, tt.want)
+		}
+		if max := config.Empty.MaxGas; max > 0 && w.emptycurrent.header.GasUsed > max {
+			t.Errorf("test %d: gas used %d exceeds cap %d", i, w.emptycurrent.header.GasUsed, max)
+		}
+		w.close()
+		engine.Close()
+	}
+}
+
+func TestEmptyBlockOutOfGas(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	config := *testConfig
+	config.Empty.MaxGas = 2 * params.TxGas
+	w := newWorker(backend, &config, ethashChainConfig, engine, backend, new(event.TypeMux), nil, false)
+	defer w.close()
+
+	parent := backend.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent.GasLimit(), config.GasCeil),
+		Time:       parent.Time() + 1,
+		Difficulty: big.NewInt(1),
+		BaseFee:    parent.BaseFee(),
+	}
+	if err := w.makeEmptyCurrent(parent, header); err != nil {
+		t.Fatalf("failed to create mining context: %v", err)
+	}
+	w.emptycurrent.state.AddBalance(testBankAddress, testBankFunds)
+	w.emptycurrent.state.AddBalance(testUserAddress, testBankFunds)
+
+	// The regular block being mined must not be touched by the empty one
+	current := &environment{gasPool: new(core.GasPool).AddGas(header.GasLimit), header: types.CopyHeader(header)}
+	w.current = current
+
+	// The better paying transaction needs more gas than the empty block has
+	signer := types.LatestSigner(ethashChainConfig)
+	large := types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+		To:       &testUserAddress,
+		Value:    big.NewInt(1000),
+		Gas:      3 * params.TxGas,
+		GasPrice: big.NewInt(2 * params.InitialBaseFee),
+	})
+	small := types.MustSignNewTx(testUserKey, signer, &types.LegacyTx{
+		To:       &testBankAddress,
+		Value:    big.NewInt(1000),
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(params.InitialBaseFee),
+	})
+	txs := types.NewTransactionsByPriceAndNonce(w.emptycurrent.signer, map[common.Address]types.Transactions{
+		testBankAddress: {large},
+		testUserAddress: {small},
+	}, header.BaseFee)
+	if w.commitTransactionsForEmpty(txs, common.Address{}, nil) {
+		t.Fatalf("transaction commit interrupted")
+	}
+	if len(w.emptycurrent.txs) != 1 || w.emptycurrent.txs[0].Hash() != small.Hash() {
+		t.Fatalf("empty block transactions mismatch: have %d, want only the small one", len(w.emptycurrent.txs))
+	}
+	if have, want := w.emptycurrent.gasPool.Gas(), params.TxGas; have != want {
+		t.Errorf("empty block gas left mismatch: have %d, want %d", have, want)
+	}
+	if w.current != current || current.gasPool.Gas() != header.GasLimit || current.tcount != 0 || len(current.txs) != 0 || current.header.GasUsed != 0 {
+		t.Errorf("regular mining block touched by the empty block")
+	}
+}
+
+func TestGatherStaleEmptyVote(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	// A certify of its own, as a live worker would race for the vote results
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	defer backend.chain.Stop()
+
+	c := NewCertify(nodeAddress(backend), backend, nil)
+	c.stakers = types.NewValidatorList(nil)
+	voters := []common.Address{{0x01}, {0x02}, {0x03}}
+	for _, voter := range voters {
+		c.stakers.AddValidator(voter, big.NewInt(100), common.Address{})
+	}
+	results := make(chan VoteResult, 10)
+	go func() {
+		for result := range c.signatureResultCh {
+			results <- result
+		}
+	}()
+	height := big.NewInt(1)
+	vote := func(round uint64) []byte {
+		err, payload := c.assembleMessage(height, c.self, round)
+		if err != nil {
+			t.Fatalf("failed to assemble vote: %v", err)
+		}
+		return payload
+	}
+	if err := c.GatherOtherPeerSignature(voters[0], height, vote(2)); err != nil {
+		t.Fatalf("failed to gather vote: %v", err)
+	}
+	<-results
+
+	// A vote of the previous round is a replay
+	if err := c.GatherOtherPeerSignature(voters[1], height, vote(1)); !errors.Is(err, types.ErrEmptyVoteRound) {
+		t.Fatalf("error mismatch: have %v, want %v", err, types.ErrEmptyVoteRound)
+	}
+	if ps := c.proofStatePool.proofs[height.Uint64()]; len(ps.onlineValidator) != 1 || ps.round != 2 {
+		t.Fatalf("stale vote gathered: %d votes of round %d", len(ps.onlineValidator), ps.round)
+	}
+	// A vote of a newer round restarts the collection
+	if err := c.GatherOtherPeerSignature(voters[2], height, vote(3)); err != nil {
+		t.Fatalf("failed to gather vote: %v", err)
+	}
+	result := <-results
+	if !reflect.DeepEqual(result.OnlineValidators[1:], voters[2:]) {
+		t.Errorf("online validators mismatch: have %x, want %x", result.OnlineValidators[1:], voters[2:])
+	}
+	proposer, err := types.DecodeEmptyVote(result.EmptyMessages[0])
+	if err != nil {
+		t.Fatalf("failed to decode proposer message: %v", err)
+	}
+	for _, msg := range result.EmptyMessages[1:] {
+		if err := types.CheckEmptyVoteRound(proposer, msg); err != nil || proposer.Round != 3 {
+			t.Errorf("empty block messages of mixed rounds: %v, proposer round %d", err, proposer.Round)
+		}
+	}
+}
+
+func TestCertifyStatus(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	w := &worker{config: &Config{}, cerytify: NewCertify(common.Address{0xff}, backend, nil), emptyTimer: time.NewTimer(time.Hour)}
+	defer w.emptyTimer.Stop()
+
+	c := w.cerytify
+	c.stakers = types.NewValidatorList(nil)
+	for _, voter := range []common.Address{{0x01}, {0x02}} {
+		c.stakers.AddValidator(voter, big.NewInt(100), common.Address{})
+	}
+	// Votes in empty mode go round the validators
+	w.isEmpty = true
+	height := big.NewInt(1)
+	for i := 0; i < 3; i++ {
+		c.AssembleAndBroadcastMessage(height)
+	}
+	c.selfMessages.Add(common.Hash{0x01}, true)
+	if have, want := c.Status(), (CertifyStatus{Round: 1, VoteIndex: 1, SelfMessages: 1}); have != want {
+		t.Fatalf("status mismatch: have %+v, want %+v", have, want)
+	}
+	// Leaving empty mode starts over
+	w.resetEmptyCondition()
+	if have := c.Status(); have != (CertifyStatus{}) {
+		t.Fatalf("reset status mismatch: have %+v, want zero", have)
+	}
+}
+
+func TestEmptyHandlerRestart(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	c := NewCertify(common.Address{0xff}, backend, nil)
+	c.Start()
+	c.stakers = types.NewValidatorList(nil)
+	voter := common.Address{0x01}
+	c.stakers.AddValidator(voter, big.NewInt(100), common.Address{})
+	w := &worker{cerytify: c}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		w.startEmptyHandler()
+		w.startEmptyHandler() // already running
+		height := big.NewInt(int64(i + 1))
+		err, payload := c.assembleMessage(height, c.self, 0)
+		if err != nil {
+			t.Fatalf("failed to assemble vote: %v", err)
+		}
+		// Nobody receives the vote result, the loop must still stop
+		c.eventMux.Post(types.EmptyMessageEvent{Sender: voter, Height: height, Payload: payload})
+		w.stopEmptyHandler()
+		if w.emptyHandleFlag {
+			t.Fatalf("iteration %d: handler still flagged as running", i)
+		}
+	}
+	for i := 0; runtime.NumGoroutine() > before && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: have %d, want at most %d", after, before)
+	}
+}
+
+func TestBFTSizeMatchesEngineQuorum(t *testing.T) {
+	quorums := []*params.IstanbulConfig{
+		nil,
+		{},
+		{QuorumNumerator: 2, QuorumDenominator: 3},
+		{QuorumNumerator: 3, QuorumDenominator: 4},
+		{QuorumNumerator: 4, QuorumDenominator: 5},
+		{QuorumNumerator: 1, QuorumDenominator: 1},
+	}
+	for _, quorum := range quorums {
+		config := &params.ChainConfig{Istanbul: quorum}
+		if err := config.CheckConfigForkOrder(); err != nil {
+			t.Fatalf("quorum %+v rejected: %v", quorum, err)
+		}
+		// The IBFT core gets its quorum through the istanbul config
+		core := new(istanbul.Config)
+		if quorum != nil {
+			core.QuorumNumerator, core.QuorumDenominator = quorum.QuorumNumerator, quorum.QuorumDenominator
+		}
+		for n := 1; n <= types.ConsensusValidatorsNum; n++ {
+			if have, want := GetConfigBFTSize(config, n), ibftengine.QuorumSize(config, n); have != want {
+				t.Errorf("quorum %+v, %d validators: miner requires %d seals, engine %d", quorum, n, have, want)
+			}
+			if have, want := core.QuorumSize(n), ibftengine.QuorumSize(config, n); have != want {
+				t.Errorf("quorum %+v, %d validators: core requires %d messages, engine %d", quorum, n, have, want)
+			}
+		}
+	}
+	for n := 1; n <= types.ConsensusValidatorsNum; n++ {
+		if have, want := GetBFTSize(n), ibftengine.QuorumSize(nil, n); have != want {
+			t.Errorf("no config, %d validators: miner requires %d seals, engine %d", n, have, want)
+		}
+	}
+}
+
+func TestDAOForkExtraDisabled(t *testing.T) {
+	extras := [][]byte{nil, {0x01, 0x02}, params.DAOForkBlockExtra}
+	numbers := []int64{0, 1, 1_920_000, 1_920_005}
+
+	// Without a DAO fork block the extra-data must be left untouched
+	for _, config := range []*params.ChainConfig{params.TestChainConfig, {DAOForkSupport: true}} {
+		for _, number := range numbers {
+			for _, extra := range extras {
+				header := &types.Header{Number: big.NewInt(number), Extra: common.CopyBytes(extra)}
+				daoForkExtra(config, header)
+				if !bytes.Equal(header.Extra, extra) {
+					t.Errorf("block %d: extra-data changed from %x to %x", number, extra, header.Extra)
+				}
+			}
+		}
+	}
+	// With a DAO fork block the override still applies within the range
+	support := &params.ChainConfig{DAOForkBlock: big.NewInt(1_920_000), DAOForkSupport: true}
+	header := &types.Header{Number: big.NewInt(1_920_005)}
+	if daoForkExtra(support, header); !bytes.Equal(header.Extra, params.DAOForkBlockExtra) {
+		t.Errorf("supporting miner: extra-data %x, want %x", header.Extra, params.DAOForkBlockExtra)
+	}
+	oppose := &params.ChainConfig{DAOForkBlock: big.NewInt(1_920_000)}
+	header = &types.Header{Number: big.NewInt(1_920_005), Extra: common.CopyBytes(params.DAOForkBlockExtra)}
+	if daoForkExtra(oppose, header); len(header.Extra) != 0 {
+		t.Errorf("opposing miner: extra-data %x, want empty", header.Extra)
+	}
+	header = &types.Header{Number: big.NewInt(1_920_010), Extra: common.CopyBytes(params.DAOForkBlockExtra)}
+	if daoForkExtra(oppose, header); !bytes.Equal(header.Extra, params.DAOForkBlockExtra) {
+		t.Errorf("past the range: extra-data changed to %x", header.Extra)
+	}
+}
+
+func TestEmptyVoteProgress(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	defer engine.Close()
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, db, 0)
+	w := &worker{config: &Config{}, cerytify: NewCertify(common.Address{0xff}, backend, nil), emptyTimer: time.NewTimer(time.Hour)}
+	defer w.emptyTimer.Stop()
+
+	if have := w.emptyVoteProgress(); have != (EmptyVoteProgress{}) {
+		t.Fatalf("progress outside empty mode: have %+v, want zero", have)
+	}
+	height, target := big.NewInt(5), big.NewInt(1000)
+	w.setEmptyTarget(height, target)
+
+	progress := func() (*big.Int, *big.Int) {
+		t.Helper()
+		p := w.emptyVoteProgress()
+		if p.Height == nil || p.Height.ToInt().Cmp(height) != 0 {
+			t.Fatalf("height mismatch: have %v, want %v", p.Height, height)
+		}
+		return p.Target.ToInt(), p.Collected.ToInt()
+	}
+	// Partial votes stay below the target
+	w.setCollectedWeight(height, big.NewInt(400))
+	if target, collected := progress(); collected.Cmp(target) >= 0 {
+		t.Errorf("partial votes: collected %v not below target %v", collected, target)
+	}
+	// Votes for another height are not counted
+	w.setCollectedWeight(big.NewInt(6), big.NewInt(5000))
+	if _, collected := progress(); collected.Cmp(big.NewInt(400)) != 0 {
+		t.Errorf("vote for another height counted: collected %v, want 400", collected)
+	}
+	// Enough votes exceed it
+	w.setCollectedWeight(height, big.NewInt(1001))
+	if target, collected := progress(); collected.Cmp(target) <= 0 {
+		t.Errorf("sufficient votes: collected %v not above target %v", collected, target)
+	}
+	// Leaving empty mode clears the progress
+	w.resetEmptyCondition()
+	if have := w.emptyVoteProgress(); have != (EmptyVoteProgress{}) {
+		t.Errorf("progress after reset: have %+v, want zero", have)
+	}
+}
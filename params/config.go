@@ -20,6 +20,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"reflect"
 
 	"github.com/ethereum/go-ethereum/common"
 	"golang.org/x/crypto/sha3"
@@ -242,9 +243,10 @@ var (
 		LondonBlock: big.NewInt(0),
 		//Ethash:              new(EthashConfig),
 		Istanbul: &IstanbulConfig{
-			Epoch:          30000,
-			ProposerPolicy: 0,
-			Ceil2Nby3Block: big.NewInt(0),
+			Epoch:                  30000,
+			ProposerPolicy:         0,
+			Ceil2Nby3Block:         big.NewInt(0),
+			AllowedFutureBlockTime: newUint64(1),
 		},
 		IsQuorum: true,
 	}
@@ -268,9 +270,10 @@ var (
 		LondonBlock: big.NewInt(0),
 		//Ethash:              new(EthashConfig),
 		Istanbul: &IstanbulConfig{
-			Epoch:          30000,
-			ProposerPolicy: 0,
-			Ceil2Nby3Block: big.NewInt(0),
+			Epoch:                  30000,
+			ProposerPolicy:         0,
+			Ceil2Nby3Block:         big.NewInt(0),
+			AllowedFutureBlockTime: newUint64(3),
 		},
 		IsQuorum: true,
 	}
@@ -294,9 +297,10 @@ var (
 		LondonBlock: big.NewInt(0),
 		//Ethash:              new(EthashConfig),
 		Istanbul: &IstanbulConfig{
-			Epoch:          30000,
-			ProposerPolicy: 0,
-			Ceil2Nby3Block: big.NewInt(0),
+			Epoch:                  30000,
+			ProposerPolicy:         0,
+			Ceil2Nby3Block:         big.NewInt(0),
+			AllowedFutureBlockTime: newUint64(5),
 		},
 		IsQuorum: true,
 	}
@@ -306,16 +310,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, false}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, new(EthashConfig), nil, nil, false}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, false}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, false}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, false}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, new(EthashConfig), nil, nil, false}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -397,6 +401,21 @@ type ChainConfig struct {
 
 	CatalystBlock *big.Int `json:"catalystBlock,omitempty"` // Catalyst switch block (nil = no fork, 0 = already on catalyst)
 
+	ValidatorRewardForks   []ValidatorRewardFork  `json:"validatorRewardForks,omitempty"`   // Schedule of the validator share of block rewards (nil = DefaultValidatorRewardPercentage)
+	EvilPenaltyForks       []EvilPenaltyFork      `json:"evilPenaltyForks,omitempty"`       // Schedule of the penalties of double signing validators (nil = coefficient reset)
+	WormholesGasForks      []WormholesGasFork     `json:"wormholesGasForks,omitempty"`      // Schedule of the execution gas of Wormholes operations on top of the intrinsic gas (nil = intrinsic gas only)
+	EmptyVoteRoundBlock    *big.Int               `json:"emptyVoteRoundBlock,omitempty"`    // Block from which empty block votes only count in the proposer's round (nil = no fork)
+	EmptyBlockRewardForks  []EmptyBlockRewardFork `json:"emptyBlockRewardForks,omitempty"`  // Schedule of the coefficient gained by the voters of an empty block (nil = voters but the leader restored to the maximum)
+	DelegatorRefundBlock   *big.Int               `json:"delegatorRefundBlock,omitempty"`   // Block from which validators can refund a consenting delegator's pledge (nil = no fork)
+	TxFreeEmptyBlock       *big.Int               `json:"txFreeEmptyBlock,omitempty"`       // Block from which empty blocks may not carry transactions (nil = no fork)
+	EmptyVoteQuorumBlock   *big.Int               `json:"emptyVoteQuorumBlock,omitempty"`   // Block from which empty blocks need a weighted quorum of valid votes to finalize (nil = no fork)
+	RewardSealsBlock       *big.Int               `json:"rewardSealsBlock,omitempty"`       // Block from which the reward seals of a normal block must come from the previous normal block's committee (nil = no fork)
+	ProxyPledgeBlock       *big.Int               `json:"proxyPledgeBlock,omitempty"`       // Block from which accounts serving as another validator's proxy can't be pledged to (nil = no fork)
+	ValidatorProxyBlock    *big.Int               `json:"validatorProxyBlock,omitempty"`    // Block from which validators can't pledge naming themselves, a validator or another validator's proxy as their proxy (nil = no fork)
+	EmptyBlockPenaltyBlock *big.Int               `json:"emptyBlockPenaltyBlock,omitempty"` // Block from which empty blocks without selected validators penalize a small validator set in full (nil = no fork)
+	EmptyVoterRewardBlock  *big.Int               `json:"emptyVoterRewardBlock,omitempty"`  // Block from which empty blocks only reward the validators of valid votes (nil = no fork)
+	CSBTAddressBlock       *big.Int               `json:"csbtAddressBlock,omitempty"`       // Block from which CSBT transfers must name a well formed SNFT address (nil = no fork)
+
 	// Various consensus engines
 	Ethash   *EthashConfig   `json:"ethash,omitempty"`
 	Clique   *CliqueConfig   `json:"clique,omitempty"`
@@ -405,6 +424,66 @@ type ChainConfig struct {
 	IsQuorum bool `json:"isQuorum"` // Quorum flag
 }
 
+// DefaultValidatorRewardPercentage is the percentage of a block reward kept by
+// the validator, the rest going to its stakers, before any ValidatorRewardFork.
+const DefaultValidatorRewardPercentage = 7
+
+// ValidatorRewardFork changes the percentage of the block reward kept by the
+// validator from Block onwards.
+type ValidatorRewardFork struct {
+	Block      *big.Int `json:"block"`
+	Percentage uint64   `json:"percentage"`
+}
+
+// EvilPenaltyFork changes the penalties of a validator's first, second, ...
+// double sign, the last repeating, from Block onwards. No penalties go back to
+// the coefficient reset.
+type EvilPenaltyFork struct {
+	Block     *big.Int      `json:"block"`
+	Penalties []EvilPenalty `json:"penalties"`
+}
+
+// EvilPenalty is the punishment of a validator caught signing two blocks of the
+// same height.
+type EvilPenalty struct {
+	Coefficient uint8 `json:"coefficient"` // Amount subtracted from the validator's coefficient
+	Remove      bool  `json:"remove"`      // Whether the validator is also dropped from the validator pool
+}
+
+// WormholesGasFork changes the gas charged for executing Wormholes operations
+// from Block onwards.
+type WormholesGasFork struct {
+	Block *big.Int           `json:"block"`
+	Gas   WormholesGasConfig `json:"gas"`
+}
+
+// WormholesGasConfig is the gas charged for executing Wormholes operations, on
+// top of their intrinsic gas.
+type WormholesGasConfig struct {
+	TransferCSBT       uint64 `json:"transferCSBT"`       // Type 1, transferring a CSBT
+	Withdraw           uint64 `json:"withdraw"`           // Type 2, withdrawing ERB from a CSBT owner
+	Pledge             uint64 `json:"pledge"`             // Type 3, pledging to a validator
+	CancelPledge       uint64 `json:"cancelPledge"`       // Type 4, cancelling a pledge
+	RevokeStaker       uint64 `json:"revokeStaker"`       // Per delegator refunded when a validator cancels its whole pledge
+	RecoverCoefficient uint64 `json:"recoverCoefficient"` // Type 5, recovering the validator coefficient
+	RefundDelegator    uint64 `json:"refundDelegator"`    // Type 6, a validator refunding a delegator's pledge
+}
+
+// EmptyBlockRewardFork changes the coefficient gained by the voters of an empty
+// block from Block onwards.
+type EmptyBlockRewardFork struct {
+	Block  *big.Int         `json:"block"`
+	Reward EmptyBlockReward `json:"reward"`
+}
+
+// EmptyBlockReward is the coefficient gained by the validators whose votes carry
+// an empty block, up to the maximum coefficient. The leader is the validator
+// that assembled the block, whose vote comes first.
+type EmptyBlockReward struct {
+	Leader uint8 `json:"leader"` // Added to the leader's coefficient (0 = left unchanged)
+	Voter  uint8 `json:"voter"`  // Added to the coefficient of every other voter
+}
+
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
 type EthashConfig struct{}
 
@@ -430,6 +509,17 @@ type IstanbulConfig struct {
 	ProposerPolicy uint64   `json:"policy"`                   // The policy for proposer selection
 	Ceil2Nby3Block *big.Int `json:"ceil2Nby3Block,omitempty"` // Number of confirmations required to move from one state to next [2F + 1 to Ceil(2N/3)]
 	TestQBFTBlock  *big.Int `json:"testQBFTBlock,omitempty"`  // Fork block at which block confirmations are done using qbft consensus instead of ibft
+
+	// AllowedFutureBlockTime is the network default of the seconds a header may
+	// be ahead of the local clock before it's rejected as a future block. Nil
+	// keeps the engine default.
+	AllowedFutureBlockTime *uint64 `json:"allowedFutureBlockTime,omitempty"`
+
+	// QuorumNumerator/QuorumDenominator is the share of the validators selected
+	// for a height whose seals a block needs, rounded up. A zero denominator
+	// keeps the 2*(ceil(n/3)-1)+1 formula.
+	QuorumNumerator   uint64 `json:"quorumNumerator,omitempty"`
+	QuorumDenominator uint64 `json:"quorumDenominator,omitempty"`
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -437,6 +527,21 @@ func (c *IstanbulConfig) String() string {
 	return "istanbul"
 }
 
+// QuorumSize returns the number of seals a block needs when n validators were
+// selected for its height. Block producers and verifiers must both go through
+// it, a different count on either side halts the chain.
+func (c *IstanbulConfig) QuorumSize(n int) int {
+	if c == nil || c.QuorumDenominator == 0 {
+		return 2*((n+2)/3-1) + 1
+	}
+	return int((uint64(n)*c.QuorumNumerator + c.QuorumDenominator - 1) / c.QuorumDenominator)
+}
+
+// newUint64 returns a pointer to v, for the optional config fields.
+func newUint64(v uint64) *uint64 {
+	return &v
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -537,6 +642,118 @@ func (c *ChainConfig) IsCatalyst(num *big.Int) bool {
 	return isForked(c.CatalystBlock, num)
 }
 
+// IsEmptyVoteRound returns whether num is either equal to the block from which
+// empty block votes of other rounds than the proposer's are rejected, or greater.
+func (c *ChainConfig) IsEmptyVoteRound(num *big.Int) bool {
+	return isForked(c.EmptyVoteRoundBlock, num)
+}
+
+// IsDelegatorRefund returns whether num is either equal to the block from which
+// validators can refund a delegator's pledge, or greater.
+func (c *ChainConfig) IsDelegatorRefund(num *big.Int) bool {
+	return isForked(c.DelegatorRefundBlock, num)
+}
+
+// IsTxFreeEmptyBlock returns whether num is either equal to the block from which
+// empty blocks may not carry transactions, or greater.
+func (c *ChainConfig) IsTxFreeEmptyBlock(num *big.Int) bool {
+	return isForked(c.TxFreeEmptyBlock, num)
+}
+
+// IsEmptyVoteQuorum returns whether num is either equal to the block from which
+// empty blocks only finalize with a weighted quorum of valid votes, or greater.
+func (c *ChainConfig) IsEmptyVoteQuorum(num *big.Int) bool {
+	return isForked(c.EmptyVoteQuorumBlock, num)
+}
+
+// IsRewardSeals returns whether num is either equal to the block from which the
+// reward seals of a normal block must come from the previous normal block's
+// committee, or greater.
+func (c *ChainConfig) IsRewardSeals(num *big.Int) bool {
+	return isForked(c.RewardSealsBlock, num)
+}
+
+// IsProxyPledge returns whether num is either equal to the block from which
+// accounts serving as another validator's proxy can't be pledged to, or greater.
+func (c *ChainConfig) IsProxyPledge(num *big.Int) bool {
+	return isForked(c.ProxyPledgeBlock, num)
+}
+
+// IsValidatorProxy returns whether num is either equal to the block from which
+// self pledges of validators can't name themselves, a validator or another
+// validator's proxy as their proxy, or greater.
+func (c *ChainConfig) IsValidatorProxy(num *big.Int) bool {
+	return isForked(c.ValidatorProxyBlock, num)
+}
+
+// IsEmptyBlockPenalty returns whether num is either equal to the block from which
+// empty blocks without selected validators penalize a small validator set in
+// full, or greater.
+func (c *ChainConfig) IsEmptyBlockPenalty(num *big.Int) bool {
+	return isForked(c.EmptyBlockPenaltyBlock, num)
+}
+
+// IsEmptyVoterReward returns whether num is either equal to the block from which
+// empty blocks only reward the validators whose votes check out for their height
+// and round, or greater.
+func (c *ChainConfig) IsEmptyVoterReward(num *big.Int) bool {
+	return isForked(c.EmptyVoterRewardBlock, num)
+}
+
+// IsCSBTAddress returns whether num is either equal to the block from which
+// CSBT transfers must name a well formed SNFT address, or greater.
+func (c *ChainConfig) IsCSBTAddress(num *big.Int) bool {
+	return isForked(c.CSBTAddressBlock, num)
+}
+
+// ValidatorRewardPercentage returns the percentage of the block reward kept by
+// the validator at the given block number.
+func (c *ChainConfig) ValidatorRewardPercentage(num *big.Int) uint64 {
+	percentage := uint64(DefaultValidatorRewardPercentage)
+	for _, fork := range c.ValidatorRewardForks {
+		if isForked(fork.Block, num) {
+			percentage = fork.Percentage
+		}
+	}
+	return percentage
+}
+
+// EvilPenalties returns the penalties of double signing validators at the given
+// block number, or nil if their coefficient is reset.
+func (c *ChainConfig) EvilPenalties(num *big.Int) []EvilPenalty {
+	var penalties []EvilPenalty
+	for _, fork := range c.EvilPenaltyForks {
+		if isForked(fork.Block, num) {
+			penalties = fork.Penalties
+		}
+	}
+	return penalties
+}
+
+// WormholesGas returns the gas charged for executing Wormholes operations at the
+// given block number, or nil if they only pay their intrinsic gas.
+func (c *ChainConfig) WormholesGas(num *big.Int) *WormholesGasConfig {
+	var schedule *WormholesGasConfig
+	for i, fork := range c.WormholesGasForks {
+		if isForked(fork.Block, num) {
+			schedule = &c.WormholesGasForks[i].Gas
+		}
+	}
+	return schedule
+}
+
+// EmptyBlockReward returns the coefficient gained by the voters of an empty block
+// at the given block number, or nil if the legacy reward applies.
+func (c *ChainConfig) EmptyBlockReward(num *big.Int) *EmptyBlockReward {
+	var reward *EmptyBlockReward
+	for i, fork := range c.EmptyBlockRewardForks {
+		if isForked(fork.Block, num) {
+			reward = &c.EmptyBlockRewardForks[i].Reward
+		}
+	}
+	return reward
+}
+
 // CheckCompatible checks whether scheduled fork transitions have been imported
 // with a mismatching chain configuration.
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
@@ -596,6 +813,61 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	for i, fork := range c.ValidatorRewardForks {
+		if fork.Block == nil {
+			return fmt.Errorf("validator reward fork %d has no block", i)
+		}
+		if fork.Percentage > 100 {
+			return fmt.Errorf("validator reward fork at %v has percentage %d above 100", fork.Block, fork.Percentage)
+		}
+		if i > 0 && c.ValidatorRewardForks[i-1].Block.Cmp(fork.Block) >= 0 {
+			return fmt.Errorf("unsupported validator reward fork ordering: %v before %v",
+				c.ValidatorRewardForks[i-1].Block, fork.Block)
+		}
+	}
+	blocks := make([]*big.Int, len(c.EvilPenaltyForks))
+	for i, fork := range c.EvilPenaltyForks {
+		blocks[i] = fork.Block
+	}
+	if err := checkScheduleOrder("evil penalty", blocks); err != nil {
+		return err
+	}
+	blocks = make([]*big.Int, len(c.WormholesGasForks))
+	for i, fork := range c.WormholesGasForks {
+		blocks[i] = fork.Block
+	}
+	if err := checkScheduleOrder("wormholes gas", blocks); err != nil {
+		return err
+	}
+	blocks = make([]*big.Int, len(c.EmptyBlockRewardForks))
+	for i, fork := range c.EmptyBlockRewardForks {
+		blocks[i] = fork.Block
+	}
+	if err := checkScheduleOrder("empty block reward", blocks); err != nil {
+		return err
+	}
+	if c.Istanbul != nil && (c.Istanbul.QuorumNumerator != 0 || c.Istanbul.QuorumDenominator != 0) {
+		// Two quorums have to share a validator or conflicting blocks could
+		// both be sealed
+		num, den := c.Istanbul.QuorumNumerator, c.Istanbul.QuorumDenominator
+		if num > den || 2*num <= den {
+			return fmt.Errorf("invalid istanbul quorum %d/%d, must be above 1/2 and at most 1", num, den)
+		}
+	}
+	return nil
+}
+
+// checkScheduleOrder checks the blocks of a parameter schedule are set and
+// strictly ascending.
+func checkScheduleOrder(name string, blocks []*big.Int) error {
+	for i, block := range blocks {
+		if block == nil {
+			return fmt.Errorf("%s fork %d has no block", name, i)
+		}
+		if i > 0 && blocks[i-1].Cmp(block) >= 0 {
+			return fmt.Errorf("unsupported %s fork ordering: %v before %v", name, blocks[i-1], block)
+		}
+	}
 	return nil
 }
 
@@ -646,9 +918,123 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.LondonBlock, newcfg.LondonBlock, head) {
 		return newCompatError("London fork block", c.LondonBlock, newcfg.LondonBlock)
 	}
+	if isForkIncompatible(c.EmptyVoteRoundBlock, newcfg.EmptyVoteRoundBlock, head) {
+		return newCompatError("Empty vote round fork block", c.EmptyVoteRoundBlock, newcfg.EmptyVoteRoundBlock)
+	}
+	if isForkIncompatible(c.DelegatorRefundBlock, newcfg.DelegatorRefundBlock, head) {
+		return newCompatError("Delegator refund fork block", c.DelegatorRefundBlock, newcfg.DelegatorRefundBlock)
+	}
+	if isForkIncompatible(c.TxFreeEmptyBlock, newcfg.TxFreeEmptyBlock, head) {
+		return newCompatError("Transaction free empty block fork block", c.TxFreeEmptyBlock, newcfg.TxFreeEmptyBlock)
+	}
+	if isForkIncompatible(c.EmptyVoteQuorumBlock, newcfg.EmptyVoteQuorumBlock, head) {
+		return newCompatError("Empty vote quorum fork block", c.EmptyVoteQuorumBlock, newcfg.EmptyVoteQuorumBlock)
+	}
+	if isForkIncompatible(c.RewardSealsBlock, newcfg.RewardSealsBlock, head) {
+		return newCompatError("Reward seals fork block", c.RewardSealsBlock, newcfg.RewardSealsBlock)
+	}
+	if isForkIncompatible(c.ProxyPledgeBlock, newcfg.ProxyPledgeBlock, head) {
+		return newCompatError("Proxy pledge fork block", c.ProxyPledgeBlock, newcfg.ProxyPledgeBlock)
+	}
+	if isForkIncompatible(c.ValidatorProxyBlock, newcfg.ValidatorProxyBlock, head) {
+		return newCompatError("Validator proxy fork block", c.ValidatorProxyBlock, newcfg.ValidatorProxyBlock)
+	}
+	if isForkIncompatible(c.EmptyBlockPenaltyBlock, newcfg.EmptyBlockPenaltyBlock, head) {
+		return newCompatError("Empty block penalty fork block", c.EmptyBlockPenaltyBlock, newcfg.EmptyBlockPenaltyBlock)
+	}
+	if isForkIncompatible(c.EmptyVoterRewardBlock, newcfg.EmptyVoterRewardBlock, head) {
+		return newCompatError("Empty voter reward fork block", c.EmptyVoterRewardBlock, newcfg.EmptyVoterRewardBlock)
+	}
+	if isForkIncompatible(c.CSBTAddressBlock, newcfg.CSBTAddressBlock, head) {
+		return newCompatError("CSBT address fork block", c.CSBTAddressBlock, newcfg.CSBTAddressBlock)
+	}
+	if block := c.validatorRewardIncompatible(newcfg, head); block != nil {
+		return newCompatError("Validator reward fork", block, block)
+	}
+	if block := c.evilPenaltyIncompatible(newcfg, head); block != nil {
+		return newCompatError("Evil penalty fork", block, block)
+	}
+	if block := c.wormholesGasIncompatible(newcfg, head); block != nil {
+		return newCompatError("Wormholes gas fork", block, block)
+	}
+	if block := c.emptyBlockRewardIncompatible(newcfg, head); block != nil {
+		return newCompatError("Empty block reward fork", block, block)
+	}
 	return nil
 }
 
+// validatorRewardIncompatible returns the lowest block up to head at which the
+// two configs pay validators a different share, or nil if they agree.
+func (c *ChainConfig) validatorRewardIncompatible(newcfg *ChainConfig, head *big.Int) *big.Int {
+	var blocks []*big.Int
+	for _, forks := range [][]ValidatorRewardFork{c.ValidatorRewardForks, newcfg.ValidatorRewardForks} {
+		for _, fork := range forks {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	return scheduleIncompatible(blocks, head, func(num *big.Int) bool {
+		return c.ValidatorRewardPercentage(num) == newcfg.ValidatorRewardPercentage(num)
+	})
+}
+
+// evilPenaltyIncompatible returns the lowest block up to head at which the two
+// configs punish double signing differently, or nil if they agree.
+func (c *ChainConfig) evilPenaltyIncompatible(newcfg *ChainConfig, head *big.Int) *big.Int {
+	var blocks []*big.Int
+	for _, forks := range [][]EvilPenaltyFork{c.EvilPenaltyForks, newcfg.EvilPenaltyForks} {
+		for _, fork := range forks {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	return scheduleIncompatible(blocks, head, func(num *big.Int) bool {
+		return reflect.DeepEqual(c.EvilPenalties(num), newcfg.EvilPenalties(num))
+	})
+}
+
+// wormholesGasIncompatible returns the lowest block up to head at which the two
+// configs charge Wormholes operations differently, or nil if they agree.
+func (c *ChainConfig) wormholesGasIncompatible(newcfg *ChainConfig, head *big.Int) *big.Int {
+	var blocks []*big.Int
+	for _, forks := range [][]WormholesGasFork{c.WormholesGasForks, newcfg.WormholesGasForks} {
+		for _, fork := range forks {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	return scheduleIncompatible(blocks, head, func(num *big.Int) bool {
+		return reflect.DeepEqual(c.WormholesGas(num), newcfg.WormholesGas(num))
+	})
+}
+
+// emptyBlockRewardIncompatible returns the lowest block up to head at which the
+// two configs reward the voters of an empty block differently, or nil if they
+// agree.
+func (c *ChainConfig) emptyBlockRewardIncompatible(newcfg *ChainConfig, head *big.Int) *big.Int {
+	var blocks []*big.Int
+	for _, forks := range [][]EmptyBlockRewardFork{c.EmptyBlockRewardForks, newcfg.EmptyBlockRewardForks} {
+		for _, fork := range forks {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	return scheduleIncompatible(blocks, head, func(num *big.Int) bool {
+		return reflect.DeepEqual(c.EmptyBlockReward(num), newcfg.EmptyBlockReward(num))
+	})
+}
+
+// scheduleIncompatible returns the lowest of the fork blocks up to head at which
+// equal reports the two configs apart, or nil if they agree at all of them.
+func scheduleIncompatible(blocks []*big.Int, head *big.Int, equal func(*big.Int) bool) *big.Int {
+	var lowest *big.Int
+	for _, block := range blocks {
+		if !isForked(block, head) || (lowest != nil && lowest.Cmp(block) <= 0) {
+			continue
+		}
+		if !equal(block) {
+			lowest = block
+		}
+	}
+	return lowest
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2, head *big.Int) bool {
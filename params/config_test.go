@@ -17,6 +17,7 @@
 package params
 
 import (
+	"math"
 	"math/big"
 	"reflect"
 	"testing"
@@ -96,3 +97,157 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestValidatorRewardPercentage(t *testing.T) {
+	config := &ChainConfig{ValidatorRewardForks: []ValidatorRewardFork{
+		{Block: big.NewInt(10), Percentage: 20},
+		{Block: big.NewInt(30), Percentage: 50},
+	}}
+	for _, tt := range []struct {
+		number uint64
+		want   uint64
+	}{{0, DefaultValidatorRewardPercentage}, {9, DefaultValidatorRewardPercentage}, {10, 20}, {29, 20}, {30, 50}, {1000, 50}} {
+		if have := config.ValidatorRewardPercentage(new(big.Int).SetUint64(tt.number)); have != tt.want {
+			t.Errorf("block %d: percentage mismatch: have %d, want %d", tt.number, have, tt.want)
+		}
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		t.Errorf("valid schedule rejected: %v", err)
+	}
+
+	for _, forks := range [][]ValidatorRewardFork{
+		{{Block: big.NewInt(30), Percentage: 20}, {Block: big.NewInt(10), Percentage: 50}},
+		{{Block: big.NewInt(10), Percentage: 20}, {Block: big.NewInt(10), Percentage: 50}},
+		{{Block: big.NewInt(10), Percentage: 101}},
+		{{Percentage: 20}},
+	} {
+		if err := (&ChainConfig{ValidatorRewardForks: forks}).CheckConfigForkOrder(); err == nil {
+			t.Errorf("invalid schedule %v accepted", forks)
+		}
+	}
+
+	// Moving a fork that already happened is incompatible, one in the future is not
+	moved := &ChainConfig{ValidatorRewardForks: []ValidatorRewardFork{
+		{Block: big.NewInt(10), Percentage: 20},
+		{Block: big.NewInt(40), Percentage: 50},
+	}}
+	if err := config.CheckCompatible(moved, 20); err != nil {
+		t.Errorf("future reschedule rejected: %v", err)
+	}
+	err := config.CheckCompatible(moved, 35)
+	if err == nil || err.RewindTo != 29 {
+		t.Errorf("past reschedule mismatch: have %v, want rewind to 29", err)
+	}
+}
+
+func TestEvilPenalties(t *testing.T) {
+	first, later := []EvilPenalty{{Coefficient: 20}}, []EvilPenalty{{Coefficient: 30, Remove: true}}
+	config := &ChainConfig{EvilPenaltyForks: []EvilPenaltyFork{
+		{Block: big.NewInt(10), Penalties: first},
+		{Block: big.NewInt(30), Penalties: later},
+	}}
+	for _, tt := range []struct {
+		number uint64
+		want   []EvilPenalty
+	}{{0, nil}, {9, nil}, {10, first}, {29, first}, {30, later}, {1000, later}} {
+		if have := config.EvilPenalties(new(big.Int).SetUint64(tt.number)); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("block %d: penalties mismatch: have %v, want %v", tt.number, have, tt.want)
+		}
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		t.Errorf("valid schedule rejected: %v", err)
+	}
+	for _, forks := range [][]EvilPenaltyFork{
+		{{Block: big.NewInt(30)}, {Block: big.NewInt(10)}},
+		{{Penalties: first}},
+	} {
+		if err := (&ChainConfig{EvilPenaltyForks: forks}).CheckConfigForkOrder(); err == nil {
+			t.Errorf("invalid schedule %v accepted", forks)
+		}
+	}
+
+	// Changing penalties that already applied is incompatible
+	changed := &ChainConfig{EvilPenaltyForks: []EvilPenaltyFork{
+		{Block: big.NewInt(10), Penalties: first},
+		{Block: big.NewInt(30), Penalties: first},
+	}}
+	if err := config.CheckCompatible(changed, 20); err != nil {
+		t.Errorf("future change rejected: %v", err)
+	}
+	err := config.CheckCompatible(changed, 35)
+	if err == nil || err.RewindTo != 29 {
+		t.Errorf("past change mismatch: have %v, want rewind to 29", err)
+	}
+}
+
+func TestWormholesGasSchedule(t *testing.T) {
+	config := &ChainConfig{WormholesGasForks: []WormholesGasFork{
+		{Block: big.NewInt(10), Gas: WormholesGasConfig{TransferCSBT: 5000}},
+	}}
+	if have := config.WormholesGas(big.NewInt(9)); have != nil {
+		t.Errorf("gas charged before the fork: %v", have)
+	}
+	if have := config.WormholesGas(big.NewInt(10)); have == nil || have.TransferCSBT != 5000 {
+		t.Errorf("gas mismatch at the fork: have %v, want TransferCSBT 5000", have)
+	}
+	changed := &ChainConfig{WormholesGasForks: []WormholesGasFork{
+		{Block: big.NewInt(10), Gas: WormholesGasConfig{TransferCSBT: 6000}},
+	}}
+	if err := config.CheckCompatible(changed, 9); err != nil {
+		t.Errorf("future change rejected: %v", err)
+	}
+	err := config.CheckCompatible(changed, 20)
+	if err == nil || err.RewindTo != 9 {
+		t.Errorf("past change mismatch: have %v, want rewind to 9", err)
+	}
+}
+
+func TestEmptyBlockRewardSchedule(t *testing.T) {
+	config := &ChainConfig{EmptyBlockRewardForks: []EmptyBlockRewardFork{
+		{Block: big.NewInt(10), Reward: EmptyBlockReward{Leader: 5, Voter: 10}},
+	}}
+	if have := config.EmptyBlockReward(big.NewInt(9)); have != nil {
+		t.Errorf("reward applied before the fork: %v", have)
+	}
+	if have := config.EmptyBlockReward(big.NewInt(10)); have == nil || *have != (EmptyBlockReward{Leader: 5, Voter: 10}) {
+		t.Errorf("reward mismatch at the fork: have %v", have)
+	}
+	if err := (&ChainConfig{EmptyBlockRewardForks: []EmptyBlockRewardFork{{}}}).CheckConfigForkOrder(); err == nil {
+		t.Errorf("reward without a block accepted")
+	}
+	changed := &ChainConfig{EmptyBlockRewardForks: []EmptyBlockRewardFork{
+		{Block: big.NewInt(10), Reward: EmptyBlockReward{Voter: 10}},
+	}}
+	err := config.CheckCompatible(changed, 20)
+	if err == nil || err.RewindTo != 9 {
+		t.Errorf("past change mismatch: have %v, want rewind to 9", err)
+	}
+}
+
+func TestIstanbulQuorumSize(t *testing.T) {
+	// Without a configured quorum the 2*(ceil(n/3)-1)+1 formula applies
+	for n := 1; n <= 100; n++ {
+		want := 2*(int(math.Ceil(float64(n)/3))-1) + 1
+		if have := (*IstanbulConfig)(nil).QuorumSize(n); have != want {
+			t.Errorf("nil config, %d validators: have %d, want %d", n, have, want)
+		}
+		if have := new(IstanbulConfig).QuorumSize(n); have != want {
+			t.Errorf("default config, %d validators: have %d, want %d", n, have, want)
+		}
+	}
+	strict := &IstanbulConfig{QuorumNumerator: 3, QuorumDenominator: 4}
+	for _, tt := range []struct{ n, want int }{{1, 1}, {4, 3}, {7, 6}, {11, 9}, {12, 9}} {
+		if have := strict.QuorumSize(tt.n); have != tt.want {
+			t.Errorf("3/4 quorum, %d validators: have %d, want %d", tt.n, have, tt.want)
+		}
+	}
+	if err := (&ChainConfig{Istanbul: strict}).CheckConfigForkOrder(); err != nil {
+		t.Errorf("valid quorum rejected: %v", err)
+	}
+	for _, quorum := range [][2]uint64{{1, 2}, {1, 3}, {5, 4}, {2, 0}, {0, 3}} {
+		config := &ChainConfig{Istanbul: &IstanbulConfig{QuorumNumerator: quorum[0], QuorumDenominator: quorum[1]}}
+		if err := config.CheckConfigForkOrder(); err == nil {
+			t.Errorf("invalid quorum %d/%d accepted", quorum[0], quorum[1])
+		}
+	}
+}